@@ -9,6 +9,16 @@ APP_NAME="lhc"
 VERSION=${VERSION:-"dev"}
 BUILD_DIR="build"
 
+# Release signing: SIGNING_KEY is an Ed25519 private key in PEM format
+# (openssl genpkey -algorithm ed25519 -out release.pem). Its public key is
+# built into the binaries so that "lhc self-update" checks the signature of
+# SHA256SUMS.
+LDFLAGS="-X main.version=${VERSION}"
+if [ -n "${SIGNING_KEY}" ]; then
+    PUBLIC_KEY=$(openssl pkey -in "${SIGNING_KEY}" -pubout -outform DER | tail -c 32 | base64)
+    LDFLAGS="${LDFLAGS} -X main.releasePublicKey=${PUBLIC_KEY}"
+fi
+
 echo "Building Longhorn Volume Manager v${VERSION}"
 
 # Create build directory
@@ -16,27 +26,37 @@ mkdir -p ${BUILD_DIR}
 
 # Build for macOS (Intel)
 echo "Building for macOS (Intel)..."
-GOOS=darwin GOARCH=amd64 go build -ldflags "-X main.version=${VERSION}" -o ${BUILD_DIR}/${APP_NAME}-darwin-amd64 main.go
+GOOS=darwin GOARCH=amd64 go build -ldflags "${LDFLAGS}" -o ${BUILD_DIR}/${APP_NAME}-darwin-amd64 .
 
 # Build for macOS (Apple Silicon)
 echo "Building for macOS (Apple Silicon)..."
-GOOS=darwin GOARCH=arm64 go build -ldflags "-X main.version=${VERSION}" -o ${BUILD_DIR}/${APP_NAME}-darwin-arm64 main.go
+GOOS=darwin GOARCH=arm64 go build -ldflags "${LDFLAGS}" -o ${BUILD_DIR}/${APP_NAME}-darwin-arm64 .
 
 # Build for Linux (Intel)
 echo "Building for Linux (Intel)..."
-GOOS=linux GOARCH=amd64 go build -ldflags "-X main.version=${VERSION}" -o ${BUILD_DIR}/${APP_NAME}-linux-amd64 main.go
+GOOS=linux GOARCH=amd64 go build -ldflags "${LDFLAGS}" -o ${BUILD_DIR}/${APP_NAME}-linux-amd64 .
 
 # Build for Linux (ARM64)
 echo "Building for Linux (ARM64)..."
-GOOS=linux GOARCH=arm64 go build -ldflags "-X main.version=${VERSION}" -o ${BUILD_DIR}/${APP_NAME}-linux-arm64 main.go
+GOOS=linux GOARCH=arm64 go build -ldflags "${LDFLAGS}" -o ${BUILD_DIR}/${APP_NAME}-linux-arm64 .
 
 # Build for Windows (Intel)
 echo "Building for Windows (Intel)..."
-GOOS=windows GOARCH=amd64 go build -ldflags "-X main.version=${VERSION}" -o ${BUILD_DIR}/${APP_NAME}-windows-amd64.exe main.go
+GOOS=windows GOARCH=amd64 go build -ldflags "${LDFLAGS}" -o ${BUILD_DIR}/${APP_NAME}-windows-amd64.exe .
 
 # Build for Windows (ARM64)
 echo "Building for Windows (ARM64)..."
-GOOS=windows GOARCH=arm64 go build -ldflags "-X main.version=${VERSION}" -o ${BUILD_DIR}/${APP_NAME}-windows-arm64.exe main.go
+GOOS=windows GOARCH=arm64 go build -ldflags "${LDFLAGS}" -o ${BUILD_DIR}/${APP_NAME}-windows-arm64.exe .
+
+# Checksums (and their signature) for "lhc self-update"
+echo "Writing checksums..."
+SHA256SUM="sha256sum"
+command -v sha256sum >/dev/null || SHA256SUM="shasum -a 256"
+(cd ${BUILD_DIR} && ${SHA256SUM} ${APP_NAME}-* > SHA256SUMS)
+if [ -n "${SIGNING_KEY}" ]; then
+    echo "Signing checksums..."
+    openssl pkeyutl -sign -inkey "${SIGNING_KEY}" -rawin -in ${BUILD_DIR}/SHA256SUMS -out ${BUILD_DIR}/SHA256SUMS.sig
+fi
 
 echo ""
 echo "Build complete! Binaries created in ${BUILD_DIR}/"
@@ -44,9 +64,13 @@ ls -la ${BUILD_DIR}/
 
 echo ""
 echo "To build for a specific platform only:"
-echo "  macOS Intel:     GOOS=darwin GOARCH=amd64 go build -o lhc main.go"
-echo "  macOS ARM:       GOOS=darwin GOARCH=arm64 go build -o lhc main.go"
-echo "  Linux Intel:     GOOS=linux GOARCH=amd64 go build -o lhc main.go"
-echo "  Linux ARM:       GOOS=linux GOARCH=arm64 go build -o lhc main.go"
-echo "  Windows Intel:   GOOS=windows GOARCH=amd64 go build -o lhc.exe main.go"
-echo "  Windows ARM:     GOOS=windows GOARCH=arm64 go build -o lhc.exe main.go"
+echo "  macOS Intel:     GOOS=darwin GOARCH=amd64 go build -o lhc ."
+echo "  macOS ARM:       GOOS=darwin GOARCH=arm64 go build -o lhc ."
+echo "  Linux Intel:     GOOS=linux GOARCH=amd64 go build -o lhc ."
+echo "  Linux ARM:       GOOS=linux GOARCH=arm64 go build -o lhc ."
+echo "  Windows Intel:   GOOS=windows GOARCH=amd64 go build -o lhc.exe ."
+echo "  Windows ARM:     GOOS=windows GOARCH=arm64 go build -o lhc.exe ."
+
+echo ""
+echo "To install as a kubectl plugin (kubectl lhc ...):"
+echo "  cp ${BUILD_DIR}/${APP_NAME}-<os>-<arch> /usr/local/bin/kubectl-lhc"
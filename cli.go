@@ -0,0 +1,3403 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"longhorn-volume-manager/pkg/longhorntools"
+)
+
+// cliOptions holds the values of every command-line flag. Flags that
+// configure the cluster connection and temporary pods are persistent on the
+// root command; the rest are registered by the commands that use them.
+type cliOptions struct {
+	kubeconfig   string
+	kubeContext  string
+	offline      string
+	namespace    string
+	storageClass string
+
+	// Shared behavior
+	dryRun           bool
+	assumeYes        bool
+	annotate         bool
+	metricsAddr      string
+	lockTimeout      time.Duration
+	waitTimeout      time.Duration
+	retries          int
+	retryBackoff     time.Duration
+	qps              float32
+	burst            int
+	backend          string
+	managerURL       string
+	progress         string
+	progressInterval time.Duration
+
+	// Temporary pods
+	tempImage      string
+	tempTTL        time.Duration
+	cpuRequest     string
+	memRequest     string
+	cpuLimit       string
+	memLimit       string
+	secProfile     string
+	fsGroup        int64
+	tempSA         string
+	pullSecrets    []string
+	imageRegistry  string
+	imageOverrides []string
+	nodeSelector   []string
+	tolerations    []string
+	affinityFile   string
+	pinToNode      bool
+	reapInterval   time.Duration
+	allNamespaces  bool
+
+	// Volume selection
+	volume      string
+	volumes     []string
+	volumesFile string
+	source      string
+	dest        string
+	copyStreams int
+	output      string
+	input       string
+
+	// Downloads and copies
+	sparse      bool
+	encrypt     string
+	chunkSize   string
+	fileSums    bool
+	resume      bool
+	compress    string
+	compressLvl int
+	parallel    int
+
+	// list
+	listStates       []string
+	listBound        bool
+	listUnbound      bool
+	listNode         string
+	listPVCNamespace string
+	listSortBy       string
+	listOrder        string
+	listOutput       string
+	listWatch        bool
+
+	// replicas
+	rebuilding bool
+
+	// capacity
+	maxProvisioned int
+	minAvailable   int
+
+	// orphans
+	orphanCleanup bool
+
+	// replica-cleanup
+	minHealthy int
+
+	// stuck
+	reattach bool
+
+	// self-update
+	updateCheck bool
+	updateTo    string
+
+	// delete
+	finalBackup bool
+	downloadTo  string
+
+	// create
+	createSize string
+	createPVC  string
+
+	// rename
+	deleteOld bool
+
+	// events
+	eventsSince time.Duration
+
+	// expand
+	expandSize string
+	growFS     bool
+
+	// salvage
+	salvageReplicas []string
+
+	// fsck
+	repair bool
+
+	// export-nfs
+	nfsReadWrite bool
+	nfsClients   string
+	nfsService   string
+	nfsLocalPort int
+
+	// mount
+	mountReadOnly  bool
+	mountLocalPort int
+	mountNoMount   bool
+
+	// set-replicas
+	replicaCount int64
+	wait         bool
+
+	// migrate-sc
+	toStorageClass string
+	rebind         bool
+
+	// upgrade-engine
+	all bool
+
+	// recurring-job
+	jobTask        string
+	jobRetain      int64
+	jobConcurrency int64
+	jobGroups      []string
+	jobLabels      []string
+	jobName        string
+	jobGroup       string
+	remove         bool
+
+	// backup-target
+	backupTarget string
+
+	// velero-export
+	veleroNamespace string
+	storageLocation string
+	backupTTL       time.Duration
+	fsBackup        bool
+	moveData        bool
+
+	// Label and pattern selection
+	selector      string
+	destNamespace string
+	regex         bool
+
+	// copy
+	inCluster bool
+
+	// schedule
+	cronSchedule string
+	image        string
+	action       string
+	targetPVC    string
+	name         string
+	apply        bool
+
+	// server
+	listen   string
+	apiToken string
+	tlsCert  string
+	tlsKey   string
+}
+
+// newRootCommand builds the lhc command tree.
+func newRootCommand() *cobra.Command {
+	o := &cliOptions{}
+
+	root := &cobra.Command{
+		Use:     "lhc",
+		Short:   "Longhorn Volume Manager",
+		Long:    "lhc lists, inspects, downloads, and copies Longhorn volumes through temporary pods.",
+		Version: version,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := applyConfigDefaults(cmd); err != nil {
+				return fmt.Errorf("failed to load configuration: %v", err)
+			}
+			if o.namespace == "" {
+				o.namespace = defaultNamespace(o.clientConfig())
+			}
+			if o.metricsAddr != "" {
+				serveMetrics(o.metricsAddr)
+			}
+			return nil
+		},
+	}
+	root.SetGlobalNormalizationFunc(func(f *pflag.FlagSet, name string) pflag.NormalizedName {
+		// --force is an alias for --yes
+		if name == "force" {
+			name = "yes"
+		}
+		return pflag.NormalizedName(name)
+	})
+
+	flags := root.PersistentFlags()
+	flags.StringVar(&o.kubeconfig, "kubeconfig", "", "Path to the kubeconfig file (default $KUBECONFIG or ~/.kube/config)")
+	flags.StringVar(&o.kubeContext, "context", "", "Kubeconfig context to use (default the current context)")
+	flags.StringVar(&o.offline, "offline", "", "Read volumes from recorded fixtures in this directory instead of a cluster")
+	flags.StringVarP(&o.namespace, "namespace", "n", "", "Kubernetes namespace (default the context's namespace, or \"default\")")
+	flags.StringVarP(&o.storageClass, "storage-class", "c", "longhorn", "Storage class name")
+	flags.BoolVar(&o.dryRun, "dry-run", false, "Print what would be created, deleted, and executed without doing it")
+	flags.BoolVarP(&o.assumeYes, "yes", "y", false, "Answer yes to confirmation prompts (alias: --force)")
+	flags.BoolVar(&o.annotate, "annotate", false, "Record the last operation as annotations on Longhorn volumes")
+	flags.StringVar(&o.metricsAddr, "metrics-addr", "", "Serve Prometheus metrics on this address (e.g. :9090)")
+	flags.DurationVar(&o.lockTimeout, "lock-timeout", 0, "Wait this long for another operation's lock on a volume")
+	flags.DurationVar(&o.waitTimeout, "wait-timeout", 0, "How long to wait for temporary PVCs to bind and pods to start (default 60s/2m)")
+	flags.IntVar(&o.retries, "retries", longhorntools.DefaultRetries, "Times to retry transient API and exec session failures")
+	flags.DurationVar(&o.retryBackoff, "retry-backoff", longhorntools.DefaultRetryBackoff, "Initial delay between retries; doubles on each attempt")
+	flags.Float32Var(&o.qps, "qps", longhorntools.DefaultQPS, "Maximum sustained API requests per second")
+	flags.IntVar(&o.burst, "burst", longhorntools.DefaultBurst, "Maximum burst of API requests above --qps")
+	flags.StringVar(&o.backend, "backend", longhorntools.BackendKubernetes, "List volumes, snapshots, and backups through kubernetes (custom resources) or api (the Longhorn manager)")
+	flags.StringVar(&o.managerURL, "manager-url", "", "Longhorn manager API URL for --backend api (default through the API server's service proxy)")
+	flags.StringVar(&o.progress, "progress", longhorntools.ProgressPlain, "Progress of downloads and copies: plain (a line per interval), json (a record per line), or none")
+	flags.DurationVar(&o.progressInterval, "progress-interval", longhorntools.DefaultProgressInterval, "How often to report the progress of downloads and copies")
+	flags.StringVar(&o.tempImage, "temp-image", longhorntools.DefaultTempImage, "Image for temporary pods and in-cluster copy Jobs")
+	flags.DurationVar(&o.tempTTL, "ttl", longhorntools.DefaultTempTTL, "Time temporary pods, PVCs, PVs, and Jobs outlive the run using them before they may be reaped")
+	flags.StringVar(&o.cpuRequest, "cpu-request", longhorntools.DefaultCPURequest, "CPU request for temporary pods (empty to omit)")
+	flags.StringVar(&o.memRequest, "memory-request", longhorntools.DefaultMemoryRequest, "Memory request for temporary pods (empty to omit)")
+	flags.StringVar(&o.cpuLimit, "cpu-limit", longhorntools.DefaultCPULimit, "CPU limit for temporary pods (empty to omit)")
+	flags.StringVar(&o.memLimit, "memory-limit", longhorntools.DefaultMemoryLimit, "Memory limit for temporary pods (empty to omit)")
+	flags.StringVar(&o.secProfile, "security-profile", longhorntools.SecurityProfileDefault, "Temporary pod security profile: default or restricted")
+	flags.Int64Var(&o.fsGroup, "fs-group", -1, "fsGroup for temporary pods (default none, or 65534 with --security-profile restricted)")
+	flags.StringVar(&o.tempSA, "service-account", "", "ServiceAccount for temporary pods (default: the namespace default)")
+	flags.StringArrayVar(&o.pullSecrets, "image-pull-secret", nil, "Image pull secret for temporary pods (repeatable)")
+	flags.StringVar(&o.imageRegistry, "image-registry", "", "Pull every helper image from this registry instead (e.g. registry.internal:5000/mirror)")
+	flags.StringArrayVar(&o.imageOverrides, "image-override", nil, "Replace a helper image, image=replacement or image=@sha256:<digest> (repeatable)")
+	flags.StringArrayVar(&o.nodeSelector, "node-selector", nil, "Node label key=value for temporary pods (repeatable)")
+	flags.StringArrayVar(&o.tolerations, "toleration", nil, "Toleration key[=value][:effect] for temporary pods, or '*' (repeatable)")
+	flags.StringVar(&o.affinityFile, "affinity-file", "", "YAML or JSON file with a Pod affinity for temporary pods")
+	flags.BoolVar(&o.pinToNode, "pin-node", true, "Schedule temporary pods on the node an attached volume is attached to")
+	flags.BoolVar(&o.sparse, "sparse", false, "Preserve holes in sparse files in copies and downloads (needs GNU tar, see --temp-image)")
+	root.MarkPersistentFlagFilename("kubeconfig")
+	root.MarkPersistentFlagDirname("offline")
+	root.RegisterFlagCompletionFunc("context", completeContexts)
+	root.RegisterFlagCompletionFunc("namespace", completeNamespaces)
+	root.RegisterFlagCompletionFunc("backend", cobra.FixedCompletions(
+		[]string{longhorntools.BackendKubernetes, longhorntools.BackendAPI}, cobra.ShellCompDirectiveNoFileComp))
+	root.RegisterFlagCompletionFunc("progress", cobra.FixedCompletions(
+		[]string{longhorntools.ProgressPlain, longhorntools.ProgressJSON, longhorntools.ProgressNone}, cobra.ShellCompDirectiveNoFileComp))
+
+	root.AddCommand(
+		o.listCommand(),
+		o.contentsCommand(),
+		o.describeCommand(),
+		o.replicasCommand(),
+		o.whoUsesCommand(),
+		o.eventsCommand(),
+		o.nodesCommand(),
+		o.healthCommand(),
+		o.stuckCommand(),
+		o.usageCommand(),
+		o.capacityCommand(),
+		o.snapshotUsageCommand(),
+		o.createCommand(),
+		o.expandCommand(),
+		o.setReplicasCommand(),
+		o.upgradeEngineCommand(),
+		o.salvageCommand(),
+		o.trimCommand(),
+		o.fsckCommand(),
+		o.downloadCommand(),
+		o.copyCommand(),
+		o.cpCommand(),
+		o.exportNFSCommand(),
+		o.mountCommand(),
+		o.importCommand(),
+		o.migrateSCCommand(),
+		o.renameCommand(),
+		o.cleanupCommand(),
+		o.orphansCommand(),
+		o.replicaCleanupCommand(),
+		o.deleteCommand(),
+		o.reapCommand(),
+		o.backupAllCommand(),
+		o.restoreAllCommand(),
+		o.scheduleCommand(),
+		o.veleroExportCommand(),
+		o.recurringJobCommand(),
+		o.backupTargetCommand(),
+		o.serveOperatorCommand(),
+		o.tuiCommand(),
+		o.serverCommand(),
+		o.imagesCommand(),
+		o.selfUpdateCommand(),
+	)
+	setupPluginMode(root)
+	return root
+}
+
+// clientConfig returns the cluster access selected by --kubeconfig and
+// --context.
+func (o *cliOptions) clientConfig() clientcmd.ClientConfig {
+	return newClientConfig(o.kubeconfig, o.kubeContext)
+}
+
+// volumeManager connects to the cluster and applies the shared flags. The
+// returned context is cancelled on SIGINT/SIGTERM.
+func (o *cliOptions) volumeManager() (*longhorntools.VolumeManager, context.Context) {
+	if o.qps <= 0 || o.burst <= 0 {
+		fatalf("--qps and --burst must be positive")
+	}
+	vm, err := connect(o.kubeconfig, o.kubeContext, o.offline, o.qps, o.burst)
+	if err != nil {
+		fatalf("Failed to initialize volume manager: %v", err)
+	}
+	vm.Output = os.Stdout
+	vm.Annotate = o.annotate
+	vm.LockTimeout = o.lockTimeout
+	vm.WaitTimeout = o.waitTimeout
+	vm.Retries = o.retries
+	vm.RetryBackoff = o.retryBackoff
+	vm.DryRun = o.dryRun
+	vm.TempTTL = o.tempTTL
+	vm.TempImage = o.tempImage
+	vm.PinToNode = o.pinToNode
+	vm.Sparse = o.sparse
+	if err := longhorntools.ValidateSecurityProfile(o.secProfile); err != nil {
+		fatalf("Invalid --security-profile: %v", err)
+	}
+	vm.SecurityProfile = o.secProfile
+	if err := longhorntools.ValidateBackend(o.backend); err != nil {
+		fatalf("Invalid --backend: %v", err)
+	}
+	if o.backend == longhorntools.BackendAPI && o.offline != "" && o.managerURL == "" {
+		fatalf("--backend api needs --manager-url with --offline")
+	}
+	vm.Backend = o.backend
+	vm.ManagerURL = o.managerURL
+	if err := longhorntools.ValidateProgress(o.progress); err != nil {
+		fatalf("Invalid --progress: %v", err)
+	}
+	vm.Progress = o.progress
+	vm.ProgressInterval = o.progressInterval
+	vm.FSGroup = o.fsGroup
+	vm.ServiceAccount = o.tempSA
+	vm.ImagePullSecrets = o.pullSecrets
+	vm.ImageRegistry = o.imageRegistry
+	if vm.ImageOverrides, err = longhorntools.ParseImageOverrides(o.imageOverrides); err != nil {
+		fatalf("Invalid --image-override: %v", err)
+	}
+	if vm.TempResources, err = longhorntools.ParseResources(o.cpuRequest, o.memRequest, o.cpuLimit, o.memLimit); err != nil {
+		fatalf("Invalid temporary pod resources: %v", err)
+	}
+	if vm.NodeSelector, err = longhorntools.ParseNodeSelector(o.nodeSelector); err != nil {
+		fatalf("Invalid --node-selector: %v", err)
+	}
+	for _, value := range o.tolerations {
+		toleration, err := longhorntools.ParseToleration(value)
+		if err != nil {
+			fatalf("Invalid --toleration: %v", err)
+		}
+		vm.Tolerations = append(vm.Tolerations, toleration)
+	}
+	if o.affinityFile != "" {
+		if vm.Affinity, err = longhorntools.LoadAffinity(o.affinityFile); err != nil {
+			fatalf("Invalid --affinity-file: %v", err)
+		}
+	}
+	ctx := handleInterrupts(vm)
+
+	if o.offline == "" {
+		info, err := vm.DetectLonghorn(ctx)
+		if err != nil {
+			fatalf("%v", err)
+		}
+		for _, warning := range info.Warnings {
+			fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+		}
+	}
+
+	if o.dryRun {
+		fmt.Println("Dry run: nothing will be created, deleted, or executed in the cluster.")
+		fmt.Println()
+	}
+	return vm, ctx
+}
+
+// resolveVolume maps a volume identifier given with -v, -s, or -d, which
+// may name a PVC or PV, to its Longhorn volume.
+func (o *cliOptions) resolveVolume(ctx context.Context, vm *longhorntools.VolumeManager, identifier string) string {
+	volume, err := vm.ResolveVolume(ctx, identifier, o.namespace)
+	if err != nil {
+		fatalf("Failed to resolve volume %s: %v", identifier, err)
+	}
+	if volume != identifier {
+		fmt.Printf("Resolved %s to Longhorn volume %s\n", identifier, volume)
+	}
+	return volume
+}
+
+// expandVolumes resolves volume arguments to Longhorn volume names,
+// expanding glob patterns, or every argument with --regex, into the volumes
+// they match. expanded reports whether any argument was a pattern.
+func (o *cliOptions) expandVolumes(ctx context.Context, vm *longhorntools.VolumeManager, args []string) (volumes []string, expanded bool) {
+	seen := make(map[string]bool)
+	add := func(volume string) {
+		if !seen[volume] {
+			seen[volume] = true
+			volumes = append(volumes, volume)
+		}
+	}
+
+	for _, arg := range args {
+		if !o.regex && !longhorntools.IsVolumePattern(arg) {
+			add(o.resolveVolume(ctx, vm, arg))
+			continue
+		}
+		matches, err := vm.MatchVolumes(ctx, arg, o.regex)
+		if err != nil {
+			fatalf("Failed to match volumes: %v", err)
+		}
+		if len(matches) == 0 {
+			fatalf("No Longhorn volumes match %q", arg)
+		}
+		for _, volume := range matches {
+			add(volume)
+		}
+		expanded = true
+	}
+	return volumes, expanded
+}
+
+// confirmVolumes lists the volumes a pattern expanded to and asks before
+// acting on them, exiting if the answer is no.
+func (o *cliOptions) confirmVolumes(action string, volumes []string) {
+	fmt.Printf("%s %d volume(s):\n", action, len(volumes))
+	for _, volume := range volumes {
+		fmt.Printf("  - %s\n", volume)
+	}
+	if o.dryRun {
+		return
+	}
+	ok, err := confirm("Continue?", o.assumeYes)
+	if err != nil {
+		fatalf("%s not confirmed: %v", action, err)
+	}
+	if !ok {
+		fmt.Printf("%s cancelled.\n", action)
+		os.Exit(exitFailure)
+	}
+}
+
+// selectVolumes returns the volumes matched by --selector. Matching nothing
+// is an error, since a selector is the only volume argument it is used
+// with.
+func (o *cliOptions) selectVolumes(ctx context.Context, vm *longhorntools.VolumeManager) []longhorntools.SelectedVolume {
+	selected, err := vm.SelectVolumes(ctx, o.selector, o.namespace)
+	if err != nil {
+		fatalf("Failed to select volumes: %v", err)
+	}
+	if len(selected) == 0 {
+		fatalf("No Longhorn volumes, or PVCs in namespace %s, match selector %q", o.namespace, o.selector)
+	}
+	fmt.Printf("Selector %q matched %d volume(s)\n", o.selector, len(selected))
+	return selected
+}
+
+// confirmCopy asks before a copy overwrites its destination, and exits if
+// the answer is no.
+func (o *cliOptions) confirmCopy(question string) {
+	if o.dryRun {
+		return
+	}
+	ok, err := confirm(question, o.assumeYes)
+	if err != nil {
+		fatalf("Copy not confirmed: %v", err)
+	}
+	if !ok {
+		fmt.Println("Copy cancelled.")
+		os.Exit(exitFailure)
+	}
+}
+
+// copyVolume copies one volume with the method selected by --in-cluster.
+// The copy removes the temporary resources it used.
+func (o *cliOptions) copyVolume(ctx context.Context, vm *longhorntools.VolumeManager, source, dest string) error {
+	if o.inCluster {
+		return vm.CopyVolumeInCluster(ctx, source, dest, o.namespace, o.storageClass)
+	}
+	return vm.CopyVolume(ctx, source, dest, o.namespace, o.storageClass)
+}
+
+// copySelected copies every volume matched by --selector onto the PVC of
+// the same name in --dest-namespace.
+func (o *cliOptions) copySelected(ctx context.Context, vm *longhorntools.VolumeManager) {
+	selected := o.selectVolumes(ctx, vm)
+
+	dests := make([]string, len(selected))
+	for i, s := range selected {
+		if s.PVCName == "" {
+			fatalf("Volume %s has no PVC to pair with one in namespace %s", s.Volume, o.destNamespace)
+		}
+		dest, err := vm.ResolveVolume(ctx, "pvc:"+o.destNamespace+"/"+s.PVCName, o.namespace)
+		if err != nil {
+			fatalf("No destination for PVC %s/%s: %v", s.PVCNamespace, s.PVCName, err)
+		}
+		if dest == s.Volume {
+			fatalf("PVC %s/%s would be copied onto itself", s.PVCNamespace, s.PVCName)
+		}
+		dests[i] = dest
+		fmt.Printf("  %s/%s (%s) -> %s/%s (%s)\n", s.PVCNamespace, s.PVCName, s.Volume, o.destNamespace, s.PVCName, dest)
+	}
+	o.confirmCopy(fmt.Sprintf("This deletes all existing data on these %d destination volumes before copying onto them. Continue?", len(selected)))
+
+	var results []longhorntools.BatchResult
+	failed := 0
+	for i, s := range selected {
+		start := time.Now()
+		err := o.copyVolume(ctx, vm, s.Volume, dests[i])
+		if err != nil {
+			failed++
+		}
+		results = append(results, longhorntools.BatchResult{Volume: s.Volume, Output: "-> " + dests[i], Err: err, Duration: time.Since(start)})
+	}
+	printBatchSummary(results)
+	if failed > 0 {
+		fatalf("Failed to copy volumes: %d of %d volumes failed", failed, len(results))
+	}
+	fmt.Printf("\nCopy completed: %d volume(s) into namespace %s\n", len(results), o.destNamespace)
+}
+
+// addDownloadFlags registers the archive options shared by download and
+// backup-all.
+func (o *cliOptions) addDownloadFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&o.encrypt, "encrypt", "", "Encrypt download (age:<recipient> or gpg:<keyid>)")
+	cmd.Flags().BoolVar(&o.fileSums, "file-checksums", false, "Write a per-file SHA256SUMS manifest for downloads")
+	cmd.Flags().BoolVar(&o.resume, "resume", false, "Continue an interrupted download")
+	cmd.Flags().StringVar(&o.compress, "compress", longhorntools.CompressGzip, "Archive compression: none, gzip, zstd, xz")
+	cmd.Flags().IntVar(&o.compressLvl, "compress-level", 0, "Compression level (0 selects the default)")
+	cmd.Flags().IntVar(&o.parallel, "parallel", 1, "Number of concurrent downloads")
+	cmd.RegisterFlagCompletionFunc("compress", cobra.FixedCompletions(
+		[]string{longhorntools.CompressNone, longhorntools.CompressGzip, longhorntools.CompressZstd, longhorntools.CompressXz}, cobra.ShellCompDirectiveNoFileComp))
+}
+
+func (o *cliOptions) downloadOptions() longhorntools.DownloadOptions {
+	return longhorntools.DownloadOptions{
+		Encrypt:          o.encrypt,
+		FileChecksums:    o.fileSums,
+		Resume:           o.resume,
+		Compression:      o.compress,
+		CompressionLevel: o.compressLvl,
+	}
+}
+
+func (o *cliOptions) listCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List all Longhorn volumes",
+		Example: `  lhc list
+  lhc list -n kube-system
+  lhc list --state detached --unbound
+  lhc list --state degraded,faulted --node worker-2
+  lhc list --namespace-of-pvc production
+  lhc list --sort-by size --order desc
+  lhc list -o wide
+  lhc list --watch --state degraded`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			filter := longhorntools.VolumeFilter{
+				States:       o.listStates,
+				Node:         o.listNode,
+				PVCNamespace: o.listPVCNamespace,
+			}
+			if o.listBound || o.listUnbound {
+				bound := o.listBound
+				filter.Bound = &bound
+			}
+			if o.listOrder != "asc" && o.listOrder != "desc" {
+				fatalf("Invalid --order %q (expected asc or desc)", o.listOrder)
+			}
+			if o.listOutput != "" && o.listOutput != "wide" {
+				fatalf("Invalid --output %q (expected wide)", o.listOutput)
+			}
+			if err := longhorntools.SortVolumes(nil, o.listSortBy, false); err != nil {
+				fatalf("Invalid --sort-by: %v", err)
+			}
+
+			vm, ctx := o.volumeManager()
+			show := func(volumes []longhorntools.LonghornVolume) {
+				volumes = longhorntools.FilterVolumes(volumes, filter)
+				longhorntools.SortVolumes(volumes, o.listSortBy, o.listOrder == "desc")
+				o.printVolumeTable(volumes)
+			}
+			if o.listWatch {
+				err := vm.WatchVolumes(ctx, func(volumes []longhorntools.LonghornVolume) {
+					// Clear the screen and redraw
+					fmt.Print("\033[H\033[2J")
+					fmt.Printf("Watching Longhorn volumes (updated %s, Ctrl-C to stop)\n\n", time.Now().Format("15:04:05"))
+					show(volumes)
+				})
+				if err != nil {
+					fatalf("Failed to watch volumes: %v", err)
+				}
+				return
+			}
+
+			volumes, err := vm.Volumes(ctx)
+			if err != nil {
+				fatalf("Failed to list volumes: %v", err)
+			}
+			show(volumes)
+		},
+	}
+	cmd.Flags().StringSliceVar(&o.listStates, "state", nil, "Only volumes in these states or robustness values (attached, detached, healthy, degraded, faulted, ...)")
+	cmd.Flags().BoolVar(&o.listBound, "bound", false, "Only volumes with a PersistentVolume")
+	cmd.Flags().BoolVar(&o.listUnbound, "unbound", false, "Only volumes without a PersistentVolume")
+	cmd.Flags().StringVar(&o.listNode, "node", "", "Only volumes attached to this node")
+	cmd.Flags().StringVar(&o.listPVCNamespace, "namespace-of-pvc", "", "Only volumes whose PVC is in this namespace")
+	cmd.Flags().StringVar(&o.listSortBy, "sort-by", "name", "Sort by name, size, state, or created")
+	cmd.Flags().StringVar(&o.listOrder, "order", "asc", "Sort order: asc or desc")
+	cmd.Flags().BoolVarP(&o.listWatch, "watch", "w", false, "Keep watching and redraw the table whenever a volume changes")
+	cmd.Flags().StringVarP(&o.listOutput, "output", "o", "", "Output format: wide adds node, robustness, replicas, actual size, frontend, and PVC")
+	cmd.MarkFlagsMutuallyExclusive("bound", "unbound")
+	cmd.RegisterFlagCompletionFunc("output", cobra.FixedCompletions([]string{"wide"}, cobra.ShellCompDirectiveNoFileComp))
+	cmd.RegisterFlagCompletionFunc("sort-by", cobra.FixedCompletions(longhorntools.VolumeSortKeys, cobra.ShellCompDirectiveNoFileComp))
+	cmd.RegisterFlagCompletionFunc("order", cobra.FixedCompletions([]string{"asc", "desc"}, cobra.ShellCompDirectiveNoFileComp))
+	cmd.RegisterFlagCompletionFunc("state", cobra.FixedCompletions(
+		[]string{"attached", "detached", "attaching", "detaching", "creating", "deleting", "healthy", "degraded", "faulted", "unknown"}, cobra.ShellCompDirectiveNoFileComp))
+	cmd.RegisterFlagCompletionFunc("namespace-of-pvc", completeNamespaces)
+	return cmd
+}
+
+// printVolumeTable prints volumes in the format selected by list's
+// --output.
+func (o *cliOptions) printVolumeTable(volumes []longhorntools.LonghornVolume) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	wide := o.listOutput == "wide"
+	if wide {
+		fmt.Fprintln(w, "NAME\tSTATUS\tSIZE\tPV_BOUND\tNODE\tROBUSTNESS\tREPLICAS\tACTUAL_SIZE\tFRONTEND\tPVC")
+	} else {
+		fmt.Fprintln(w, "NAME\tSTATUS\tSIZE\tPV_BOUND")
+	}
+	for _, volume := range volumes {
+		pvBound := "No"
+		if volume.PVName != "" {
+			pvBound = "Yes"
+		}
+		if !wide {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", volume.Name, volume.State, volume.Size, pvBound)
+			continue
+		}
+
+		actualSize := "-"
+		if volume.ActualSize > 0 {
+			actualSize = formatBytes(volume.ActualSize)
+		}
+		pvc := "-"
+		if volume.PVCName != "" {
+			pvc = volume.PVCNamespace + "/" + volume.PVCName
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%d\t%s\t%s\t%s\n", volume.Name, volume.State, volume.Size, pvBound,
+			orDash(volume.NodeID), orDash(volume.Robustness), volume.Replicas, actualSize, orDash(volume.Frontend), pvc)
+	}
+	w.Flush()
+}
+
+// orDash returns s, or "-" if it is empty, for table cells.
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func (o *cliOptions) contentsCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "contents",
+		Short: "Show volume contents recursively",
+		Example: `  lhc contents -v pvc-12345
+  lhc contents -v pvc-12345 -n default`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			vm, ctx := o.volumeManager()
+			volumes, expanded := o.expandVolumes(ctx, vm, []string{o.volume})
+			if len(volumes) > 1 {
+				fatalf("%q matches %d volumes (%s); contents takes one", o.volume, len(volumes), strings.Join(volumes, ", "))
+			}
+			volume := volumes[0]
+			if expanded {
+				fmt.Printf("Matched volume %s\n", volume)
+			}
+			entries, err := vm.VolumeContents(ctx, volume, o.namespace, o.storageClass)
+			if err != nil {
+				fatalf("Failed to get volume contents: %v", err)
+			}
+
+			fmt.Println("Contents (recursive):")
+			for _, entry := range entries {
+				fmt.Printf("%s %10d %s %s\n", entry.Mode, entry.Size, entry.ModTime.Format("2006-01-02 15:04"), entry.Path)
+			}
+		},
+	}
+	cmd.Flags().StringVarP(&o.volume, "volume", "v", "", "Volume name, pvc:<namespace>/<name>, pv:<name>, or glob pattern")
+	cmd.Flags().BoolVar(&o.regex, "regex", false, "Treat -v as a regular expression matched against Longhorn volume names")
+	cmd.MarkFlagRequired("volume")
+	cmd.RegisterFlagCompletionFunc("volume", completeVolumes)
+	return cmd
+}
+
+func (o *cliOptions) describeCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "describe",
+		Short: "Show details of a volume: replicas, engine, PV/PVC, pods, snapshots, and events",
+		Example: `  lhc describe -v pvc-12345
+  lhc describe -v pvc:production/postgres-data`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			vm, ctx := o.volumeManager()
+			volume := o.resolveVolume(ctx, vm, o.volume)
+			d, err := vm.DescribeVolume(ctx, volume)
+			if err != nil {
+				fatalf("Failed to describe volume: %v", err)
+			}
+			printVolumeDescription(os.Stdout, d)
+		},
+	}
+	cmd.Flags().StringVarP(&o.volume, "volume", "v", "", "Volume name, pvc:<namespace>/<name>, or pv:<name>")
+	cmd.MarkFlagRequired("volume")
+	cmd.RegisterFlagCompletionFunc("volume", completeVolumes)
+	return cmd
+}
+
+func (o *cliOptions) replicasCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "replicas",
+		Short: "List replica placement and rebuild status",
+		Long: `Replicas lists the Longhorn replicas of a volume, or of every volume without
+-v, with the node and disk holding each, its mode (RW, or WO while
+rebuilding), and rebuild progress.`,
+		Example: `  lhc replicas
+  lhc replicas -v pvc-12345
+  lhc replicas --rebuilding`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			vm, ctx := o.volumeManager()
+			volume := ""
+			if o.volume != "" {
+				volume = o.resolveVolume(ctx, vm, o.volume)
+			}
+			replicas, err := vm.VolumeReplicas(ctx, volume)
+			if err != nil {
+				fatalf("Failed to list replicas: %v", err)
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "VOLUME\tREPLICA\tNODE\tDISK\tSTATE\tMODE\tREBUILD")
+			rebuilding := 0
+			for _, r := range replicas {
+				if r.Rebuilding {
+					rebuilding++
+				} else if o.rebuilding {
+					continue
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", r.Volume, r.Name, orDash(r.Node), orDash(r.DiskPath), orDash(r.State), orDash(r.Mode), rebuildCell(r))
+			}
+			w.Flush()
+			fmt.Printf("\n%d replica(s), %d rebuilding\n", len(replicas), rebuilding)
+		},
+	}
+	cmd.Flags().StringVarP(&o.volume, "volume", "v", "", "Volume name, pvc:<namespace>/<name>, or pv:<name> (default all volumes)")
+	cmd.Flags().BoolVar(&o.rebuilding, "rebuilding", false, "Only show replicas that are being rebuilt")
+	cmd.RegisterFlagCompletionFunc("volume", completeVolumes)
+	return cmd
+}
+
+func (o *cliOptions) whoUsesCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "who-uses",
+		Short: "Show the workloads that use a volume",
+		Long: `Who-uses follows a volume to its PV and PVC, the pods that mount the PVC, and
+the Deployments, StatefulSets, DaemonSets, Jobs, or CronJobs that own them,
+so you know what depends on the data before copying over or wiping it.`,
+		Example: `  lhc who-uses -v pvc-12345
+  lhc who-uses -v pvc:production/postgres-data`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			vm, ctx := o.volumeManager()
+			volume := o.resolveVolume(ctx, vm, o.volume)
+			pvc, consumers, err := vm.VolumeConsumers(ctx, volume)
+			if err != nil {
+				fatalf("Failed to find consumers: %v", err)
+			}
+			if pvc == "" {
+				fmt.Printf("Volume %s is not bound to a PVC, so nothing can use it.\n", volume)
+				return
+			}
+			if len(consumers) == 0 {
+				fmt.Printf("Volume %s is bound to PVC %s, which no pod uses.\n", volume, pvc)
+				return
+			}
+
+			fmt.Printf("Volume %s is bound to PVC %s and used by:\n\n", volume, pvc)
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "WORKLOAD\tPOD\tPHASE\tNODE")
+			for _, c := range consumers {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", c.Workload, c.Pod, c.Phase, orDash(c.Node))
+			}
+			w.Flush()
+		},
+	}
+	cmd.Flags().StringVarP(&o.volume, "volume", "v", "", "Volume name, pvc:<namespace>/<name>, or pv:<name>")
+	cmd.MarkFlagRequired("volume")
+	cmd.RegisterFlagCompletionFunc("volume", completeVolumes)
+	return cmd
+}
+
+func (o *cliOptions) eventsCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "events",
+		Short: "Show Kubernetes events related to a volume, or to all Longhorn volumes",
+		Long: `Events gathers the events about a volume's Longhorn resources (volume, engine,
+replicas, attachment), its PV and PVC, the VolumeAttachments of the PV, and
+the pods using the PVC, and prints them oldest first. Without -v it does the
+same for every Longhorn volume.`,
+		Example: `  lhc events -v pvc-12345
+  lhc events -v pvc:production/postgres-data --since 1h
+  lhc events --since 30m`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			vm, ctx := o.volumeManager()
+			volume := ""
+			if o.volume != "" {
+				volume = o.resolveVolume(ctx, vm, o.volume)
+			}
+			var since time.Time
+			if o.eventsSince > 0 {
+				since = time.Now().Add(-o.eventsSince)
+			}
+			events, err := vm.VolumeEvents(ctx, volume, since)
+			if err != nil {
+				fatalf("Failed to get events: %v", err)
+			}
+			if len(events) == 0 {
+				fmt.Println("No events found.")
+				return
+			}
+			printEvents(os.Stdout, events, "")
+		},
+	}
+	cmd.Flags().StringVarP(&o.volume, "volume", "v", "", "Volume name, pvc:<namespace>/<name>, or pv:<name> (default all volumes)")
+	cmd.Flags().DurationVar(&o.eventsSince, "since", 0, "Only show events seen within this duration (e.g. 1h)")
+	cmd.RegisterFlagCompletionFunc("volume", completeVolumes)
+	return cmd
+}
+
+func (o *cliOptions) nodesCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "nodes",
+		Short: "Summarize Longhorn node and disk status",
+		Long: `Nodes reads Longhorn's node resources and shows, per node, whether it is
+ready and schedulable, its storage (maximum, available, reserved, and
+scheduled to replicas), and tags, followed by the same for each disk with any
+disk conditions that are not met.`,
+		Example: `  lhc nodes`,
+		Args:    cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			vm, ctx := o.volumeManager()
+			nodes, err := vm.Nodes(ctx)
+			if err != nil {
+				fatalf("Failed to list nodes: %v", err)
+			}
+
+			yesNo := map[bool]string{true: "Yes", false: "No"}
+			tags := func(t []string) string { return orDash(strings.Join(t, ",")) }
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "NODE\tREADY\tSCHEDULABLE\tMAXIMUM\tAVAILABLE\tRESERVED\tSCHEDULED\tTAGS")
+			for _, n := range nodes {
+				maximum, available, reserved, scheduled := n.Storage()
+				schedulable := yesNo[n.Schedulable && n.AllowScheduling]
+				if !n.AllowScheduling {
+					schedulable = "Disabled"
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", n.Name, yesNo[n.Ready], schedulable,
+					formatBytes(maximum), formatBytes(available), formatBytes(reserved), formatBytes(scheduled), tags(n.Tags))
+			}
+			w.Flush()
+
+			fmt.Println()
+			w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "NODE\tDISK\tPATH\tSCHEDULING\tMAXIMUM\tAVAILABLE\tRESERVED\tSCHEDULED\tTAGS\tCONDITIONS")
+			for _, n := range nodes {
+				for _, d := range n.Disks {
+					scheduling := "Enabled"
+					if !d.AllowScheduling {
+						scheduling = "Disabled"
+					}
+					conditions := "OK"
+					if len(d.Problems) > 0 {
+						conditions = strings.Join(d.Problems, "; ")
+					}
+					fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", n.Name, d.Name, d.Path, scheduling,
+						formatBytes(d.StorageMaximum), formatBytes(d.StorageAvailable), formatBytes(d.StorageReserved), formatBytes(d.StorageScheduled),
+						tags(d.Tags), conditions)
+				}
+			}
+			w.Flush()
+		},
+	}
+	return cmd
+}
+
+func (o *cliOptions) healthCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "health",
+		Short: "Report degraded and faulted volumes",
+		Long: `Health scans every Longhorn volume and lists those that are degraded or
+faulted or have failed replicas. It exits with status 2 when it finds a
+problem, so it can run from cron or a monitoring check; status 1 means the
+scan itself failed.`,
+		Example: `  lhc health
+  lhc health || notify-oncall`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			vm, ctx := o.volumeManager()
+			problems, err := vm.CheckHealth(ctx)
+			if err != nil {
+				fatalf("Failed to check volume health: %v", err)
+			}
+			if len(problems) == 0 {
+				fmt.Println("All volumes are healthy.")
+				return
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "VOLUME\tSTATE\tROBUSTNESS\tNODE\tPVC\tPROBLEMS")
+			for _, p := range problems {
+				v := p.Volume
+				pvc := "-"
+				if v.PVCName != "" {
+					pvc = v.PVCNamespace + "/" + v.PVCName
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", v.Name, v.State, orDash(v.Robustness), orDash(v.NodeID), pvc, strings.Join(p.Reasons, ", "))
+			}
+			w.Flush()
+
+			for _, p := range problems {
+				for _, r := range p.FailedReplicas {
+					fmt.Printf("  %s: replica %s on %s failed at %s\n", p.Volume.Name, r.Name, orDash(r.Node), orDash(r.FailedAt))
+				}
+			}
+			fmt.Printf("\n%d volume(s) need attention.\n", len(problems))
+			os.Exit(exitProblemsFound)
+		},
+	}
+	return cmd
+}
+
+func (o *cliOptions) stuckCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "stuck",
+		Aliases: []string{"detached"},
+		Short:   "Report volumes stuck detached or attaching, and reattach them",
+		Long: `Stuck lists volumes that are attaching or detaching, detached while pods
+wait for them, or attached to another node than a waiting pod was scheduled
+to, as happens after a node failure. For each it shows why, from Longhorn's
+volume conditions, the PV's VolumeAttachments, and the waiting pods'
+attach, mount, and scheduling events.
+
+With --reattach, once confirmed, it deletes the VolumeAttachments that hold
+a volume on a node that is gone or not ready, and deletes the waiting pods
+so their controllers recreate them and the volume is attached afresh. Pods
+without a controller are left alone with a hint. Like health, stuck exits
+with status 2 when it finds a stuck volume and --reattach is not given.`,
+		Example: `  lhc stuck
+  lhc stuck --reattach
+  lhc stuck --reattach --dry-run`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			vm, ctx := o.volumeManager()
+			stuck, err := vm.StuckVolumes(ctx)
+			if err != nil {
+				fatalf("Failed to find stuck volumes: %v", err)
+			}
+			if len(stuck) == 0 {
+				fmt.Println("No stuck volumes found.")
+				return
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "VOLUME\tSTATE\tNODE\tPVC\tWAITING PODS")
+			for _, s := range stuck {
+				var waiting []string
+				for _, c := range s.Waiting {
+					waiting = append(waiting, fmt.Sprintf("%s (%s on %s)", c.Pod, c.Phase, orDash(c.Node)))
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", s.Volume.Name, s.Volume.State, orDash(s.Volume.NodeID), orDash(s.PVC), orDash(strings.Join(waiting, ", ")))
+			}
+			w.Flush()
+			fmt.Println()
+			for _, s := range stuck {
+				fmt.Printf("%s:\n", s.Volume.Name)
+				for _, reason := range s.Reasons {
+					fmt.Printf("  - %s\n", reason)
+				}
+			}
+			fmt.Printf("\n%d stuck volume(s).\n", len(stuck))
+
+			if !o.reattach {
+				fmt.Println("Run with --reattach to release stale attachments and restart waiting pods.")
+				os.Exit(exitProblemsFound)
+			}
+			if !o.dryRun {
+				ok, err := confirm(fmt.Sprintf("Reattach %d volume(s), deleting stale VolumeAttachments and restarting waiting pods?", len(stuck)), o.assumeYes)
+				if err != nil {
+					fatalf("Reattach not confirmed: %v", err)
+				}
+				if !ok {
+					fmt.Println("Aborted.")
+					return
+				}
+			}
+			fmt.Println()
+			failed := 0
+			for _, s := range stuck {
+				actions, err := vm.ReattachVolume(ctx, s)
+				for _, action := range actions {
+					fmt.Printf("%s: %s\n", s.Volume.Name, action)
+				}
+				if err != nil {
+					fmt.Printf("%s: %v\n", s.Volume.Name, err)
+					failed++
+				}
+			}
+			if failed > 0 {
+				fatalf("Failed to reattach %d of %d volume(s)", failed, len(stuck))
+			}
+		},
+	}
+	cmd.Flags().BoolVar(&o.reattach, "reattach", false, "Delete stale VolumeAttachments and restart waiting pods")
+	return cmd
+}
+
+func (o *cliOptions) usageCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "usage",
+		Aliases: []string{"df"},
+		Short:   "Show filesystem usage of volumes",
+		Long: `Usage mounts each volume (or uses the pod already mounting it) and runs df,
+so you can see how full a volume is rather than its nominal Longhorn size.
+Without -v or --selector every Longhorn volume is measured.`,
+		Example: `  lhc usage
+  lhc usage -v pvc-12345
+  lhc usage -v 'pvc-9a*'
+  lhc usage -l app=postgres -n production`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			vm, ctx := o.volumeManager()
+			volumes, _ := o.expandVolumes(ctx, vm, o.volumes)
+			if o.selector != "" {
+				for _, selected := range o.selectVolumes(ctx, vm) {
+					volumes = append(volumes, selected.Volume)
+				}
+			}
+			if len(o.volumes) == 0 && o.selector == "" {
+				all, err := vm.Volumes(ctx)
+				if err != nil {
+					fatalf("Failed to list volumes: %v", err)
+				}
+				for _, volume := range all {
+					volumes = append(volumes, volume.Name)
+				}
+			}
+
+			rows := make([]usageRow, len(volumes))
+			for i, volume := range volumes {
+				rows[i].volume = volume
+				rows[i].usage, rows[i].err = vm.VolumeUsage(ctx, volume, o.namespace, o.storageClass)
+			}
+
+			fmt.Println()
+			failed := writeUsageTable(os.Stdout, rows)
+			if failed > 0 {
+				fatalf("Failed to measure %d of %d volumes", failed, len(volumes))
+			}
+		},
+	}
+	cmd.Flags().StringArrayVarP(&o.volumes, "volume", "v", nil, "Volume name, pvc:<namespace>/<name>, pv:<name>, or glob pattern (repeatable)")
+	cmd.Flags().BoolVar(&o.regex, "regex", false, "Treat -v values as regular expressions matched against Longhorn volume names")
+	cmd.Flags().StringVarP(&o.selector, "selector", "l", "", "Also measure volumes whose Longhorn volume or PVC labels match (e.g. app=postgres)")
+	cmd.RegisterFlagCompletionFunc("volume", completeVolumes)
+	return cmd
+}
+
+// usageRow is one volume's line in the usage table.
+type usageRow struct {
+	volume string
+	usage  *longhorntools.VolumeUsage
+	err    error
+}
+
+// writeUsageTable writes the usage table and returns how many volumes could
+// not be measured. Their rows show dashes and the error in the USE% column.
+func writeUsageTable(out io.Writer, rows []usageRow) int {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VOLUME\tSIZE\tUSED\tAVAILABLE\tUSE%")
+	failed := 0
+	for _, r := range rows {
+		if r.err != nil {
+			failed++
+			fmt.Fprintf(w, "%s\t-\t-\t-\terror: %v\n", r.volume, r.err)
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%.0f%%\n", r.volume,
+			formatBytes(r.usage.Size), formatBytes(r.usage.Used), formatBytes(r.usage.Available), r.usage.UsedPercent())
+	}
+	w.Flush()
+	return failed
+}
+
+func (o *cliOptions) capacityCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "capacity",
+		Short: "Report provisioned, actual, and physical capacity per node",
+		Long: `Capacity sums, per Longhorn node and for the cluster, the disk space
+(physical, reserved, and available), the size of the replicas scheduled to
+the node (provisioned), and the data those replicas hold (actual). PROV% is
+provisioned space against the space Longhorn may schedule to, the physical
+space less the reserved space.
+
+A node is flagged when PROV% is above --max-provisioned or less than
+--min-available percent of its disk space is available. They default to
+Longhorn's storage-over-provisioning-percentage and
+storage-minimal-available-percentage settings, beyond which Longhorn stops
+scheduling replicas to the node. Like health, capacity exits with status 2
+when a node is flagged.`,
+		Example: `  lhc capacity
+  lhc capacity --max-provisioned 150 --min-available 20`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if o.maxProvisioned < 0 {
+				fatalf("--max-provisioned cannot be negative")
+			}
+			if o.minAvailable < 0 || o.minAvailable > 100 {
+				fatalf("--min-available must be between 0 and 100")
+			}
+			vm, ctx := o.volumeManager()
+			report, err := vm.Capacity(ctx, longhorntools.CapacityThresholds{
+				MaxProvisioned: o.maxProvisioned,
+				MinAvailable:   o.minAvailable,
+			})
+			if err != nil {
+				fatalf("Failed to compute capacity: %v", err)
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "NODE\tREPLICAS\tPHYSICAL\tRESERVED\tUSED\tAVAILABLE\tPROVISIONED\tACTUAL\tPROV%\tAVAIL%\tSTATUS")
+			row := func(c longhorntools.NodeCapacity) {
+				status := "OK"
+				if len(c.Warnings) > 0 {
+					status = strings.Join(c.Warnings, ", ")
+				}
+				fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\t%s\t%s\t%s\t%.0f%%\t%.0f%%\t%s\n", c.Node, c.Replicas,
+					formatBytes(c.Physical), formatBytes(c.Reserved), formatBytes(c.Used()), formatBytes(c.Available),
+					formatBytes(c.Provisioned), formatBytes(c.Actual), c.ProvisionedPercent(), c.AvailablePercent(), status)
+			}
+			for _, n := range report.Nodes {
+				row(n)
+			}
+			cluster := report.Cluster
+			cluster.Node = "(cluster)"
+			row(cluster)
+			w.Flush()
+
+			fmt.Printf("\n%d volume(s) of %s, provisioned as %s of replicas holding %s.\n",
+				report.Volumes, formatBytes(report.VolumeSize), formatBytes(cluster.Provisioned), formatBytes(cluster.Actual))
+			fmt.Printf("Thresholds: provisioned above %d%%, available below %d%%.\n",
+				report.Thresholds.MaxProvisioned, report.Thresholds.MinAvailable)
+			if flagged := report.Flagged(); len(flagged) > 0 {
+				fmt.Printf("\n%d node(s) need attention.\n", len(flagged))
+				os.Exit(exitProblemsFound)
+			}
+		},
+	}
+	cmd.Flags().IntVar(&o.maxProvisioned, "max-provisioned", 0, "Flag nodes with more than this percentage of their schedulable space provisioned (default: Longhorn's setting)")
+	cmd.Flags().IntVar(&o.minAvailable, "min-available", 0, "Flag nodes with less than this percentage of their disk space available (default: Longhorn's setting)")
+	return cmd
+}
+
+func (o *cliOptions) snapshotUsageCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "snapshot-usage",
+		Short: "Report the disk space taken by volume snapshots",
+		Long: `Snapshot-usage walks a volume's snapshot chain from Longhorn's Snapshot
+resources, oldest first, and lists the space each snapshot takes and the
+running total. Branches left by reverting to a snapshot are indented. Sizes
+are per replica.
+
+The summary shows how much of that is held by snapshots that were removed
+but not yet purged, by snapshots a revert left behind, and by snapshots
+Longhorn created itself, which are the first candidates to purge.
+
+With --all, every volume is listed with its snapshot totals instead, the
+volumes whose snapshots take the most space first.`,
+		Example: `  lhc snapshot-usage -v pvc-12345
+  lhc snapshot-usage --all`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			vm, ctx := o.volumeManager()
+			if o.all {
+				usage, err := vm.AllSnapshotUsage(ctx)
+				if err != nil {
+					fatalf("Failed to compute snapshot usage: %v", err)
+				}
+				w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+				fmt.Fprintln(w, "VOLUME\tSIZE\tACTUAL\tSNAPSHOTS\tSNAPSHOT SPACE\tSNAP%\tREMOVED\tSTALE\tSYSTEM")
+				var total int64
+				for _, u := range usage {
+					total += u.Total
+					fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%.0f%%\t%s\t%s\t%s\n", u.Volume, formatBytes(u.Size), formatBytes(u.ActualSize),
+						len(u.Snapshots), formatBytes(u.Total), u.SnapshotPercent(), formatBytes(u.Removed), formatBytes(u.Stale), formatBytes(u.System))
+				}
+				w.Flush()
+				fmt.Printf("\nSnapshots of %d volume(s) take %s per replica.\n", len(usage), formatBytes(total))
+				return
+			}
+
+			volume := o.resolveVolume(ctx, vm, o.volume)
+			u, err := vm.SnapshotUsage(ctx, volume)
+			if err != nil {
+				fatalf("Failed to compute snapshot usage: %v", err)
+			}
+			if len(u.Snapshots) == 0 {
+				fmt.Printf("Volume %s has no snapshots.\n", u.Volume)
+				return
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "SNAPSHOT\tCREATED\tSIZE\tCUMULATIVE\tCREATED BY\tSTATUS")
+			for _, s := range u.Snapshots {
+				createdBy := "system"
+				if s.UserCreated {
+					createdBy = "user"
+				}
+				status := "-"
+				switch {
+				case s.Removed:
+					status = "removed"
+				case s.Live:
+					status = "live"
+				case s.Stale:
+					status = "stale"
+				}
+				fmt.Fprintf(w, "%s%s\t%s\t%s\t%s\t%s\t%s\n", strings.Repeat("  ", s.Depth), s.Name, orDash(s.Created),
+					formatBytes(s.Size), formatBytes(s.Cumulative), createdBy, status)
+			}
+			w.Flush()
+
+			fmt.Printf("\n%d snapshot(s) take %s per replica, %.0f%% of the volume's actual size of %s (size %s).\n",
+				len(u.Snapshots), formatBytes(u.Total), u.SnapshotPercent(), formatBytes(u.ActualSize), formatBytes(u.Size))
+			if u.Removed > 0 {
+				fmt.Printf("Removed snapshots hold %s until Longhorn purges them.\n", formatBytes(u.Removed))
+			}
+			if u.Stale > 0 {
+				fmt.Printf("Snapshots left behind by a revert hold %s.\n", formatBytes(u.Stale))
+			}
+			if u.System > 0 {
+				fmt.Printf("Snapshots Longhorn created itself hold %s.\n", formatBytes(u.System))
+			}
+			if u.Removed > 0 || u.System > 0 {
+				fmt.Println("A snapshot-cleanup recurring job purges removed snapshots and deletes system ones, e.g.:")
+				fmt.Println("  lhc recurring-job create snapshot-cleanup --task snapshot-cleanup --cron '0 3 * * *' --group default")
+			}
+		},
+	}
+	cmd.Flags().StringVarP(&o.volume, "volume", "v", "", "Volume name, pvc:<namespace>/<name>, or pv:<name>")
+	cmd.Flags().BoolVar(&o.all, "all", false, "Report snapshot totals of every volume")
+	cmd.MarkFlagsOneRequired("volume", "all")
+	cmd.MarkFlagsMutuallyExclusive("volume", "all")
+	cmd.RegisterFlagCompletionFunc("volume", completeVolumes)
+	return cmd
+}
+
+func (o *cliOptions) createCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "create",
+		Short: "Create a new Longhorn volume",
+		Long: `Create makes a new volume and waits until Longhorn reports it ready.
+
+With -v it creates a bare Longhorn volume of that name, without a PV or PVC,
+as the Longhorn UI does. With --pvc it instead creates a PVC from the
+Longhorn storage class -c, and Longhorn provisions and names the volume.
+--replicas overrides Longhorn's default replica count, or the storage
+class's.`,
+		Example: `  lhc create -v scratch --size 10Gi
+  lhc create -v scratch --size 10Gi --replicas 2
+  lhc create --pvc production/postgres-data --size 50Gi -c longhorn-encrypted`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			size, err := resource.ParseQuantity(o.createSize)
+			if err != nil {
+				fatalf("Invalid --size %q: %v", o.createSize, err)
+			}
+			opts := longhorntools.CreateVolumeOptions{Size: size, Replicas: o.replicaCount}
+			vm, ctx := o.volumeManager()
+
+			volume := o.volume
+			if o.createPVC != "" {
+				namespace, name, found := strings.Cut(o.createPVC, "/")
+				if !found {
+					namespace, name = o.namespace, o.createPVC
+				}
+				volume, err = vm.CreateVolumeClaim(ctx, namespace, name, o.storageClass, opts)
+				if err != nil {
+					fatalf("Failed to create PVC: %v", err)
+				}
+				if volume == "" && !o.dryRun {
+					fmt.Printf("\nCreated PVC %s/%s\n", namespace, name)
+					return
+				}
+			} else if err := vm.CreateVolume(ctx, volume, opts); err != nil {
+				fatalf("Failed to create volume: %v", err)
+			}
+			if o.dryRun {
+				return
+			}
+
+			info, err := vm.Volume(ctx, volume)
+			if err != nil {
+				fatalf("Failed to get volume: %v", err)
+			}
+			fmt.Printf("\nCreated volume %s\n", volume)
+			fmt.Printf("  Size:      %s\n", formatVolumeSize(info.Size))
+			fmt.Printf("  Replicas:  %d\n", info.Replicas)
+			fmt.Printf("  State:     %s\n", info.State)
+			if info.PVCName != "" {
+				fmt.Printf("  PVC:       %s/%s (PV %s)\n", info.PVCNamespace, info.PVCName, orDash(info.PVName))
+				fmt.Printf("  Mount it in a pod of namespace %s with persistentVolumeClaim.claimName: %s\n", info.PVCNamespace, info.PVCName)
+			} else {
+				fmt.Printf("  Device:    /dev/longhorn/%s (once attached)\n", volume)
+				fmt.Println("  Create a PV and PVC for it in the Longhorn UI to mount it in a pod")
+			}
+		},
+	}
+	cmd.Flags().StringVarP(&o.volume, "volume", "v", "", "Name of the new Longhorn volume")
+	cmd.Flags().StringVar(&o.createPVC, "pvc", "", "Create a PVC <namespace>/<name> (or <name> in -n) from storage class -c instead")
+	cmd.Flags().StringVar(&o.createSize, "size", "", "Size of the volume, e.g. 10Gi")
+	cmd.Flags().Int64Var(&o.replicaCount, "replicas", 0, "Number of replicas (default Longhorn's or the storage class's)")
+	cmd.MarkFlagRequired("size")
+	cmd.MarkFlagsOneRequired("volume", "pvc")
+	cmd.MarkFlagsMutuallyExclusive("volume", "pvc")
+	return cmd
+}
+
+func (o *cliOptions) expandCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "expand",
+		Short: "Grow a volume to a new size",
+		Long: `Expand grows a volume and waits until Longhorn and Kubernetes report the new
+size. A volume with a PVC is expanded through the claim; one without is
+expanded by patching the Longhorn volume. Volumes cannot shrink.
+
+Pods that mount the claim see the larger filesystem once the kubelet has
+resized it online. If nothing mounts the claim, the filesystem grows the next
+time it is mounted; --grow-fs mounts it in a temporary pod to do so now.`,
+		Example: `  lhc expand -v pvc-12345 --size 50Gi
+  lhc expand -v pvc:production/postgres-data --size 100Gi --grow-fs
+  lhc expand -v pvc-12345 --size 50Gi --dry-run`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			size, err := resource.ParseQuantity(o.expandSize)
+			if err != nil {
+				fatalf("Invalid --size %q: %v", o.expandSize, err)
+			}
+			vm, ctx := o.volumeManager()
+			volume := o.resolveVolume(ctx, vm, o.volume)
+			if err := vm.ExpandVolume(ctx, volume, size, o.growFS); err != nil {
+				fatalf("Failed to expand volume: %v", err)
+			}
+			fmt.Printf("\nExpansion completed: %s is now %s\n", volume, size.String())
+		},
+	}
+	cmd.Flags().StringVarP(&o.volume, "volume", "v", "", "Volume name, pvc:<namespace>/<name>, or pv:<name>")
+	cmd.Flags().StringVar(&o.expandSize, "size", "", "New size of the volume, e.g. 50Gi")
+	cmd.Flags().BoolVar(&o.growFS, "grow-fs", false, "Mount an unused claim in a temporary pod so its filesystem grows now")
+	cmd.MarkFlagRequired("volume")
+	cmd.MarkFlagRequired("size")
+	cmd.RegisterFlagCompletionFunc("volume", completeVolumes)
+	return cmd
+}
+
+func (o *cliOptions) setReplicasCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "set-replicas",
+		Short: "Change the number of replicas of a volume",
+		Long: `Set-replicas changes how many replicas Longhorn keeps of a volume. With
+--wait it follows the rebuild of new replicas, or the removal of surplus
+ones, reporting progress until the volume has exactly that many healthy
+replicas. Longhorn only rebuilds attached volumes, so a detached volume is
+not waited for.`,
+		Example: `  lhc set-replicas -v pvc-12345 -r 3
+  lhc set-replicas -v pvc:production/postgres-data -r 3 --wait`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			vm, ctx := o.volumeManager()
+			volume := o.resolveVolume(ctx, vm, o.volume)
+			if err := vm.SetReplicas(ctx, volume, o.replicaCount, o.wait); err != nil {
+				fatalf("Failed to set replicas: %v", err)
+			}
+			if !o.dryRun {
+				fmt.Printf("\nVolume %s is set to %d replicas\n", volume, o.replicaCount)
+			}
+		},
+	}
+	cmd.Flags().StringVarP(&o.volume, "volume", "v", "", "Volume name, pvc:<namespace>/<name>, or pv:<name>")
+	cmd.Flags().Int64VarP(&o.replicaCount, "replicas", "r", 0, fmt.Sprintf("Number of replicas (1-%d)", longhorntools.MaxReplicas))
+	cmd.Flags().BoolVar(&o.wait, "wait", false, "Wait until the replicas are rebuilt or removed (see --wait-timeout, default 1h)")
+	cmd.MarkFlagRequired("volume")
+	cmd.MarkFlagRequired("replicas")
+	cmd.RegisterFlagCompletionFunc("volume", completeVolumes)
+	return cmd
+}
+
+func (o *cliOptions) upgradeEngineCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "upgrade-engine",
+		Short: "Upgrade volumes to a new Longhorn engine image",
+		Long: `Upgrade-engine moves a volume, or with --all every volume not yet on the
+image, to a new engine image through Longhorn's own upgrade flow, and waits
+for each to report it. Attached volumes are upgraded live and must be
+healthy; detached volumes are upgraded offline. The image must already be
+deployed as an EngineImage. Without --image, Longhorn's default engine image
+is used.
+
+Volumes are upgraded one at a time. Afterwards the volumes still on other
+engine images are listed.`,
+		Example: `  lhc upgrade-engine -v pvc-12345
+  lhc upgrade-engine -v pvc-12345 --image longhornio/longhorn-engine:v1.7.2
+  lhc upgrade-engine --all
+  lhc upgrade-engine --all --dry-run`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			vm, ctx := o.volumeManager()
+			image := o.image
+			if image == "" {
+				var err error
+				if image, err = vm.DefaultEngineImage(ctx); err != nil {
+					fatalf("Failed to find the default engine image (pass --image): %v", err)
+				}
+			}
+
+			var volumes []string
+			if o.all {
+				all, err := vm.Volumes(ctx)
+				if err != nil {
+					fatalf("Failed to list volumes: %v", err)
+				}
+				for _, volume := range all {
+					if volume.EngineImage != image {
+						volumes = append(volumes, volume.Name)
+					}
+				}
+				if len(volumes) == 0 {
+					fmt.Printf("All volumes run engine image %s\n", image)
+					return
+				}
+				o.confirmVolumes(fmt.Sprintf("Upgrade to %s", image), volumes)
+			} else {
+				volumes = []string{o.resolveVolume(ctx, vm, o.volume)}
+			}
+
+			failed := 0
+			for _, volume := range volumes {
+				if err := vm.UpgradeEngine(ctx, volume, image); err != nil {
+					fmt.Printf("Failed to upgrade %s: %v\n", volume, err)
+					failed++
+				}
+			}
+			if o.dryRun {
+				return
+			}
+
+			all, err := vm.Volumes(ctx)
+			if err != nil {
+				fatalf("Failed to list volumes: %v", err)
+			}
+			fmt.Println()
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			old := 0
+			for _, volume := range all {
+				if volume.EngineImage == image {
+					continue
+				}
+				if old == 0 {
+					fmt.Printf("Volumes not on %s:\n", image)
+					fmt.Fprintln(w, "  VOLUME\tSTATE\tROBUSTNESS\tENGINE IMAGE")
+				}
+				old++
+				fmt.Fprintf(w, "  %s\t%s\t%s\t%s\n", volume.Name, volume.State, orDash(volume.Robustness), orDash(volume.EngineImage))
+			}
+			w.Flush()
+			if old == 0 {
+				fmt.Printf("All volumes run engine image %s\n", image)
+			}
+			if failed > 0 {
+				fatalf("Failed to upgrade %d of %d volume(s)", failed, len(volumes))
+			}
+		},
+	}
+	cmd.Flags().StringVarP(&o.volume, "volume", "v", "", "Volume name, pvc:<namespace>/<name>, or pv:<name>")
+	cmd.Flags().BoolVar(&o.all, "all", false, "Upgrade every volume that is not on the image")
+	cmd.Flags().StringVar(&o.image, "image", "", "Engine image to upgrade to (default Longhorn's default engine image)")
+	cmd.MarkFlagsOneRequired("volume", "all")
+	cmd.MarkFlagsMutuallyExclusive("volume", "all")
+	cmd.RegisterFlagCompletionFunc("volume", completeVolumes)
+	return cmd
+}
+
+func (o *cliOptions) salvageCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "salvage",
+		Short: "Recover a faulted volume from its failed replicas",
+		Long: `Salvage recovers a volume whose replicas have all failed. It lists the failed
+replicas, most recent failure first, and asks which to salvage; that replica
+usually holds the newest data. The chosen replicas' failures are cleared so
+Longhorn can attach the volume from them again, and salvage waits until the
+volume is no longer faulted.
+
+Pass --replica to choose replicas without prompting. The volume must be
+detached.`,
+		Example: `  lhc salvage -v pvc-12345
+  lhc salvage -v pvc-12345 --replica pvc-12345-r-1a2b
+  lhc salvage -v pvc:production/postgres-data --dry-run`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			vm, ctx := o.volumeManager()
+			volume := o.resolveVolume(ctx, vm, o.volume)
+			failed, err := vm.FailedReplicas(ctx, volume)
+			if err != nil {
+				fatalf("Failed to list replicas: %v", err)
+			}
+			if len(failed) == 0 {
+				fatalf("Volume %s has no failed replicas to salvage", volume)
+			}
+
+			fmt.Printf("Failed replicas of %s:\n", volume)
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "  NAME\tNODE\tDISK\tSTATE\tFAILED AT")
+			for _, r := range failed {
+				fmt.Fprintf(w, "  %s\t%s\t%s\t%s\t%s\n", r.Name, orDash(r.Node), orDash(r.DiskPath), orDash(r.State), r.FailedAt)
+			}
+			w.Flush()
+			fmt.Println()
+
+			replicas := o.salvageReplicas
+			if len(replicas) == 0 {
+				for _, r := range failed {
+					ok := true
+					if !o.dryRun {
+						ok, err = confirm(fmt.Sprintf("Salvage replica %s on %s (failed at %s)?", r.Name, orDash(r.Node), r.FailedAt), o.assumeYes)
+						if err != nil {
+							fatalf("Salvage not confirmed: %v", err)
+						}
+					}
+					if ok {
+						replicas = append(replicas, r.Name)
+					}
+				}
+				if len(replicas) == 0 {
+					fmt.Println("No replicas chosen; nothing to salvage.")
+					return
+				}
+			}
+
+			if err := vm.SalvageVolume(ctx, volume, replicas); err != nil {
+				fatalf("Failed to salvage volume: %v", err)
+			}
+			fmt.Printf("\nSalvage completed: %s recovered from %s\n", volume, strings.Join(replicas, ", "))
+		},
+	}
+	cmd.Flags().StringVarP(&o.volume, "volume", "v", "", "Volume name, pvc:<namespace>/<name>, or pv:<name>")
+	cmd.Flags().StringSliceVar(&o.salvageReplicas, "replica", nil, "Failed replica to salvage (repeatable); skips the prompt")
+	cmd.MarkFlagRequired("volume")
+	cmd.RegisterFlagCompletionFunc("volume", completeVolumes)
+	return cmd
+}
+
+func (o *cliOptions) trimCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "trim",
+		Short: "Reclaim unused space of a volume with fstrim",
+		Long: `Trim runs fstrim on a volume's filesystem so Longhorn can release the blocks
+of deleted files and the volume's actual size shrinks. The pod already
+mounting the volume is used if there is one; fstrim needs CAP_SYS_ADMIN
+there. Otherwise a temporary pod with that capability mounts the volume.
+
+Longhorn only reclaims space in the volume head. Blocks still referenced by
+snapshots stay allocated until those snapshots are removed.`,
+		Example: `  lhc trim -v pvc-12345
+  lhc trim -v pvc:production/postgres-data`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			vm, ctx := o.volumeManager()
+			volume := o.resolveVolume(ctx, vm, o.volume)
+			result, err := vm.TrimVolume(ctx, volume, o.namespace, o.storageClass)
+			if err != nil {
+				fatalf("Failed to trim volume: %v", err)
+			}
+			if o.dryRun {
+				return
+			}
+
+			fmt.Println()
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
+			fmt.Fprintf(w, "Trimmed:\t%s\n", formatBytes(result.Trimmed))
+			fmt.Fprintf(w, "Actual size before:\t%s\n", formatBytes(result.ActualSizeBefore))
+			fmt.Fprintf(w, "Actual size after:\t%s\n", formatBytes(result.ActualSizeAfter))
+			fmt.Fprintf(w, "Reclaimed:\t%s\n", formatBytes(max(result.Reclaimed(), 0)))
+			w.Flush()
+			if result.Reclaimed() <= 0 && result.Trimmed > 0 {
+				fmt.Println("\nLonghorn may take a moment to update the actual size, and snapshots keep their blocks allocated.")
+			}
+		},
+	}
+	cmd.Flags().StringVarP(&o.volume, "volume", "v", "", "Volume name, pvc:<namespace>/<name>, or pv:<name>")
+	cmd.MarkFlagRequired("volume")
+	cmd.RegisterFlagCompletionFunc("volume", completeVolumes)
+	return cmd
+}
+
+func (o *cliOptions) fsckCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "fsck",
+		Short: "Check a detached volume's filesystem",
+		Long: `Fsck attaches a volume as a raw block device in a temporary pod, without
+mounting it, and runs e2fsck or xfs_repair as its filesystem requires. The
+output is streamed as the check runs. By default the check is read-only;
+--repair lets it fix what it finds, after confirmation.
+
+The volume must be detached and no pod may use its PVC: checking a mounted
+filesystem reports bogus errors, and repairing one corrupts it. Scale down
+the workload first.
+
+The default image installs e2fsprogs and xfsprogs with apk when it starts.
+Without internet access, pass --image with both preinstalled. Exits with
+status 2 if the check found problems.`,
+		Example: `  lhc fsck -v pvc-12345
+  lhc fsck -v pvc:production/postgres-data --repair
+  lhc fsck -v pvc-12345 --image registry.example.com/tools/fsck:1.0`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			vm, ctx := o.volumeManager()
+			volume := o.resolveVolume(ctx, vm, o.volume)
+			if o.repair && !o.dryRun {
+				ok, err := confirm(fmt.Sprintf("Repairing modifies the filesystem on volume %s. Continue?", volume), o.assumeYes)
+				if err != nil {
+					fatalf("Repair not confirmed: %v", err)
+				}
+				if !ok {
+					fmt.Println("Repair cancelled.")
+					return
+				}
+			}
+
+			result, err := vm.CheckFilesystem(ctx, volume, o.namespace, o.storageClass, longhorntools.FsckOptions{
+				Repair: o.repair,
+				Image:  o.image,
+			})
+			if err != nil {
+				fatalf("Failed to check filesystem: %v", err)
+			}
+			if o.dryRun {
+				return
+			}
+			fmt.Printf("\n%s filesystem on %s: %s\n", result.Filesystem, volume, result.Summary())
+			if !result.Clean() {
+				os.Exit(exitProblemsFound)
+			}
+		},
+	}
+	cmd.Flags().StringVarP(&o.volume, "volume", "v", "", "Volume name, pvc:<namespace>/<name>, or pv:<name>")
+	cmd.Flags().BoolVar(&o.repair, "repair", false, "Fix the problems found instead of only reporting them")
+	cmd.Flags().StringVar(&o.image, "image", longhorntools.DefaultFsckImage, "Image of the fsck pod; needs e2fsprogs and xfsprogs, or apk to install them")
+	cmd.MarkFlagRequired("volume")
+	cmd.RegisterFlagCompletionFunc("volume", completeVolumes)
+	return cmd
+}
+
+func (o *cliOptions) downloadCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "download",
+		Short: "Download volume as a tar archive (gzip by default)",
+		Long: `Download streams a volume out of the cluster as a tar archive.
+
+With several -v flags, a -v pattern, --volumes-file, --selector, or an -o
+ending in "/", -o names a directory and each volume is written to its own
+archive there. Patterns are listed for confirmation before downloading.`,
+		Example: `  lhc download -v pvc-12345 -o backup.tar.gz
+  lhc download -v pvc-12345 -o backup.tar.gz.age --encrypt age:age1...
+  lhc download -v pvc-12345 -o backup.tar.gz --chunk-size 4Gi
+  lhc download -v pvc-12345 -o backup.tar.gz --resume
+  lhc download -v pvc-12345 -o backup.tar.zst --compress zstd --compress-level 3
+  lhc download -v pvc-a -v pvc-b -o backups/ --parallel 4
+  lhc download -l app=postgres -n production -o backups/
+  lhc download -v 'pvc-9a*' -o backups/
+  lhc download -v 'pvc-(9a|7f).*' --regex -o backups/ --yes`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			volumes := o.volumes
+			if o.volumesFile != "" {
+				list, err := longhorntools.ReadVolumeList(o.volumesFile)
+				if err != nil {
+					return fmt.Errorf("failed to read volume list: %v", err)
+				}
+				volumes = append(volumes, list...)
+			}
+			if len(volumes) == 0 && o.selector == "" {
+				return fmt.Errorf("-v (volume), --volumes-file, or --selector is required")
+			}
+			opts := o.downloadOptions()
+			if o.chunkSize != "" {
+				size, err := longhorntools.ParseChunkSize(o.chunkSize)
+				if err != nil {
+					return err
+				}
+				opts.ChunkSize = size
+			}
+			cmd.SilenceUsage = true
+
+			vm, ctx := o.volumeManager()
+			volumes, expanded := o.expandVolumes(ctx, vm, volumes)
+			if expanded {
+				o.confirmVolumes("Download", volumes)
+			}
+			if o.selector != "" {
+				for _, selected := range o.selectVolumes(ctx, vm) {
+					volumes = append(volumes, selected.Volume)
+				}
+			}
+			if len(volumes) > 1 || expanded || o.selector != "" || strings.HasSuffix(o.output, "/") {
+				// With several volumes (or a pattern, selector, or trailing
+				// slash), -o names a directory
+				results, err := vm.DownloadVolumes(ctx, volumes, o.namespace, o.output, o.storageClass, o.parallel, opts)
+				printBatchSummary(results)
+				if err != nil {
+					fatalf("Failed to download volumes: %v", err)
+				}
+				fmt.Printf("\nBatch download completed: %s\n", o.output)
+				return nil
+			}
+
+			if err := vm.DownloadVolume(ctx, volumes[0], o.namespace, o.output, o.storageClass, opts); err != nil {
+				fatalf("Failed to download volume: %v", err)
+			}
+			fmt.Printf("\nDownload completed: %s\n", o.output)
+			return nil
+		},
+	}
+	cmd.Flags().StringArrayVarP(&o.volumes, "volume", "v", nil, "Volume name, pvc:<namespace>/<name>, pv:<name>, or glob pattern (repeatable)")
+	cmd.Flags().BoolVar(&o.regex, "regex", false, "Treat -v values as regular expressions matched against Longhorn volume names")
+	cmd.Flags().StringVar(&o.volumesFile, "volumes-file", "", "File with volume names, one per line")
+	cmd.Flags().StringVarP(&o.selector, "selector", "l", "", "Also download volumes whose Longhorn volume or PVC labels match (e.g. app=postgres)")
+	cmd.Flags().StringVarP(&o.output, "output", "o", "", "Output file (or directory for several volumes)")
+	cmd.Flags().StringVar(&o.chunkSize, "chunk-size", "", "Split download into parts of this size (e.g. 4Gi)")
+	o.addDownloadFlags(cmd)
+	cmd.MarkFlagRequired("output")
+	cmd.RegisterFlagCompletionFunc("volume", completeVolumes)
+	return cmd
+}
+
+func (o *cliOptions) copyCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "copy",
+		Short: "Copy source volume to destination volume",
+		Long: `Copy replaces the contents of the destination volume with those of the
+source volume. It asks for confirmation first unless --yes is given.
+
+With --selector, every matching volume is copied onto the PVC of the same
+name in --dest-namespace, one pair at a time.
+
+A single tar pipe is limited by one exec stream. --streams N splits the
+source's top-level files and directories into N groups of about equal size
+and copies them over N tar pipes at once, which helps volumes with many
+large directories.`,
+		Example: `  lhc copy -s pvc-source -d pvc-dest
+  lhc copy -s pvc-source -d pvc-dest -c longhorn
+  lhc copy -s pvc-source -d pvc-dest --in-cluster
+  lhc copy -s pvc-source -d pvc-dest --lock-timeout 10m
+  lhc copy -s pvc-source -d pvc-dest --dry-run
+  lhc copy -s pvc-source -d pvc-dest --streams 4
+  lhc copy -l app=postgres -n staging --dest-namespace production`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if o.copyStreams < 1 || o.copyStreams > longhorntools.MaxCopyStreams {
+				fatalf("--streams must be between 1 and %d", longhorntools.MaxCopyStreams)
+			}
+			vm, ctx := o.volumeManager()
+			vm.CopyStreams = o.copyStreams
+			if o.selector != "" {
+				o.copySelected(ctx, vm)
+				return
+			}
+
+			o.source = o.resolveVolume(ctx, vm, o.source)
+			o.dest = o.resolveVolume(ctx, vm, o.dest)
+			o.confirmCopy(fmt.Sprintf("This deletes all existing data on volume %s before copying %s onto it. Continue?", o.dest, o.source))
+
+			if err := o.copyVolume(ctx, vm, o.source, o.dest); err != nil {
+				fatalf("Failed to copy volume: %v", err)
+			}
+			fmt.Printf("\nCopy completed: %s -> %s\n", o.source, o.dest)
+		},
+	}
+	cmd.Flags().StringVarP(&o.source, "source", "s", "", "Source volume, pvc:<namespace>/<name>, or pv:<name>")
+	cmd.Flags().StringVarP(&o.dest, "dest", "d", "", "Destination volume, pvc:<namespace>/<name>, or pv:<name>")
+	cmd.Flags().StringVarP(&o.selector, "selector", "l", "", "Copy every volume whose Longhorn volume or PVC labels match")
+	cmd.Flags().StringVar(&o.destNamespace, "dest-namespace", "", "With --selector, copy onto the PVCs of the same name in this namespace")
+	cmd.Flags().BoolVar(&o.inCluster, "in-cluster", false, "Run copy as a Kubernetes Job inside the cluster")
+	cmd.Flags().IntVar(&o.copyStreams, "streams", 1, "Number of tar pipes to copy over in parallel")
+	cmd.MarkFlagsRequiredTogether("source", "dest")
+	cmd.MarkFlagsMutuallyExclusive("streams", "in-cluster")
+	cmd.MarkFlagsRequiredTogether("selector", "dest-namespace")
+	cmd.MarkFlagsOneRequired("source", "selector")
+	cmd.MarkFlagsMutuallyExclusive("source", "selector")
+	cmd.RegisterFlagCompletionFunc("dest-namespace", completeNamespaces)
+	cmd.RegisterFlagCompletionFunc("source", completeVolumes)
+	cmd.RegisterFlagCompletionFunc("dest", completeVolumes)
+	return cmd
+}
+
+func (o *cliOptions) cpCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cp",
+		Short: "Copy a file or directory between volumes or to and from a volume",
+		Long: `Cp copies a single file or directory instead of a whole volume. Each side
+is either <volume>:<path>, with the path relative to the volume's root, or a
+local path. At least one side must be a volume; the volume may be given as a
+name, pvc:<namespace>/<name>, or pv:<name>.
+
+As with cp, a destination that is an existing directory, or ends in "/",
+receives the source inside it; otherwise the source is written under the
+destination's name, replacing a file of that name and merging into a
+directory. Volumes are read and written through the pod that mounts them,
+or a temporary pod if none does.`,
+		Example: `  lhc cp -s pvc-data:/config/app.yaml -d pvc-other:/config/
+  lhc cp -s pvc-data:/uploads -d ./uploads-backup
+  lhc cp -s ./seed.sql -d pvc:production/db:/docker-entrypoint-initdb.d/
+  lhc cp -s pvc-data:/ -d pvc-other:/restore --dry-run`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			vm, ctx := o.volumeManager()
+			src := longhorntools.ParseCopyEndpoint(o.source)
+			dest := longhorntools.ParseCopyEndpoint(o.dest)
+			if src.Volume == "" && dest.Volume == "" {
+				fatalf("At least one of -s and -d must be <volume>:<path>")
+			}
+			if src.Volume != "" {
+				src.Volume = o.resolveVolume(ctx, vm, src.Volume)
+			}
+			if dest.Volume != "" {
+				dest.Volume = o.resolveVolume(ctx, vm, dest.Volume)
+			}
+
+			if err := vm.CopyFiles(ctx, src, dest, o.namespace, o.storageClass); err != nil {
+				fatalf("Failed to copy: %v", err)
+			}
+			if !o.dryRun {
+				fmt.Printf("\nCopied %s -> %s\n", src, dest)
+			}
+		},
+	}
+	cmd.Flags().StringVarP(&o.source, "source", "s", "", "Source <volume>:<path> or local path")
+	cmd.Flags().StringVarP(&o.dest, "dest", "d", "", "Destination <volume>:<path> or local path")
+	cmd.MarkFlagRequired("source")
+	cmd.MarkFlagRequired("dest")
+	cmd.RegisterFlagCompletionFunc("source", completeCopyEndpoints)
+	cmd.RegisterFlagCompletionFunc("dest", completeCopyEndpoints)
+	return cmd
+}
+
+func (o *cliOptions) exportNFSCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "export-nfs",
+		Short: "Serve a volume over NFS for the duration of a migration",
+		Long: `Export-nfs mounts a volume in a temporary NFS server pod and prints the
+endpoints and a mount command, so systems outside Longhorn can read the data
+directly. The export stays up until interrupted with Ctrl+C or until its
+--ttl passes, then the pod and its PVC and PV are removed.
+
+The export is read-only unless --read-write is given. The server is reached
+through a Service, of type ClusterIP by default; use --service-type NodePort
+or LoadBalancer for clients outside the cluster, or --port-forward to mount
+it on this machine. --clients limits which hosts may mount it.
+
+The kernel NFS server needs a privileged pod, so this does not work with
+--security-profile restricted. No pod may use the volume's PVC.`,
+		Example: `  lhc export-nfs -v pvc-12345
+  lhc export-nfs -v pvc:production/media --service-type LoadBalancer --clients 10.20.0.0/16 --ttl 8h
+  lhc export-nfs -v pvc-12345 --port-forward 2049`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			serviceType := corev1.ServiceType(o.nfsService)
+			if err := longhorntools.ValidateServiceType(serviceType); err != nil {
+				fatalf("Invalid --service-type: %v", err)
+			}
+			vm, ctx := o.volumeManager()
+			volume := o.resolveVolume(ctx, vm, o.volume)
+			if o.nfsReadWrite && !o.dryRun {
+				ok, err := confirm(fmt.Sprintf("NFS clients will be able to modify volume %s. Continue?", volume), o.assumeYes)
+				if err != nil {
+					fatalf("Read-write export not confirmed: %v", err)
+				}
+				if !ok {
+					fmt.Println("Export cancelled.")
+					return
+				}
+			}
+
+			err := vm.ExportNFS(ctx, volume, o.namespace, o.storageClass, longhorntools.NFSExportOptions{
+				ReadWrite:   o.nfsReadWrite,
+				Clients:     o.nfsClients,
+				ServiceType: serviceType,
+				LocalPort:   o.nfsLocalPort,
+				Image:       o.image,
+			}, func(export *longhorntools.NFSExport) {
+				mode := "read-only"
+				if !export.ReadOnly {
+					mode = "read-write"
+				}
+				fmt.Printf("\nVolume %s is exported over NFS (%s) until %s.\n", volume, mode, export.Expires.Local().Format(time.RFC1123))
+				fmt.Println("Mount it with:")
+				for _, endpoint := range export.Endpoints {
+					fmt.Printf("  %s\n", export.MountCommand(endpoint))
+				}
+				fmt.Println("\nPress Ctrl+C to stop the export.")
+			})
+			if err != nil {
+				fatalf("Failed to export volume over NFS: %v", err)
+			}
+		},
+	}
+	cmd.Flags().StringVarP(&o.volume, "volume", "v", "", "Volume name, pvc:<namespace>/<name>, or pv:<name>")
+	cmd.Flags().BoolVar(&o.nfsReadWrite, "read-write", false, "Let NFS clients write to the volume")
+	cmd.Flags().StringVar(&o.nfsClients, "clients", "", "Hosts or network allowed to mount, e.g. 10.0.0.0/8 (default all)")
+	cmd.Flags().StringVar(&o.nfsService, "service-type", string(corev1.ServiceTypeClusterIP), "Service type of the NFS server: ClusterIP, NodePort, or LoadBalancer")
+	cmd.Flags().IntVar(&o.nfsLocalPort, "port-forward", 0, "Also forward this local port to the NFS server")
+	cmd.Flags().StringVar(&o.image, "image", longhorntools.DefaultNFSImage, "Image of the NFS server pod")
+	cmd.MarkFlagRequired("volume")
+	cmd.RegisterFlagCompletionFunc("volume", completeVolumes)
+	cmd.RegisterFlagCompletionFunc("service-type", cobra.FixedCompletions([]string{
+		string(corev1.ServiceTypeClusterIP), string(corev1.ServiceTypeNodePort), string(corev1.ServiceTypeLoadBalancer),
+	}, cobra.ShellCompDirectiveNoFileComp))
+	return cmd
+}
+
+func (o *cliOptions) mountCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "mount PATH",
+		Short: "Mount a volume on this machine over WebDAV",
+		Long: `Mount serves a volume over WebDAV from a temporary pod, forwards a local
+port to it, and mounts it at PATH, for quick edits without downloading and
+uploading the volume. The mount stays up until interrupted with Ctrl+C or
+until its --ttl passes; then it is unmounted and the pod and its PVC and PV
+are removed.
+
+The share is mounted with mount_webdav on macOS, and with rclone or, as
+root, davfs2 on Linux. With --no-mount, only the WebDAV URL is printed, to
+mount with any WebDAV client. No pod may use the volume's PVC.`,
+		Example: `  lhc mount -v pvc-12345 ./data
+  lhc mount -v pvc:production/config /mnt/config --read-only
+  lhc mount -v pvc-12345 --no-mount --port 8080`,
+		Args: cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) == 0 && !o.mountNoMount {
+				fatalf("A mount point is required unless --no-mount is given")
+			}
+			vm, ctx := o.volumeManager()
+			volume := o.resolveVolume(ctx, vm, o.volume)
+
+			err := vm.ServeWebDAV(ctx, volume, o.namespace, o.storageClass, longhorntools.WebDAVOptions{
+				ReadOnly:  o.mountReadOnly,
+				LocalPort: o.mountLocalPort,
+				Image:     o.image,
+			}, func(server *longhorntools.WebDAVServer) func() {
+				mode := "read-only"
+				if !server.ReadOnly {
+					mode = "read-write"
+				}
+				if o.mountNoMount {
+					fmt.Printf("\nVolume %s is served over WebDAV (%s) at %s until %s.\n", volume, mode, server.URL, server.Expires.Local().Format(time.RFC1123))
+					fmt.Println("\nPress Ctrl+C to stop the server.")
+					return nil
+				}
+				mount, err := mountWebDAV(server.URL, args[0], server.ReadOnly)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Failed to mount %s: %v\n", args[0], err)
+					fmt.Printf("\nVolume %s is served over WebDAV (%s) at %s; mount it yourself or press Ctrl+C to stop.\n", volume, mode, server.URL)
+					return nil
+				}
+				onInterrupt(mount.Unmount)
+				fmt.Printf("\nVolume %s is mounted at %s (%s) until %s.\n", volume, args[0], mode, server.Expires.Local().Format(time.RFC1123))
+				fmt.Println("\nPress Ctrl+C to unmount it.")
+				return mount.Unmount
+			})
+			if err != nil {
+				fatalf("Failed to mount volume: %v", err)
+			}
+		},
+	}
+	cmd.Flags().StringVarP(&o.volume, "volume", "v", "", "Volume name, pvc:<namespace>/<name>, or pv:<name>")
+	cmd.Flags().BoolVar(&o.mountReadOnly, "read-only", false, "Serve the volume without write access")
+	cmd.Flags().IntVar(&o.mountLocalPort, "port", 0, "Local port to forward to the WebDAV server (default any free port)")
+	cmd.Flags().BoolVar(&o.mountNoMount, "no-mount", false, "Only print the WebDAV URL instead of mounting it")
+	cmd.Flags().StringVar(&o.image, "image", longhorntools.DefaultWebDAVImage, "Image of the WebDAV server pod")
+	cmd.MarkFlagRequired("volume")
+	cmd.RegisterFlagCompletionFunc("volume", completeVolumes)
+	return cmd
+}
+
+func (o *cliOptions) importCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "import",
+		Short: "Copy a non-Longhorn PVC into a new Longhorn volume",
+		Long: `Import moves data onto Longhorn. It takes an existing PVC on any other
+storage (hostPath, NFS, another CSI driver), creates a PVC of the same size
+and access modes from the Longhorn storage class (-c), and streams the data
+across. The new PVC is named after the source with a "-longhorn" suffix
+unless -d is given; point the workload at it once the import completes.
+
+The source is read through the pod mounting it if it is in use. Scale the
+workload down first for a consistent copy.`,
+		Example: `  lhc import -s legacy-uploads
+  lhc import -s nfs-data -d data -n production -c longhorn-ssd`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			dest := o.dest
+			if dest == "" {
+				dest = o.source + "-longhorn"
+			}
+			vm, ctx := o.volumeManager()
+			volume, err := vm.ImportPVC(ctx, o.namespace, o.source, dest, o.storageClass)
+			if err != nil {
+				fatalf("Failed to import PVC: %v", err)
+			}
+			if !o.dryRun {
+				fmt.Printf("\nImport completed: PVC %s/%s is now on Longhorn volume %s\n", o.namespace, dest, volume)
+			}
+		},
+	}
+	cmd.Flags().StringVarP(&o.source, "source", "s", "", "PVC to import, in the -n namespace")
+	cmd.Flags().StringVarP(&o.dest, "dest", "d", "", "Name of the new Longhorn PVC (default <source>-longhorn)")
+	cmd.MarkFlagRequired("source")
+	return cmd
+}
+
+func (o *cliOptions) migrateSCCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "migrate-sc",
+		Short: "Move a volume to a different Longhorn storage class",
+		Long: `Migrate-sc changes parameters of a volume that cannot be edited in place,
+such as its replica count default, data locality, or encryption, by copying
+it into a new volume provisioned from another Longhorn storage class. The
+new volume gets a PVC of the same size and access modes next to the old
+one, named <pvc>-<storage-class> unless -d is given.
+
+With --rebind the volume's PVC is then recreated on the new volume under
+its own name, so workloads need no changes. This deletes and recreates the
+PVC, so it asks for confirmation, and no pod may use the PVC. Both
+PersistentVolumes are set to Retain first; the old volume is kept until you
+delete it.`,
+		Example: `  lhc migrate-sc -v pvc-12345 --to longhorn-encrypted
+  lhc migrate-sc -v pvc:production/postgres-data --to longhorn-2-replicas --rebind`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			vm, ctx := o.volumeManager()
+			volume := o.resolveVolume(ctx, vm, o.volume)
+			if o.rebind && !o.dryRun {
+				ok, err := confirm(fmt.Sprintf("Rebinding deletes and recreates the PVC of volume %s. Continue?", volume), o.assumeYes)
+				if err != nil {
+					fatalf("Migration not confirmed: %v", err)
+				}
+				if !ok {
+					fmt.Println("Migration cancelled.")
+					return
+				}
+			}
+
+			opts := longhorntools.MigrateOptions{Rebind: o.rebind, DestPVC: o.dest}
+			result, err := vm.MigrateStorageClass(ctx, volume, o.toStorageClass, opts)
+			if err != nil {
+				fatalf("Failed to migrate volume: %v", err)
+			}
+			if o.dryRun {
+				return
+			}
+			fmt.Printf("\nMigration completed: PVC %s/%s is on volume %s (storage class %s)\n",
+				result.Namespace, result.DestPVC, result.DestVolume, o.toStorageClass)
+			if result.Rebound {
+				fmt.Printf("The old volume %s is retained on PV %s; delete it once the workload runs on the new volume.\n",
+					result.SourceVolume, result.OldPV)
+			} else {
+				fmt.Printf("Point the workload at PVC %s, or run again with --rebind to keep the name %s.\n", result.DestPVC, result.SourcePVC)
+			}
+		},
+	}
+	cmd.Flags().StringVarP(&o.volume, "volume", "v", "", "Volume name, pvc:<namespace>/<name>, or pv:<name>")
+	cmd.Flags().StringVar(&o.toStorageClass, "to", "", "Longhorn storage class of the new volume")
+	cmd.Flags().StringVarP(&o.dest, "dest", "d", "", "Name of the new PVC (default <pvc>-<storage-class>)")
+	cmd.Flags().BoolVar(&o.rebind, "rebind", false, "Recreate the volume's PVC on the new volume, keeping its name")
+	cmd.MarkFlagRequired("volume")
+	cmd.MarkFlagRequired("to")
+	cmd.MarkFlagsMutuallyExclusive("dest", "rebind")
+	cmd.RegisterFlagCompletionFunc("volume", completeVolumes)
+	cmd.RegisterFlagCompletionFunc("to", completeStorageClasses)
+	return cmd
+}
+
+func (o *cliOptions) renameCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "rename",
+		Short: "Give a volume a new name by cloning it",
+		Long: `Longhorn cannot rename a volume in place. Rename creates a volume with the
+new name and the settings and labels of the old one, copies the data, and
+compares checksums of every file on both sides. It then creates a PV for
+the new volume and recreates the old volume's PVC on it under the same
+name, so workloads need no changes. No pod may use the PVC meanwhile.
+
+The old volume is kept, with its PV set to Retain, until you delete it;
+--delete-old deletes it once the copy is verified and the PVC moved.`,
+		Example: `  lhc rename -s pvc-0f1e2d3c-4b5a -d postgres-data
+  lhc rename -s pvc:production/postgres-data -d postgres-data --delete-old`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			vm, ctx := o.volumeManager()
+			source := o.resolveVolume(ctx, vm, o.source)
+			if !o.dryRun {
+				question := fmt.Sprintf("Rename volume %s to %s, recreating its PV and PVC?", source, o.dest)
+				if o.deleteOld {
+					question = fmt.Sprintf("Rename volume %s to %s, recreating its PV and PVC and deleting %s afterwards?", source, o.dest, source)
+				}
+				ok, err := confirm(question, o.assumeYes)
+				if err != nil {
+					fatalf("Rename not confirmed: %v", err)
+				}
+				if !ok {
+					fmt.Println("Aborted.")
+					return
+				}
+			}
+
+			result, err := vm.RenameVolume(ctx, source, o.dest, longhorntools.RenameOptions{
+				DeleteOld:    o.deleteOld,
+				Namespace:    o.namespace,
+				StorageClass: o.storageClass,
+			})
+			if err != nil {
+				fatalf("Failed to rename volume: %v", err)
+			}
+			if o.dryRun {
+				return
+			}
+			fmt.Printf("\nRename completed: %s is now %s (%d file(s) verified)\n", source, result.NewVolume, result.Files)
+			if result.PVC != "" {
+				fmt.Printf("PVC %s is bound to PV %s\n", result.PVC, result.PV)
+			}
+			if !result.OldDeleted {
+				fmt.Printf("The old volume %s is kept; delete it with: lhc delete -v %s\n", source, source)
+			}
+		},
+	}
+	cmd.Flags().StringVarP(&o.source, "source", "s", "", "Volume to rename: name, pvc:<namespace>/<name>, or pv:<name>")
+	cmd.Flags().StringVarP(&o.dest, "dest", "d", "", "New volume name")
+	cmd.Flags().BoolVar(&o.deleteOld, "delete-old", false, "Delete the old volume and its PV once the copy is verified")
+	cmd.MarkFlagRequired("source")
+	cmd.MarkFlagRequired("dest")
+	cmd.RegisterFlagCompletionFunc("source", completeVolumes)
+	return cmd
+}
+
+func (o *cliOptions) cleanupCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cleanup",
+		Short: "Clean up temporary resources (lhc-temp-* prefixed)",
+		Example: `  lhc cleanup -n default
+  lhc cleanup -n default --yes
+  lhc cleanup -n production -l app=postgres`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			vm, ctx := o.volumeManager()
+			var volumes []string
+			if o.selector != "" {
+				for _, selected := range o.selectVolumes(ctx, vm) {
+					volumes = append(volumes, selected.Volume)
+				}
+			}
+			if err := cleanupTemporaryResources(ctx, vm, o.namespace, volumes, o.assumeYes); err != nil {
+				fatalf("Failed to cleanup temporary resources: %v", err)
+			}
+		},
+	}
+	cmd.Flags().StringVarP(&o.selector, "selector", "l", "", "Only clean up resources for volumes whose Longhorn volume or PVC labels match")
+	return cmd
+}
+
+func (o *cliOptions) deleteCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "delete",
+		Short: "Delete a volume together with its PVC and PV",
+		Long: `Delete removes a Longhorn volume, its PVC, and its PV, and with them the
+volume's data. It refuses while a pod mounts the PVC or the volume is
+attached, and lists the workloads that still use it.
+
+--backup takes a final snapshot and backs it up to the backup target, and
+--download saves the volume as a tar archive, before anything is deleted.
+If either fails, nothing is deleted. Deletion always asks for confirmation
+unless --yes is given.`,
+		Example: `  lhc delete -v pvc-12345
+  lhc delete -v pvc:staging/scratch --download scratch-final.tar.gz
+  lhc delete -v pvc-12345 --backup --target s3-offsite --yes`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			vm, ctx := o.volumeManager()
+			volume := o.resolveVolume(ctx, vm, o.volume)
+			info, err := vm.Volume(ctx, volume)
+			if err != nil {
+				fatalf("Failed to get volume: %v", err)
+			}
+
+			fmt.Printf("Volume: %s (%s, %s)\n", info.Name, formatVolumeSize(info.Size), info.State)
+			if info.PVCName != "" {
+				fmt.Printf("PVC: %s/%s\n", info.PVCNamespace, info.PVCName)
+			}
+			if info.PVName != "" {
+				fmt.Printf("PV: %s\n", info.PVName)
+			}
+			fmt.Println()
+			if !o.dryRun {
+				ok, err := confirm(fmt.Sprintf("Delete volume %s and all of its data?", volume), o.assumeYes)
+				if err != nil {
+					fatalf("Delete not confirmed: %v", err)
+				}
+				if !ok {
+					fmt.Println("Aborted.")
+					return
+				}
+			}
+
+			opts := longhorntools.DeleteVolumeOptions{
+				Backup:       o.finalBackup,
+				BackupTarget: o.backupTarget,
+				DownloadTo:   o.downloadTo,
+				Download:     o.downloadOptions(),
+				Namespace:    o.namespace,
+				StorageClass: o.storageClass,
+			}
+			if err := vm.DeleteVolume(ctx, volume, opts); err != nil {
+				fatalf("Failed to delete volume: %v", err)
+			}
+			fmt.Printf("\nDeleted volume %s\n", volume)
+		},
+	}
+	cmd.Flags().StringVarP(&o.volume, "volume", "v", "", "Volume name, pvc:<namespace>/<name>, or pv:<name>")
+	cmd.Flags().BoolVar(&o.finalBackup, "backup", false, "Back up a final snapshot of the volume before deleting it")
+	cmd.Flags().StringVar(&o.backupTarget, "target", "", "Backup target for --backup (default Longhorn's default target)")
+	cmd.Flags().StringVar(&o.downloadTo, "download", "", "Download the volume to this file before deleting it")
+	cmd.Flags().StringVar(&o.encrypt, "encrypt", "", "Encrypt the download (age:<recipient> or gpg:<keyid>)")
+	cmd.Flags().StringVar(&o.compress, "compress", longhorntools.CompressGzip, "Download compression: none, gzip, zstd, xz")
+	cmd.Flags().IntVar(&o.compressLvl, "compress-level", 0, "Compression level (0 selects the default)")
+	cmd.MarkFlagRequired("volume")
+	cmd.RegisterFlagCompletionFunc("volume", completeVolumes)
+	return cmd
+}
+
+func (o *cliOptions) orphansCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "orphans",
+		Short: "Find unreferenced Longhorn volumes, stale PVs, and orphaned replica data",
+		Long: `Orphans reports Longhorn volumes with no bound PV or PVC, Longhorn PVs whose
+volume no longer exists, and Longhorn Orphan resources (replica data left on a
+disk). With --cleanup, each finding is offered for deletion in turn.
+Deleting a volume or orphan deletes its data.`,
+		Example: `  lhc orphans
+  lhc orphans --cleanup`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			vm, ctx := o.volumeManager()
+			report, err := vm.FindOrphans(ctx)
+			if err != nil {
+				fatalf("Failed to find orphans: %v", err)
+			}
+			if report.Total() == 0 {
+				fmt.Println("No orphans found.")
+				return
+			}
+
+			if len(report.UnboundVolumes) > 0 {
+				fmt.Println("Longhorn volumes without a bound PV/PVC:")
+				for _, v := range report.UnboundVolumes {
+					fmt.Printf("  - %s (%s, %s, PV %s)\n", v.Name, v.State, formatVolumeSize(v.Size), orDash(v.PVName))
+				}
+				fmt.Println()
+			}
+			if len(report.StalePVs) > 0 {
+				fmt.Println("PersistentVolumes whose Longhorn volume is gone:")
+				for _, pv := range report.StalePVs {
+					fmt.Printf("  - %s (%s, volume %s, claim %s)\n", pv.Name, pv.Phase, pv.Volume, orDash(pv.Claim))
+				}
+				fmt.Println()
+			}
+			if len(report.OrphanData) > 0 {
+				fmt.Println("Orphaned replica data:")
+				for _, orphan := range report.OrphanData {
+					fmt.Printf("  - %s (%s data on %s:%s)\n", orphan.Name, orphan.Type, orphan.Node, path.Join(orphan.DiskPath, "replicas", orphan.DataName))
+				}
+				fmt.Println()
+			}
+			fmt.Printf("Found %d orphan(s).\n", report.Total())
+
+			if !o.orphanCleanup {
+				return
+			}
+			fmt.Println()
+			ask := func(question string) bool {
+				if o.dryRun {
+					return true
+				}
+				ok, err := confirm(question, o.assumeYes)
+				if err != nil {
+					fatalf("Cleanup not confirmed: %v", err)
+				}
+				return ok
+			}
+			failed := 0
+			remove := func(err error) {
+				if err != nil {
+					fmt.Printf("  %v\n", err)
+					failed++
+				}
+			}
+			for _, v := range report.UnboundVolumes {
+				if ask(fmt.Sprintf("Delete Longhorn volume %s and its data?", v.Name)) {
+					remove(vm.DeleteLonghornVolume(ctx, v.Name))
+				}
+			}
+			for _, pv := range report.StalePVs {
+				if ask(fmt.Sprintf("Delete PersistentVolume %s?", pv.Name)) {
+					remove(vm.DeletePV(ctx, pv.Name))
+				}
+			}
+			for _, orphan := range report.OrphanData {
+				if ask(fmt.Sprintf("Delete orphaned data %s on %s?", orphan.DataName, orphan.Node)) {
+					remove(vm.DeleteOrphanData(ctx, orphan.Name))
+				}
+			}
+			if failed > 0 {
+				fatalf("Failed to delete %d orphan(s)", failed)
+			}
+			fmt.Println("\nCleanup completed.")
+		},
+	}
+	cmd.Flags().BoolVar(&o.orphanCleanup, "cleanup", false, "Offer each finding for deletion")
+	return cmd
+}
+
+func (o *cliOptions) replicaCleanupCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "replica-cleanup",
+		Short: "Delete failed, errored, and stranded replicas",
+		Long: `Replica-cleanup finds the replicas of a volume, or of every volume without
+-v, that have failed, are in an error state or ERR mode, or sit on a node
+Longhorn no longer has. It lists them and, once confirmed, deletes them;
+Longhorn rebuilds replacements where a volume is short of replicas.
+
+A volume's stale replicas are kept while it has fewer than --min-healthy
+healthy replicas, since a faulted volume can only be salvaged from them.
+Use --dry-run to see the deletions without making them.`,
+		Example: `  lhc replica-cleanup
+  lhc replica-cleanup -v pvc-12345 --yes
+  lhc replica-cleanup --min-healthy 2 --dry-run`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if o.minHealthy < 0 {
+				fatalf("--min-healthy cannot be negative")
+			}
+			vm, ctx := o.volumeManager()
+			volume := ""
+			if o.volume != "" {
+				volume = o.resolveVolume(ctx, vm, o.volume)
+			}
+			stale, err := vm.FindStaleReplicas(ctx, volume, o.minHealthy)
+			if err != nil {
+				fatalf("Failed to find stale replicas: %v", err)
+			}
+			if len(stale) == 0 {
+				fmt.Println("No stale replicas found.")
+				return
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "VOLUME\tREPLICA\tNODE\tSTATE\tMODE\tREASON\tACTION")
+			var remove []longhorntools.StaleReplica
+			for _, r := range stale {
+				action := "delete"
+				if r.Keep != "" {
+					action = "keep: " + r.Keep
+				} else {
+					remove = append(remove, r)
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", r.Volume, r.Name, orDash(r.Node), orDash(r.State), orDash(r.Mode),
+					strings.Join(r.Reasons, ", "), action)
+			}
+			w.Flush()
+			fmt.Printf("\n%d stale replica(s), %d to delete.\n", len(stale), len(remove))
+			if len(remove) == 0 {
+				return
+			}
+
+			if !o.dryRun {
+				ok, err := confirm(fmt.Sprintf("Delete %d replica(s) and their data?", len(remove)), o.assumeYes)
+				if err != nil {
+					fatalf("Cleanup not confirmed: %v", err)
+				}
+				if !ok {
+					fmt.Println("Aborted.")
+					return
+				}
+			}
+			failed := 0
+			for _, r := range remove {
+				if err := vm.DeleteReplica(ctx, r.Volume, r.Name, r.Reasons); err != nil {
+					fmt.Printf("  %v\n", err)
+					failed++
+					continue
+				}
+				if !o.dryRun {
+					fmt.Printf("Deleted replica %s of %s\n", r.Name, r.Volume)
+				}
+			}
+			if failed > 0 {
+				fatalf("Failed to delete %d of %d replica(s)", failed, len(remove))
+			}
+		},
+	}
+	cmd.Flags().StringVarP(&o.volume, "volume", "v", "", "Volume name, pvc:<namespace>/<name>, or pv:<name> (default all volumes)")
+	cmd.Flags().IntVar(&o.minHealthy, "min-healthy", longhorntools.DefaultMinHealthyReplicas, "Keep a volume's stale replicas while it has fewer healthy replicas than this")
+	cmd.RegisterFlagCompletionFunc("volume", completeVolumes)
+	return cmd
+}
+
+func (o *cliOptions) reapCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "reap",
+		Short: "Delete temporary resources whose TTL has expired",
+		Example: `  lhc reap --all-namespaces
+  lhc reap -n default --reap-interval 10m`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			vm, ctx := o.volumeManager()
+			namespace := o.namespace
+			if o.allNamespaces {
+				namespace = ""
+			}
+			if o.reapInterval > 0 {
+				vm.ReapLoop(ctx, namespace, o.reapInterval)
+			} else if err := vm.ReapExpiredResources(ctx, namespace); err != nil {
+				fatalf("Failed to reap temporary resources: %v", err)
+			}
+		},
+	}
+	cmd.Flags().BoolVarP(&o.allNamespaces, "all-namespaces", "A", false, "Reap temporary resources in every namespace")
+	cmd.Flags().DurationVar(&o.reapInterval, "reap-interval", 0, "Keep reaping at this interval instead of once")
+	return cmd
+}
+
+func (o *cliOptions) backupAllCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "backup-all",
+		Short:   "Download every Longhorn-backed PVC in a namespace into a bundle",
+		Example: `  lhc backup-all -n production -o bundle/ --parallel 4`,
+		Args:    cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			vm, ctx := o.volumeManager()
+			results, err := vm.BackupNamespace(ctx, o.namespace, o.output, o.storageClass, o.parallel, o.downloadOptions())
+			printBatchSummary(results)
+			if err != nil {
+				fatalf("Failed to back up namespace: %v", err)
+			}
+			fmt.Printf("\nBackup completed: %s\n", o.output)
+		},
+	}
+	cmd.Flags().StringVarP(&o.output, "output", "o", "", "Output directory for the bundle")
+	o.addDownloadFlags(cmd)
+	cmd.MarkFlagRequired("output")
+	return cmd
+}
+
+func (o *cliOptions) restoreAllCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "restore-all",
+		Short:   "Recreate PVCs and upload data from a backup bundle",
+		Example: `  lhc restore-all -i bundle/ -n production-restore`,
+		Args:    cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			vm, ctx := o.volumeManager()
+			results, err := vm.RestoreNamespace(ctx, o.input, o.namespace, o.storageClass)
+			printBatchSummary(results)
+			if err != nil {
+				fatalf("Failed to restore bundle: %v", err)
+			}
+			fmt.Printf("\nRestore completed into namespace %s\n", o.namespace)
+		},
+	}
+	cmd.Flags().StringVarP(&o.input, "input", "i", "", "Bundle directory written by backup-all")
+	cmd.MarkFlagRequired("input")
+	cmd.MarkFlagDirname("input")
+	return cmd
+}
+
+// imageArgs passes the image registry, overrides, and pull secrets on to
+// scheduled runs, so the pods they start come from the same registry.
+func (o *cliOptions) imageArgs() []string {
+	var args []string
+	if o.imageRegistry != "" {
+		args = append(args, "--image-registry", o.imageRegistry)
+	}
+	for _, override := range o.imageOverrides {
+		args = append(args, "--image-override", override)
+	}
+	for _, secret := range o.pullSecrets {
+		args = append(args, "--image-pull-secret", secret)
+	}
+	return args
+}
+
+func (o *cliOptions) scheduleCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "schedule [-- extra lhc flags]",
+		Short: "Generate (or --apply) a CronJob that runs download/copy in-cluster",
+		Long: `Schedule renders a ServiceAccount, RBAC, and a CronJob that run lhc inside
+the cluster. Arguments after "--" are passed on to the scheduled lhc run.
+
+The --image is pulled through --image-registry and --image-override like
+the helper images, with the --image-pull-secret secrets. All three are also
+passed on to the scheduled run for the pods it starts.`,
+		Example: `  lhc schedule -v pvc-12345 --target-pvc backups --schedule '0 2 * * *' --image registry/lhc:v1
+  lhc schedule --action copy -s pvc-a -d pvc-b --schedule '@hourly' --image registry/lhc:v1 --apply
+  lhc schedule -v pvc-12345 --target-pvc backups --schedule '@daily' --image registry/lhc:v1 -- --compress zstd`,
+		Run: func(cmd *cobra.Command, args []string) {
+			overrides, err := longhorntools.ParseImageOverrides(o.imageOverrides)
+			if err != nil {
+				fatalf("Invalid --image-override: %v", err)
+			}
+			opts := longhorntools.ScheduleOptions{
+				Name:             o.name,
+				Schedule:         o.cronSchedule,
+				Image:            longhorntools.ResolveImage(o.image, o.imageRegistry, overrides),
+				Action:           o.action,
+				Volumes:          o.volumes,
+				TargetPVC:        o.targetPVC,
+				Source:           o.source,
+				Dest:             o.dest,
+				ExtraArgs:        append(o.imageArgs(), args...),
+				ImagePullSecrets: o.pullSecrets,
+			}
+			if opts.Name == "" {
+				opts.Name = "lhc-" + opts.Action
+			}
+
+			if o.apply {
+				// Rendering manifests is purely local; only --apply needs the cluster
+				vm, ctx := o.volumeManager()
+				if err := vm.ApplySchedule(ctx, o.namespace, o.storageClass, opts); err != nil {
+					fatalf("Failed to apply schedule: %v", err)
+				}
+				fmt.Printf("\nSchedule %s applied in namespace %s\n", opts.Name, o.namespace)
+				return
+			}
+
+			out := io.Writer(os.Stdout)
+			if o.output != "" {
+				f, err := os.Create(o.output)
+				if err != nil {
+					fatalf("Failed to create output file: %v", err)
+				}
+				defer f.Close()
+				out = f
+			}
+			if err := longhorntools.WriteScheduleManifests(out, o.namespace, o.storageClass, opts); err != nil {
+				fatalf("Failed to generate schedule: %v", err)
+			}
+		},
+	}
+	cmd.Flags().StringVar(&o.cronSchedule, "schedule", "", "Cron expression")
+	cmd.Flags().StringVar(&o.image, "image", "", "Container image with the lhc binary")
+	cmd.Flags().StringVar(&o.action, "action", "download", "Scheduled action: download or copy")
+	cmd.Flags().StringVar(&o.targetPVC, "target-pvc", "", "PVC that receives scheduled downloads")
+	cmd.Flags().StringVar(&o.name, "name", "", "Name for the generated CronJob and RBAC (default lhc-<action>)")
+	cmd.Flags().BoolVar(&o.apply, "apply", false, "Create the schedule in the cluster instead of printing YAML")
+	cmd.Flags().StringArrayVarP(&o.volumes, "volume", "v", nil, "Volume to download (repeatable)")
+	cmd.Flags().StringVarP(&o.source, "source", "s", "", "Source volume for copy schedules")
+	cmd.Flags().StringVarP(&o.dest, "dest", "d", "", "Destination volume for copy schedules")
+	cmd.Flags().StringVarP(&o.output, "output", "o", "", "Write the manifests to this file instead of stdout")
+	cmd.RegisterFlagCompletionFunc("action", cobra.FixedCompletions([]string{"download", "copy"}, cobra.ShellCompDirectiveNoFileComp))
+	cmd.RegisterFlagCompletionFunc("volume", completeVolumes)
+	cmd.RegisterFlagCompletionFunc("source", completeVolumes)
+	cmd.RegisterFlagCompletionFunc("dest", completeVolumes)
+	return cmd
+}
+
+func (o *cliOptions) veleroExportCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "velero-export",
+		Short: "Generate (or --apply) a Velero Backup of selected volumes",
+		Long: `Velero-export hands the volumes selected with -v or --selector to Velero. It
+labels their PVCs with lhc.longhorn.io/velero-export=<name> and renders a
+Velero Backup, or with --schedule a Velero Schedule, that selects exactly
+those claims and the PersistentVolumes bound to them.
+
+By default Velero takes CSI snapshots of the volumes, which needs a
+VolumeSnapshotClass for Longhorn; add --snapshot-move-data to upload the
+snapshot data to Velero's storage location. --fs-backup uses Velero's
+file-system backup instead, which reads the files through the running pods
+mounting each claim, so those pods are labeled too.
+
+The manifest is printed as YAML (or written to -o <file>) for review or
+GitOps; --apply creates it. The labels stay on the claims, so a Schedule
+keeps matching them.`,
+		Example: `  lhc velero-export -v pvc-12345 --name postgres-data
+  lhc velero-export -l app=postgres -n production --name postgres --apply
+  lhc velero-export -v 'pvc-db-*' --name nightly-db --schedule '0 1 * * *' --backup-ttl 168h --snapshot-move-data --apply
+  lhc velero-export -v pvc:production/uploads --name uploads --fs-backup -o uploads-backup.yaml`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			vm, ctx := o.volumeManager()
+			volumes, _ := o.expandVolumes(ctx, vm, o.volumes)
+			if o.selector != "" {
+				for _, selected := range o.selectVolumes(ctx, vm) {
+					volumes = append(volumes, selected.Volume)
+				}
+			}
+			if len(volumes) == 0 {
+				fatalf("No volumes selected (use -v or --selector)")
+			}
+
+			opts := longhorntools.VeleroExportOptions{
+				Name:             o.name,
+				Namespace:        o.veleroNamespace,
+				Schedule:         o.cronSchedule,
+				StorageLocation:  o.storageLocation,
+				TTL:              o.backupTTL,
+				FSBackup:         o.fsBackup,
+				SnapshotMoveData: o.moveData,
+			}
+			if opts.Name == "" {
+				opts.Name = "lhc-" + time.Now().Format("20060102-150405")
+			}
+			claims, err := vm.VeleroClaims(ctx, volumes, o.fsBackup)
+			if err != nil {
+				fatalf("Failed to find the claims to export: %v", err)
+			}
+
+			if o.apply {
+				if err := vm.ApplyVeleroExport(ctx, claims, opts); err != nil {
+					fatalf("Failed to apply Velero export: %v", err)
+				}
+				return
+			}
+
+			// Render first so invalid options fail before anything is labeled
+			out := io.Writer(os.Stdout)
+			if o.output != "" {
+				f, err := os.Create(o.output)
+				if err != nil {
+					fatalf("Failed to create output file: %v", err)
+				}
+				defer f.Close()
+				out = f
+			}
+			if err := longhorntools.WriteVeleroExport(out, claims, opts); err != nil {
+				fatalf("Failed to generate Velero export: %v", err)
+			}
+			if err := vm.LabelVeleroClaims(ctx, claims, opts.Name); err != nil {
+				fatalf("Failed to label claims: %v", err)
+			}
+		},
+	}
+	cmd.Flags().StringArrayVarP(&o.volumes, "volume", "v", nil, "Volume name, pvc:<namespace>/<name>, pv:<name>, or glob pattern (repeatable)")
+	cmd.Flags().BoolVar(&o.regex, "regex", false, "Treat -v values as regular expressions matched against Longhorn volume names")
+	cmd.Flags().StringVarP(&o.selector, "selector", "l", "", "Also export volumes whose Longhorn volume or PVC labels match (e.g. app=postgres)")
+	cmd.Flags().StringVar(&o.name, "name", "", "Name of the Velero Backup or Schedule and value of the claim label (default lhc-<timestamp>)")
+	cmd.Flags().StringVar(&o.veleroNamespace, "velero-namespace", longhorntools.DefaultVeleroNamespace, "Namespace Velero is installed in")
+	cmd.Flags().StringVar(&o.cronSchedule, "schedule", "", "Cron expression; generates a Velero Schedule instead of a Backup")
+	cmd.Flags().StringVar(&o.storageLocation, "storage-location", "", "Velero BackupStorageLocation (default Velero's default)")
+	cmd.Flags().DurationVar(&o.backupTTL, "backup-ttl", 0, "How long Velero keeps the backup (default Velero's default, 720h)")
+	cmd.Flags().BoolVar(&o.fsBackup, "fs-backup", false, "Use Velero file-system backup through the pods mounting the claims instead of CSI snapshots")
+	cmd.Flags().BoolVar(&o.moveData, "snapshot-move-data", false, "Upload CSI snapshot data to the backup storage location")
+	cmd.Flags().BoolVar(&o.apply, "apply", false, "Create the Velero resource in the cluster instead of printing YAML")
+	cmd.Flags().StringVarP(&o.output, "output", "o", "", "Write the manifest to this file instead of stdout")
+	cmd.MarkFlagsMutuallyExclusive("apply", "output")
+	cmd.MarkFlagsMutuallyExclusive("fs-backup", "snapshot-move-data")
+	cmd.RegisterFlagCompletionFunc("volume", completeVolumes)
+	return cmd
+}
+
+func (o *cliOptions) recurringJobCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "recurring-job",
+		Aliases: []string{"recurring-jobs"},
+		Short:   "List, create, and assign Longhorn recurring jobs",
+		Long: `Recurring-job manages Longhorn's RecurringJobs, the snapshot and backup
+schedules Longhorn runs itself, and which volumes they apply to. A volume
+opts into a job, or a group of jobs, with a label; a volume without any such
+label belongs to the "default" group.`,
+		Args: cobra.NoArgs,
+	}
+	cmd.AddCommand(
+		o.recurringJobListCommand(),
+		o.recurringJobCreateCommand(),
+		o.recurringJobAssignCommand(),
+	)
+	return cmd
+}
+
+func (o *cliOptions) recurringJobListCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List recurring jobs and the volumes they apply to",
+		Long: `List shows every recurring job with its task, schedule, retention, groups,
+and the number of volumes it applies to. With -v it shows the jobs and
+groups one volume has opted into instead.`,
+		Example: `  lhc recurring-job list
+  lhc recurring-job list -v pvc-12345`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			vm, ctx := o.volumeManager()
+			jobs, err := vm.RecurringJobs(ctx)
+			if err != nil {
+				fatalf("Failed to list recurring jobs: %v", err)
+			}
+
+			if o.volume != "" {
+				volume := o.resolveVolume(ctx, vm, o.volume)
+				jobNames, groups, err := vm.VolumeRecurringJobs(ctx, volume)
+				if err != nil {
+					fatalf("Failed to read recurring jobs of %s: %v", volume, err)
+				}
+				fmt.Printf("Volume %s\n", volume)
+				fmt.Printf("  Jobs:   %s\n", orDash(strings.Join(jobNames, ", ")))
+				fmt.Printf("  Groups: %s\n\n", orDash(strings.Join(groups, ", ")))
+				var applied []longhorntools.RecurringJob
+				for _, job := range jobs {
+					if slices.Contains(job.Volumes, volume) {
+						applied = append(applied, job)
+					}
+				}
+				jobs = applied
+			}
+			if len(jobs) == 0 {
+				fmt.Println("No recurring jobs apply.")
+				return
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "NAME\tTASK\tCRON\tRETAIN\tCONCURRENCY\tGROUPS\tVOLUMES")
+			for _, job := range jobs {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%s\t%d\n", job.Name, job.Task, job.Cron, job.Retain, job.Concurrency,
+					orDash(strings.Join(job.Groups, ",")), len(job.Volumes))
+			}
+			w.Flush()
+		},
+	}
+	cmd.Flags().StringVarP(&o.volume, "volume", "v", "", "Only show the jobs that apply to this volume")
+	cmd.RegisterFlagCompletionFunc("volume", completeVolumes)
+	return cmd
+}
+
+func (o *cliOptions) recurringJobCreateCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "create NAME",
+		Short: "Create a recurring snapshot or backup job",
+		Long: `Create adds a Longhorn RecurringJob. Put it in the "default" group to apply
+it to every volume without recurring job labels, or in another group and
+assign volumes to that group.`,
+		Example: `  lhc recurring-job create nightly-backup --task backup --cron '0 2 * * *' --retain 7
+  lhc recurring-job create hourly-snap --task snapshot --cron '@hourly' --retain 24 --group default
+  lhc recurring-job create weekly-trim --task filesystem-trim --cron '0 4 * * 0' --group databases`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			job := longhorntools.RecurringJob{
+				Name:        args[0],
+				Task:        o.jobTask,
+				Cron:        o.cronSchedule,
+				Retain:      o.jobRetain,
+				Concurrency: o.jobConcurrency,
+				Groups:      o.jobGroups,
+			}
+			for _, label := range o.jobLabels {
+				key, value, ok := strings.Cut(label, "=")
+				if !ok || key == "" {
+					fatalf("Invalid --label %q (expected key=value)", label)
+				}
+				if job.Labels == nil {
+					job.Labels = map[string]string{}
+				}
+				job.Labels[key] = value
+			}
+
+			vm, ctx := o.volumeManager()
+			if err := vm.CreateRecurringJob(ctx, job); err != nil {
+				fatalf("Failed to create recurring job: %v", err)
+			}
+			if !o.dryRun {
+				fmt.Printf("Recurring job %s created\n", job.Name)
+			}
+		},
+	}
+	cmd.Flags().StringVar(&o.jobTask, "task", "", "Task to run: "+strings.Join(longhorntools.RecurringJobTasks, ", "))
+	cmd.Flags().StringVar(&o.cronSchedule, "cron", "", "Cron expression, e.g. '0 2 * * *' or @daily")
+	cmd.Flags().Int64Var(&o.jobRetain, "retain", 1, "Number of snapshots or backups to keep")
+	cmd.Flags().Int64Var(&o.jobConcurrency, "concurrency", 1, "Number of volumes to process at once")
+	cmd.Flags().StringArrayVar(&o.jobGroups, "group", nil, "Group the job belongs to (repeatable)")
+	cmd.Flags().StringArrayVar(&o.jobLabels, "label", nil, "Label key=value to put on the snapshots or backups (repeatable)")
+	cmd.MarkFlagRequired("task")
+	cmd.MarkFlagRequired("cron")
+	cmd.RegisterFlagCompletionFunc("task", cobra.FixedCompletions(longhorntools.RecurringJobTasks, cobra.ShellCompDirectiveNoFileComp))
+	return cmd
+}
+
+func (o *cliOptions) recurringJobAssignCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "assign",
+		Short: "Assign volumes to a recurring job or group",
+		Long: `Assign labels volumes so a recurring job, or every job in a group, applies to
+them; --remove takes them out again. A volume's first label takes it out of
+the "default" group, and removing its last label puts it back.`,
+		Example: `  lhc recurring-job assign -v pvc-12345 --job nightly-backup
+  lhc recurring-job assign -v 'pvc-db-*' --group databases
+  lhc recurring-job assign -v pvc-12345 --group databases --remove`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			name, group := o.jobName, false
+			if o.jobGroup != "" {
+				name, group = o.jobGroup, true
+			}
+
+			vm, ctx := o.volumeManager()
+			volumes, expanded := o.expandVolumes(ctx, vm, o.volumes)
+			if expanded {
+				action := "Assign to " + name
+				if o.remove {
+					action = "Remove from " + name
+				}
+				o.confirmVolumes(action, volumes)
+			}
+
+			failed := 0
+			for _, volume := range volumes {
+				if err := vm.AssignRecurringJob(ctx, volume, name, group, o.remove); err != nil {
+					fmt.Printf("Failed to update %s: %v\n", volume, err)
+					failed++
+				} else if !o.dryRun {
+					if o.remove {
+						fmt.Printf("Removed %s from %s\n", volume, name)
+					} else {
+						fmt.Printf("Assigned %s to %s\n", volume, name)
+					}
+				}
+			}
+			if failed > 0 {
+				fatalf("Failed to update %d of %d volume(s)", failed, len(volumes))
+			}
+		},
+	}
+	cmd.Flags().StringArrayVarP(&o.volumes, "volume", "v", nil, "Volume name, pvc:<namespace>/<name>, pv:<name>, or glob pattern (repeatable)")
+	cmd.Flags().BoolVar(&o.regex, "regex", false, "Treat -v values as regular expressions matched against Longhorn volume names")
+	cmd.Flags().StringVar(&o.jobName, "job", "", "Recurring job to assign the volumes to")
+	cmd.Flags().StringVar(&o.jobGroup, "group", "", "Recurring job group to assign the volumes to")
+	cmd.Flags().BoolVar(&o.remove, "remove", false, "Remove the volumes from the job or group instead")
+	cmd.MarkFlagRequired("volume")
+	cmd.MarkFlagsOneRequired("job", "group")
+	cmd.MarkFlagsMutuallyExclusive("job", "group")
+	cmd.RegisterFlagCompletionFunc("volume", completeVolumes)
+	return cmd
+}
+
+func (o *cliOptions) backupTargetCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "backup-target",
+		Aliases: []string{"backup-targets"},
+		Short:   "Inspect Longhorn backup targets and the backups on them",
+		Long: `Backup-target shows what Longhorn's backup targets (S3, NFS, and other
+backupstores) hold, as recorded in the BackupTarget, BackupVolume, and Backup
+resources Longhorn keeps in sync with them, so you can see what is available
+before restoring.`,
+		Args: cobra.NoArgs,
+	}
+	cmd.AddCommand(
+		o.backupTargetListCommand(),
+		o.backupTargetVolumesCommand(),
+	)
+	return cmd
+}
+
+func (o *cliOptions) backupTargetListCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "list",
+		Short:   "List backup targets and whether they are reachable",
+		Example: `  lhc backup-target list`,
+		Args:    cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			vm, ctx := o.volumeManager()
+			targets, err := vm.BackupTargets(ctx)
+			if err != nil {
+				fatalf("Failed to list backup targets: %v", err)
+			}
+			if len(targets) == 0 {
+				fmt.Println("No backup targets are configured.")
+				return
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "NAME\tURL\tCREDENTIALS\tPOLL INTERVAL\tAVAILABLE\tLAST SYNCED")
+			for _, t := range targets {
+				available := "Yes"
+				if !t.Available {
+					available = "No"
+					if t.Message != "" {
+						available += ": " + t.Message
+					}
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", t.Name, orDash(t.URL), orDash(t.CredentialSecret), orDash(t.PollInterval),
+					available, formatTimestamp(t.LastSyncedAt))
+			}
+			w.Flush()
+		},
+	}
+	return cmd
+}
+
+func (o *cliOptions) backupTargetVolumesCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "volumes",
+		Short: "List the volumes backed up to a target and their backups",
+		Long: `Volumes lists every volume with backups on the backup targets, or on
+--target only, with its size, the number of backups, and when the last one
+was taken. With -v it lists the backups of that volume instead, newest first.
+The volume need not exist in the cluster anymore.`,
+		Example: `  lhc backup-target volumes
+  lhc backup-target volumes --target default
+  lhc backup-target volumes -v pvc-12345`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			vm, ctx := o.volumeManager()
+			if o.volume != "" {
+				backups, err := vm.Backups(ctx, o.backupTarget, o.volume)
+				if err != nil {
+					fatalf("Failed to list backups: %v", err)
+				}
+				if len(backups) == 0 {
+					fmt.Printf("No backups of %s found.\n", o.volume)
+					return
+				}
+				w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+				fmt.Fprintln(w, "BACKUP\tTARGET\tSNAPSHOT\tSTATE\tSIZE\tCREATED")
+				for _, b := range backups {
+					fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", b.Name, b.Target, orDash(b.Snapshot), orDash(b.State),
+						formatBytes(b.Size), formatTimestamp(b.Created))
+				}
+				w.Flush()
+				return
+			}
+
+			volumes, err := vm.BackupVolumes(ctx, o.backupTarget)
+			if err != nil {
+				fatalf("Failed to list backup volumes: %v", err)
+			}
+			if len(volumes) == 0 {
+				fmt.Println("No backed-up volumes found.")
+				return
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "VOLUME\tTARGET\tSIZE\tBACKUPS\tLAST BACKUP\tLAST BACKUP AT")
+			for _, v := range volumes {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\n", v.Volume, v.Target, formatBytes(v.Size), v.Backups,
+					orDash(v.LastBackupName), formatTimestamp(v.LastBackupAt))
+			}
+			w.Flush()
+		},
+	}
+	cmd.Flags().StringVar(&o.backupTarget, "target", "", "Only show this backup target (default all)")
+	cmd.Flags().StringVarP(&o.volume, "volume", "v", "", "List the backups of this Longhorn volume")
+	cmd.RegisterFlagCompletionFunc("volume", completeVolumes)
+	return cmd
+}
+
+func (o *cliOptions) serveOperatorCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "serve-operator",
+		Short:   "Run a controller for VolumeCopy/VolumeExport resources",
+		Example: `  lhc serve-operator --metrics-addr :9090 --reap-interval 10m`,
+		Args:    cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			vm, ctx := o.volumeManager()
+			if o.reapInterval > 0 {
+				go vm.ReapLoop(ctx, "", o.reapInterval)
+			}
+			log.Printf("lhc v%s", version)
+			operator := longhorntools.NewOperator(vm, o.storageClass)
+			if err := operator.Run(ctx); err != nil {
+				fatalf("Operator failed: %v", err)
+			}
+		},
+	}
+	cmd.Flags().DurationVar(&o.reapInterval, "reap-interval", 0, "Reap expired temporary resources in all namespaces at this interval")
+	return cmd
+}
+
+func (o *cliOptions) tuiCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:     "tui",
+		Short:   "Browse volumes and run operations in an interactive terminal UI",
+		Example: `  lhc tui -n production`,
+		Args:    cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			vm, ctx := o.volumeManager()
+			if err := RunTUI(ctx, vm, o.namespace, o.storageClass); err != nil {
+				fatalf("TUI failed: %v", err)
+			}
+		},
+	}
+}
+
+func (o *cliOptions) serverCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "server",
+		Short:   "Serve list/contents/download/copy/cleanup over an authenticated HTTP API",
+		Example: `  lhc server --listen :8443 --tls-cert tls.crt --tls-key tls.key`,
+		Args:    cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			vm, ctx := o.volumeManager()
+			if o.reapInterval > 0 {
+				go vm.ReapLoop(ctx, "", o.reapInterval)
+			}
+			server := longhorntools.NewServer(vm, longhorntools.ServerOptions{
+				Listen:       o.listen,
+				Token:        o.apiToken,
+				TLSCert:      o.tlsCert,
+				TLSKey:       o.tlsKey,
+				StorageClass: o.storageClass,
+			})
+			if err := server.Run(ctx); err != nil {
+				fatalf("API server failed: %v", err)
+			}
+		},
+	}
+	cmd.Flags().StringVar(&o.listen, "listen", ":8080", "Address for the API server")
+	cmd.Flags().StringVar(&o.apiToken, "token", os.Getenv("LHC_API_TOKEN"), "API bearer token (default $LHC_API_TOKEN, or generated)")
+	cmd.Flags().StringVar(&o.tlsCert, "tls-cert", "", "TLS certificate file")
+	cmd.Flags().StringVar(&o.tlsKey, "tls-key", "", "TLS key file")
+	cmd.Flags().DurationVar(&o.reapInterval, "reap-interval", 0, "Reap expired temporary resources in all namespaces at this interval")
+	return cmd
+}
+
+func (o *cliOptions) imagesCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "images",
+		Short: "List the helper images lhc may start pods from",
+		Long: `Images lists every image lhc may start pods from and the reference it
+actually uses after --temp-image, --image-registry, and --image-override.
+Mirror the DEFAULT images into the private registry of a disconnected
+cluster, then set the same flags (or imageRegistry and imageOverrides in the
+config file) for every run. No cluster access is needed.`,
+		Example: `  lhc images
+  lhc images --image-registry registry.internal:5000/mirror
+  lhc images --image-override busybox:latest=@sha256:<digest>`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			overrides, err := longhorntools.ParseImageOverrides(o.imageOverrides)
+			if err != nil {
+				fatalf("Invalid --image-override: %v", err)
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "NAME\tDEFAULT\tIMAGE\tUSED FOR")
+			for _, image := range longhorntools.HelperImages {
+				source := image.Default
+				if image.Default == longhorntools.DefaultTempImage && o.tempImage != "" {
+					source = o.tempImage
+				}
+				resolved := longhorntools.ResolveImage(source, o.imageRegistry, overrides)
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", image.Name, source, resolved, image.Usage)
+			}
+			w.Flush()
+		},
+	}
+	return cmd
+}
+
+func (o *cliOptions) selfUpdateCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "self-update",
+		Short: "Replace lhc with the latest release",
+		Long: `Self-update looks up the latest release of lhc on GitHub (or the one tagged
+--to), downloads the binary for this platform, verifies it against the
+release's SHA256SUMS, and replaces the running binary with it. Builds made
+with a release key also check the signature of SHA256SUMS and refuse
+unsigned releases. No cluster access is needed; HTTPS_PROXY is honored and
+GITHUB_TOKEN, if set, raises GitHub's rate limit.
+
+An older release, or the same one again, is only installed with --yes (or
+--force).`,
+		Example: `  lhc self-update --check
+  lhc self-update
+  lhc self-update --to v1.4.0 --force`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+			defer cancel()
+
+			exe, err := os.Executable()
+			if err == nil {
+				exe, err = filepath.EvalSymlinks(exe)
+			}
+			if err != nil {
+				fatalf("Cannot locate the running binary: %v", err)
+			}
+			release, err := fetchRelease(ctx, o.updateTo)
+			if err != nil {
+				fatalf("Failed to look up the release: %v", err)
+			}
+			fmt.Printf("Current version: %s\n", version)
+			fmt.Printf("Release:         %s (%s)\n", release.TagName, release.HTMLURL)
+
+			if o.updateCheck {
+				fmt.Println(checkMessage(version, release.TagName))
+				return
+			}
+			cmp, comparable := compareVersions(version, release.TagName)
+			if comparable && cmp == 0 && !o.assumeYes {
+				fmt.Println("lhc is up to date.")
+				return
+			}
+			if comparable && cmp > 0 && !o.assumeYes {
+				fmt.Println("This build is newer than the release; pass --yes to install the release anyway.")
+				return
+			}
+
+			asset := releaseAssetName()
+			url, err := release.assetURL(asset)
+			if err != nil {
+				fatalf("No binary for this platform: %v", err)
+			}
+			sum, signed, err := releaseChecksum(ctx, release, asset)
+			if err != nil {
+				fatalf("Cannot verify the release: %v", err)
+			}
+			if !signed {
+				fmt.Println("Warning: this build has no release key, so only the checksum is verified, not who published it.")
+			}
+			fmt.Printf("Downloading %s...\n", asset)
+			downloaded, err := downloadVerified(ctx, url, exe, sum)
+			if err != nil {
+				fatalf("Download failed: %v", err)
+			}
+			if err := replaceExecutable(downloaded, exe); err != nil {
+				os.Remove(downloaded)
+				fatalf("Update failed: %v", err)
+			}
+			fmt.Printf("Updated %s from %s to %s (SHA-256 %s).\n", exe, version, release.TagName, sum)
+		},
+	}
+	cmd.Flags().BoolVar(&o.updateCheck, "check", false, "Only report whether an update is available; always exits 0")
+	cmd.Flags().StringVar(&o.updateTo, "to", "", "Install the release with this tag instead of the latest")
+	return cmd
+}
+
+// connect returns a volume manager for the selected cluster, or for the
+// fixtures in offlineDir when set. Zero qps and burst use the library's
+// defaults.
+func connect(kubeconfig, kubeContext, offlineDir string, qps float32, burst int) (*longhorntools.VolumeManager, error) {
+	if offlineDir != "" {
+		return longhorntools.NewOfflineVolumeManager(offlineDir)
+	}
+	config, err := newClientConfig(kubeconfig, kubeContext).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load kubeconfig: %v", err)
+	}
+	config.QPS = qps
+	config.Burst = burst
+	return longhorntools.NewVolumeManager(config)
+}
+
+// completionVolumeManager connects with the --kubeconfig, --context, and
+// --offline given so far on the command line being completed.
+func completionVolumeManager(cmd *cobra.Command) (*longhorntools.VolumeManager, error) {
+	kubeconfig, _ := cmd.Flags().GetString("kubeconfig")
+	kubeContext, _ := cmd.Flags().GetString("context")
+	offline, _ := cmd.Flags().GetString("offline")
+	return connect(kubeconfig, kubeContext, offline, 0, 0)
+}
+
+// completeVolumes completes Longhorn volume names from the cluster. Errors
+// just yield no suggestions.
+func completeVolumes(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	vm, err := completionVolumeManager(cmd)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	volumes, err := vm.Volumes(context.Background())
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	var names []string
+	for _, volume := range volumes {
+		if strings.HasPrefix(volume.Name, toComplete) {
+			names = append(names, fmt.Sprintf("%s\t%s, %s", volume.Name, volume.State, volume.Size))
+		}
+	}
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeCopyEndpoints completes the volume of a cp endpoint, leaving the
+// cursor after the colon for the path. Anything else is a local path.
+func completeCopyEndpoints(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if strings.Contains(toComplete, ":") || strings.HasPrefix(toComplete, "/") || strings.HasPrefix(toComplete, ".") {
+		return nil, cobra.ShellCompDirectiveDefault
+	}
+	volumes, _ := completeVolumes(cmd, args, toComplete)
+	for i, v := range volumes {
+		name, desc, _ := strings.Cut(v, "\t")
+		volumes[i] = name + ":\t" + desc
+	}
+	return volumes, cobra.ShellCompDirectiveNoSpace
+}
+
+// completeNamespaces completes namespace names from the cluster.
+func completeNamespaces(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	vm, err := completionVolumeManager(cmd)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	namespaces, err := vm.Clientset().CoreV1().Namespaces().List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	var names []string
+	for _, ns := range namespaces.Items {
+		if strings.HasPrefix(ns.Name, toComplete) {
+			names = append(names, ns.Name)
+		}
+	}
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeStorageClasses completes the names of Longhorn storage classes.
+func completeStorageClasses(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	vm, err := completionVolumeManager(cmd)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	classes, err := vm.Clientset().StorageV1().StorageClasses().List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	var names []string
+	for _, sc := range classes.Items {
+		if sc.Provisioner == "driver.longhorn.io" && strings.HasPrefix(sc.Name, toComplete) {
+			names = append(names, sc.Name)
+		}
+	}
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
+
+// cleanupTemporaryResources lists the temporary resources in namespace,
+// only those for volumes if given, and deletes them once confirmed.
+func cleanupTemporaryResources(ctx context.Context, vm *longhorntools.VolumeManager, namespace string, volumes []string, assumeYes bool) error {
+	fmt.Printf("Searching for temporary resources with 'lhc-temp-' prefix in namespace '%s'...\n\n", namespace)
+
+	res, err := vm.FindTemporaryResources(ctx, namespace)
+	if err != nil {
+		return err
+	}
+	if volumes != nil {
+		res = res.ForVolumes(volumes)
+	}
+
+	// Check if any resources were found
+	totalResources := res.Total()
+	if totalResources == 0 {
+		fmt.Println("No temporary resources found.")
+		return nil
+	}
+
+	// Display found resources
+	fmt.Printf("Found %d temporary resources:\n\n", totalResources)
+
+	if len(res.Pods) > 0 {
+		fmt.Println("Pods:")
+		for _, pod := range res.Pods {
+			fmt.Printf("  - %s (Status: %s)\n", pod.Name, pod.Status.Phase)
+		}
+		fmt.Println()
+	}
+
+	if len(res.PVCs) > 0 {
+		fmt.Println("PersistentVolumeClaims:")
+		for _, pvc := range res.PVCs {
+			fmt.Printf("  - %s (Status: %s)\n", pvc.Name, pvc.Status.Phase)
+		}
+		fmt.Println()
+	}
+
+	if len(res.PVs) > 0 {
+		fmt.Println("PersistentVolumes:")
+		for _, pv := range res.PVs {
+			fmt.Printf("  - %s (Status: %s)\n", pv.Name, pv.Status.Phase)
+		}
+		fmt.Println()
+	}
+
+	if vm.DryRun {
+		vm.DeleteTemporaryResources(ctx, namespace, res)
+		return nil
+	}
+
+	ok, err := confirm("Do you want to delete these resources?", assumeYes)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		fmt.Println("Cleanup cancelled.")
+		return nil
+	}
+
+	// Delete resources
+	fmt.Println("\nDeleting resources...")
+	if failed := vm.DeleteTemporaryResources(ctx, namespace, res); failed > 0 {
+		return fmt.Errorf("%w: %d deletion(s) failed", longhorntools.ErrPartialCleanup, failed)
+	}
+
+	fmt.Println("\nCleanup completed.")
+	return nil
+}
+
+// printBatchSummary prints one row per volume of a batch operation.
+func printBatchSummary(results []longhorntools.BatchResult) {
+	if len(results) == 0 {
+		return
+	}
+
+	fmt.Println("\nBatch summary:")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VOLUME\tSTATUS\tDURATION\tDETAILS")
+	for _, r := range results {
+		status, details := "OK", r.Output
+		switch {
+		case r.Skipped:
+			status, details = "SKIPPED", "already downloaded"
+		case r.Err != nil:
+			status, details = "FAILED", r.Err.Error()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", r.Volume, status, r.Duration.Round(time.Second), details)
+	}
+	w.Flush()
+}
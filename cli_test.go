@@ -0,0 +1,41 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"longhorn-volume-manager/pkg/longhorntools"
+)
+
+func TestWriteUsageTable(t *testing.T) {
+	var out bytes.Buffer
+	failed := writeUsageTable(&out, []usageRow{
+		{volume: "pvc-a", usage: &longhorntools.VolumeUsage{Size: 1 << 30, Used: 1 << 29, Available: 1 << 29}},
+		{volume: "pvc-b", err: errors.New("attach timed out")},
+	})
+	if failed != 1 {
+		t.Errorf("failed = %d, want 1", failed)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("got %d lines, want 3:\n%s", len(lines), out.String())
+	}
+	// Every row must line up with the header's five columns
+	header := strings.Fields(lines[0])
+	if want := []string{"VOLUME", "SIZE", "USED", "AVAILABLE", "USE%"}; strings.Join(header, " ") != strings.Join(want, " ") {
+		t.Errorf("header = %q, want %q", header, want)
+	}
+	errorColumn := strings.Index(lines[0], "USE%")
+	if got := strings.Index(lines[2], "error:"); got != errorColumn {
+		t.Errorf("error starts at column %d, want %d under USE%%:\n%s", got, errorColumn, out.String())
+	}
+	if got := strings.Index(lines[1], "50%"); got != errorColumn {
+		t.Errorf("USE%% value starts at column %d, want %d:\n%s", got, errorColumn, out.String())
+	}
+	if fields := strings.Fields(lines[2]); len(fields) < 5 || fields[1] != "-" || fields[3] != "-" {
+		t.Errorf("error row = %q", lines[2])
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+)
+
+// configSetting maps a config file key and environment variable onto the
+// flag whose default it changes.
+type configSetting struct {
+	key  string
+	env  string
+	flag string
+	// list settings take a YAML list (or map, as key=value entries) in
+	// the file and a comma-separated value in the environment.
+	list bool
+	// command limits the setting to one command path, for flags whose name
+	// means something else on other commands.
+	command string
+}
+
+// configSettings lists every default that can come from the config file or
+// the environment. Precedence is flag, then environment, then config file,
+// then the built-in default.
+var configSettings = []configSetting{
+	{key: "namespace", env: "LHC_NAMESPACE", flag: "namespace"},
+	{key: "storageClass", env: "LHC_STORAGE_CLASS", flag: "storage-class"},
+	{key: "compress", env: "LHC_COMPRESS", flag: "compress"},
+	{key: "compressLevel", env: "LHC_COMPRESS_LEVEL", flag: "compress-level"},
+	{key: "parallel", env: "LHC_PARALLEL", flag: "parallel"},
+	{key: "waitTimeout", env: "LHC_WAIT_TIMEOUT", flag: "wait-timeout"},
+	{key: "lockTimeout", env: "LHC_LOCK_TIMEOUT", flag: "lock-timeout"},
+	{key: "tempImage", env: "LHC_TEMP_IMAGE", flag: "temp-image"},
+	{key: "cpuRequest", env: "LHC_CPU_REQUEST", flag: "cpu-request"},
+	{key: "memoryRequest", env: "LHC_MEMORY_REQUEST", flag: "memory-request"},
+	{key: "cpuLimit", env: "LHC_CPU_LIMIT", flag: "cpu-limit"},
+	{key: "memoryLimit", env: "LHC_MEMORY_LIMIT", flag: "memory-limit"},
+	{key: "securityProfile", env: "LHC_SECURITY_PROFILE", flag: "security-profile"},
+	{key: "fsGroup", env: "LHC_FS_GROUP", flag: "fs-group"},
+	{key: "serviceAccount", env: "LHC_SERVICE_ACCOUNT", flag: "service-account"},
+	{key: "imagePullSecrets", env: "LHC_IMAGE_PULL_SECRETS", flag: "image-pull-secret", list: true},
+	{key: "imageRegistry", env: "LHC_IMAGE_REGISTRY", flag: "image-registry"},
+	{key: "imageOverrides", env: "LHC_IMAGE_OVERRIDES", flag: "image-override", list: true},
+	{key: "nodeSelector", env: "LHC_NODE_SELECTOR", flag: "node-selector", list: true},
+	{key: "tolerations", env: "LHC_TOLERATIONS", flag: "toleration", list: true},
+	{key: "affinityFile", env: "LHC_AFFINITY_FILE", flag: "affinity-file"},
+	{key: "pinNode", env: "LHC_PIN_NODE", flag: "pin-node"},
+	{key: "ttl", env: "LHC_TTL", flag: "ttl"},
+	{key: "retries", env: "LHC_RETRIES", flag: "retries"},
+	{key: "retryBackoff", env: "LHC_RETRY_BACKOFF", flag: "retry-backoff"},
+	{key: "annotate", env: "LHC_ANNOTATE", flag: "annotate"},
+	{key: "metricsAddr", env: "LHC_METRICS_ADDR", flag: "metrics-addr"},
+	{key: "progress", env: "LHC_PROGRESS", flag: "progress"},
+	{key: "progressInterval", env: "LHC_PROGRESS_INTERVAL", flag: "progress-interval"},
+	{key: "output", env: "LHC_OUTPUT", flag: "output", command: "lhc list"},
+}
+
+// configPath returns $LHC_CONFIG, or config.yaml under $XDG_CONFIG_HOME/lhc
+// (default ~/.config/lhc).
+func configPath() string {
+	if path := os.Getenv("LHC_CONFIG"); path != "" {
+		return path
+	}
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "lhc", "config.yaml")
+}
+
+// loadConfigFile reads the config file. A missing file is not an error,
+// unless it was named explicitly with $LHC_CONFIG.
+func loadConfigFile(path string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) && os.Getenv("LHC_CONFIG") == "" {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	values := map[string]interface{}{}
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %v", path, err)
+	}
+
+	known := map[string]bool{}
+	for _, setting := range configSettings {
+		known[setting.key] = true
+	}
+	var unknown []string
+	for key := range values {
+		if !known[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("unknown keys in config file %s: %s", path, strings.Join(unknown, ", "))
+	}
+	return values, nil
+}
+
+// applyConfigDefaults sets flag values from the config file and the
+// environment. It runs after parsing and skips flags given on the command
+// line, and flags the running command does not have.
+func applyConfigDefaults(cmd *cobra.Command) error {
+	fs := cmd.Flags()
+	path := configPath()
+	values, err := loadConfigFile(path)
+	if err != nil {
+		return err
+	}
+
+	for _, setting := range configSettings {
+		if setting.command != "" && setting.command != cmd.CommandPath() {
+			continue
+		}
+		flag := fs.Lookup(setting.flag)
+		if flag == nil || flag.Changed {
+			continue
+		}
+
+		var items []string
+		source := ""
+		if value, ok := os.LookupEnv(setting.env); ok {
+			items = []string{value}
+			if setting.list {
+				items = strings.Split(value, ",")
+			}
+			source = setting.env
+		} else if value, ok := values[setting.key]; ok && value != nil {
+			items = configValues(value, setting.list)
+			source = fmt.Sprintf("%s in config file %s", setting.key, path)
+		}
+		for _, item := range items {
+			if err := fs.Set(setting.flag, item); err != nil {
+				return fmt.Errorf("invalid %s %q: %v", source, item, err)
+			}
+		}
+	}
+	return nil
+}
+
+// configValues flattens a config file value into flag values. Lists yield
+// one value per entry and maps yield key=value entries.
+func configValues(value interface{}, list bool) []string {
+	if !list {
+		return []string{configString(value)}
+	}
+	switch v := value.(type) {
+	case []interface{}:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			items = append(items, configString(item))
+		}
+		return items
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		items := make([]string, 0, len(v))
+		for _, key := range keys {
+			items = append(items, key+"="+configString(v[key]))
+		}
+		return items
+	default:
+		return []string{configString(value)}
+	}
+}
+
+// configString formats a scalar config value. YAML numbers decode as
+// float64, which fmt would print in exponent form past a million.
+func configString(value interface{}) string {
+	if v, ok := value.(float64); ok {
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fmt.Sprint(value)
+}
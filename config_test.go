@@ -0,0 +1,66 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestConfigValues(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		list  bool
+		want  []string
+	}{
+		{float64(1000680000), false, []string{"1000680000"}},
+		{float64(1.5), false, []string{"1.5"}},
+		{"10m", false, []string{"10m"}},
+		{true, false, []string{"true"}},
+		{[]interface{}{"a", float64(2000000)}, true, []string{"a", "2000000"}},
+		{map[string]interface{}{"zone": "b", "id": float64(1234567)}, true, []string{"id=1234567", "zone=b"}},
+	}
+	for _, tt := range tests {
+		if got := configValues(tt.value, tt.list); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("configValues(%v, %v) = %q, want %q", tt.value, tt.list, got, tt.want)
+		}
+	}
+}
+
+func TestApplyConfigDefaults(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("fsGroup: 1000680000\noutput: wide\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("LHC_CONFIG", path)
+
+	var fsGroup int64
+	var listOutput, downloadOutput string
+	root := &cobra.Command{Use: "lhc"}
+	root.PersistentFlags().Int64Var(&fsGroup, "fs-group", 0, "")
+	list := &cobra.Command{Use: "list"}
+	list.Flags().StringVarP(&listOutput, "output", "o", "", "")
+	download := &cobra.Command{Use: "download"}
+	download.Flags().StringVar(&downloadOutput, "output", "", "")
+	root.AddCommand(list, download)
+
+	for _, cmd := range []*cobra.Command{list, download} {
+		if err := cmd.ParseFlags(nil); err != nil {
+			t.Fatal(err)
+		}
+		if err := applyConfigDefaults(cmd); err != nil {
+			t.Fatalf("applyConfigDefaults(%s): %v", cmd.Name(), err)
+		}
+	}
+	if fsGroup != 1000680000 {
+		t.Errorf("fs-group = %d, want 1000680000", fsGroup)
+	}
+	if listOutput != "wide" {
+		t.Errorf("list --output = %q, want wide", listOutput)
+	}
+	if downloadOutput != "" {
+		t.Errorf("download --output = %q, want it left unset", downloadOutput)
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// confirm asks a yes/no question on stdin. assumeYes (--yes/--force)
+// answers it without prompting; otherwise stdin must be a terminal so that
+// scripts and Jobs fail clearly instead of hanging on a prompt.
+func confirm(question string, assumeYes bool) (bool, error) {
+	if assumeYes {
+		return true, nil
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return false, fmt.Errorf("cannot ask for confirmation because stdin is not a terminal; pass --yes to proceed")
+	}
+
+	fmt.Printf("%s (y/N): ", question)
+	response, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	response = strings.TrimSpace(response)
+	return response == "y" || response == "Y", nil
+}
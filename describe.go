@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/duration"
+	"sigs.k8s.io/yaml"
+
+	"longhorn-volume-manager/pkg/longhorntools"
+)
+
+// printVolumeDescription writes d in the style of kubectl describe.
+func printVolumeDescription(out io.Writer, d *longhorntools.VolumeDescription) {
+	v := d.Volume
+	w := tabwriter.NewWriter(out, 0, 0, 1, ' ', 0)
+	fmt.Fprintf(w, "Name:\t%s\n", v.Name)
+	fmt.Fprintf(w, "Namespace:\tlonghorn-system\n")
+	fmt.Fprintf(w, "Created:\t%s\n", formatTimestamp(v.Created))
+	fmt.Fprintf(w, "State:\t%s\n", v.State)
+	fmt.Fprintf(w, "Robustness:\t%s\n", orDash(v.Robustness))
+	fmt.Fprintf(w, "Size:\t%s\n", formatVolumeSize(v.Size))
+	if v.ActualSize > 0 {
+		fmt.Fprintf(w, "Actual Size:\t%s\n", formatBytes(v.ActualSize))
+	}
+	fmt.Fprintf(w, "Number Of Replicas:\t%d\n", v.Replicas)
+	fmt.Fprintf(w, "Frontend:\t%s\n", orDash(v.Frontend))
+	fmt.Fprintf(w, "Attached To:\t%s\n", orDash(v.NodeID))
+	w.Flush()
+
+	printFields(out, "Spec", d.Spec)
+	printFields(out, "Status", d.Status)
+
+	fmt.Fprintln(out, "Engine:")
+	if len(d.Engines) == 0 {
+		fmt.Fprintln(out, "  <none>")
+	}
+	for _, e := range d.Engines {
+		w = tabwriter.NewWriter(out, 0, 0, 1, ' ', 0)
+		fmt.Fprintf(w, "  Name:\t%s\n", e.Name)
+		fmt.Fprintf(w, "  Node:\t%s\n", orDash(e.Node))
+		fmt.Fprintf(w, "  State:\t%s\n", orDash(e.State))
+		fmt.Fprintf(w, "  Image:\t%s\n", orDash(e.Image))
+		fmt.Fprintf(w, "  Endpoint:\t%s\n", orDash(e.Endpoint))
+		w.Flush()
+	}
+
+	fmt.Fprintln(out, "Replicas:")
+	if len(d.Replicas) == 0 {
+		fmt.Fprintln(out, "  <none>")
+	} else {
+		w = tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "  NAME\tNODE\tSTATE\tMODE\tREBUILD\tDISK\tFAILED AT")
+		for _, r := range d.Replicas {
+			fmt.Fprintf(w, "  %s\t%s\t%s\t%s\t%s\t%s\t%s\n", r.Name, orDash(r.Node), orDash(r.State), orDash(r.Mode), rebuildCell(r), orDash(r.DiskPath), orDash(r.FailedAt))
+		}
+		w.Flush()
+	}
+
+	w = tabwriter.NewWriter(out, 0, 0, 1, ' ', 0)
+	if d.PV != nil {
+		capacity := d.PV.Spec.Capacity.Storage()
+		fmt.Fprintf(w, "PersistentVolume:\t%s (%s, %s, storage class %s)\n", d.PV.Name, d.PV.Status.Phase, capacity, orDash(d.PV.Spec.StorageClassName))
+	} else {
+		fmt.Fprintf(w, "PersistentVolume:\t%s\n", orDash(v.PVName))
+	}
+	if d.PVC != nil {
+		fmt.Fprintf(w, "PersistentVolumeClaim:\t%s/%s (%s)\n", d.PVC.Namespace, d.PVC.Name, d.PVC.Status.Phase)
+	} else if v.PVCName != "" {
+		fmt.Fprintf(w, "PersistentVolumeClaim:\t%s/%s\n", v.PVCNamespace, v.PVCName)
+	} else {
+		fmt.Fprintf(w, "PersistentVolumeClaim:\t-\n")
+	}
+	w.Flush()
+
+	fmt.Fprintln(out, "Used By:")
+	if len(d.Pods) == 0 {
+		fmt.Fprintln(out, "  <none>")
+	}
+	for _, pod := range d.Pods {
+		fmt.Fprintf(out, "  %s/%s (%s on %s)\n", pod.Namespace, pod.Name, pod.Status.Phase, orDash(pod.Spec.NodeName))
+	}
+
+	fmt.Fprintln(out, "Snapshots:")
+	if len(d.Snapshots) == 0 {
+		fmt.Fprintln(out, "  <none>")
+	} else {
+		w = tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "  NAME\tCREATED\tSIZE\tUSER CREATED\tREADY")
+		for _, s := range d.Snapshots {
+			fmt.Fprintf(w, "  %s\t%s\t%s\t%t\t%t\n", s.Name, orDash(s.Created), formatBytes(s.Size), s.UserCreated, s.ReadyToUse)
+		}
+		w.Flush()
+	}
+
+	fmt.Fprintln(out, "Events:")
+	if len(d.Events) == 0 {
+		fmt.Fprintln(out, "  <none>")
+		return
+	}
+	printEvents(out, d.Events, "  ")
+}
+
+// printEvents writes events as a table, each line prefixed with indent.
+func printEvents(out io.Writer, events []corev1.Event, indent string) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "%sLAST SEEN\tTYPE\tREASON\tOBJECT\tMESSAGE\n", indent)
+	for _, e := range events {
+		last := e.LastTimestamp.Time
+		if last.IsZero() {
+			last = e.EventTime.Time
+		}
+		age := "-"
+		if !last.IsZero() {
+			age = duration.HumanDuration(time.Since(last))
+		}
+		object := e.InvolvedObject.Kind + "/" + e.InvolvedObject.Name
+		if e.InvolvedObject.Namespace != "" {
+			object = e.InvolvedObject.Kind + "/" + e.InvolvedObject.Namespace + "/" + e.InvolvedObject.Name
+		}
+		message := strings.TrimSpace(e.Message)
+		if e.Count > 1 {
+			message += fmt.Sprintf(" (x%d)", e.Count)
+		}
+		fmt.Fprintf(w, "%s%s\t%s\t%s\t%s\t%s\n", indent, age, e.Type, e.Reason, object, message)
+	}
+	w.Flush()
+}
+
+// printFields writes a section of raw resource fields as indented YAML.
+func printFields(out io.Writer, title string, fields map[string]interface{}) {
+	fmt.Fprintf(out, "%s:\n", title)
+	if len(fields) == 0 {
+		fmt.Fprintln(out, "  <none>")
+		return
+	}
+	data, err := yaml.Marshal(fields)
+	if err != nil {
+		fmt.Fprintf(out, "  <%v>\n", err)
+		return
+	}
+	for _, line := range strings.Split(strings.TrimRight(string(data), "\n"), "\n") {
+		fmt.Fprintf(out, "  %s\n", line)
+	}
+}
+
+// formatTimestamp formats t with its age, or "-" for the zero time.
+func formatTimestamp(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return fmt.Sprintf("%s (%s ago)", t.Format(time.RFC1123Z), duration.HumanDuration(time.Since(t)))
+}
+
+// rebuildCell describes a replica's rebuild for a table cell.
+func rebuildCell(r longhorntools.Replica) string {
+	switch {
+	case !r.Rebuilding:
+		return "-"
+	case r.RebuildProgress > 0:
+		return fmt.Sprintf("%d%%", r.RebuildProgress)
+	default:
+		return "pending"
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"errors"
+
+	"longhorn-volume-manager/pkg/longhorntools"
+)
+
+// Exit codes, so scripts can branch on why lhc failed. They are listed in
+// the README's Exit Codes section; keep it in sync.
+const (
+	exitFailure        = 1
+	exitProblemsFound  = 2
+	exitNotFound       = 3
+	exitInUse          = 4
+	exitAttachTimeout  = 5
+	exitExecFailed     = 6
+	exitVerification   = 7
+	exitPartialCleanup = 8
+	exitInterrupted    = 130
+)
+
+// errorExitCodes maps the library's error categories to exit codes. The
+// first category an error matches wins.
+var errorExitCodes = []struct {
+	category error
+	code     int
+}{
+	{longhorntools.ErrVolumeNotFound, exitNotFound},
+	{longhorntools.ErrVolumeInUse, exitInUse},
+	{longhorntools.ErrAttachTimeout, exitAttachTimeout},
+	{longhorntools.ErrVerification, exitVerification},
+	{longhorntools.ErrExecFailed, exitExecFailed},
+	{longhorntools.ErrPartialCleanup, exitPartialCleanup},
+}
+
+// exitCode returns the exit code for a run that failed with err.
+func exitCode(err error) int {
+	for _, e := range errorExitCodes {
+		if errors.Is(err, e.category) {
+			return e.code
+		}
+	}
+	return exitFailure
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"longhorn-volume-manager/pkg/longhorntools"
+)
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{errors.New("boom"), exitFailure},
+		{longhorntools.ErrVolumeNotFound, exitNotFound},
+		{fmt.Errorf("resolve: %w", longhorntools.ErrVolumeNotFound), exitNotFound},
+		{fmt.Errorf("delete: %w", longhorntools.ErrVolumeInUse), exitInUse},
+		{fmt.Errorf("attach: %w", longhorntools.ErrAttachTimeout), exitAttachTimeout},
+		{fmt.Errorf("exec: %w", longhorntools.ErrExecFailed), exitExecFailed},
+		{fmt.Errorf("verify: %w", longhorntools.ErrVerification), exitVerification},
+		{fmt.Errorf("cleanup: %w", longhorntools.ErrPartialCleanup), exitPartialCleanup},
+		// A verification failure found by a command in the pod is
+		// reported as the verification failure
+		{errors.Join(longhorntools.ErrExecFailed, longhorntools.ErrVerification), exitVerification},
+	}
+	for _, tt := range tests {
+		if got := exitCode(tt.err); got != tt.want {
+			t.Errorf("exitCode(%v) = %d, want %d", tt.err, got, tt.want)
+		}
+	}
+}
+
+// TestExitCodeFromManager checks the exit code of an error categorized by
+// the library rather than built here.
+func TestExitCodeFromManager(t *testing.T) {
+	volumes := schema.GroupVersionResource{Group: "longhorn.io", Version: "v1beta2", Resource: "volumes"}
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{volumes: "VolumeList"})
+	vm := longhorntools.NewVolumeManagerWithClients(fake.NewSimpleClientset(), dynamicClient, nil)
+
+	_, err := vm.ResolveVolume(context.Background(), "missing", "default")
+	if got := exitCode(err); got != exitNotFound {
+		t.Errorf("exitCode(%v) = %d, want %d", err, got, exitNotFound)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"longhorn-volume-manager/pkg/longhorntools"
+)
+
+// interrupted is closed once SIGINT or SIGTERM has been received.
+var interrupted = make(chan struct{})
+
+var (
+	interruptMu    sync.Mutex
+	interruptHooks []func()
+)
+
+// onInterrupt registers f to run on SIGINT/SIGTERM before the run's
+// context is cancelled and its temporary resources are deleted, such as
+// unmounting a share served by a temporary pod.
+func onInterrupt(f func()) {
+	interruptMu.Lock()
+	defer interruptMu.Unlock()
+	interruptHooks = append(interruptHooks, f)
+}
+
+// handleInterrupts returns the context for the run's cluster calls and
+// exec streams. On SIGINT/SIGTERM it runs the onInterrupt hooks, cancels
+// that context, deletes the temporary resources created so far, and exits.
+// A second signal exits immediately.
+func handleInterrupts(vm *longhorntools.VolumeManager) context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		sig := <-signals
+		close(interrupted)
+		fmt.Fprintf(os.Stderr, "\nReceived %s, cancelling and cleaning up (press Ctrl+C again to exit immediately)...\n", sig)
+		go func() {
+			<-signals
+			os.Exit(exitInterrupted)
+		}()
+
+		interruptMu.Lock()
+		for i := len(interruptHooks) - 1; i >= 0; i-- {
+			interruptHooks[i]()
+		}
+		interruptMu.Unlock()
+		cancel()
+
+		// The run's context is already cancelled
+		cleanupCtx, cleanupCancel := context.WithTimeout(context.Background(), 60*time.Second)
+		vm.CleanupTracked(cleanupCtx)
+		cleanupCancel()
+		os.Exit(exitInterrupted)
+	}()
+	return ctx
+}
+
+// fatalf is log.Fatalf, except that while an interrupt cleanup is running
+// it waits for that to finish and exit instead. The exit code follows the
+// category of the first error among args; see exitCode.
+func fatalf(format string, args ...interface{}) {
+	select {
+	case <-interrupted:
+		select {}
+	default:
+	}
+	log.Printf(format, args...)
+	for _, arg := range args {
+		if err, ok := arg.(error); ok {
+			os.Exit(exitCode(err))
+		}
+	}
+	os.Exit(exitFailure)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// kubectlPluginPrefix is how kubectl finds plugins on $PATH: an executable
+// named kubectl-lhc runs as "kubectl lhc".
+const kubectlPluginPrefix = "kubectl-"
+
+// kubectlCompletionPrefix names the helper kubectl (1.26+) runs to complete
+// a plugin's arguments: kubectl_complete-lhc.
+const kubectlCompletionPrefix = "kubectl_complete-"
+
+// newClientConfig loads cluster access the way kubectl does: --kubeconfig,
+// else the files in $KUBECONFIG merged in order, else ~/.kube/config, and
+// the in-cluster service account when none of them exist. context selects
+// a kubeconfig context other than the current one.
+func newClientConfig(kubeconfig, context string) clientcmd.ClientConfig {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = kubeconfig
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: context}
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, overrides)
+}
+
+// defaultNamespace returns the namespace of the selected kubeconfig context
+// (or of the service account in-cluster), like kubectl without -n.
+func defaultNamespace(clientConfig clientcmd.ClientConfig) string {
+	namespace, _, err := clientConfig.Namespace()
+	if err != nil || namespace == "" {
+		return "default"
+	}
+	return namespace
+}
+
+// pluginName returns the kubectl subcommand this binary runs as ("lhc" for
+// kubectl-lhc), or "" when it was not invoked as a kubectl plugin.
+func pluginName(arg0 string) string {
+	base := strings.TrimSuffix(filepath.Base(arg0), ".exe")
+	for _, prefix := range []string{kubectlPluginPrefix, kubectlCompletionPrefix} {
+		if name, ok := strings.CutPrefix(base, prefix); ok {
+			// kubectl maps dashes in subcommands to underscores in file names
+			return strings.ReplaceAll(name, "_", "-")
+		}
+	}
+	return ""
+}
+
+// setupPluginMode adjusts root for running as "kubectl <name>": help and
+// examples show the kubectl form, and the kubectl_complete-<name> helper
+// answers kubectl's completion requests.
+func setupPluginMode(root *cobra.Command) {
+	name := pluginName(os.Args[0])
+	if name == "" {
+		return
+	}
+
+	display := "kubectl " + name
+	if root.Annotations == nil {
+		root.Annotations = map[string]string{}
+	}
+	root.Annotations[cobra.CommandDisplayNameAnnotation] = display
+
+	var rewrite func(cmd *cobra.Command)
+	rewrite = func(cmd *cobra.Command) {
+		cmd.Example = strings.ReplaceAll(cmd.Example, "  lhc ", "  "+display+" ")
+		for _, sub := range cmd.Commands() {
+			rewrite(sub)
+		}
+	}
+	rewrite(root)
+
+	if strings.HasPrefix(filepath.Base(os.Args[0]), kubectlCompletionPrefix) {
+		root.SetArgs(append([]string{cobra.ShellCompRequestCmd}, os.Args[1:]...))
+	}
+}
+
+// completeContexts completes context names from the kubeconfig.
+func completeContexts(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	kubeconfig, _ := cmd.Flags().GetString("kubeconfig")
+	raw, err := newClientConfig(kubeconfig, "").RawConfig()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	var names []string
+	for name := range raw.Contexts {
+		if strings.HasPrefix(name, toComplete) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
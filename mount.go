@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// localMount is a WebDAV share that mountWebDAV mounted on this machine.
+type localMount struct {
+	path    string
+	unmount []string
+	once    sync.Once
+}
+
+// mountWebDAV mounts the WebDAV share at url on path, creating path if
+// needed: with mount_webdav on macOS, and with rclone or, as root, davfs2
+// on Linux.
+func mountWebDAV(url, path string, readOnly bool) (*localMount, error) {
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return nil, fmt.Errorf("cannot create mount point: %v", err)
+	}
+	var mount, unmount []string
+	var stdin string
+	switch runtime.GOOS {
+	case "darwin":
+		mount = []string{"mount_webdav", "-S"}
+		if readOnly {
+			mount = append(mount, "-o", "rdonly")
+		}
+		mount = append(mount, url, path)
+		unmount = []string{"umount", path}
+	case "linux":
+		if _, err := exec.LookPath("rclone"); err == nil {
+			// --daemon returns once the mount is ready
+			mount = []string{"rclone", "mount", ":webdav:", path, "--webdav-url", url, "--vfs-cache-mode", "writes", "--daemon"}
+			if readOnly {
+				mount = append(mount, "--read-only")
+			}
+			unmount = []string{"fusermount", "-u", path}
+			if _, err := exec.LookPath("fusermount3"); err == nil {
+				unmount[0] = "fusermount3"
+			}
+			break
+		}
+		if _, err := exec.LookPath("mount.davfs"); err != nil || os.Geteuid() != 0 {
+			return nil, fmt.Errorf("mounting WebDAV needs rclone, or davfs2 and root")
+		}
+		mount = []string{"mount", "-t", "davfs"}
+		if readOnly {
+			mount = append(mount, "-o", "ro")
+		}
+		mount = append(mount, url, path)
+		unmount = []string{"umount", path}
+		// The share has no credentials; answer davfs2's prompts with empty ones
+		stdin = "\n\n"
+	default:
+		return nil, fmt.Errorf("mounting WebDAV is not supported on %s", runtime.GOOS)
+	}
+
+	cmd := exec.Command(mount[0], mount[1:]...)
+	cmd.Stdin = strings.NewReader(stdin)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("%s failed: %v: %s", mount[0], err, strings.TrimSpace(string(out)))
+	}
+	return &localMount{path: path, unmount: unmount}, nil
+}
+
+// Unmount unmounts the share, once; later calls do nothing. Failures are
+// reported on stderr, since there is nothing else to be done about them.
+func (m *localMount) Unmount() {
+	m.once.Do(func() {
+		fmt.Fprintf(os.Stderr, "Unmounting %s...\n", m.path)
+		out, err := exec.Command(m.unmount[0], m.unmount[1:]...).CombinedOutput()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to unmount %s: %v: %s\n", m.path, err, strings.TrimSpace(string(out)))
+		}
+	})
+}
@@ -0,0 +1,236 @@
+package longhorntools
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// Longhorn's BackupTarget, BackupVolume, and Backup custom resources, which
+// Longhorn keeps in sync with the contents of the backupstore.
+var (
+	longhornBackupTargetGVR = schema.GroupVersionResource{
+		Group:    "longhorn.io",
+		Version:  "v1beta2",
+		Resource: "backuptargets",
+	}
+	longhornBackupVolumeGVR = schema.GroupVersionResource{
+		Group:    "longhorn.io",
+		Version:  "v1beta2",
+		Resource: "backupvolumes",
+	}
+	longhornBackupGVR = schema.GroupVersionResource{
+		Group:    "longhorn.io",
+		Version:  "v1beta2",
+		Resource: "backups",
+	}
+)
+
+// DefaultBackupTarget is the backup target Longhorn versions before 1.8,
+// which support only one, call theirs.
+const DefaultBackupTarget = "default"
+
+// BackupTarget is an S3, NFS, or other backupstore Longhorn backs up to.
+type BackupTarget struct {
+	Name             string `json:"name"`
+	URL              string `json:"url"`
+	CredentialSecret string `json:"credentialSecret,omitempty"`
+	PollInterval     string `json:"pollInterval,omitempty"`
+	Available        bool   `json:"available"`
+	// Message explains why an unavailable target cannot be reached.
+	Message      string    `json:"message,omitempty"`
+	LastSyncedAt time.Time `json:"lastSyncedAt"`
+}
+
+// BackupVolume is a volume that has backups on a backup target. Sizes are
+// in bytes.
+type BackupVolume struct {
+	Name   string `json:"name"`
+	Volume string `json:"volume"`
+	Target string `json:"target"`
+	// Size is the size of the volume as of its last backup.
+	Size           int64     `json:"size"`
+	DataStored     int64     `json:"dataStored,omitempty"`
+	Backups        int       `json:"backups"`
+	LastBackupName string    `json:"lastBackupName,omitempty"`
+	LastBackupAt   time.Time `json:"lastBackupAt"`
+	Created        time.Time `json:"created"`
+}
+
+// Backup is a single backup of a volume.
+type Backup struct {
+	Name     string    `json:"name"`
+	Volume   string    `json:"volume"`
+	Target   string    `json:"target"`
+	Snapshot string    `json:"snapshot,omitempty"`
+	State    string    `json:"state"`
+	Size     int64     `json:"size"`
+	URL      string    `json:"url,omitempty"`
+	Created  time.Time `json:"created"`
+}
+
+// BackupTargets lists Longhorn's backup targets, sorted by name.
+func (vm *VolumeManager) BackupTargets(ctx context.Context) ([]BackupTarget, error) {
+	list, err := vm.dynamicClient.Resource(longhornBackupTargetGVR).Namespace("longhorn-system").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list Longhorn backup targets: %w", err)
+	}
+
+	targets := make([]BackupTarget, 0, len(list.Items))
+	for _, item := range list.Items {
+		target := BackupTarget{Name: item.GetName()}
+		target.URL, _, _ = unstructured.NestedString(item.Object, "spec", "backupTargetURL")
+		target.CredentialSecret, _, _ = unstructured.NestedString(item.Object, "spec", "credentialSecret")
+		target.PollInterval, _, _ = unstructured.NestedString(item.Object, "spec", "pollInterval")
+		target.Available, _, _ = unstructured.NestedBool(item.Object, "status", "available")
+		target.LastSyncedAt = nestedTime(item.Object, "status", "lastSyncedAt")
+
+		conditions, _, _ := unstructured.NestedSlice(item.Object, "status", "conditions")
+		for _, c := range conditions {
+			condition, ok := c.(map[string]interface{})
+			if ok && condition["type"] == "Unavailable" && condition["status"] == "True" {
+				target.Message, _ = condition["message"].(string)
+			}
+		}
+		targets = append(targets, target)
+	}
+	sort.Slice(targets, func(i, j int) bool { return targets[i].Name < targets[j].Name })
+	return targets, nil
+}
+
+// BackupVolumes lists the volumes with backups on target, or on every
+// target if target is empty, sorted by volume name.
+func (vm *VolumeManager) BackupVolumes(ctx context.Context, target string) ([]BackupVolume, error) {
+	var all []BackupVolume
+	if vm.useManagerAPI() {
+		var err error
+		if all, err = vm.managerBackupVolumes(ctx); err != nil {
+			return nil, err
+		}
+	} else {
+		list, err := vm.dynamicClient.Resource(longhornBackupVolumeGVR).Namespace("longhorn-system").List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list Longhorn backup volumes: %w", err)
+		}
+		for _, item := range list.Items {
+			bv := BackupVolume{
+				Name:   item.GetName(),
+				Volume: backupVolumeName(&item),
+				Target: backupTargetName(&item),
+			}
+			bv.Size = nestedSize(item.Object, "status", "size")
+			bv.DataStored = nestedSize(item.Object, "status", "dataStored")
+			bv.LastBackupName, _, _ = unstructured.NestedString(item.Object, "status", "lastBackupName")
+			bv.LastBackupAt = nestedTime(item.Object, "status", "lastBackupAt")
+			bv.Created = nestedTime(item.Object, "status", "createdAt")
+			all = append(all, bv)
+		}
+	}
+	backups, err := vm.Backups(ctx, target, "")
+	if err != nil {
+		return nil, err
+	}
+	counts := map[[2]string]int{}
+	for _, b := range backups {
+		counts[[2]string{b.Target, b.Volume}]++
+	}
+
+	volumes := make([]BackupVolume, 0, len(all))
+	for _, bv := range all {
+		if target != "" && bv.Target != target {
+			continue
+		}
+		bv.Backups = counts[[2]string{bv.Target, bv.Volume}]
+		volumes = append(volumes, bv)
+	}
+	sort.Slice(volumes, func(i, j int) bool {
+		if volumes[i].Volume != volumes[j].Volume {
+			return volumes[i].Volume < volumes[j].Volume
+		}
+		return volumes[i].Target < volumes[j].Target
+	})
+	return volumes, nil
+}
+
+// Backups lists the backups on target and of volumeName, either of which
+// may be empty to list all, newest first.
+func (vm *VolumeManager) Backups(ctx context.Context, target, volumeName string) ([]Backup, error) {
+	if vm.useManagerAPI() {
+		backups, err := vm.managerBackups(ctx, target, volumeName)
+		if err != nil {
+			return nil, err
+		}
+		sort.Slice(backups, func(i, j int) bool { return backups[i].Created.After(backups[j].Created) })
+		return backups, nil
+	}
+	list, err := vm.dynamicClient.Resource(longhornBackupGVR).Namespace("longhorn-system").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list Longhorn backups: %w", err)
+	}
+
+	var backups []Backup
+	for _, item := range list.Items {
+		b := Backup{Name: item.GetName(), Target: backupTargetName(&item)}
+		b.Volume, _, _ = unstructured.NestedString(item.Object, "status", "volumeName")
+		if b.Volume == "" {
+			b.Volume = item.GetLabels()["backup-volume"]
+		}
+		if (target != "" && b.Target != target) || (volumeName != "" && b.Volume != volumeName) {
+			continue
+		}
+		b.Snapshot, _, _ = unstructured.NestedString(item.Object, "status", "snapshotName")
+		b.State, _, _ = unstructured.NestedString(item.Object, "status", "state")
+		b.URL, _, _ = unstructured.NestedString(item.Object, "status", "url")
+		b.Size = nestedSize(item.Object, "status", "size")
+		b.Created = nestedTime(item.Object, "status", "backupCreatedAt")
+		backups = append(backups, b)
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].Created.After(backups[j].Created) })
+	return backups, nil
+}
+
+// backupTargetName returns the target a backup volume or backup belongs
+// to. Longhorn 1.8 records it in the spec and a label; older versions have
+// a single default target.
+func backupTargetName(item *unstructured.Unstructured) string {
+	if name, _, _ := unstructured.NestedString(item.Object, "spec", "backupTargetName"); name != "" {
+		return name
+	}
+	if name := item.GetLabels()["backup-target"]; name != "" {
+		return name
+	}
+	return DefaultBackupTarget
+}
+
+// backupVolumeName returns the Longhorn volume a backup volume holds. Before
+// Longhorn 1.8 the backup volume was named after it.
+func backupVolumeName(item *unstructured.Unstructured) string {
+	if name, _, _ := unstructured.NestedString(item.Object, "spec", "volumeName"); name != "" {
+		return name
+	}
+	if name := item.GetLabels()["backup-volume"]; name != "" {
+		return name
+	}
+	return item.GetName()
+}
+
+// nestedSize reads a byte count that Longhorn stores as a decimal string.
+func nestedSize(obj map[string]interface{}, fields ...string) int64 {
+	value, _, _ := unstructured.NestedString(obj, fields...)
+	size, _ := strconv.ParseInt(value, 10, 64)
+	return size
+}
+
+// nestedTime reads an RFC 3339 timestamp, returning the zero time if it is
+// missing or malformed.
+func nestedTime(obj map[string]interface{}, fields ...string) time.Time {
+	value, _, _ := unstructured.NestedString(obj, fields...)
+	t, _ := time.Parse(time.RFC3339, value)
+	return t
+}
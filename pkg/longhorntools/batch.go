@@ -0,0 +1,140 @@
+package longhorntools
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BatchResult records the outcome of one volume in a batch operation.
+type BatchResult struct {
+	Volume   string
+	Output   string
+	Skipped  bool
+	Err      error
+	Duration time.Duration
+}
+
+// ReadVolumeList reads volume names from a file, one per line. Blank lines
+// and lines starting with '#' are ignored.
+func ReadVolumeList(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open volume list: %w", err)
+	}
+	defer f.Close()
+
+	var volumes []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		volumes = append(volumes, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read volume list: %w", err)
+	}
+	return volumes, nil
+}
+
+// DownloadVolumes downloads several volumes into outputDir, running at most
+// parallel transfers at a time. Each volume is written to
+// <outputDir>/<volume><ext> and gets its own temporary pod.
+// The error reports how many volumes failed; results has the details.
+func (vm *VolumeManager) DownloadVolumes(ctx context.Context, volumes []string, namespace, outputDir, storageClass string, parallel int, opts DownloadOptions) ([]BatchResult, error) {
+	results, err := vm.downloadBatch(ctx, volumes, namespace, outputDir, storageClass, parallel, opts)
+	if err != nil {
+		return nil, err
+	}
+	return results, batchError(results)
+}
+
+// downloadBatch runs the worker pool behind DownloadVolumes and returns the
+// per-volume results in input order.
+func (vm *VolumeManager) downloadBatch(ctx context.Context, volumes []string, namespace, outputDir, storageClass string, parallel int, opts DownloadOptions) ([]BatchResult, error) {
+	if parallel < 1 {
+		parallel = 1
+	}
+
+	if vm.DryRun {
+		vm.dryRunf("create directory %s", outputDir)
+	} else if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	algo := opts.Compression
+	if algo == "" {
+		algo = CompressGzip
+	}
+	ext := CompressionExtension(algo)
+	if opts.Encrypt != "" {
+		scheme, _, _ := strings.Cut(opts.Encrypt, ":")
+		ext += "." + scheme
+	}
+
+	vm.printf("Downloading %d volumes to %s with %d parallel worker(s)\n\n", len(volumes), outputDir, parallel)
+
+	jobs := make(chan int)
+	results := make([]BatchResult, len(volumes))
+
+	var wg sync.WaitGroup
+	for w := 0; w < parallel; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				volume := volumes[i]
+				output := filepath.Join(outputDir, volume+ext)
+				result := BatchResult{Volume: volume, Output: output}
+
+				volOpts := opts
+				if opts.Resume {
+					// Only volumes with an interrupted transfer are resumed;
+					// finished ones are skipped and the rest start fresh
+					if _, err := os.Stat(downloadStatePath(output)); err != nil {
+						if _, err := os.Stat(output + ".sha256"); err == nil {
+							result.Skipped = true
+							results[i] = result
+							continue
+						}
+						volOpts.Resume = false
+					}
+				}
+
+				start := time.Now()
+				result.Err = vm.DownloadVolume(ctx, volume, namespace, output, storageClass, volOpts)
+				result.Duration = time.Since(start)
+				results[i] = result
+			}
+		}()
+	}
+
+	for i := range volumes {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results, nil
+}
+
+// batchError returns an error if any volume in a batch failed.
+func batchError(results []BatchResult) error {
+	failed := 0
+	for _, r := range results {
+		if r.Err != nil {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d volumes failed", failed, len(results))
+	}
+	return nil
+}
@@ -0,0 +1,246 @@
+package longhorntools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const bundleManifestName = "bundle.json"
+
+// bundleEntry describes one PVC captured in a namespace backup bundle.
+type bundleEntry struct {
+	PVC          string                              `json:"pvc"`
+	Volume       string                              `json:"volume"`
+	Size         string                              `json:"size"`
+	StorageClass string                              `json:"storageClass"`
+	AccessModes  []corev1.PersistentVolumeAccessMode `json:"accessModes"`
+	File         string                              `json:"file"`
+	SHA256       string                              `json:"sha256"`
+}
+
+// bundleManifest is written as bundle.json at the root of a backup bundle.
+type bundleManifest struct {
+	Namespace   string        `json:"namespace"`
+	Created     time.Time     `json:"created"`
+	Compression string        `json:"compression"`
+	Encrypted   bool          `json:"encrypted"`
+	Volumes     []bundleEntry `json:"volumes"`
+}
+
+// longhornPVC pairs a PVC with the Longhorn volume backing it.
+type longhornPVC struct {
+	PVC    corev1.PersistentVolumeClaim
+	Volume string
+}
+
+// findLonghornPVCs returns every bound PVC in namespace whose PV is
+// provisioned by the Longhorn CSI driver.
+func (vm *VolumeManager) findLonghornPVCs(ctx context.Context, namespace string) ([]longhornPVC, error) {
+	pvcs, err := vm.clientset.CoreV1().PersistentVolumeClaims(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list PVCs: %w", err)
+	}
+
+	var result []longhornPVC
+	for _, pvc := range pvcs.Items {
+		if pvc.Status.Phase != corev1.ClaimBound || pvc.Spec.VolumeName == "" {
+			continue
+		}
+
+		pv, err := vm.clientset.CoreV1().PersistentVolumes().Get(ctx, pvc.Spec.VolumeName, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get PV %s: %w", pvc.Spec.VolumeName, err)
+		}
+		if pv.Spec.CSI == nil || pv.Spec.CSI.Driver != "driver.longhorn.io" {
+			continue
+		}
+
+		result = append(result, longhornPVC{PVC: pvc, Volume: pv.Spec.CSI.VolumeHandle})
+	}
+
+	return result, nil
+}
+
+// BackupNamespace downloads every Longhorn-backed PVC in namespace into
+// outputDir and writes a bundle.json manifest describing them. The error
+// reports how many volumes failed; results has the details.
+func (vm *VolumeManager) BackupNamespace(ctx context.Context, namespace, outputDir, storageClass string, parallel int, opts DownloadOptions) ([]BatchResult, error) {
+	pvcs, err := vm.findLonghornPVCs(ctx, namespace)
+	if err != nil {
+		return nil, err
+	}
+	if len(pvcs) == 0 {
+		vm.printf("No Longhorn-backed PVCs found in namespace '%s'.\n", namespace)
+		return nil, nil
+	}
+
+	vm.printf("Found %d Longhorn-backed PVC(s) in namespace '%s':\n", len(pvcs), namespace)
+	volumes := make([]string, len(pvcs))
+	for i, p := range pvcs {
+		vm.printf("  - %s (volume %s)\n", p.PVC.Name, p.Volume)
+		volumes[i] = p.Volume
+	}
+	vm.println()
+
+	results, err := vm.downloadBatch(ctx, volumes, namespace, outputDir, storageClass, parallel, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	algo := opts.Compression
+	if algo == "" {
+		algo = CompressGzip
+	}
+	manifest := bundleManifest{
+		Namespace:   namespace,
+		Created:     time.Now().UTC(),
+		Compression: algo,
+		Encrypted:   opts.Encrypt != "",
+	}
+
+	for i, r := range results {
+		if r.Err != nil {
+			continue
+		}
+
+		pvc := pvcs[i].PVC
+		size := pvc.Spec.Resources.Requests[corev1.ResourceStorage]
+		entry := bundleEntry{
+			PVC:         pvc.Name,
+			Volume:      r.Volume,
+			Size:        size.String(),
+			AccessModes: pvc.Spec.AccessModes,
+			File:        filepath.Base(r.Output),
+		}
+		if pvc.Spec.StorageClassName != nil {
+			entry.StorageClass = *pvc.Spec.StorageClassName
+		}
+		if data, err := os.ReadFile(r.Output + ".sha256"); err == nil {
+			entry.SHA256, _, _ = strings.Cut(string(data), " ")
+		}
+
+		manifest.Volumes = append(manifest.Volumes, entry)
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode bundle manifest: %w", err)
+	}
+	manifestPath := filepath.Join(outputDir, bundleManifestName)
+	if vm.DryRun {
+		vm.dryRunf("write bundle manifest %s", manifestPath)
+		return results, batchError(results)
+	}
+	if err := os.WriteFile(manifestPath, append(data, '\n'), 0644); err != nil {
+		return nil, fmt.Errorf("failed to write bundle manifest: %w", err)
+	}
+	vm.printf("\nWrote bundle manifest %s\n", manifestPath)
+
+	return results, batchError(results)
+}
+
+// RestoreNamespace recreates the PVCs recorded in a backup bundle in
+// namespace and uploads their data. Existing PVCs are left untouched.
+// defaultStorageClass is used for entries that did not record one.
+func (vm *VolumeManager) RestoreNamespace(ctx context.Context, inputDir, namespace, defaultStorageClass string) ([]BatchResult, error) {
+	data, err := os.ReadFile(filepath.Join(inputDir, bundleManifestName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read bundle manifest: %w", err)
+	}
+
+	var manifest bundleManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse bundle manifest: %w", err)
+	}
+	if manifest.Encrypted {
+		return nil, fmt.Errorf("bundle is encrypted; decrypt the archives and set \"encrypted\": false in %s before restoring", bundleManifestName)
+	}
+
+	vm.printf("Restoring %d volume(s) from namespace '%s' into namespace '%s'\n\n",
+		len(manifest.Volumes), manifest.Namespace, namespace)
+
+	var results []BatchResult
+	for _, entry := range manifest.Volumes {
+		start := time.Now()
+		result := BatchResult{Volume: entry.PVC, Output: entry.File}
+
+		_, err := vm.clientset.CoreV1().PersistentVolumeClaims(namespace).Get(ctx, entry.PVC, metav1.GetOptions{})
+		if err == nil {
+			vm.printf("PVC %s already exists, skipping\n", entry.PVC)
+			result.Skipped = true
+			result.Output = "PVC already exists"
+			results = append(results, result)
+			continue
+		}
+
+		result.Err = vm.restoreBundleEntry(ctx, inputDir, namespace, defaultStorageClass, manifest.Compression, entry)
+		result.Duration = time.Since(start)
+		results = append(results, result)
+	}
+
+	return results, batchError(results)
+}
+
+func (vm *VolumeManager) restoreBundleEntry(ctx context.Context, inputDir, namespace, defaultStorageClass, algo string, entry bundleEntry) error {
+	size, err := resource.ParseQuantity(entry.Size)
+	if err != nil {
+		return fmt.Errorf("invalid size %q for PVC %s: %w", entry.Size, entry.PVC, err)
+	}
+
+	storageClass := entry.StorageClass
+	if storageClass == "" {
+		storageClass = defaultStorageClass
+	}
+	accessModes := entry.AccessModes
+	if len(accessModes) == 0 {
+		accessModes = []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce}
+	}
+
+	vm.printf("Creating PVC %s (%s, storage class %s)...\n", entry.PVC, entry.Size, storageClass)
+	pvc := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      entry.PVC,
+			Namespace: namespace,
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes: accessModes,
+			Resources: corev1.VolumeResourceRequirements{
+				Requests: corev1.ResourceList{
+					corev1.ResourceStorage: size,
+				},
+			},
+			StorageClassName: &storageClass,
+		},
+	}
+	if vm.DryRun {
+		vm.dryRunf("create PersistentVolumeClaim %s/%s", namespace, entry.PVC)
+	} else {
+		_, err = vm.clientset.CoreV1().PersistentVolumeClaims(namespace).Create(ctx, pvc, metav1.CreateOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to create PVC %s: %w", entry.PVC, err)
+		}
+	}
+
+	podName, mountPath, containerName, err := vm.createTemporaryPodForPVC(ctx, entry.PVC, namespace)
+	if err != nil {
+		return err
+	}
+	defer vm.deleteTemporaryPod(ctx, namespace, podName)
+
+	vm.printf("Uploading %s into PVC %s...\n", entry.File, entry.PVC)
+	err = vm.uploadArchive(ctx, namespace, podName, containerName, mountPath, filepath.Join(inputDir, entry.File), algo)
+	if err != nil {
+		return fmt.Errorf("failed to upload data for PVC %s: %w", entry.PVC, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,180 @@
+package longhorntools
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Longhorn's defaults for the settings that bound scheduling, used when the
+// settings cannot be read.
+const (
+	DefaultOverProvisioningPercentage = 100
+	DefaultMinimalAvailablePercentage = 25
+)
+
+// NodeCapacity compares what is provisioned on a node with the data its
+// replicas hold and the disk space behind them. Sizes are in bytes and sum
+// over all of the node's disks.
+type NodeCapacity struct {
+	Node string `json:"node"`
+	// Physical, Reserved, and Available are the disks' storage maximum,
+	// the space reserved for other uses, and the space left.
+	Physical  int64 `json:"physical"`
+	Reserved  int64 `json:"reserved"`
+	Available int64 `json:"available"`
+	// Provisioned is the full size of every replica scheduled to the
+	// node, and Actual the data they hold.
+	Provisioned int64 `json:"provisioned"`
+	Actual      int64 `json:"actual"`
+	Replicas    int   `json:"replicas"`
+	// Warnings lists the thresholds the node is beyond.
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// Used returns the disk space in use, by replicas or anything else.
+func (c NodeCapacity) Used() int64 {
+	return c.Physical - c.Available
+}
+
+// ProvisionedPercent returns Provisioned as a percentage of the space
+// Longhorn may schedule to, the physical space less the reserved space.
+func (c NodeCapacity) ProvisionedPercent() float64 {
+	if c.Physical-c.Reserved <= 0 {
+		return 0
+	}
+	return float64(c.Provisioned) * 100 / float64(c.Physical-c.Reserved)
+}
+
+// AvailablePercent returns Available as a percentage of Physical.
+func (c NodeCapacity) AvailablePercent() float64 {
+	if c.Physical <= 0 {
+		return 0
+	}
+	return float64(c.Available) * 100 / float64(c.Physical)
+}
+
+func (c *NodeCapacity) add(o NodeCapacity) {
+	c.Physical += o.Physical
+	c.Reserved += o.Reserved
+	c.Available += o.Available
+	c.Provisioned += o.Provisioned
+	c.Actual += o.Actual
+	c.Replicas += o.Replicas
+}
+
+// CapacityThresholds are the limits beyond which a node is flagged, in
+// percent. A zero value uses the Longhorn setting of the same meaning.
+type CapacityThresholds struct {
+	// MaxProvisioned flags nodes whose provisioned replica size exceeds
+	// this share of their schedulable space, like Longhorn's
+	// storage-over-provisioning-percentage.
+	MaxProvisioned int
+	// MinAvailable flags nodes with less than this share of their disk
+	// space available, like Longhorn's storage-minimal-available-percentage.
+	MinAvailable int
+}
+
+// CapacityReport is the result of Capacity.
+type CapacityReport struct {
+	Nodes   []NodeCapacity `json:"nodes"`
+	Cluster NodeCapacity   `json:"cluster"`
+	// Volumes is the number of volumes and VolumeSize their total size
+	// before replication.
+	Volumes    int   `json:"volumes"`
+	VolumeSize int64 `json:"volumeSize"`
+	// Thresholds are the limits that were applied.
+	Thresholds CapacityThresholds `json:"thresholds"`
+}
+
+// Flagged returns the nodes beyond a threshold.
+func (r *CapacityReport) Flagged() []NodeCapacity {
+	var flagged []NodeCapacity
+	for _, n := range r.Nodes {
+		if len(n.Warnings) > 0 {
+			flagged = append(flagged, n)
+		}
+	}
+	return flagged
+}
+
+// Capacity reports the provisioned, actual, and physical capacity of every
+// Longhorn node and of the cluster, and flags nodes beyond thresholds. A
+// replica's actual size is taken to be its volume's, which Longhorn
+// reports per replica.
+func (vm *VolumeManager) Capacity(ctx context.Context, thresholds CapacityThresholds) (*CapacityReport, error) {
+	nodes, err := vm.Nodes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	volumes, err := vm.Volumes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	replicas, err := vm.VolumeReplicas(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+
+	if thresholds.MaxProvisioned == 0 {
+		thresholds.MaxProvisioned = vm.percentSetting(ctx, "storage-over-provisioning-percentage", DefaultOverProvisioningPercentage)
+	}
+	if thresholds.MinAvailable == 0 {
+		thresholds.MinAvailable = vm.percentSetting(ctx, "storage-minimal-available-percentage", DefaultMinimalAvailablePercentage)
+	}
+	report := &CapacityReport{Cluster: NodeCapacity{Node: "cluster"}, Volumes: len(volumes), Thresholds: thresholds}
+
+	actualSize := make(map[string]int64)
+	for _, v := range volumes {
+		actualSize[v.Name] = v.ActualSize
+		size, _ := strconv.ParseInt(v.Size, 10, 64)
+		report.VolumeSize += size
+	}
+	byNode := make(map[string]*NodeCapacity)
+	for _, r := range replicas {
+		if r.Node == "" {
+			continue
+		}
+		if byNode[r.Node] == nil {
+			byNode[r.Node] = &NodeCapacity{Node: r.Node}
+		}
+		byNode[r.Node].Actual += actualSize[r.Volume]
+		byNode[r.Node].Replicas++
+	}
+
+	for _, n := range nodes {
+		c := NodeCapacity{Node: n.Name}
+		if fromReplicas := byNode[n.Name]; fromReplicas != nil {
+			c.Actual, c.Replicas = fromReplicas.Actual, fromReplicas.Replicas
+		}
+		c.Physical, c.Available, c.Reserved, c.Provisioned = n.Storage()
+
+		if p := c.ProvisionedPercent(); p > float64(thresholds.MaxProvisioned) {
+			c.Warnings = append(c.Warnings, fmt.Sprintf("provisioned %.0f%% > %d%%", p, thresholds.MaxProvisioned))
+		}
+		if a := c.AvailablePercent(); c.Physical > 0 && a < float64(thresholds.MinAvailable) {
+			c.Warnings = append(c.Warnings, fmt.Sprintf("available %.0f%% < %d%%", a, thresholds.MinAvailable))
+		}
+		report.Nodes = append(report.Nodes, c)
+		report.Cluster.add(c)
+	}
+	return report, nil
+}
+
+// percentSetting reads an integer Longhorn setting, falling back to def if
+// it cannot be read.
+func (vm *VolumeManager) percentSetting(ctx context.Context, name string, def int) int {
+	setting, err := vm.dynamicClient.Resource(longhornSettingGVR).Namespace("longhorn-system").Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return def
+	}
+	value, _, _ := unstructured.NestedString(setting.Object, "value")
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		return def
+	}
+	return n
+}
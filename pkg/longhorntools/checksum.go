@@ -0,0 +1,147 @@
+package longhorntools
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// writeChecksumFile writes a single sha256sum-compatible line for name.
+func writeChecksumFile(path, sum, name string) error {
+	line := fmt.Sprintf("%s  %s\n", sum, name)
+	if err := os.WriteFile(path, []byte(line), 0644); err != nil {
+		return fmt.Errorf("failed to write checksum file %s: %w", path, err)
+	}
+	return nil
+}
+
+// fileSummer computes a SHA-256 for every regular file in the pod's tar
+// stream as it is written, so per-file checksums can be produced without
+// reading the volume a second time.
+type fileSummer struct {
+	algo string
+	pw   *io.PipeWriter
+	done chan error
+	sums map[string]string
+}
+
+func newFileSummer(algo string) *fileSummer {
+	pr, pw := io.Pipe()
+	fs := &fileSummer{
+		algo: algo,
+		pw:   pw,
+		done: make(chan error, 1),
+		sums: make(map[string]string),
+	}
+
+	go func() {
+		err := fs.consume(pr)
+		// Keep draining so the writer side never blocks on a parse failure
+		io.Copy(io.Discard, pr)
+		fs.done <- err
+	}()
+
+	return fs
+}
+
+func (fs *fileSummer) consume(r io.Reader) error {
+	stream, err := newPodStreamReader(fs.algo, r)
+	if err != nil {
+		return err
+	}
+
+	tr := tar.NewReader(stream)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read tar stream: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		h := sha256.New()
+		if _, err := io.Copy(h, tr); err != nil {
+			return fmt.Errorf("failed to hash %s: %w", header.Name, err)
+		}
+		fs.sums[header.Name] = hex.EncodeToString(h.Sum(nil))
+	}
+}
+
+func (fs *fileSummer) Write(p []byte) (int, error) {
+	return fs.pw.Write(p)
+}
+
+// Close finishes parsing the stream and writes a SHA256SUMS-style manifest
+// to path, with entries sorted by file name.
+func (fs *fileSummer) Close(path string) error {
+	fs.pw.Close()
+	if err := <-fs.done; err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(fs.sums))
+	for name := range fs.sums {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&b, "%s  %s\n", fs.sums[name], name)
+	}
+
+	if err := os.WriteFile(path, []byte(b.String()), 0644); err != nil {
+		return fmt.Errorf("failed to write file checksums %s: %w", path, err)
+	}
+	return nil
+}
+
+// verifiedExtractScript extracts the tar stream on stdin into the directory
+// in $1 and prints the SHA-256 of every byte it received, so a copy can be
+// checked against what was sent. Whatever follows the end-of-archive
+// blocks is read too, so the hash covers the whole stream, and tar's exit
+// status is kept without relying on pipefail, which dash lacks. Images
+// without sha256sum or /dev/fd only extract.
+const verifiedExtractScript = `command -v sha256sum >/dev/null 2>&1 && [ -e /dev/fd/1 ] || exec tar -xf - -C "$1"
+exec 4>&1
+status=$( { { tee /dev/fd/3 | { tar -xf - -C "$1"; echo $? >&5; cat >/dev/null; }; } 3>&1 | sha256sum >&4; } 5>&1 )
+exit "$status"`
+
+// extractVerified extracts the tar stream from reader into destPath in the
+// pod and compares the SHA-256 of what the pod received with sent, the
+// hash of what was written to reader. sent is read once the pod has seen
+// the end of the stream, so the writer must hash each chunk before writing
+// it and close the pipe when done.
+func (vm *VolumeManager) extractVerified(ctx context.Context, namespace, podName, containerName, destPath string, reader io.Reader, sent hash.Hash) error {
+	var out bytes.Buffer
+	err := vm.streamExec(ctx, namespace, podName, containerName,
+		[]string{"sh", "-c", verifiedExtractScript, "sh", destPath},
+		countingReader{r: reader, counter: bytesTransferred.WithLabelValues("to_pod")}, &out)
+	if err != nil || vm.DryRun {
+		return err
+	}
+
+	fields := strings.Fields(out.String())
+	if len(fields) == 0 {
+		vm.printf("Warning: pod %s has no sha256sum; the copy stream was not verified\n", podName)
+		return nil
+	}
+	sum := hex.EncodeToString(sent.Sum(nil))
+	if fields[0] != sum {
+		return categorize(ErrVerification, fmt.Errorf("checksum mismatch: sent a stream with SHA-256 %s, but pod %s received %s", sum, podName, fields[0]))
+	}
+	vm.printf("Copy stream verified (SHA-256 %s)\n", sum)
+	return nil
+}
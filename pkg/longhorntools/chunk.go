@@ -0,0 +1,252 @@
+package longhorntools
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// chunkPart describes a single part file of a split archive.
+type chunkPart struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// chunkManifest is written next to the parts so that a split archive can be
+// verified and reassembled later.
+type chunkManifest struct {
+	Archive   string      `json:"archive"`
+	ChunkSize int64       `json:"chunkSize"`
+	TotalSize int64       `json:"totalSize"`
+	Created   time.Time   `json:"created"`
+	Parts     []chunkPart `json:"parts"`
+}
+
+// chunkWriter splits everything written to it into fixed-size part files
+// named <base>.000, <base>.001, ... and writes <base>.manifest.json on Close,
+// but not on Abort.
+type chunkWriter struct {
+	base      string
+	chunkSize int64
+
+	file    *os.File
+	hash    hash.Hash
+	written int64
+	total   int64
+	parts   []chunkPart
+}
+
+// ParseChunkSize parses a Kubernetes-style quantity such as "4Gi" or "500M".
+func ParseChunkSize(value string) (int64, error) {
+	q, err := resource.ParseQuantity(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid chunk size %q: %w", value, err)
+	}
+	size := q.Value()
+	if size <= 0 {
+		return 0, fmt.Errorf("chunk size must be positive, got %q", value)
+	}
+	return size, nil
+}
+
+func newChunkWriter(base string, chunkSize int64) *chunkWriter {
+	return &chunkWriter{base: base, chunkSize: chunkSize}
+}
+
+// existingChunkParts returns the part files already written for base, in
+// order, stopping at the first missing index.
+func existingChunkParts(base string) []string {
+	var names []string
+	for i := 0; ; i++ {
+		name := fmt.Sprintf("%s.%03d", base, i)
+		if _, err := os.Stat(name); err != nil {
+			return names
+		}
+		names = append(names, name)
+	}
+}
+
+// openChunkParts returns a reader over the concatenation of all existing
+// parts for base. The returned function closes the underlying files.
+func openChunkParts(base string) (io.Reader, func(), error) {
+	var readers []io.Reader
+	var files []*os.File
+	closeAll := func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}
+
+	for _, name := range existingChunkParts(base) {
+		f, err := os.Open(name)
+		if err != nil {
+			closeAll()
+			return nil, nil, fmt.Errorf("failed to open chunk %s: %w", name, err)
+		}
+		files = append(files, f)
+		readers = append(readers, f)
+	}
+
+	return io.MultiReader(readers...), closeAll, nil
+}
+
+// resumeChunkWriter reopens a partially written split archive. Completed
+// parts are re-hashed for the manifest and the last part is appended to.
+func resumeChunkWriter(base string, chunkSize int64) (*chunkWriter, error) {
+	c := newChunkWriter(base, chunkSize)
+
+	names := existingChunkParts(base)
+	for i, name := range names {
+		info, err := os.Stat(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat chunk %s: %w", name, err)
+		}
+		if info.Size() > chunkSize {
+			return nil, fmt.Errorf("chunk %s is larger than the chunk size; was it written with a different --chunk-size?", name)
+		}
+
+		h := sha256.New()
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open chunk %s: %w", name, err)
+		}
+		_, err = io.Copy(h, f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read chunk %s: %w", name, err)
+		}
+		c.total += info.Size()
+
+		if info.Size() == chunkSize || i < len(names)-1 {
+			c.parts = append(c.parts, chunkPart{
+				Name:   filepath.Base(name),
+				Size:   info.Size(),
+				SHA256: hex.EncodeToString(h.Sum(nil)),
+			})
+			continue
+		}
+
+		// Last, partially filled part: keep appending to it
+		f, err = os.OpenFile(name, os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to reopen chunk %s: %w", name, err)
+		}
+		c.file = f
+		c.hash = h
+		c.written = info.Size()
+	}
+
+	return c, nil
+}
+
+func (c *chunkWriter) partName(index int) string {
+	return fmt.Sprintf("%s.%03d", c.base, index)
+}
+
+func (c *chunkWriter) openPart() error {
+	name := c.partName(len(c.parts))
+	f, err := os.Create(name)
+	if err != nil {
+		return fmt.Errorf("failed to create chunk %s: %w", name, err)
+	}
+	c.file = f
+	c.hash = sha256.New()
+	c.written = 0
+	return nil
+}
+
+func (c *chunkWriter) closePart() error {
+	if c.file == nil {
+		return nil
+	}
+	name := c.file.Name()
+	if err := c.file.Close(); err != nil {
+		return fmt.Errorf("failed to close chunk %s: %w", name, err)
+	}
+	c.parts = append(c.parts, chunkPart{
+		Name:   filepath.Base(name),
+		Size:   c.written,
+		SHA256: hex.EncodeToString(c.hash.Sum(nil)),
+	})
+	c.file = nil
+	return nil
+}
+
+func (c *chunkWriter) Write(p []byte) (int, error) {
+	total := 0
+	for len(p) > 0 {
+		if c.file == nil {
+			if err := c.openPart(); err != nil {
+				return total, err
+			}
+		}
+
+		n := int64(len(p))
+		if remaining := c.chunkSize - c.written; n > remaining {
+			n = remaining
+		}
+
+		written, err := c.file.Write(p[:n])
+		c.hash.Write(p[:written])
+		c.written += int64(written)
+		c.total += int64(written)
+		total += written
+		if err != nil {
+			return total, fmt.Errorf("failed to write chunk %s: %w", c.file.Name(), err)
+		}
+		p = p[written:]
+
+		if c.written == c.chunkSize {
+			if err := c.closePart(); err != nil {
+				return total, err
+			}
+		}
+	}
+	return total, nil
+}
+
+// Abort finishes the current part without writing the manifest, for a
+// transfer that failed. The parts stay for --resume, but are not presented
+// as a complete archive; a manifest left from an earlier run is removed.
+func (c *chunkWriter) Abort() error {
+	err := c.closePart()
+	if rmErr := os.Remove(c.base + ".manifest.json"); rmErr != nil && !os.IsNotExist(rmErr) && err == nil {
+		err = fmt.Errorf("failed to remove stale chunk manifest: %w", rmErr)
+	}
+	return err
+}
+
+// Close finishes the current part and writes the manifest.
+func (c *chunkWriter) Close() error {
+	if err := c.closePart(); err != nil {
+		return err
+	}
+
+	manifest := chunkManifest{
+		Archive:   filepath.Base(c.base),
+		ChunkSize: c.chunkSize,
+		TotalSize: c.total,
+		Created:   time.Now().UTC(),
+		Parts:     c.parts,
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode chunk manifest: %w", err)
+	}
+
+	manifestPath := c.base + ".manifest.json"
+	if err := os.WriteFile(manifestPath, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write chunk manifest: %w", err)
+	}
+	return nil
+}
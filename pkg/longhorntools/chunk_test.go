@@ -0,0 +1,107 @@
+package longhorntools
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestChunkWriter(t *testing.T) {
+	base := filepath.Join(t.TempDir(), "backup.tar.gz")
+	data := bytes.Repeat([]byte("0123456789"), 25)
+
+	c := newChunkWriter(base, 100)
+	// Writes that straddle part boundaries
+	for _, p := range [][]byte{data[:30], data[30:170], data[170:]} {
+		if n, err := c.Write(p); err != nil || n != len(p) {
+			t.Fatalf("Write = %d, %v", n, err)
+		}
+	}
+	if err := c.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	if got := existingChunkParts(base); len(got) != 3 {
+		t.Fatalf("got parts %v, want 3", got)
+	}
+	r, closeAll, err := openChunkParts(base)
+	if err != nil {
+		t.Fatalf("openChunkParts: %v", err)
+	}
+	joined, _ := io.ReadAll(r)
+	closeAll()
+	if !bytes.Equal(joined, data) {
+		t.Errorf("parts do not reassemble to the written data")
+	}
+
+	raw, err := os.ReadFile(base + ".manifest.json")
+	if err != nil {
+		t.Fatalf("manifest: %v", err)
+	}
+	var manifest chunkManifest
+	if err := json.Unmarshal(raw, &manifest); err != nil {
+		t.Fatalf("manifest: %v", err)
+	}
+	if manifest.Archive != "backup.tar.gz" || manifest.ChunkSize != 100 || manifest.TotalSize != int64(len(data)) {
+		t.Errorf("manifest = %+v", manifest)
+	}
+	wantSizes := []int64{100, 100, 50}
+	for i, part := range manifest.Parts {
+		sum := sha256.Sum256(data[i*100 : i*100+int(part.Size)])
+		if part.Size != wantSizes[i] || part.SHA256 != hex.EncodeToString(sum[:]) {
+			t.Errorf("part %d = %+v", i, part)
+		}
+	}
+}
+
+func TestChunkWriterResumeAndAbort(t *testing.T) {
+	base := filepath.Join(t.TempDir(), "backup.tar")
+	data := bytes.Repeat([]byte("abcdefghij"), 20)
+
+	// A complete earlier run leaves a manifest that an aborted run must
+	// remove
+	c := newChunkWriter(base, 64)
+	c.Write(data[:150])
+	if err := c.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	c, err := resumeChunkWriter(base, 64)
+	if err != nil {
+		t.Fatalf("resumeChunkWriter: %v", err)
+	}
+	c.Write(data[150:180])
+	if err := c.Abort(); err != nil {
+		t.Fatalf("Abort: %v", err)
+	}
+	if _, err := os.Stat(base + ".manifest.json"); !os.IsNotExist(err) {
+		t.Errorf("Abort left the manifest: %v", err)
+	}
+
+	c, err = resumeChunkWriter(base, 64)
+	if err != nil {
+		t.Fatalf("resumeChunkWriter: %v", err)
+	}
+	c.Write(data[180:])
+	if err := c.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	r, closeAll, err := openChunkParts(base)
+	if err != nil {
+		t.Fatalf("openChunkParts: %v", err)
+	}
+	joined, _ := io.ReadAll(r)
+	closeAll()
+	if !bytes.Equal(joined, data) {
+		t.Errorf("resumed parts do not reassemble to the written data")
+	}
+	if _, err := os.Stat(base + ".manifest.json"); err != nil {
+		t.Errorf("manifest: %v", err)
+	}
+}
@@ -0,0 +1,48 @@
+package longhorntools
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+// PodExecutor runs a command in a pod's container, connecting the given
+// streams. A nil streams.Stdin means the command gets no input.
+// NewVolumeManager uses the exec subresource; tests and offline mode
+// substitute their own.
+type PodExecutor interface {
+	Exec(ctx context.Context, namespace, podName, containerName string, command []string, streams remotecommand.StreamOptions) error
+}
+
+// spdyExecutor runs commands through the API server's exec subresource.
+type spdyExecutor struct {
+	clientset kubernetes.Interface
+	config    *rest.Config
+}
+
+func (e *spdyExecutor) Exec(ctx context.Context, namespace, podName, containerName string, command []string, streams remotecommand.StreamOptions) error {
+	req := e.clientset.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Name(podName).
+		Namespace(namespace).
+		SubResource("exec")
+
+	req.VersionedParams(&corev1.PodExecOptions{
+		Container: containerName,
+		Command:   command,
+		Stdin:     streams.Stdin != nil,
+		Stdout:    streams.Stdout != nil,
+		Stderr:    streams.Stderr != nil,
+	}, scheme.ParameterCodec)
+
+	exec, err := remotecommand.NewSPDYExecutor(e.config, "POST", req.URL())
+	if err != nil {
+		return fmt.Errorf("failed to create executor: %w", err)
+	}
+	return exec.StreamWithContext(ctx, streams)
+}
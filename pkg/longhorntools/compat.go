@@ -0,0 +1,208 @@
+package longhorntools
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+const (
+	// MinSupportedLonghornVersion is the first Longhorn release with the
+	// v1beta2 API this package is written against.
+	MinSupportedLonghornVersion = "1.3.0"
+	// LatestTestedLonghornVersion is the newest minor release this package
+	// has been tested with.
+	LatestTestedLonghornVersion = "1.9"
+)
+
+// longhornGroup is the API group of Longhorn's custom resources.
+const longhornGroup = "longhorn.io"
+
+// LonghornInfo is what DetectLonghorn found out about the installed
+// Longhorn.
+type LonghornInfo struct {
+	// Version is the Longhorn release, e.g. "v1.7.2", or empty if it
+	// could not be determined.
+	Version string `json:"version,omitempty"`
+	// APIVersion is the longhorn.io API version in use.
+	APIVersion string `json:"apiVersion"`
+	// Warnings describe what may not work with this installation.
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// DetectLonghorn finds the longhorn.io API versions the cluster serves and
+// the Longhorn release, and adapts the manager to them: on a release
+// before 1.3, which only serves v1beta1, Longhorn resources are read and
+// written at that version. It fails only if the cluster serves no Longhorn
+// API at all; a release that is older or newer than supported is reported
+// in the warnings.
+func (vm *VolumeManager) DetectLonghorn(ctx context.Context) (*LonghornInfo, error) {
+	info := &LonghornInfo{APIVersion: longhornVolumeGVR.Version}
+
+	groups, err := vm.clientset.Discovery().ServerGroups()
+	if err != nil {
+		info.Warnings = append(info.Warnings, fmt.Sprintf("cannot discover the Longhorn API, assuming %s: %v", info.APIVersion, err))
+		return info, nil
+	}
+	var served []string
+	for _, group := range groups.Groups {
+		if group.Name != longhornGroup {
+			continue
+		}
+		for _, v := range group.Versions {
+			served = append(served, v.Version)
+		}
+	}
+	switch {
+	case len(served) == 0:
+		return nil, fmt.Errorf("the cluster serves no %s API; is Longhorn installed?", longhornGroup)
+	case !containsString(served, longhornVolumeGVR.Version):
+		info.APIVersion = served[0]
+		vm.dynamicClient = &longhornAPIClient{Interface: vm.dynamicClient, version: info.APIVersion}
+		info.Warnings = append(info.Warnings, fmt.Sprintf("Longhorn serves %s %s, not %s; resources are accessed at %s, but some commands may fail",
+			longhornGroup, strings.Join(served, ", "), longhornVolumeGVR.Version, info.APIVersion))
+	}
+
+	info.Version = vm.longhornVersion(ctx)
+	if info.Version == "" {
+		info.Warnings = append(info.Warnings, "cannot determine the Longhorn version")
+		return info, nil
+	}
+	if v, ok := parseVersion(info.Version); ok {
+		min, _ := parseVersion(MinSupportedLonghornVersion)
+		latest, _ := parseVersion(LatestTestedLonghornVersion)
+		switch {
+		case compareParsedVersions(v, min) < 0:
+			info.Warnings = append(info.Warnings, fmt.Sprintf("Longhorn %s is older than %s, the oldest release lhc supports", info.Version, MinSupportedLonghornVersion))
+		case compareParsedVersions(v[:2], latest) > 0:
+			info.Warnings = append(info.Warnings, fmt.Sprintf("Longhorn %s is newer than %s, the latest release lhc was tested with", info.Version, LatestTestedLonghornVersion))
+		}
+	}
+	return info, nil
+}
+
+// longhornVersion reads the Longhorn release from the
+// current-longhorn-version setting or, on releases without it, from the
+// image tag of the longhorn-manager DaemonSet.
+func (vm *VolumeManager) longhornVersion(ctx context.Context) string {
+	setting, err := vm.dynamicClient.Resource(longhornSettingGVR).Namespace("longhorn-system").Get(ctx, "current-longhorn-version", metav1.GetOptions{})
+	if err == nil {
+		if value, _, _ := unstructured.NestedString(setting.Object, "value"); value != "" {
+			return value
+		}
+	}
+	ds, err := vm.clientset.AppsV1().DaemonSets("longhorn-system").Get(ctx, "longhorn-manager", metav1.GetOptions{})
+	if err != nil {
+		return ""
+	}
+	for _, c := range ds.Spec.Template.Spec.Containers {
+		image := c.Image
+		if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+			return image[i+1:]
+		}
+	}
+	return ""
+}
+
+// parseVersion parses a release such as "v1.7.2" or "1.9" into its
+// numbers, ignoring a pre-release suffix.
+func parseVersion(version string) ([]int, bool) {
+	version = strings.TrimPrefix(version, "v")
+	version, _, _ = strings.Cut(version, "-")
+	var parts []int
+	for _, p := range strings.Split(version, ".") {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return nil, false
+		}
+		parts = append(parts, n)
+	}
+	return parts, len(parts) >= 2
+}
+
+// compareParsedVersions compares two parsed versions, missing numbers
+// counting as zero.
+func compareParsedVersions(a, b []int) int {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var x, y int
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		if x < y {
+			return -1
+		}
+		if x > y {
+			return 1
+		}
+	}
+	return 0
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// longhornAPIClient accesses longhorn.io resources at the version the
+// cluster serves rather than the one they are declared with, and sends
+// objects with a matching apiVersion.
+type longhornAPIClient struct {
+	dynamic.Interface
+	version string
+}
+
+func (c *longhornAPIClient) Resource(gvr schema.GroupVersionResource) dynamic.NamespaceableResourceInterface {
+	if gvr.Group != longhornGroup {
+		return c.Interface.Resource(gvr)
+	}
+	gvr.Version = c.version
+	return &longhornResource{NamespaceableResourceInterface: c.Interface.Resource(gvr), apiVersion: gvr.GroupVersion().String()}
+}
+
+// longhornResource and longhornNamespacedResource rewrite the apiVersion
+// of the objects they create and update. Longhorn's resources are all
+// namespaced.
+type longhornResource struct {
+	dynamic.NamespaceableResourceInterface
+	apiVersion string
+}
+
+func (r *longhornResource) Namespace(namespace string) dynamic.ResourceInterface {
+	return &longhornNamespacedResource{ResourceInterface: r.NamespaceableResourceInterface.Namespace(namespace), apiVersion: r.apiVersion}
+}
+
+type longhornNamespacedResource struct {
+	dynamic.ResourceInterface
+	apiVersion string
+}
+
+func (r *longhornNamespacedResource) Create(ctx context.Context, obj *unstructured.Unstructured, options metav1.CreateOptions, subresources ...string) (*unstructured.Unstructured, error) {
+	obj = obj.DeepCopy()
+	obj.SetAPIVersion(r.apiVersion)
+	return r.ResourceInterface.Create(ctx, obj, options, subresources...)
+}
+
+func (r *longhornNamespacedResource) Update(ctx context.Context, obj *unstructured.Unstructured, options metav1.UpdateOptions, subresources ...string) (*unstructured.Unstructured, error) {
+	obj = obj.DeepCopy()
+	obj.SetAPIVersion(r.apiVersion)
+	return r.ResourceInterface.Update(ctx, obj, options, subresources...)
+}
+
+func (r *longhornNamespacedResource) UpdateStatus(ctx context.Context, obj *unstructured.Unstructured, options metav1.UpdateOptions) (*unstructured.Unstructured, error) {
+	obj = obj.DeepCopy()
+	obj.SetAPIVersion(r.apiVersion)
+	return r.ResourceInterface.UpdateStatus(ctx, obj, options)
+}
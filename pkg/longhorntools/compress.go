@@ -0,0 +1,292 @@
+package longhorntools
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Supported archive compression algorithms.
+const (
+	CompressNone = "none"
+	CompressGzip = "gzip"
+	CompressZstd = "zstd"
+	CompressXz   = "xz"
+)
+
+// validateCompression checks the algorithm name and level. A level of zero
+// selects the algorithm's default.
+func validateCompression(algo string, level int) error {
+	switch algo {
+	case CompressNone:
+		if level != 0 {
+			return fmt.Errorf("--compress-level has no effect with --compress=none")
+		}
+	case CompressGzip:
+		if level < 0 || level > 9 {
+			return fmt.Errorf("gzip compression level must be between 1 and 9, got %d", level)
+		}
+	case CompressZstd:
+		if level < 0 || level > 22 {
+			return fmt.Errorf("zstd compression level must be between 1 and 22, got %d", level)
+		}
+	case CompressXz:
+		if level < 0 || level > 9 {
+			return fmt.Errorf("xz compression level must be between 1 and 9, got %d", level)
+		}
+	default:
+		return fmt.Errorf("unsupported compression %q (expected none, gzip, zstd, or xz)", algo)
+	}
+	return nil
+}
+
+// CompressionExtension returns the conventional archive extension for algo.
+func CompressionExtension(algo string) string {
+	switch algo {
+	case CompressGzip:
+		return ".tar.gz"
+	case CompressZstd:
+		return ".tar.zst"
+	case CompressXz:
+		return ".tar.xz"
+	default:
+		return ".tar"
+	}
+}
+
+// DefaultCompressImage runs the temporary pods of zstd and xz downloads,
+// which compress in the pod. Its base set of packages has both, besides
+// GNU tar.
+const DefaultCompressImage = "archlinux:base"
+
+// compressImage returns the image a temporary pod needs to compress with
+// algo in the pod, or "" if the temp image will do.
+func compressImage(algo string) string {
+	if algo == CompressZstd || algo == CompressXz {
+		return DefaultCompressImage
+	}
+	return ""
+}
+
+// podCompressFilter returns the shell filter appended to the tar pipeline
+// inside the pod to compress with algo, or "" for CompressNone.
+func podCompressFilter(algo string, level int) string {
+	var filter string
+	switch algo {
+	case CompressGzip:
+		// -n omits the timestamp so the output is reproducible
+		filter = "gzip -n"
+	case CompressZstd:
+		filter = "zstd -q -c"
+		if level > 19 {
+			filter += " --ultra"
+		}
+	case CompressXz:
+		filter = "xz -c"
+	default:
+		return ""
+	}
+	if level > 0 {
+		filter += fmt.Sprintf(" -%d", level)
+	}
+	return filter
+}
+
+// podCompression returns how the pod compresses an archive for algo:
+// algo itself, or CompressNone if the pod lacks its compressor and the
+// stream has to be compressed locally instead. gzip is taken to be in
+// every image.
+func (vm *VolumeManager) podCompression(ctx context.Context, namespace, podName, containerName, algo string) string {
+	if algo == CompressNone || algo == CompressGzip || vm.DryRun {
+		return algo
+	}
+	err := vm.streamExec(ctx, namespace, podName, containerName, []string{"sh", "-c", "command -v " + algo}, nil, io.Discard)
+	if err == nil {
+		return algo
+	}
+	vm.printf("Warning: pod %s has no %s; compressing locally, so the archive leaves the pod uncompressed\n", podName, algo)
+	return CompressNone
+}
+
+// withCompressImage returns a temporary pod hook that runs the pod from
+// the image algo needs to compress in the pod, if any. An explicit
+// TempImage is kept; podCompression finds out whether it has the
+// compressor.
+func (vm *VolumeManager) withCompressImage(algo string) func(*corev1.PodSpec) {
+	image := compressImage(algo)
+	if image == "" || vm.TempImage != "" {
+		return nil
+	}
+	return func(spec *corev1.PodSpec) {
+		spec.Containers[0].Image = vm.resolveImage(image)
+	}
+}
+
+// xzDictCap is the dictionary size of each xz level.
+var xzDictCap = [...]int{0: 256 << 10, 1: 1 << 20, 2: 2 << 20, 3: 4 << 20, 4: 4 << 20, 5: 8 << 20, 6: 8 << 20, 7: 16 << 20, 8: 32 << 20, 9: 64 << 20}
+
+// newLocalCompressor wraps w with a client-side compressor for algo, for
+// pods that cannot compress with it themselves. It returns nil for gzip
+// and CompressNone.
+func newLocalCompressor(algo string, level int, w io.Writer) (io.WriteCloser, error) {
+	switch algo {
+	case CompressZstd:
+		zopts := []zstd.EOption{}
+		if level > 0 {
+			zopts = append(zopts, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+		}
+		enc, err := zstd.NewWriter(w, zopts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create zstd encoder: %w", err)
+		}
+		return enc, nil
+
+	case CompressXz:
+		// The xz package has no presets; the dictionary size is what
+		// mostly sets xz's levels apart, and its default matches level 6
+		var config xz.WriterConfig
+		if level > 0 {
+			config.DictCap = xzDictCap[level]
+		}
+		enc, err := config.NewWriter(w)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create xz encoder: %w", err)
+		}
+		return enc, nil
+	}
+	return nil, nil
+}
+
+// newPodStreamReader returns a reader yielding the raw tar stream from the
+// bytes a pod compressing with algo produces.
+func newPodStreamReader(algo string, r io.Reader) (io.Reader, error) {
+	switch algo {
+	case CompressGzip:
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read gzip stream: %w", err)
+		}
+		return gz, nil
+	case CompressZstd, CompressXz:
+		return newLocalDecompressor(algo, r)
+	}
+	return r, nil
+}
+
+// podArchiveCommand returns the shell pipeline that archives mountPath
+// inside the pod, including the in-pod part of algo. With sparse, holes
+// are recorded rather than archived as zeros. A positive skip drops that
+// many bytes from the start of the output, to resume a download.
+func podArchiveCommand(algo string, level int, mountPath string, sparse bool, skip int64) string {
+	commands := []string{fmt.Sprintf("%s -C %s .", strings.Join(tarCreateArgs(sparse), " "), shellQuote(mountPath))}
+	if filter := podCompressFilter(algo, level); filter != "" {
+		commands = append(commands, filter)
+	}
+	if skip > 0 {
+		commands = append(commands, fmt.Sprintf("tail -c +%d", skip+1))
+	}
+	return shellPipeline(commands...)
+}
+
+// shellPipeline joins commands into a shell pipeline that fails if any of
+// them fails, not only the last. Each command reports its exit status on
+// fd 3 instead of relying on pipefail, which dash, the /bin/sh of Debian
+// and Ubuntu images, lacks. The pipeline's output goes to stdout as usual.
+func shellPipeline(commands ...string) string {
+	if len(commands) == 1 {
+		return commands[0]
+	}
+	stages := make([]string, len(commands))
+	for i, command := range commands {
+		stages[i] = fmt.Sprintf("{ %s; echo $? >&3; }", command)
+	}
+	return fmt.Sprintf(`exec 4>&1
+for status in $( { %s >&4; } 3>&1 ); do [ "$status" -eq 0 ] || exit "$status"; done`, strings.Join(stages, " | "))
+}
+
+// podExtractCommand returns the command that unpacks the stream produced by
+// newLocalDecompressor into mountPath inside the pod.
+func podExtractCommand(algo, mountPath string) []string {
+	if algo == CompressGzip {
+		return []string{"tar", "-xzf", "-", "-C", mountPath}
+	}
+	return []string{"tar", "-xf", "-", "-C", mountPath}
+}
+
+// newLocalDecompressor undoes the client-side part of algo so the result
+// can be fed to podExtractCommand. gzip is left for the pod to decompress.
+func newLocalDecompressor(algo string, r io.Reader) (io.Reader, error) {
+	switch algo {
+	case CompressZstd:
+		dec, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create zstd decoder: %w", err)
+		}
+		return dec.IOReadCloser(), nil
+
+	case CompressXz:
+		dec, err := xz.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create xz decoder: %w", err)
+		}
+		return dec, nil
+	}
+	return r, nil
+}
+
+// Magic bytes at the start of each compressed format, and of the ustar
+// header at offset 257 of a plain tar archive.
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	xzMagic   = []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+	tarMagic  = []byte("ustar")
+	ageMagic  = []byte("age-encryption.org/")
+
+	// pgpSessionKeyTags are the first bytes of the OpenPGP packets gpg
+	// starts an encrypted message with: a public-key or symmetric-key
+	// encrypted session key, in the old or new packet format.
+	pgpSessionKeyTags = []byte{0x84, 0x85, 0x86, 0x8c, 0x8d, 0xc1, 0xc3}
+)
+
+// tarMagicOffset is where the ustar magic sits in a tar header.
+const tarMagicOffset = 257
+
+// detectCompression identifies the archive r starts with from its magic
+// bytes, without consuming them. Encrypted archives and anything that is
+// not a tar archive are reported as errors, rather than left for tar in
+// the pod to fail on.
+func detectCompression(r *bufio.Reader) (string, error) {
+	head, err := r.Peek(tarMagicOffset + len(tarMagic))
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return "", fmt.Errorf("failed to read archive: %w", err)
+	}
+	switch {
+	case bytes.HasPrefix(head, gzipMagic):
+		return CompressGzip, nil
+	case bytes.HasPrefix(head, zstdMagic):
+		return CompressZstd, nil
+	case bytes.HasPrefix(head, xzMagic):
+		return CompressXz, nil
+	case len(head) >= tarMagicOffset+len(tarMagic) && bytes.Equal(head[tarMagicOffset:tarMagicOffset+len(tarMagic)], tarMagic):
+		return CompressNone, nil
+	case len(head) >= tarMagicOffset && len(bytes.Trim(head, "\x00")) == 0:
+		// The end-of-archive blocks of an empty tar archive
+		return CompressNone, nil
+	case bytes.HasPrefix(head, ageMagic), bytes.HasPrefix(head, []byte("-----BEGIN AGE")):
+		return "", fmt.Errorf("archive is encrypted with age; decrypt it first")
+	case bytes.HasPrefix(head, []byte("-----BEGIN PGP")), len(head) > 0 && bytes.IndexByte(pgpSessionKeyTags, head[0]) >= 0:
+		return "", fmt.Errorf("archive appears to be encrypted with gpg; decrypt it first")
+	case len(head) == 0:
+		return "", fmt.Errorf("archive is empty")
+	}
+	return "", fmt.Errorf("archive is not a tar, tar.gz, tar.zst, or tar.xz file")
+}
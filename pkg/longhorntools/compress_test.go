@@ -0,0 +1,57 @@
+package longhorntools
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestDetectCompression(t *testing.T) {
+	var tarball bytes.Buffer
+	tw := tar.NewWriter(&tarball)
+	tw.WriteHeader(&tar.Header{Name: "a.txt", Mode: 0644, Size: 1})
+	tw.Write([]byte("a"))
+	tw.Close()
+
+	var empty bytes.Buffer
+	tar.NewWriter(&empty).Close()
+
+	tests := []struct {
+		name  string
+		data  []byte
+		want  string
+		error string
+	}{
+		{name: "gzip", data: []byte{0x1f, 0x8b, 0x08, 0x00}, want: CompressGzip},
+		{name: "zstd", data: []byte{0x28, 0xb5, 0x2f, 0xfd, 0x00}, want: CompressZstd},
+		{name: "xz", data: []byte{0xfd, '7', 'z', 'X', 'Z', 0x00, 0x00}, want: CompressXz},
+		{name: "tar", data: tarball.Bytes(), want: CompressNone},
+		{name: "empty tar", data: empty.Bytes(), want: CompressNone},
+		{name: "age", data: []byte("age-encryption.org/v1\n"), error: "age"},
+		{name: "armored age", data: []byte("-----BEGIN AGE ENCRYPTED FILE-----\n"), error: "age"},
+		{name: "armored gpg", data: []byte("-----BEGIN PGP MESSAGE-----\n"), error: "gpg"},
+		{name: "gpg", data: []byte{0x85, 0x01, 0x0c}, error: "gpg"},
+		{name: "empty", data: nil, error: "empty"},
+		{name: "text", data: []byte("hello world\n"), error: "not a tar"},
+	}
+	for _, tt := range tests {
+		r := bufio.NewReader(bytes.NewReader(tt.data))
+		got, err := detectCompression(r)
+		if tt.error != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.error) {
+				t.Errorf("%s: detectCompression = %q, %v; want an error mentioning %q", tt.name, got, err, tt.error)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("%s: detectCompression = %q, %v; want %q", tt.name, got, err, tt.want)
+		}
+
+		// The magic bytes are left for the decompressor
+		if rest, _ := r.Peek(len(tt.data)); !bytes.Equal(rest, tt.data) {
+			t.Errorf("%s: detectCompression consumed input", tt.name)
+		}
+	}
+}
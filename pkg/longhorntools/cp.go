@@ -0,0 +1,331 @@
+package longhorntools
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// CopyEndpoint is one side of CopyFiles: a path inside a volume, or a local
+// path if Volume is empty.
+type CopyEndpoint struct {
+	Volume string
+	Path   string
+}
+
+// ParseCopyEndpoint parses "<volume>:<path>" or a local path. The volume
+// may be any identifier ResolveVolume accepts, such as
+// pvc:<namespace>/<name>; the path after its last colon is relative to the
+// volume's root. Paths starting with "/" or "." are always local.
+func ParseCopyEndpoint(s string) CopyEndpoint {
+	if strings.HasPrefix(s, "/") || strings.HasPrefix(s, ".") {
+		return CopyEndpoint{Path: s}
+	}
+	i := strings.LastIndex(s, ":")
+	if i <= 0 {
+		return CopyEndpoint{Path: s}
+	}
+	return CopyEndpoint{Volume: s[:i], Path: s[i+1:]}
+}
+
+func (e CopyEndpoint) String() string {
+	if e.Volume == "" {
+		return e.Path
+	}
+	return e.Volume + ":" + e.Path
+}
+
+// volumePath splits the endpoint's path into the directory and the name
+// of what it names, relative to the volume root. The root itself is ".".
+func (e CopyEndpoint) volumePath() (dir, base string) {
+	cleaned := path.Clean("/" + e.Path)
+	if cleaned == "/" {
+		return "/", "."
+	}
+	return path.Dir(cleaned), path.Base(cleaned)
+}
+
+// intoDir reports whether the endpoint's path ends in a slash, so a copy
+// goes inside it even if it does not exist yet.
+func (e CopyEndpoint) intoDir() bool {
+	return e.Path == "" || strings.HasSuffix(e.Path, "/")
+}
+
+// copyExtractScript extracts a tar stream of a single file or directory
+// named $base onto $dest in a volume. As with cp, an existing directory
+// receives the copy inside it, a directory onto a directory is merged, and
+// anything else is replaced. Extracting into a scratch directory first
+// keeps a failed copy from leaving half a file behind.
+const copyExtractScript = `set -e
+dest=%s; base=%s; into=%s
+if [ -d "$dest" ] || [ "$into" = yes ]; then dir=$dest; name=$base; else dir=$(dirname "$dest"); name=$(basename "$dest"); fi
+mkdir -p "$dir"
+tmp=$(mktemp -d "$dir/.lhc-cp.XXXXXX")
+trap 'rm -rf "$tmp"' EXIT
+tar -xf - -C "$tmp"
+if [ "$base" = . ]; then src=$tmp; else src=$tmp/$base; fi
+if [ -d "$dir/$name" ] && [ -d "$src" ]; then cp -a "$src/." "$dir/$name/"; else rm -rf "$dir/$name"; mv "$src" "$dir/$name"; fi`
+
+// CopyFiles copies a single file or directory from src to dest, where
+// either may be in a volume and the other local, or both in volumes. Only
+// the named path is streamed, as a tar archive, through the pod mounting
+// each volume. Copies follow cp's rules: a destination that is an existing
+// directory, or ends in "/", receives the source inside it under its own
+// name; otherwise the source is written as the destination.
+func (vm *VolumeManager) CopyFiles(ctx context.Context, src, dest CopyEndpoint, namespace, storageClass string) error {
+	if src.Volume == "" && dest.Volume == "" {
+		return fmt.Errorf("at least one side of the copy must be a volume (<volume>:<path>)")
+	}
+	var volumes []string
+	for _, e := range []CopyEndpoint{src, dest} {
+		if e.Volume != "" {
+			volumes = append(volumes, e.Volume)
+		}
+	}
+	return vm.withVolumeLocks(ctx, volumes, func() error {
+		err := observeOperation("cp", func() error {
+			return vm.copyFiles(ctx, src, dest, namespace, storageClass)
+		})
+		if dest.Volume != "" {
+			vm.recordOperationResult(ctx, dest.Volume, "FilesCopied", "FilesCopyFailed", fmt.Sprintf("copy of %s to %s", src, dest.Path), err)
+		}
+		return err
+	})
+}
+
+// volumeAccess is a pod that mounts a volume.
+type volumeAccess struct {
+	pod, container, mountPath string
+}
+
+func (vm *VolumeManager) copyFiles(ctx context.Context, src, dest CopyEndpoint, namespace, storageClass string) error {
+	access := map[string]volumeAccess{}
+	for _, e := range []CopyEndpoint{src, dest} {
+		if e.Volume == "" {
+			continue
+		}
+		if _, ok := access[e.Volume]; ok {
+			continue
+		}
+		pod, mountPath, container, err := vm.getVolumeInfo(ctx, e.Volume, namespace, storageClass)
+		if err != nil {
+			return fmt.Errorf("volume %s error: %w", e.Volume, err)
+		}
+		defer vm.CleanupVolumeResources(ctx, e.Volume, namespace)
+		access[e.Volume] = volumeAccess{pod: pod, container: container, mountPath: mountPath}
+	}
+
+	srcDir, base := src.volumePath()
+	if src.Volume == "" {
+		abs, err := filepath.Abs(src.Path)
+		if err != nil {
+			return err
+		}
+		if _, err := os.Lstat(abs); err != nil {
+			return err
+		}
+		base = filepath.Base(abs)
+	}
+	if vm.DryRun {
+		vm.dryRunf("copy %s to %s", src, dest)
+		return nil
+	}
+
+	produce := func(w io.Writer) error {
+		if src.Volume == "" {
+			return writeLocalTar(w, src.Path)
+		}
+		a := access[src.Volume]
+		dir := path.Join(a.mountPath, srcDir)
+		script := fmt.Sprintf(`[ -e %s ] || { echo "%s: no such file or directory" >&2; exit 1; }; tar -cf - -C %s %s`,
+			shellQuote(path.Join(dir, base)), src.Path, shellQuote(dir), shellQuote(base))
+		return vm.execInPodWithOutput(ctx, namespace, a.pod, a.container, []string{"sh", "-c", script}, w)
+	}
+	consume := func(r io.Reader) error {
+		if dest.Volume == "" {
+			return extractLocalTar(r, dest.Path, base, dest.intoDir())
+		}
+		a := access[dest.Volume]
+		destDir, destBase := dest.volumePath()
+		target := path.Join(a.mountPath, destDir, destBase)
+		into := "no"
+		if dest.intoDir() {
+			into = "yes"
+		}
+		script := fmt.Sprintf(copyExtractScript, shellQuote(target), shellQuote(base), into)
+		return vm.execInPodWithInput(ctx, namespace, a.pod, a.container, []string{"sh", "-c", script}, r)
+	}
+
+	vm.printf("Copying %s to %s...\n", src, dest)
+	reader, writer := io.Pipe()
+	errChan := make(chan error, 2)
+	go func() {
+		err := produce(writer)
+		writer.CloseWithError(err)
+		errChan <- err
+	}()
+	go func() {
+		err := consume(reader)
+		if err != nil {
+			reader.CloseWithError(err)
+		} else {
+			// Drain what tar leaves unread, such as trailing padding, so the
+			// producer does not block
+			_, err = io.Copy(io.Discard, reader)
+		}
+		errChan <- err
+	}()
+	for i := 0; i < 2; i++ {
+		if err := <-errChan; err != nil {
+			return fmt.Errorf("copy failed: %w", err)
+		}
+	}
+	return nil
+}
+
+// writeLocalTar writes the local file or directory at root as a tar stream
+// whose entries start with root's base name.
+func writeLocalTar(w io.Writer, root string) error {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return err
+	}
+	parent := filepath.Dir(abs)
+	tw := tar.NewWriter(w)
+	err = filepath.WalkDir(abs, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		link := ""
+		if info.Mode()&fs.ModeSymlink != 0 {
+			if link, err = os.Readlink(p); err != nil {
+				return err
+			}
+		}
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return fmt.Errorf("%s: %w", p, err)
+		}
+		rel, err := filepath.Rel(parent, p)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(rel)
+		if d.IsDir() {
+			header.Name += "/"
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// extractLocalTar extracts a tar stream of the file or directory base onto
+// dest by the same rules as copyExtractScript. Entries that would land
+// outside the target are refused.
+func extractLocalTar(r io.Reader, dest, base string, intoDir bool) error {
+	target := dest
+	if info, err := os.Stat(dest); (err == nil && info.IsDir()) || intoDir {
+		name := base
+		if base == "." {
+			name = ""
+		}
+		target = filepath.Join(dest, name)
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		name := strings.TrimPrefix(header.Name, "./")
+		if base != "." {
+			rest, ok := strings.CutPrefix(name, base)
+			if !ok || (rest != "" && !strings.HasPrefix(rest, "/")) {
+				return fmt.Errorf("unexpected archive entry %q", header.Name)
+			}
+			name = strings.TrimPrefix(rest, "/")
+		}
+		name = strings.TrimSuffix(name, "/")
+		if name != "" && !filepath.IsLocal(name) {
+			return fmt.Errorf("refusing archive entry %q outside the destination", header.Name)
+		}
+		p := filepath.Join(target, filepath.FromSlash(name))
+		mode := fs.FileMode(header.Mode).Perm()
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if info, err := os.Lstat(p); err == nil && !info.IsDir() {
+				if err := os.Remove(p); err != nil {
+					return err
+				}
+			}
+			if err := os.MkdirAll(p, mode|0o700); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+				return err
+			}
+			if err := os.RemoveAll(p); err != nil {
+				return err
+			}
+			f, err := os.OpenFile(p, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(f, tr); err != nil {
+				f.Close()
+				return err
+			}
+			if err := f.Close(); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+				return err
+			}
+			if err := os.RemoveAll(p); err != nil {
+				return err
+			}
+			if err := os.Symlink(header.Linkname, p); err != nil {
+				return err
+			}
+		default:
+			// Devices, FIFOs, and hard links are not worth recreating locally
+			continue
+		}
+		if !header.ModTime.IsZero() && header.Typeflag != tar.TypeSymlink {
+			os.Chtimes(p, header.ModTime, header.ModTime)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package longhorntools
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// defaultCreateTimeout bounds the wait for a new volume to become ready
+// when --wait-timeout is not set.
+const defaultCreateTimeout = 2 * time.Minute
+
+// CreateVolumeOptions describes a new volume.
+type CreateVolumeOptions struct {
+	Size resource.Quantity
+	// Replicas is the number of replicas; zero uses Longhorn's default
+	// replica count, or the storage class's for a claim.
+	Replicas int64
+}
+
+// CreateVolume creates a Longhorn volume named volumeName without a PV or
+// PVC and waits for it to be ready, which for a new volume means detached.
+func (vm *VolumeManager) CreateVolume(ctx context.Context, volumeName string, opts CreateVolumeOptions) error {
+	if errs := validation.IsDNS1123Label(volumeName); len(errs) > 0 {
+		return fmt.Errorf("invalid volume name %q: %s", volumeName, strings.Join(errs, "; "))
+	}
+	if err := validateCreateOptions(opts); err != nil {
+		return err
+	}
+	return vm.withVolumeLocks(ctx, []string{volumeName}, func() error {
+		volumes := vm.dynamicClient.Resource(longhornVolumeGVR).Namespace("longhorn-system")
+		if _, err := volumes.Get(ctx, volumeName, metav1.GetOptions{}); err == nil {
+			return fmt.Errorf("Longhorn volume %s already exists", volumeName)
+		} else if !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to check for Longhorn volume %s: %w", volumeName, err)
+		}
+		err := observeOperation("create", func() error {
+			return vm.createVolume(ctx, volumeName, opts)
+		})
+		if !vm.DryRun {
+			vm.recordOperationResult(ctx, volumeName, "Created", "CreateFailed", fmt.Sprintf("creation with size %s", opts.Size.String()), err)
+		}
+		return err
+	})
+}
+
+func (vm *VolumeManager) createVolume(ctx context.Context, volumeName string, opts CreateVolumeOptions) error {
+	spec := map[string]interface{}{
+		"size":       strconv.FormatInt(opts.Size.Value(), 10),
+		"frontend":   "blockdev",
+		"accessMode": "rwo",
+	}
+	if opts.Replicas > 0 {
+		spec["numberOfReplicas"] = opts.Replicas
+	}
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": longhornVolumeGVR.GroupVersion().String(),
+		"kind":       "Volume",
+		"metadata": map[string]interface{}{
+			"name":      volumeName,
+			"namespace": "longhorn-system",
+		},
+		"spec": spec,
+	}}
+
+	if vm.DryRun {
+		vm.dryRunf("create Longhorn volume %s (%s)", volumeName, opts.Size.String())
+		return nil
+	}
+	vm.printf("Creating Longhorn volume %s (%s)...\n", volumeName, opts.Size.String())
+	_, err := vm.dynamicClient.Resource(longhornVolumeGVR).Namespace("longhorn-system").Create(ctx, obj, metav1.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to create Longhorn volume %s: %w", volumeName, err)
+	}
+	return vm.waitForVolumeReady(ctx, volumeName)
+}
+
+// CreateVolumeClaim creates the PVC namespace/pvcName from the Longhorn
+// storageClass and returns the name of the volume Longhorn provisions for
+// it. A storage class that binds on first use provisions nothing until a
+// pod mounts the claim; the returned name is then empty.
+func (vm *VolumeManager) CreateVolumeClaim(ctx context.Context, namespace, pvcName, storageClass string, opts CreateVolumeOptions) (string, error) {
+	if err := validateCreateOptions(opts); err != nil {
+		return "", err
+	}
+	var volumeName string
+	err := observeOperation("create", func() error {
+		var err error
+		volumeName, err = vm.createVolumeClaim(ctx, namespace, pvcName, storageClass, opts)
+		return err
+	})
+	if volumeName != "" {
+		vm.recordOperationResult(ctx, volumeName, "Created", "CreateFailed", fmt.Sprintf("creation for PVC %s/%s", namespace, pvcName), err)
+	}
+	return volumeName, err
+}
+
+func (vm *VolumeManager) createVolumeClaim(ctx context.Context, namespace, pvcName, storageClass string, opts CreateVolumeOptions) (string, error) {
+	sc, err := vm.clientset.StorageV1().StorageClasses().Get(ctx, storageClass, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("storage class %s not found: %w", storageClass, err)
+	}
+	if sc.Provisioner != "driver.longhorn.io" {
+		return "", fmt.Errorf("storage class %s is provisioned by %s, not driver.longhorn.io", storageClass, sc.Provisioner)
+	}
+	pvcs := vm.clientset.CoreV1().PersistentVolumeClaims(namespace)
+	if _, err := pvcs.Get(ctx, pvcName, metav1.GetOptions{}); err == nil {
+		return "", fmt.Errorf("PVC %s/%s already exists", namespace, pvcName)
+	} else if !apierrors.IsNotFound(err) {
+		return "", fmt.Errorf("failed to check for PVC %s/%s: %w", namespace, pvcName, err)
+	}
+
+	pvc := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      pvcName,
+			Namespace: namespace,
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes:      []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+			StorageClassName: &storageClass,
+			Resources: corev1.VolumeResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceStorage: opts.Size},
+			},
+		},
+	}
+	if vm.DryRun {
+		vm.dryRunf("create PersistentVolumeClaim %s/%s (%s, storage class %s)", namespace, pvcName, opts.Size.String(), storageClass)
+		if opts.Replicas > 0 {
+			vm.dryRunf("set the replica count of its volume to %d", opts.Replicas)
+		}
+		return "", nil
+	}
+	vm.printf("Creating PVC %s/%s (%s, storage class %s)...\n", namespace, pvcName, opts.Size.String(), storageClass)
+	if _, err := pvcs.Create(ctx, pvc, metav1.CreateOptions{}); err != nil {
+		return "", fmt.Errorf("failed to create PVC %s/%s: %w", namespace, pvcName, err)
+	}
+
+	if sc.VolumeBindingMode != nil && *sc.VolumeBindingMode == storagev1.VolumeBindingWaitForFirstConsumer {
+		vm.printf("Storage class %s binds on first use; Longhorn provisions the volume when a pod mounts PVC %s\n", storageClass, pvcName)
+		return "", nil
+	}
+	if err := vm.waitForPVCBound(ctx, namespace, pvcName); err != nil {
+		return "", err
+	}
+	bound, err := pvcs.Get(ctx, pvcName, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to get PVC %s/%s: %w", namespace, pvcName, err)
+	}
+	volumeName, err := vm.pvVolume(ctx, bound.Spec.VolumeName)
+	if err != nil {
+		return "", err
+	}
+
+	// Storage classes set the replica count of all their volumes, so a
+	// different count is applied to the volume afterwards
+	if opts.Replicas > 0 {
+		if err := vm.setReplicas(ctx, volumeName, opts.Replicas, false); err != nil {
+			return volumeName, err
+		}
+	}
+	return volumeName, vm.waitForVolumeReady(ctx, volumeName)
+}
+
+// waitForVolumeReady waits for a new volume to finish creating its
+// replicas and settle as detached.
+func (vm *VolumeManager) waitForVolumeReady(ctx context.Context, volumeName string) error {
+	vm.printf("Waiting for volume %s to be ready...\n", volumeName)
+	return vm.waitForVolume(ctx, volumeName, "ready", defaultCreateTimeout, func(obj *unstructured.Unstructured) bool {
+		state, _, _ := unstructured.NestedString(obj.Object, "status", "state")
+		return state == "detached" || state == "attached"
+	})
+}
+
+func validateCreateOptions(opts CreateVolumeOptions) error {
+	if opts.Size.Sign() <= 0 {
+		return fmt.Errorf("size must be positive")
+	}
+	if opts.Replicas < 0 || opts.Replicas > MaxReplicas {
+		return fmt.Errorf("replica count must be between 1 and %d, got %d", MaxReplicas, opts.Replicas)
+	}
+	return nil
+}
@@ -0,0 +1,298 @@
+package longhorntools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// defaultBackupTimeout bounds the wait for a final backup when
+// --wait-timeout is not set. A first backup uploads the whole volume.
+const defaultBackupTimeout = time.Hour
+
+// backupPollInterval is how often the snapshot and backup of a final backup
+// are checked.
+const backupPollInterval = 2 * time.Second
+
+// defaultDetachTimeout bounds the wait for a volume to detach after its
+// final download when --wait-timeout is not set.
+const defaultDetachTimeout = 2 * time.Minute
+
+// DeleteVolumeOptions controls what DeleteVolume saves before deleting.
+type DeleteVolumeOptions struct {
+	// Backup takes a final snapshot and backs it up to BackupTarget, waiting
+	// for the backup to complete. Longhorn deletes snapshots together with
+	// their volume, so a snapshot alone would not survive.
+	Backup bool
+	// BackupTarget is the target to back up to; empty uses the default.
+	BackupTarget string
+	// DownloadTo, if set, downloads the volume to this file first.
+	DownloadTo string
+	// Download configures the download. Namespace and StorageClass are used
+	// for the temporary pod that reads a volume without a PVC.
+	Download     DownloadOptions
+	Namespace    string
+	StorageClass string
+}
+
+// DeleteVolume deletes a Longhorn volume together with its PVC and PV. It
+// refuses to touch a volume that is attached or mounted by a pod, reporting
+// the workloads that still use it. With opts, the volume is backed up or
+// downloaded first, and nothing is deleted if that fails.
+func (vm *VolumeManager) DeleteVolume(ctx context.Context, volumeName string, opts DeleteVolumeOptions) error {
+	return vm.withVolumeLocks(ctx, []string{volumeName}, func() error {
+		err := observeOperation("delete", func() error {
+			return vm.deleteVolume(ctx, volumeName, opts)
+		})
+		if err != nil {
+			// A deleted volume has nothing left to record an event on
+			vm.recordOperationResult(ctx, volumeName, "Deleted", "DeleteFailed", "delete", err)
+		}
+		return err
+	})
+}
+
+func (vm *VolumeManager) deleteVolume(ctx context.Context, volumeName string, opts DeleteVolumeOptions) error {
+	// The final download attaches the volume itself, so check before it
+	volume, err := vm.checkDeletable(ctx, volumeName)
+	if err != nil {
+		return err
+	}
+
+	if opts.Backup {
+		if err := vm.finalBackup(ctx, volumeName, opts.BackupTarget); err != nil {
+			return fmt.Errorf("final backup failed, nothing was deleted: %w", err)
+		}
+	}
+	if opts.DownloadTo != "" {
+		err := observeOperation("download", func() error {
+			return vm.downloadVolume(ctx, volumeName, opts.Namespace, opts.DownloadTo, opts.StorageClass, opts.Download)
+		})
+		// The temporary pod keeps the volume attached until it is gone
+		cleanupErr := vm.CleanupVolumeResources(ctx, volumeName, opts.Namespace)
+		if err != nil {
+			return fmt.Errorf("final download failed, nothing was deleted: %w", err)
+		}
+		if cleanupErr != nil {
+			return fmt.Errorf("nothing was deleted: %w", cleanupErr)
+		}
+		vm.printf("Downloaded volume %s to %s\n", volumeName, opts.DownloadTo)
+
+		if !vm.DryRun {
+			vm.printf("Waiting for volume %s to detach...\n", volumeName)
+			err = vm.waitForVolume(ctx, volumeName, "detached", defaultDetachTimeout, func(obj *unstructured.Unstructured) bool {
+				state, _, _ := unstructured.NestedString(obj.Object, "status", "state")
+				return state == "detached"
+			})
+			if err != nil {
+				return fmt.Errorf("nothing was deleted: %w", err)
+			}
+			// Something may have started using the volume meanwhile
+			if volume, err = vm.checkDeletable(ctx, volumeName); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Deleting the PVC first keeps the PV from being bound again while the
+	// volume goes away. With the Delete reclaim policy, this alone removes
+	// the PV and the volume, so whatever is already gone below is fine.
+	if volume.PVCName != "" {
+		if vm.DryRun {
+			vm.dryRunf("delete PersistentVolumeClaim %s/%s", volume.PVCNamespace, volume.PVCName)
+		} else {
+			vm.printf("Deleting PVC %s/%s...\n", volume.PVCNamespace, volume.PVCName)
+			err := vm.clientset.CoreV1().PersistentVolumeClaims(volume.PVCNamespace).Delete(ctx, volume.PVCName, metav1.DeleteOptions{})
+			if err != nil && !apierrors.IsNotFound(err) {
+				return fmt.Errorf("failed to delete PVC %s/%s: %w", volume.PVCNamespace, volume.PVCName, err)
+			}
+			if err := vm.waitForPVCDeleted(ctx, volume.PVCNamespace, volume.PVCName); err != nil {
+				return err
+			}
+		}
+	}
+	if volume.PVName != "" {
+		if vm.DryRun {
+			vm.dryRunf("delete PersistentVolume %s", volume.PVName)
+		} else {
+			vm.printf("Deleting PV %s...\n", volume.PVName)
+			err := vm.clientset.CoreV1().PersistentVolumes().Delete(ctx, volume.PVName, metav1.DeleteOptions{})
+			if err != nil && !apierrors.IsNotFound(err) {
+				return fmt.Errorf("failed to delete PV %s: %w", volume.PVName, err)
+			}
+		}
+	}
+	if vm.DryRun {
+		vm.dryRunf("delete Longhorn volume %s", volumeName)
+		return nil
+	}
+	vm.printf("Deleting Longhorn volume %s...\n", volumeName)
+	err = vm.dynamicClient.Resource(longhornVolumeGVR).Namespace("longhorn-system").Delete(ctx, volumeName, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete Longhorn volume %s: %w", volumeName, err)
+	}
+	return nil
+}
+
+// checkDeletable returns volumeName if nothing uses it: no pod mounts its
+// PVC and it is not attached.
+func (vm *VolumeManager) checkDeletable(ctx context.Context, volumeName string) (*LonghornVolume, error) {
+	volume, err := vm.Volume(ctx, volumeName)
+	if err != nil {
+		return nil, err
+	}
+	inUse := false
+	if volume.PVCName != "" && volume.PVName != "" {
+		inUse, err = vm.IsVolumeInUse(ctx, volume.PVName, volume.PVCNamespace)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check if volume %s is in use: %w", volumeName, err)
+		}
+	}
+	claim, consumers, err := vm.VolumeConsumers(ctx, volumeName)
+	if err != nil {
+		return nil, err
+	}
+	// Pods that have finished no longer hold on to the claim
+	var active []VolumeConsumer
+	for _, c := range consumers {
+		if c.Phase != string(corev1.PodSucceeded) && c.Phase != string(corev1.PodFailed) {
+			active = append(active, c)
+		}
+	}
+	if inUse || len(active) > 0 {
+		var b strings.Builder
+		fmt.Fprintf(&b, "volume %s is in use through PVC %s by:", volumeName, claim)
+		for _, c := range active {
+			fmt.Fprintf(&b, "\n  pod %s (%s, %s)", c.Pod, c.Phase, c.Workload)
+		}
+		b.WriteString("\nscale these workloads down or delete them first")
+		return nil, categorize(ErrVolumeInUse, fmt.Errorf("%s", b.String()))
+	}
+	if volume.State == "attached" {
+		return nil, fmt.Errorf("volume %s is attached to node %s; detach it before deleting", volumeName, volume.NodeID)
+	}
+	return volume, nil
+}
+
+// finalBackup snapshots volumeName and backs the snapshot up to target,
+// waiting for both to complete.
+func (vm *VolumeManager) finalBackup(ctx context.Context, volumeName, target string) error {
+	name := fmt.Sprintf("lhc-final-%s-%d", volumeName, time.Now().Unix())
+	snapshot := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": longhornSnapshotGVR.GroupVersion().String(),
+		"kind":       "Snapshot",
+		"metadata": map[string]interface{}{
+			"name":      name,
+			"namespace": "longhorn-system",
+			"labels":    map[string]interface{}{"longhornvolume": volumeName},
+		},
+		"spec": map[string]interface{}{
+			"volume":         volumeName,
+			"createSnapshot": true,
+			"labels":         map[string]interface{}{"lhc.longhorn.io/final": "true"},
+		},
+	}}
+	backup := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": longhornBackupGVR.GroupVersion().String(),
+		"kind":       "Backup",
+		"metadata": map[string]interface{}{
+			"name":      name,
+			"namespace": "longhorn-system",
+			"labels":    map[string]interface{}{"backup-volume": volumeName},
+		},
+		"spec": map[string]interface{}{
+			"snapshotName": name,
+			"labels":       map[string]interface{}{"lhc.longhorn.io/final": "true"},
+		},
+	}}
+	if target != "" {
+		backup.SetLabels(map[string]string{"backup-volume": volumeName, "backup-target": target})
+		unstructured.SetNestedField(backup.Object, target, "spec", "backupTargetName")
+	}
+
+	if vm.DryRun {
+		vm.dryRunf("create snapshot %s of volume %s and back it up", name, volumeName)
+		return nil
+	}
+
+	vm.printf("Taking final snapshot %s of volume %s...\n", name, volumeName)
+	snapshots := vm.dynamicClient.Resource(longhornSnapshotGVR).Namespace("longhorn-system")
+	if _, err := snapshots.Create(ctx, snapshot, metav1.CreateOptions{}); err != nil {
+		return fmt.Errorf("failed to create snapshot %s: %w", name, err)
+	}
+	err := vm.pollLonghornResource(ctx, longhornSnapshotGVR, name, "snapshot", func(obj *unstructured.Unstructured) (bool, error) {
+		if msg, _, _ := unstructured.NestedString(obj.Object, "status", "error"); msg != "" {
+			return false, fmt.Errorf("snapshot %s failed: %s", name, msg)
+		}
+		ready, _, _ := unstructured.NestedBool(obj.Object, "status", "readyToUse")
+		return ready, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	vm.printf("Backing up snapshot %s...\n", name)
+	backups := vm.dynamicClient.Resource(longhornBackupGVR).Namespace("longhorn-system")
+	if _, err := backups.Create(ctx, backup, metav1.CreateOptions{}); err != nil {
+		return fmt.Errorf("failed to create backup %s: %w", name, err)
+	}
+	lastProgress := int64(-1)
+	err = vm.pollLonghornResource(ctx, longhornBackupGVR, name, "backup", func(obj *unstructured.Unstructured) (bool, error) {
+		state, _, _ := unstructured.NestedString(obj.Object, "status", "state")
+		if progress, _, _ := unstructured.NestedInt64(obj.Object, "status", "progress"); progress != lastProgress {
+			lastProgress = progress
+			vm.printf("  Backup %s: %s %d%%\n", name, state, progress)
+		}
+		switch state {
+		case "Completed":
+			return true, nil
+		case "Error":
+			msg, _, _ := unstructured.NestedString(obj.Object, "status", "error")
+			return false, fmt.Errorf("backup %s failed: %s", name, msg)
+		}
+		return false, nil
+	})
+	if err != nil {
+		return err
+	}
+	vm.printf("Backup %s of volume %s completed\n", name, volumeName)
+	return nil
+}
+
+// pollLonghornResource polls a Longhorn resource until done reports true or
+// an error. what names the resource in the timeout message.
+func (vm *VolumeManager) pollLonghornResource(ctx context.Context, gvr schema.GroupVersionResource, name, what string, done func(*unstructured.Unstructured) (bool, error)) error {
+	timeout := vm.waitTimeoutOr(defaultBackupTimeout)
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(backupPollInterval)
+	defer ticker.Stop()
+	resource := vm.dynamicClient.Resource(gvr).Namespace("longhorn-system")
+	for {
+		obj, err := resource.Get(waitCtx, name, metav1.GetOptions{})
+		if err == nil {
+			finished, err := done(obj)
+			if err != nil || finished {
+				return err
+			}
+		} else if apierrors.IsNotFound(err) {
+			return fmt.Errorf("%s %s disappeared while waiting for it", what, name)
+		}
+		select {
+		case <-waitCtx.Done():
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("%s %s did not complete within %s (use --wait-timeout to wait longer)", what, name, timeout)
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package longhorntools
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestDeleteVolume(t *testing.T) {
+	ctx := context.Background()
+	vm := newFakeVolumeManager(
+		[]*unstructured.Unstructured{
+			newFakeVolume("vol-busy", "detached", "apps", "busy"),
+			newFakeVolume("vol-attached", "attached", "", ""),
+			newFakeVolume("vol-done", "detached", "apps", "done"),
+		},
+		longhornPV("pv-vol-busy", "vol-busy"),
+		boundPVC("apps", "busy", "pv-vol-busy"),
+		claimPod("apps", "web-0", "busy", corev1.PodPending),
+		longhornPV("pv-vol-done", "vol-done"),
+		boundPVC("apps", "done", "pv-vol-done"),
+		// A finished pod no longer holds on to its claim
+		claimPod("apps", "migrate-1", "done", corev1.PodSucceeded),
+	)
+	volumes := vm.dynamicClient.Resource(longhornVolumeGVR).Namespace("longhorn-system")
+	exists := func(volume string) bool {
+		_, err := volumes.Get(ctx, volume, metav1.GetOptions{})
+		return err == nil
+	}
+
+	err := vm.DeleteVolume(ctx, "vol-busy", DeleteVolumeOptions{})
+	if err == nil || !strings.Contains(err.Error(), "pod web-0") {
+		t.Errorf("DeleteVolume(vol-busy) = %v, want an error naming pod web-0", err)
+	}
+	if !exists("vol-busy") {
+		t.Error("vol-busy was deleted while in use")
+	}
+	err = vm.DeleteVolume(ctx, "vol-attached", DeleteVolumeOptions{})
+	if err == nil || !strings.Contains(err.Error(), "detach it before deleting") {
+		t.Errorf("DeleteVolume(vol-attached) = %v, want an error asking to detach it", err)
+	}
+
+	vm.DryRun = true
+	if err := vm.DeleteVolume(ctx, "vol-done", DeleteVolumeOptions{}); err != nil {
+		t.Fatalf("DeleteVolume(vol-done) dry run: %v", err)
+	}
+	if !exists("vol-done") {
+		t.Fatal("dry run deleted vol-done")
+	}
+
+	vm.DryRun = false
+	if err := vm.DeleteVolume(ctx, "vol-done", DeleteVolumeOptions{}); err != nil {
+		t.Fatalf("DeleteVolume(vol-done): %v", err)
+	}
+	if exists("vol-done") {
+		t.Error("vol-done still exists")
+	}
+	if _, err := vm.clientset.CoreV1().PersistentVolumeClaims("apps").Get(ctx, "done", metav1.GetOptions{}); err == nil {
+		t.Error("PVC apps/done still exists")
+	}
+	if _, err := vm.clientset.CoreV1().PersistentVolumes().Get(ctx, "pv-vol-done", metav1.GetOptions{}); err == nil {
+		t.Error("PV pv-vol-done still exists")
+	}
+}
@@ -0,0 +1,200 @@
+package longhorntools
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// Longhorn custom resources that belong to a volume. Each carries a
+// longhornvolume=<volume> label.
+var (
+	longhornReplicaGVR = schema.GroupVersionResource{
+		Group:    "longhorn.io",
+		Version:  "v1beta2",
+		Resource: "replicas",
+	}
+	longhornEngineGVR = schema.GroupVersionResource{
+		Group:    "longhorn.io",
+		Version:  "v1beta2",
+		Resource: "engines",
+	}
+	longhornSnapshotGVR = schema.GroupVersionResource{
+		Group:    "longhorn.io",
+		Version:  "v1beta2",
+		Resource: "snapshots",
+	}
+)
+
+// Engine is the Longhorn engine serving a volume.
+type Engine struct {
+	Name     string `json:"name"`
+	Node     string `json:"node"`
+	State    string `json:"state"`
+	Image    string `json:"image"`
+	Endpoint string `json:"endpoint,omitempty"`
+}
+
+// Snapshot is a Longhorn snapshot of a volume.
+type Snapshot struct {
+	Name        string `json:"name"`
+	Parent      string `json:"parent,omitempty"`
+	Created     string `json:"created"`
+	Size        int64  `json:"size"`
+	UserCreated bool   `json:"userCreated"`
+	ReadyToUse  bool   `json:"readyToUse"`
+}
+
+// VolumeDescription collects everything known about one volume.
+type VolumeDescription struct {
+	Volume LonghornVolume
+	// Spec and Status are the raw fields of the Longhorn Volume resource.
+	Spec      map[string]interface{}
+	Status    map[string]interface{}
+	Replicas  []Replica
+	Engines   []Engine
+	Snapshots []Snapshot
+	PV        *corev1.PersistentVolume
+	PVC       *corev1.PersistentVolumeClaim
+	Pods      []corev1.Pod
+	Events    []corev1.Event
+}
+
+// DescribeVolume gathers the Longhorn resource, replicas, engine,
+// snapshots, bound PV and PVC, the pods using the PVC, and the events
+// from VolumeEvents for volumeName. Only a missing volume is an error; the related objects
+// are collected on a best-effort basis.
+func (vm *VolumeManager) DescribeVolume(ctx context.Context, volumeName string) (*VolumeDescription, error) {
+	obj, err := vm.dynamicClient.Resource(longhornVolumeGVR).Namespace("longhorn-system").Get(ctx, volumeName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("Longhorn volume %s not found: %w", volumeName, err)
+	}
+
+	d := &VolumeDescription{Volume: parseLonghornVolume(obj)}
+	d.Spec, _, _ = unstructured.NestedMap(obj.Object, "spec")
+	d.Status, _, _ = unstructured.NestedMap(obj.Object, "status")
+
+	d.Engines, _ = vm.VolumeEngines(ctx, volumeName)
+	d.Replicas, _ = vm.VolumeReplicas(ctx, volumeName)
+	d.Snapshots, _ = vm.VolumeSnapshots(ctx, volumeName)
+
+	if pvName := d.Volume.PVName; pvName != "" {
+		if pv, err := vm.clientset.CoreV1().PersistentVolumes().Get(ctx, pvName, metav1.GetOptions{}); err == nil {
+			d.PV = pv
+		}
+	}
+	if d.Volume.PVCName != "" {
+		if pvc, err := vm.clientset.CoreV1().PersistentVolumeClaims(d.Volume.PVCNamespace).Get(ctx, d.Volume.PVCName, metav1.GetOptions{}); err == nil {
+			d.PVC = pvc
+			d.Pods, _ = vm.podsUsingClaim(ctx, pvc.Namespace, pvc.Name)
+		}
+	}
+
+	d.Events, _ = vm.VolumeEvents(ctx, volumeName, time.Time{})
+
+	return d, nil
+}
+
+// volumeResources lists the Longhorn resources of one kind that belong to
+// volumeName, or to any volume if volumeName is empty.
+func (vm *VolumeManager) volumeResources(ctx context.Context, gvr schema.GroupVersionResource, volumeName string) ([]unstructured.Unstructured, error) {
+	opts := metav1.ListOptions{}
+	if volumeName != "" {
+		opts.LabelSelector = "longhornvolume=" + volumeName
+	}
+	list, err := vm.dynamicClient.Resource(gvr).Namespace("longhorn-system").List(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list Longhorn %s: %w", gvr.Resource, err)
+	}
+
+	// Fake clients ignore label selectors, so check again
+	var items []unstructured.Unstructured
+	for _, item := range list.Items {
+		if volumeName == "" || item.GetLabels()["longhornvolume"] == volumeName {
+			items = append(items, item)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].GetName() < items[j].GetName() })
+	return items, nil
+}
+
+// VolumeEngines returns the engines of volumeName. There is normally one;
+// a second appears briefly during live migration.
+func (vm *VolumeManager) VolumeEngines(ctx context.Context, volumeName string) ([]Engine, error) {
+	items, err := vm.volumeResources(ctx, longhornEngineGVR, volumeName)
+	if err != nil {
+		return nil, err
+	}
+
+	engines := make([]Engine, 0, len(items))
+	for _, item := range items {
+		engine := Engine{Name: item.GetName()}
+		engine.Node, _, _ = unstructured.NestedString(item.Object, "spec", "nodeID")
+		engine.State, _, _ = unstructured.NestedString(item.Object, "status", "currentState")
+		engine.Image, _, _ = unstructured.NestedString(item.Object, "status", "currentImage")
+		if engine.Image == "" {
+			engine.Image, _, _ = unstructured.NestedString(item.Object, "spec", "image")
+		}
+		if engine.Image == "" {
+			// Longhorn before 1.5
+			engine.Image, _, _ = unstructured.NestedString(item.Object, "spec", "engineImage")
+		}
+		engine.Endpoint, _, _ = unstructured.NestedString(item.Object, "status", "endpoint")
+		engines = append(engines, engine)
+	}
+	return engines, nil
+}
+
+// VolumeSnapshots returns the snapshots of volumeName, oldest first.
+func (vm *VolumeManager) VolumeSnapshots(ctx context.Context, volumeName string) ([]Snapshot, error) {
+	if vm.useManagerAPI() {
+		return vm.managerVolumeSnapshots(ctx, volumeName)
+	}
+	items, err := vm.volumeResources(ctx, longhornSnapshotGVR, volumeName)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots := make([]Snapshot, 0, len(items))
+	for _, item := range items {
+		snapshots = append(snapshots, parseSnapshot(&item))
+	}
+	sort.SliceStable(snapshots, func(i, j int) bool { return snapshots[i].Created < snapshots[j].Created })
+	return snapshots, nil
+}
+
+func parseSnapshot(item *unstructured.Unstructured) Snapshot {
+	snapshot := Snapshot{Name: item.GetName()}
+	snapshot.Parent, _, _ = unstructured.NestedString(item.Object, "status", "parent")
+	snapshot.Created, _, _ = unstructured.NestedString(item.Object, "status", "creationTime")
+	snapshot.Size, _, _ = unstructured.NestedInt64(item.Object, "status", "size")
+	snapshot.UserCreated, _, _ = unstructured.NestedBool(item.Object, "status", "userCreated")
+	snapshot.ReadyToUse, _, _ = unstructured.NestedBool(item.Object, "status", "readyToUse")
+	return snapshot
+}
+
+// podsUsingClaim returns the pods in namespace that mount the PVC
+// claimName, whatever their phase.
+func (vm *VolumeManager) podsUsingClaim(ctx context.Context, namespace, claimName string) ([]corev1.Pod, error) {
+	pods, err := vm.clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods: %w", err)
+	}
+
+	var result []corev1.Pod
+	for _, pod := range pods.Items {
+		for _, volume := range pod.Spec.Volumes {
+			if volume.PersistentVolumeClaim != nil && volume.PersistentVolumeClaim.ClaimName == claimName {
+				result = append(result, pod)
+				break
+			}
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,51 @@
+package longhorntools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// dryRunf reports an action skipped because of --dry-run. Repeated
+// actions (e.g. a PV checked by several code paths) are reported once.
+func (vm *VolumeManager) dryRunf(format string, args ...interface{}) {
+	line := fmt.Sprintf("[dry-run] would "+format, args...)
+
+	vm.dryRunMu.Lock()
+	defer vm.dryRunMu.Unlock()
+	if vm.dryRunSeen == nil {
+		vm.dryRunSeen = make(map[string]bool)
+	}
+	if vm.dryRunSeen[line] {
+		return
+	}
+	vm.dryRunSeen[line] = true
+	vm.println(line)
+}
+
+// formatCommand renders an exec command the way a shell would accept it.
+func formatCommand(command []string) string {
+	quoted := make([]string, len(command))
+	for i, arg := range command {
+		if arg != "" && !strings.ContainsAny(arg, " \t\n'\"$*?;|&<>()[]{}\\`") {
+			quoted[i] = arg
+		} else {
+			quoted[i] = shellQuote(arg)
+		}
+	}
+	return strings.Join(quoted, " ")
+}
+
+// deleteTemporaryPod removes a pod created for a single operation.
+func (vm *VolumeManager) deleteTemporaryPod(ctx context.Context, namespace, podName string) {
+	if vm.DryRun {
+		vm.dryRunf("delete pod %s/%s", namespace, podName)
+		return
+	}
+	err := vm.clientset.CoreV1().Pods(namespace).Delete(ctx, podName, metav1.DeleteOptions{})
+	if err != nil {
+		vm.printf("Warning: failed to delete temporary pod %s: %v\n", podName, err)
+	}
+}
@@ -0,0 +1,127 @@
+package longhorntools
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"filippo.io/age"
+)
+
+// newEncryptingWriter wraps out so that everything written to the returned
+// writer is encrypted before it reaches out. The spec has the form
+// "age:<recipient>" or "gpg:<keyid>". Close must be called to flush the
+// final encrypted block; it does not close out.
+func newEncryptingWriter(spec string, out io.Writer) (io.WriteCloser, error) {
+	scheme, target, ok := strings.Cut(spec, ":")
+	if !ok || target == "" {
+		return nil, fmt.Errorf("invalid encryption spec %q (expected age:<recipient> or gpg:<keyid>)", spec)
+	}
+
+	switch scheme {
+	case "age":
+		recipients, err := parseAgeRecipients(target)
+		if err != nil {
+			return nil, err
+		}
+		w, err := age.Encrypt(out, recipients...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize age encryption: %w", err)
+		}
+		return w, nil
+
+	case "gpg":
+		w, err := newGPGWriter(target, out)
+		if err != nil {
+			return nil, err
+		}
+		return w, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported encryption scheme %q (expected age or gpg)", scheme)
+	}
+}
+
+// parseAgeRecipients accepts either a single age public key or the path to a
+// recipients file with one key per line.
+func parseAgeRecipients(target string) ([]age.Recipient, error) {
+	if strings.HasPrefix(target, "age1") {
+		recipient, err := age.ParseX25519Recipient(target)
+		if err != nil {
+			return nil, fmt.Errorf("invalid age recipient: %w", err)
+		}
+		return []age.Recipient{recipient}, nil
+	}
+
+	f, err := os.Open(target)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open age recipients file: %w", err)
+	}
+	defer f.Close()
+
+	recipients, err := age.ParseRecipients(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse age recipients file %s: %w", target, err)
+	}
+	return recipients, nil
+}
+
+// gpgWriter pipes data through a local gpg process.
+type gpgWriter struct {
+	stdin io.WriteCloser
+	cmd   *exec.Cmd
+}
+
+func newGPGWriter(keyID string, out io.Writer) (*gpgWriter, error) {
+	cmd := exec.Command("gpg", "--batch", "--yes", "--trust-model", "always",
+		"--encrypt", "--recipient", keyID, "--output", "-")
+	cmd.Stdout = out
+	cmd.Stderr = os.Stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gpg stdin pipe: %w", err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start gpg (is it installed?): %w", err)
+	}
+
+	return &gpgWriter{stdin: stdin, cmd: cmd}, nil
+}
+
+func (g *gpgWriter) Write(p []byte) (int, error) {
+	return g.stdin.Write(p)
+}
+
+func (g *gpgWriter) Close() error {
+	if err := g.stdin.Close(); err != nil {
+		return fmt.Errorf("failed to close gpg stdin: %w", err)
+	}
+	if err := g.cmd.Wait(); err != nil {
+		return fmt.Errorf("gpg encryption failed: %w", err)
+	}
+	return nil
+}
+
+// Abort stops gpg without waiting for it to flush, for a transfer that
+// failed part way.
+func (g *gpgWriter) Abort() {
+	if g.cmd.ProcessState != nil {
+		return
+	}
+	g.stdin.Close()
+	g.cmd.Process.Kill()
+	g.cmd.Wait()
+}
+
+// abortEncryption stops an encrypting writer from newEncryptingWriter after
+// a failed transfer. age keeps no state outside the process, so only gpg
+// needs stopping.
+func abortEncryption(w io.WriteCloser) {
+	if g, ok := w.(*gpgWriter); ok {
+		g.Abort()
+	}
+}
@@ -0,0 +1,177 @@
+package longhorntools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Longhorn's EngineImage and Setting custom resources.
+var (
+	longhornEngineImageGVR = schema.GroupVersionResource{
+		Group:    "longhorn.io",
+		Version:  "v1beta2",
+		Resource: "engineimages",
+	}
+	longhornSettingGVR = schema.GroupVersionResource{
+		Group:    "longhorn.io",
+		Version:  "v1beta2",
+		Resource: "settings",
+	}
+)
+
+// defaultEngineUpgradeTimeout bounds the wait for one volume's engine
+// upgrade when --wait-timeout is not set.
+const defaultEngineUpgradeTimeout = 5 * time.Minute
+
+// EngineImage is an engine image Longhorn has deployed, or is deploying, to
+// the nodes.
+type EngineImage struct {
+	Name    string `json:"name"`
+	Image   string `json:"image"`
+	State   string `json:"state"`
+	Version string `json:"version,omitempty"`
+	// RefCount is the number of volumes using the image.
+	RefCount     int64 `json:"refCount"`
+	Incompatible bool  `json:"incompatible,omitempty"`
+	Default      bool  `json:"default"`
+}
+
+// EngineImages lists the engine images known to Longhorn, marking the one
+// named by the default-engine-image setting.
+func (vm *VolumeManager) EngineImages(ctx context.Context) ([]EngineImage, error) {
+	list, err := vm.dynamicClient.Resource(longhornEngineImageGVR).Namespace("longhorn-system").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list Longhorn engine images: %w", err)
+	}
+	defaultImage, _ := vm.DefaultEngineImage(ctx)
+
+	images := make([]EngineImage, 0, len(list.Items))
+	for _, item := range list.Items {
+		image := EngineImage{Name: item.GetName()}
+		image.Image, _, _ = unstructured.NestedString(item.Object, "spec", "image")
+		image.State, _, _ = unstructured.NestedString(item.Object, "status", "state")
+		image.Version, _, _ = unstructured.NestedString(item.Object, "status", "version")
+		image.RefCount, _, _ = unstructured.NestedInt64(item.Object, "status", "refCount")
+		image.Incompatible, _, _ = unstructured.NestedBool(item.Object, "status", "incompatible")
+		image.Default = image.Image != "" && image.Image == defaultImage
+		images = append(images, image)
+	}
+	sort.Slice(images, func(i, j int) bool { return images[i].Image < images[j].Image })
+	return images, nil
+}
+
+// DefaultEngineImage returns the value of Longhorn's default-engine-image
+// setting, the image new volumes use.
+func (vm *VolumeManager) DefaultEngineImage(ctx context.Context) (string, error) {
+	setting, err := vm.dynamicClient.Resource(longhornSettingGVR).Namespace("longhorn-system").Get(ctx, "default-engine-image", metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to get Longhorn setting default-engine-image: %w", err)
+	}
+	value, _, _ := unstructured.NestedString(setting.Object, "value")
+	if value == "" {
+		return "", fmt.Errorf("Longhorn setting default-engine-image is empty")
+	}
+	return value, nil
+}
+
+// UpgradeEngine moves volumeName to the engine image image through
+// Longhorn's own upgrade flow: the volume's image is changed and Longhorn
+// switches the engine and replicas over, live for an attached volume. It
+// then waits for the volume to report the new image.
+//
+// The image must be deployed, and an attached volume must be healthy, as
+// Longhorn refuses to live-upgrade a degraded one.
+func (vm *VolumeManager) UpgradeEngine(ctx context.Context, volumeName, image string) error {
+	return vm.withVolumeLocks(ctx, []string{volumeName}, func() error {
+		err := vm.upgradeEngine(ctx, volumeName, image)
+		vm.recordOperationResult(ctx, volumeName, "EngineUpgraded", "EngineUpgradeFailed", fmt.Sprintf("engine upgrade to %s", image), err)
+		return err
+	})
+}
+
+func (vm *VolumeManager) upgradeEngine(ctx context.Context, volumeName, image string) error {
+	volumes := vm.dynamicClient.Resource(longhornVolumeGVR).Namespace("longhorn-system")
+	obj, err := volumes.Get(ctx, volumeName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("Longhorn volume %s not found: %w", volumeName, err)
+	}
+	volume := parseLonghornVolume(obj)
+	if volume.EngineImage == image {
+		vm.printf("Volume %s already runs engine image %s\n", volumeName, image)
+		return nil
+	}
+	if volume.State == "attached" && volume.Robustness != "healthy" {
+		return fmt.Errorf("volume %s is %s; Longhorn only upgrades attached volumes that are healthy", volumeName, volume.Robustness)
+	}
+	if volume.State != "attached" && volume.State != "detached" {
+		return fmt.Errorf("volume %s is %s; wait until it is attached or detached", volumeName, volume.State)
+	}
+
+	images, err := vm.EngineImages(ctx)
+	if err != nil {
+		return err
+	}
+	var target *EngineImage
+	for i := range images {
+		if images[i].Image == image {
+			target = &images[i]
+		}
+	}
+	switch {
+	case target == nil:
+		return fmt.Errorf("engine image %s is not deployed; create an EngineImage for it first", image)
+	case target.Incompatible:
+		return fmt.Errorf("engine image %s is incompatible with this Longhorn version", image)
+	case target.State != "deployed":
+		return fmt.Errorf("engine image %s is %s, not deployed", image, orUnknown(target.State))
+	}
+
+	// Longhorn 1.5 renamed spec.engineImage to spec.image
+	field := "image"
+	if _, found, _ := unstructured.NestedString(obj.Object, "spec", "engineImage"); found {
+		field = "engineImage"
+	}
+	if vm.DryRun {
+		vm.dryRunf("patch volume longhorn-system/%s %s from %s to %s", volumeName, field, orUnknown(volume.EngineImage), image)
+		return nil
+	}
+
+	patch, _ := json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{
+			field: image,
+		},
+	})
+	mode := "offline"
+	if volume.State == "attached" {
+		mode = "live"
+	}
+	vm.printf("Upgrading volume %s (%s upgrade) from %s to %s...\n", volumeName, mode, orUnknown(volume.EngineImage), image)
+	if _, err := volumes.Patch(ctx, volumeName, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		return fmt.Errorf("failed to patch volume %s: %w", volumeName, err)
+	}
+
+	return vm.waitForVolume(ctx, volumeName, "upgraded", defaultEngineUpgradeTimeout, func(obj *unstructured.Unstructured) bool {
+		current, _, _ := unstructured.NestedString(obj.Object, "status", "currentImage")
+		if current != image {
+			return false
+		}
+		vm.printf("Volume %s now runs engine image %s\n", volumeName, image)
+		return true
+	})
+}
+
+// orUnknown returns s, or "unknown" if it is empty.
+func orUnknown(s string) string {
+	if s == "" {
+		return "unknown"
+	}
+	return s
+}
@@ -0,0 +1,47 @@
+package longhorntools
+
+import "errors"
+
+// Error categories. Errors returned by VolumeManager wrap one of these when
+// their cause is known, so callers can tell them apart with errors.Is; the
+// message is left as it is.
+var (
+	// ErrVolumeNotFound: no Longhorn volume, or PVC or PV backed by one,
+	// has the given name.
+	ErrVolumeNotFound = errors.New("volume not found")
+	// ErrVolumeInUse: a running pod mounts the volume, or another run
+	// holds its lock.
+	ErrVolumeInUse = errors.New("volume in use")
+	// ErrAttachTimeout: a temporary PVC was not bound, a volume not
+	// attached, or a pod mounting it not started within the wait timeout.
+	ErrAttachTimeout = errors.New("timed out attaching volume")
+	// ErrExecFailed: a command run in a pod failed or could not be run.
+	ErrExecFailed = errors.New("command in pod failed")
+	// ErrVerification: copied or downloaded data does not match its
+	// source.
+	ErrVerification = errors.New("verification failed")
+	// ErrPartialCleanup: some temporary resources could not be deleted.
+	ErrPartialCleanup = errors.New("cleanup incomplete")
+)
+
+// categorizedError is err, also matching category with errors.Is.
+type categorizedError struct {
+	err      error
+	category error
+}
+
+func (e *categorizedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *categorizedError) Unwrap() []error {
+	return []error{e.err, e.category}
+}
+
+// categorize returns err in category, or nil if err is nil.
+func categorize(category, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &categorizedError{err: err, category: category}
+}
@@ -0,0 +1,25 @@
+package longhorntools
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestCategorize(t *testing.T) {
+	if categorize(ErrExecFailed, nil) != nil {
+		t.Errorf("categorize(nil) is not nil")
+	}
+
+	cause := errors.New("tar exited with status 2")
+	err := fmt.Errorf("download failed: %w", categorize(ErrExecFailed, cause))
+	if !errors.Is(err, ErrExecFailed) || !errors.Is(err, cause) {
+		t.Errorf("%v does not match both its category and its cause", err)
+	}
+	if errors.Is(err, ErrVerification) {
+		t.Errorf("%v matches an unrelated category", err)
+	}
+	if err.Error() != "download failed: tar exited with status 2" {
+		t.Errorf("categorize changed the message: %q", err.Error())
+	}
+}
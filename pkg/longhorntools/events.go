@@ -0,0 +1,134 @@
+package longhorntools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Annotations written on Longhorn volumes when --annotate is set.
+const (
+	annotationLastOperation   = "lhc.io/last-operation"
+	annotationLastOperationBy = "lhc.io/last-operation-by"
+	annotationLastOperationAt = "lhc.io/last-operation-at"
+)
+
+// auditActor identifies who ran the tool, as user@host. Inside a pod the
+// host is the pod name.
+func auditActor() string {
+	name := "unknown"
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		name = u.Username
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		return name
+	}
+	return name + "@" + host
+}
+
+// recordVolumeEvent emits a Kubernetes Event on the Longhorn Volume and on
+// the PVC bound to it (if any), and optionally annotates the volume. Audit
+// failures are reported as warnings and never fail the operation.
+func (vm *VolumeManager) recordVolumeEvent(ctx context.Context, volumeName, eventType, reason, message string) {
+	if vm.DryRun {
+		return
+	}
+
+	actor := auditActor()
+	message = fmt.Sprintf("%s (by %s)", message, actor)
+
+	volume, err := vm.dynamicClient.Resource(longhornVolumeGVR).Namespace("longhorn-system").Get(ctx, volumeName, metav1.GetOptions{})
+	if err != nil {
+		vm.printf("Warning: failed to record event on volume %s: %v\n", volumeName, err)
+		return
+	}
+
+	vm.createEvent(ctx, corev1.ObjectReference{
+		APIVersion:      longhornVolumeGVR.GroupVersion().String(),
+		Kind:            "Volume",
+		Namespace:       volume.GetNamespace(),
+		Name:            volume.GetName(),
+		UID:             volume.GetUID(),
+		ResourceVersion: volume.GetResourceVersion(),
+	}, eventType, reason, message, actor)
+
+	// Also record on the claim so it shows up in "kubectl describe pvc"
+	if lv, err := vm.Volume(ctx, volumeName); err == nil && lv.PVName != "" {
+		pv, err := vm.clientset.CoreV1().PersistentVolumes().Get(ctx, lv.PVName, metav1.GetOptions{})
+		if err == nil && pv.Spec.ClaimRef != nil {
+			vm.createEvent(ctx, corev1.ObjectReference{
+				APIVersion: "v1",
+				Kind:       "PersistentVolumeClaim",
+				Namespace:  pv.Spec.ClaimRef.Namespace,
+				Name:       pv.Spec.ClaimRef.Name,
+				UID:        pv.Spec.ClaimRef.UID,
+			}, eventType, reason, message, actor)
+		}
+	}
+
+	if vm.Annotate {
+		patch, _ := json.Marshal(map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"annotations": map[string]string{
+					annotationLastOperation:   reason,
+					annotationLastOperationBy: actor,
+					annotationLastOperationAt: time.Now().UTC().Format(time.RFC3339),
+				},
+			},
+		})
+		_, err := vm.dynamicClient.Resource(longhornVolumeGVR).Namespace("longhorn-system").Patch(ctx, volumeName, types.MergePatchType, patch, metav1.PatchOptions{})
+		if err != nil {
+			vm.printf("Warning: failed to annotate volume %s: %v\n", volumeName, err)
+		}
+	}
+}
+
+func (vm *VolumeManager) createEvent(ctx context.Context, ref corev1.ObjectReference, eventType, reason, message, actor string) {
+	now := metav1.NewTime(time.Now())
+	event := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: ref.Name + ".",
+			Namespace:    ref.Namespace,
+		},
+		InvolvedObject:      ref,
+		Reason:              reason,
+		Message:             message,
+		Type:                eventType,
+		Source:              corev1.EventSource{Component: "lhc"},
+		FirstTimestamp:      now,
+		LastTimestamp:       now,
+		Count:               1,
+		ReportingController: "lhc.io/lhc",
+		ReportingInstance:   actor,
+	}
+
+	_, err := vm.clientset.CoreV1().Events(ref.Namespace).Create(ctx, event, metav1.CreateOptions{})
+	if err != nil {
+		vm.printf("Warning: failed to record event on %s %s/%s: %v\n", ref.Kind, ref.Namespace, ref.Name, err)
+	}
+}
+
+// recordOperationResult emits a Normal event with reason, or a Warning
+// with failedReason when err is set. operation describes what was done,
+// e.g. "download to backup.tar.gz".
+func (vm *VolumeManager) recordOperationResult(ctx context.Context, volumeName, reason, failedReason, operation string, err error) {
+	if err != nil {
+		vm.recordVolumeEvent(ctx, volumeName, corev1.EventTypeWarning, failedReason, fmt.Sprintf("%s failed: %v", operation, err))
+		return
+	}
+	vm.recordVolumeEvent(ctx, volumeName, corev1.EventTypeNormal, reason, operation+" completed")
+}
+
+// recordCopyResult emits events on both sides of a copy.
+func (vm *VolumeManager) recordCopyResult(ctx context.Context, sourceVolume, destVolume string, err error) {
+	vm.recordOperationResult(ctx, sourceVolume, "Copied", "CopyFailed", fmt.Sprintf("copy to %s", destVolume), err)
+	vm.recordOperationResult(ctx, destVolume, "Copied", "CopyFailed", fmt.Sprintf("copy from %s", sourceVolume), err)
+}
@@ -0,0 +1,57 @@
+package longhorntools
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	utilexec "k8s.io/client-go/util/exec"
+)
+
+// stderrTailSize is how much of a remote command's stderr is kept for the
+// error message when it fails.
+const stderrTailSize = 4096
+
+// tailBuffer keeps the last max bytes written to it. Exec stderr is still
+// streamed to the terminal as it arrives; this copy only feeds errors.
+type tailBuffer struct {
+	mu  sync.Mutex
+	max int
+	buf []byte
+}
+
+func newTailBuffer(max int) *tailBuffer {
+	return &tailBuffer{max: max}
+}
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.buf = append(t.buf, p...)
+	if len(t.buf) > t.max {
+		t.buf = t.buf[len(t.buf)-t.max:]
+	}
+	return len(p), nil
+}
+
+func (t *tailBuffer) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return strings.TrimSpace(string(t.buf))
+}
+
+// execFailure turns an exec stream error into an error naming the command,
+// its exit code if it ran to completion, and the end of its stderr.
+func execFailure(command []string, err error, stderr *tailBuffer) error {
+	detail := ""
+	if tail := stderr.String(); tail != "" {
+		detail = ": " + tail
+	}
+
+	var exitErr utilexec.ExitError
+	if errors.As(err, &exitErr) {
+		return categorize(ErrExecFailed, fmt.Errorf("command %s exited with code %d%s", formatCommand(command), exitErr.ExitStatus(), detail))
+	}
+	return categorize(ErrExecFailed, fmt.Errorf("failed to execute command %s: %w%s", formatCommand(command), err, detail))
+}
@@ -0,0 +1,214 @@
+package longhorntools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	watchtools "k8s.io/client-go/tools/watch"
+)
+
+// defaultExpandTimeout bounds each wait of ExpandVolume when --wait-timeout
+// is not set.
+const defaultExpandTimeout = 5 * time.Minute
+
+// ExpandVolume grows volumeName to size. A volume with a PVC is expanded
+// through the claim so Kubernetes and the CSI driver stay in sync; one
+// without is expanded by patching the Longhorn volume directly.
+//
+// The filesystem of a claim that no pod mounts is only grown the next time
+// it is mounted. With growFS, a temporary pod mounts the claim so the
+// kubelet grows it now.
+func (vm *VolumeManager) ExpandVolume(ctx context.Context, volumeName string, size resource.Quantity, growFS bool) error {
+	return vm.withVolumeLocks(ctx, []string{volumeName}, func() error {
+		err := vm.expandVolume(ctx, volumeName, size, growFS)
+		vm.recordOperationResult(ctx, volumeName, "Expanded", "ExpandFailed", fmt.Sprintf("expansion to %s", size.String()), err)
+		return err
+	})
+}
+
+func (vm *VolumeManager) expandVolume(ctx context.Context, volumeName string, size resource.Quantity, growFS bool) error {
+	volume, err := vm.Volume(ctx, volumeName)
+	if err != nil {
+		return err
+	}
+	target := size.Value()
+	if current := volume.SizeBytes(); target <= current {
+		return fmt.Errorf("new size %s is not larger than the current size %s of volume %s",
+			size.String(), resource.NewQuantity(current, resource.BinarySI).String(), volumeName)
+	}
+
+	if volume.PVCName == "" {
+		return vm.expandLonghornVolume(ctx, volumeName, target, growFS)
+	}
+
+	pvcs := vm.clientset.CoreV1().PersistentVolumeClaims(volume.PVCNamespace)
+	pvc, err := pvcs.Get(ctx, volume.PVCName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get PVC %s/%s: %w", volume.PVCNamespace, volume.PVCName, err)
+	}
+	if pvc.Spec.StorageClassName != nil && *pvc.Spec.StorageClassName != "" {
+		sc, err := vm.clientset.StorageV1().StorageClasses().Get(ctx, *pvc.Spec.StorageClassName, metav1.GetOptions{})
+		if err == nil && (sc.AllowVolumeExpansion == nil || !*sc.AllowVolumeExpansion) {
+			return fmt.Errorf("storage class %s does not allow volume expansion", sc.Name)
+		}
+	}
+
+	if vm.DryRun {
+		vm.dryRunf("patch persistentvolumeclaim %s/%s storage request to %s", pvc.Namespace, pvc.Name, size.String())
+		if growFS {
+			vm.dryRunf("grow the filesystem of PVC %s/%s", pvc.Namespace, pvc.Name)
+		}
+		return nil
+	}
+
+	patch, _ := json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{
+			"resources": map[string]interface{}{
+				"requests": map[string]string{
+					string(corev1.ResourceStorage): size.String(),
+				},
+			},
+		},
+	})
+	vm.printf("Expanding PVC %s/%s to %s...\n", pvc.Namespace, pvc.Name, size.String())
+	if _, err := pvcs.Patch(ctx, pvc.Name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		return fmt.Errorf("failed to patch PVC %s/%s: %w", pvc.Namespace, pvc.Name, err)
+	}
+
+	if err := vm.waitForVolumeSize(ctx, volumeName, target); err != nil {
+		return err
+	}
+	pending, err := vm.waitForPVCCapacity(ctx, pvc.Namespace, pvc.Name, target, true)
+	if err != nil || !pending {
+		return err
+	}
+
+	// The block device has grown; the filesystem follows when the kubelet
+	// next mounts the claim, which it does right away for running pods
+	pods, err := vm.podsUsingClaim(ctx, pvc.Namespace, pvc.Name)
+	if err != nil {
+		return err
+	}
+	running := false
+	for _, pod := range pods {
+		if pod.Status.Phase == corev1.PodRunning {
+			running = true
+		}
+	}
+	switch {
+	case running:
+		vm.printf("Waiting for the kubelet to grow the filesystem online...\n")
+	case growFS:
+		podName, _, _, err := vm.createTemporaryPodForPVC(ctx, pvc.Name, pvc.Namespace, volumeName)
+		if err != nil {
+			return fmt.Errorf("failed to mount PVC %s/%s to grow its filesystem: %w", pvc.Namespace, pvc.Name, err)
+		}
+		defer vm.deleteTemporaryPod(ctx, pvc.Namespace, podName)
+	default:
+		vm.printf("The filesystem of PVC %s/%s grows the next time it is mounted; use --grow-fs to grow it now\n", pvc.Namespace, pvc.Name)
+		return nil
+	}
+	_, err = vm.waitForPVCCapacity(ctx, pvc.Namespace, pvc.Name, target, false)
+	return err
+}
+
+// expandLonghornVolume patches the size of a volume that has no PVC.
+func (vm *VolumeManager) expandLonghornVolume(ctx context.Context, volumeName string, target int64, growFS bool) error {
+	if vm.DryRun {
+		vm.dryRunf("patch volume longhorn-system/%s size to %d", volumeName, target)
+		return nil
+	}
+
+	patch, _ := json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{
+			"size": strconv.FormatInt(target, 10),
+		},
+	})
+	vm.printf("Expanding Longhorn volume %s to %d bytes...\n", volumeName, target)
+	_, err := vm.dynamicClient.Resource(longhornVolumeGVR).Namespace("longhorn-system").Patch(ctx, volumeName, types.MergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to patch volume %s: %w", volumeName, err)
+	}
+	if err := vm.waitForVolumeSize(ctx, volumeName, target); err != nil {
+		return err
+	}
+	if growFS {
+		vm.printf("Volume %s has no PVC; its filesystem grows the next time it is mounted through one\n", volumeName)
+	}
+	return nil
+}
+
+// waitForVolumeSize waits until the Longhorn volume's size reaches target
+// and Longhorn no longer reports a pending expansion.
+func (vm *VolumeManager) waitForVolumeSize(ctx context.Context, volumeName string, target int64) error {
+	vm.printf("Waiting for Longhorn to expand volume %s...\n", volumeName)
+	return vm.waitForVolume(ctx, volumeName, "expanded", defaultExpandTimeout, func(obj *unstructured.Unstructured) bool {
+		volume := parseLonghornVolume(obj)
+		pending, _, _ := unstructured.NestedBool(obj.Object, "status", "expansionRequired")
+		if volume.SizeBytes() < target || pending {
+			return false
+		}
+		vm.printf("Volume %s is now %s\n", volumeName, resource.NewQuantity(volume.SizeBytes(), resource.BinarySI).String())
+		return true
+	})
+}
+
+// waitForPVCCapacity watches the claim until its capacity reaches target.
+// With stopAtFSPending it also returns, with pending set, once only the
+// filesystem resize is left.
+func (vm *VolumeManager) waitForPVCCapacity(ctx context.Context, namespace, pvcName string, target int64, stopAtFSPending bool) (pending bool, err error) {
+	timeout := vm.waitTimeoutOr(defaultExpandTimeout)
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	pvcs := vm.clientset.CoreV1().PersistentVolumeClaims(namespace)
+	lw := newListWatch(metav1.ListOptions{FieldSelector: fields.OneTermEqualSelector("metadata.name", pvcName).String()},
+		func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+			return pvcs.List(ctx, opts)
+		},
+		func(ctx context.Context, opts metav1.ListOptions) (watch.Interface, error) {
+			return pvcs.Watch(ctx, opts)
+		})
+
+	vm.printf("Waiting for PVC %s to report the new capacity...\n", pvcName)
+	_, err = watchtools.UntilWithSync(waitCtx, lw, &corev1.PersistentVolumeClaim{}, nil, func(event watch.Event) (bool, error) {
+		pvc, ok := event.Object.(*corev1.PersistentVolumeClaim)
+		if !ok || pvc.Name != pvcName {
+			return false, nil
+		}
+		if event.Type == watch.Deleted {
+			return false, fmt.Errorf("PVC %s was deleted while waiting for it to expand", pvcName)
+		}
+		if capacity, ok := pvc.Status.Capacity[corev1.ResourceStorage]; ok && capacity.Value() >= target {
+			vm.printf("PVC %s now has a capacity of %s\n", pvcName, capacity.String())
+			return true, nil
+		}
+		for _, cond := range pvc.Status.Conditions {
+			if cond.Type == corev1.PersistentVolumeClaimFileSystemResizePending && cond.Status == corev1.ConditionTrue && stopAtFSPending {
+				vm.printf("PVC %s is waiting for its filesystem to be resized\n", pvcName)
+				pending = true
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+	if err == nil {
+		return pending, nil
+	}
+	if waitCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+		return false, fmt.Errorf("PVC %s did not reach the new capacity within %s (use --wait-timeout to wait longer)%s",
+			pvcName, timeout, vm.eventDiagnostics(ctx, "PersistentVolumeClaim", namespace, pvcName))
+	}
+	return false, fmt.Errorf("failed waiting for PVC %s: %w", pvcName, err)
+}
@@ -0,0 +1,313 @@
+package longhorntools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DefaultFsckImage runs filesystem checks. The tools are installed with apk
+// when the image lacks them, so clusters without internet access need an
+// image that already ships e2fsprogs and xfsprogs.
+const DefaultFsckImage = "alpine:3"
+
+// fsckDevicePath is where the volume's block device appears in the fsck pod.
+const fsckDevicePath = "/dev/lhc-volume"
+
+// FsckOptions controls CheckFilesystem.
+type FsckOptions struct {
+	// Repair lets the check fix what it finds. Without it the filesystem
+	// is opened read-only (e2fsck -n, xfs_repair -n).
+	Repair bool
+
+	// Image overrides DefaultFsckImage.
+	Image string
+}
+
+// FsckResult is the outcome of a filesystem check.
+type FsckResult struct {
+	Volume     string `json:"volume"`
+	Filesystem string `json:"filesystem"`
+	Repair     bool   `json:"repair"`
+	// ExitCode is the exit status of e2fsck or xfs_repair.
+	ExitCode int `json:"exitCode"`
+}
+
+// Clean reports whether the check found nothing wrong.
+func (r FsckResult) Clean() bool {
+	return r.ExitCode == 0
+}
+
+// Summary describes the exit code in words.
+func (r FsckResult) Summary() string {
+	if r.Filesystem == "xfs" {
+		switch r.ExitCode {
+		case 0:
+			if r.Repair {
+				return "repair completed"
+			}
+			return "no corruption found"
+		case 1:
+			return "corruption found"
+		case 2:
+			return "the log is dirty; mount the volume once to replay it, then check again"
+		}
+		return fmt.Sprintf("xfs_repair failed with exit code %d", r.ExitCode)
+	}
+
+	switch {
+	case r.ExitCode == 0:
+		return "no errors found"
+	case r.ExitCode&4 != 0:
+		return "errors left uncorrected"
+	case r.ExitCode&(1|2) != 0:
+		return "errors corrected"
+	}
+	return fmt.Sprintf("e2fsck failed with exit code %d", r.ExitCode)
+}
+
+// CheckFilesystem runs e2fsck or xfs_repair, as the filesystem requires, on
+// volumeName's block device in a temporary pod and streams the output. The
+// volume is exposed through a block-mode PV and PVC, so it is never mounted.
+//
+// Checking a filesystem that is mounted elsewhere reports bogus errors, and
+// repairing one corrupts it, so the volume must be detached and its PVC
+// unused.
+func (vm *VolumeManager) CheckFilesystem(ctx context.Context, volumeName, namespace, storageClass string, opts FsckOptions) (*FsckResult, error) {
+	var result *FsckResult
+	err := vm.withVolumeLocks(ctx, []string{volumeName}, func() error {
+		var err error
+		result, err = vm.checkFilesystem(ctx, volumeName, namespace, storageClass, opts)
+		// A check that ran but found problems is not an error, but the
+		// event should still be a warning
+		eventErr := err
+		if err == nil && !result.Clean() {
+			eventErr = errors.New(result.Summary())
+		}
+		operation := "filesystem check"
+		if opts.Repair {
+			operation = "filesystem repair"
+		}
+		vm.recordOperationResult(ctx, volumeName, "Checked", "CheckFailed", operation, eventErr)
+		return err
+	})
+	return result, err
+}
+
+func (vm *VolumeManager) checkFilesystem(ctx context.Context, volumeName, namespace, storageClass string, opts FsckOptions) (*FsckResult, error) {
+	volume, err := vm.Volume(ctx, volumeName)
+	if err != nil {
+		return nil, err
+	}
+	if volume.State != "detached" {
+		where := ""
+		if volume.NodeID != "" {
+			where = " to " + volume.NodeID
+		}
+		return nil, fmt.Errorf("volume %s is %s%s; scale down the workloads using it so it detaches before checking it", volumeName, volume.State, where)
+	}
+	if volume.PVCName != "" {
+		pods, err := vm.podsUsingClaim(ctx, volume.PVCNamespace, volume.PVCName)
+		if err != nil {
+			return nil, err
+		}
+		for _, pod := range pods {
+			if pod.Status.Phase != corev1.PodSucceeded && pod.Status.Phase != corev1.PodFailed {
+				return nil, categorize(ErrVolumeInUse, fmt.Errorf("pod %s/%s uses PVC %s; delete it or scale down its workload before checking volume %s",
+					pod.Namespace, pod.Name, volume.PVCName, volumeName))
+			}
+		}
+	}
+
+	fsType := ""
+	if volume.PVName != "" {
+		if pv, err := vm.clientset.CoreV1().PersistentVolumes().Get(ctx, volume.PVName, metav1.GetOptions{}); err == nil && pv.Spec.CSI != nil {
+			fsType = pv.Spec.CSI.FSType
+		}
+	}
+
+	pvName := "lhc-temp-fsck-pv-" + volumeName
+	pvcName := "lhc-temp-fsck-pvc-" + volumeName
+	podName := "lhc-temp-fsck-" + volumeName
+	defer vm.deleteTemporaryPodAndVolume(ctx, namespace, podName, pvcName, pvName)
+	if err := vm.createBlockPVC(ctx, volume, namespace, storageClass, pvName, pvcName); err != nil {
+		return nil, err
+	}
+
+	image := opts.Image
+	if image == "" {
+		image = DefaultFsckImage
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        podName,
+			Namespace:   namespace,
+			Labels:      map[string]string{"app": "lhc-temp"},
+			Annotations: vm.tempAnnotations(volume.Name),
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{
+				Name:    "fsck",
+				Image:   image,
+				Command: []string{"sleep", tempPodSleepSeconds},
+				VolumeDevices: []corev1.VolumeDevice{{
+					Name:       "volume",
+					DevicePath: fsckDevicePath,
+				}},
+			}},
+			Volumes: []corev1.Volume{{
+				Name: "volume",
+				VolumeSource: corev1.VolumeSource{
+					PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: pvcName},
+				},
+			}},
+			RestartPolicy: corev1.RestartPolicyNever,
+		},
+	}
+	vm.applyTempPodOptions(ctx, &pod.Spec, volumeName)
+
+	if vm.DryRun {
+		vm.dryRunf("create pod %s/%s with PVC %s as block device %s", namespace, podName, pvcName, fsckDevicePath)
+	} else {
+		if _, err := vm.clientset.CoreV1().Pods(namespace).Create(ctx, pod, metav1.CreateOptions{}); err != nil {
+			return nil, fmt.Errorf("failed to create fsck pod: %w", err)
+		}
+		vm.trackTemporary("pod", namespace, pod)
+		if err := vm.waitForPodRunning(ctx, namespace, podName); err != nil {
+			return nil, err
+		}
+	}
+
+	// The check writes its report to stderr, which is streamed; stdout only
+	// carries the detected type and exit code back
+	e2fsckMode, xfsMode := "-n", "-n"
+	if opts.Repair {
+		e2fsckMode, xfsMode = "-y", ""
+	}
+	var out strings.Builder
+	err = vm.execInPodWithOutput(ctx, namespace, podName, "fsck",
+		[]string{"sh", "-c", fsckScript, "fsck", fsckDevicePath, fsType, e2fsckMode, xfsMode}, &out)
+	if err != nil {
+		return nil, err
+	}
+	result := &FsckResult{Volume: volumeName, Filesystem: fsType, Repair: opts.Repair}
+	if vm.DryRun {
+		return result, nil
+	}
+
+	exitSeen := false
+	for _, line := range strings.Split(out.String(), "\n") {
+		key, value, _ := strings.Cut(strings.TrimSpace(line), "=")
+		switch key {
+		case "lhc-fsck-type":
+			result.Filesystem = value
+		case "lhc-fsck-exit":
+			result.ExitCode, err = strconv.Atoi(value)
+			exitSeen = err == nil
+		}
+	}
+	if !exitSeen {
+		return nil, fmt.Errorf("the filesystem check did not report a result: %q", out.String())
+	}
+	return result, nil
+}
+
+// fsckScript checks the block device $1. $2 is the filesystem type, or
+// empty to detect it with blkid; $3 and $4 are the mode flags of e2fsck and
+// xfs_repair.
+const fsckScript = `dev=$1 fstype=$2
+command -v e2fsck >/dev/null && command -v xfs_repair >/dev/null ||
+  { command -v apk >/dev/null && apk add --no-cache -q e2fsprogs xfsprogs blkid >&2; }
+[ -n "$fstype" ] || fstype=$(blkid "$dev" | sed -n 's/.* TYPE="\([^"]*\)".*/\1/p')
+echo "lhc-fsck-type=$fstype"
+case "$fstype" in
+ext[234]) e2fsck -f $3 "$dev" >&2 ;;
+xfs) xfs_repair $4 "$dev" >&2 ;;
+*) echo "no supported filesystem found (${fstype:-none})" >&2; exit 3 ;;
+esac
+echo "lhc-fsck-exit=$?"`
+
+// createBlockPVC exposes volume in namespace as a block-mode PV and PVC
+// named pvName and pvcName and waits for the claim to bind.
+func (vm *VolumeManager) createBlockPVC(ctx context.Context, volume *LonghornVolume, namespace, storageClass, pvName, pvcName string) error {
+	blockMode := corev1.PersistentVolumeBlock
+	size := resource.MustParse(volume.Size)
+	pv := &corev1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        pvName,
+			Labels:      map[string]string{"app": "lhc-temp"},
+			Annotations: vm.tempAnnotations(volume.Name),
+		},
+		Spec: corev1.PersistentVolumeSpec{
+			Capacity:                      corev1.ResourceList{corev1.ResourceStorage: size},
+			AccessModes:                   []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+			PersistentVolumeReclaimPolicy: corev1.PersistentVolumeReclaimRetain,
+			StorageClassName:              storageClass,
+			VolumeMode:                    &blockMode,
+			PersistentVolumeSource: corev1.PersistentVolumeSource{
+				CSI: &corev1.CSIPersistentVolumeSource{
+					Driver:       "driver.longhorn.io",
+					VolumeHandle: volume.Name,
+				},
+			},
+		},
+	}
+	pvc := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        pvcName,
+			Namespace:   namespace,
+			Labels:      map[string]string{"app": "lhc-temp"},
+			Annotations: vm.tempAnnotations(volume.Name),
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes:      []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+			Resources:        corev1.VolumeResourceRequirements{Requests: corev1.ResourceList{corev1.ResourceStorage: size}},
+			StorageClassName: &storageClass,
+			VolumeName:       pvName,
+			VolumeMode:       &blockMode,
+		},
+	}
+
+	if vm.DryRun {
+		vm.dryRunf("create block-mode PersistentVolume %s and PersistentVolumeClaim %s/%s for Longhorn volume %s", pvName, namespace, pvcName, volume.Name)
+		return nil
+	}
+	if _, err := vm.clientset.CoreV1().PersistentVolumes().Create(ctx, pv, metav1.CreateOptions{}); err != nil {
+		return fmt.Errorf("failed to create block-mode PV: %w", err)
+	}
+	vm.trackTemporary("pv", "", pv)
+	if _, err := vm.clientset.CoreV1().PersistentVolumeClaims(namespace).Create(ctx, pvc, metav1.CreateOptions{}); err != nil {
+		return fmt.Errorf("failed to create block-mode PVC: %w", err)
+	}
+	vm.trackTemporary("pvc", namespace, pvc)
+	return vm.waitForPVCBound(ctx, namespace, pvcName)
+}
+
+// deleteTemporaryPodAndVolume removes the pod, PVC, and PV of a filesystem
+// check, NFS export, or WebDAV server. Missing objects are ignored, since
+// the operation may have stopped early.
+func (vm *VolumeManager) deleteTemporaryPodAndVolume(ctx context.Context, namespace, podName, pvcName, pvName string) {
+	if vm.DryRun {
+		vm.dryRunf("delete pod %s/%s, PersistentVolumeClaim %s/%s, and PersistentVolume %s", namespace, podName, namespace, pvcName, pvName)
+		return
+	}
+	err := vm.clientset.CoreV1().Pods(namespace).Delete(ctx, podName, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		vm.printf("Warning: failed to delete temporary pod %s: %v\n", podName, err)
+	}
+	err = vm.clientset.CoreV1().PersistentVolumeClaims(namespace).Delete(ctx, pvcName, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		vm.printf("Warning: failed to delete temporary PVC %s: %v\n", pvcName, err)
+	}
+	err = vm.clientset.CoreV1().PersistentVolumes().Delete(ctx, pvName, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		vm.printf("Warning: failed to delete temporary PV %s: %v\n", pvName, err)
+	}
+}
@@ -0,0 +1,53 @@
+package longhorntools
+
+import (
+	"context"
+	"fmt"
+)
+
+// VolumeProblem describes an unhealthy volume found by CheckHealth.
+type VolumeProblem struct {
+	Volume LonghornVolume `json:"volume"`
+	// FailedReplicas are the volume's replicas that have failed or are
+	// in an error state.
+	FailedReplicas []Replica `json:"failedReplicas,omitempty"`
+	// Reasons summarizes what is wrong, e.g. "robustness degraded".
+	Reasons []string `json:"reasons"`
+}
+
+// CheckHealth scans every Longhorn volume and returns those that are
+// degraded or faulted or have failed replicas. Detached volumes report an
+// unknown robustness, which is not a problem.
+func (vm *VolumeManager) CheckHealth(ctx context.Context) ([]VolumeProblem, error) {
+	volumes, err := vm.Volumes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	replicas, err := vm.VolumeReplicas(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+
+	failed := make(map[string][]Replica)
+	for _, r := range replicas {
+		if r.FailedAt != "" || r.State == "error" || r.Mode == "ERR" {
+			failed[r.Volume] = append(failed[r.Volume], r)
+		}
+	}
+
+	var problems []VolumeProblem
+	for _, volume := range volumes {
+		problem := VolumeProblem{Volume: volume, FailedReplicas: failed[volume.Name]}
+		switch volume.Robustness {
+		case "degraded", "faulted":
+			problem.Reasons = append(problem.Reasons, "robustness "+volume.Robustness)
+		}
+		if n := len(problem.FailedReplicas); n > 0 {
+			problem.Reasons = append(problem.Reasons, fmt.Sprintf("%d failed replica(s)", n))
+		}
+		if len(problem.Reasons) > 0 {
+			problems = append(problems, problem)
+		}
+	}
+	return problems, nil
+}
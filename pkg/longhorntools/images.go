@@ -0,0 +1,85 @@
+package longhorntools
+
+import (
+	"fmt"
+	"strings"
+)
+
+// HelperImage is an image the tool may start pods from. Clusters without
+// access to public registries need every one of them mirrored.
+type HelperImage struct {
+	Name    string
+	Default string
+	Usage   string
+}
+
+// HelperImages lists the images the tool may start pods from by default.
+// Scheduled runs use the lhc image given to schedule, which has no default.
+var HelperImages = []HelperImage{
+	{Name: "temp", Default: DefaultTempImage, Usage: "temporary pods and in-cluster copy Jobs (--temp-image)"},
+	{Name: "compress", Default: DefaultCompressImage, Usage: "temporary pods of zstd and xz downloads (compress in the pod)"},
+	{Name: "fsck", Default: DefaultFsckImage, Usage: "fsck pods (fsck --image)"},
+	{Name: "nfs", Default: DefaultNFSImage, Usage: "NFS server pods (export-nfs --image)"},
+	{Name: "webdav", Default: DefaultWebDAVImage, Usage: "WebDAV server pods (mount --image)"},
+}
+
+// ParseImageOverrides parses --image-override values of the form
+// image=replacement. A replacement starting with "@" only pins a digest:
+// busybox:latest=@sha256:... runs busybox@sha256:... from ImageRegistry.
+func ParseImageOverrides(values []string) (map[string]string, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+	overrides := map[string]string{}
+	for _, value := range values {
+		image, replacement, ok := strings.Cut(value, "=")
+		if !ok || image == "" || replacement == "" {
+			return nil, fmt.Errorf("invalid image override %q (expected image=replacement)", value)
+		}
+		if strings.HasPrefix(replacement, "@") && !strings.HasPrefix(replacement, "@sha256:") {
+			return nil, fmt.Errorf("invalid image override %q (expected a digest like @sha256:...)", value)
+		}
+		overrides[image] = replacement
+	}
+	return overrides, nil
+}
+
+// ResolveImage returns the reference pods are started from for image. An
+// override for image is used as is, unless it only pins a digest; anything
+// else is moved to registry, if set, by replacing the registry host of the
+// reference: busybox:latest becomes <registry>/busybox:latest and
+// quay.io/org/tool:v1 becomes <registry>/org/tool:v1.
+func ResolveImage(image, registry string, overrides map[string]string) string {
+	if replacement, ok := overrides[image]; ok {
+		if !strings.HasPrefix(replacement, "@") {
+			return replacement
+		}
+		image = imageRepository(image) + replacement
+	}
+	if registry == "" {
+		return image
+	}
+	registry = strings.TrimSuffix(registry, "/")
+	if strings.HasPrefix(image, registry+"/") {
+		return image
+	}
+	path := image
+	if host, rest, ok := strings.Cut(image, "/"); ok && (strings.ContainsAny(host, ".:") || host == "localhost") {
+		path = rest
+	}
+	return registry + "/" + path
+}
+
+// imageRepository strips the tag and digest from an image reference.
+func imageRepository(image string) string {
+	image, _, _ = strings.Cut(image, "@")
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		image = image[:i]
+	}
+	return image
+}
+
+// resolveImage applies ImageRegistry and ImageOverrides to image.
+func (vm *VolumeManager) resolveImage(image string) string {
+	return ResolveImage(image, vm.ImageRegistry, vm.ImageOverrides)
+}
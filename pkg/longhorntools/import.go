@@ -0,0 +1,128 @@
+package longhorntools
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ImportPVC copies the data of sourcePVC, a claim on any other kind of
+// storage, into destPVC, a new claim of the same size and access modes in
+// the same namespace provisioned from the Longhorn storageClass. It returns
+// the name of the new Longhorn volume.
+//
+// The source is read through the running pod that mounts it, if there is
+// one, and through a temporary pod otherwise. A workload still writing to it
+// makes the copy inconsistent, so scale it down first. If the copy fails,
+// destPVC is deleted again.
+func (vm *VolumeManager) ImportPVC(ctx context.Context, namespace, sourcePVC, destPVC, storageClass string) (string, error) {
+	var volumeName string
+	err := observeOperation("import", func() error {
+		var err error
+		volumeName, err = vm.importPVC(ctx, namespace, sourcePVC, destPVC, storageClass)
+		return err
+	})
+	if volumeName != "" {
+		vm.recordOperationResult(ctx, volumeName, "Imported", "ImportFailed", fmt.Sprintf("import from PVC %s/%s", namespace, sourcePVC), err)
+	}
+	return volumeName, err
+}
+
+func (vm *VolumeManager) importPVC(ctx context.Context, namespace, sourcePVC, destPVC, storageClass string) (string, error) {
+	pvcs := vm.clientset.CoreV1().PersistentVolumeClaims(namespace)
+	source, err := pvcs.Get(ctx, sourcePVC, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("source PVC %s/%s not found: %w", namespace, sourcePVC, err)
+	}
+	if source.Status.Phase != corev1.ClaimBound {
+		return "", fmt.Errorf("source PVC %s/%s is %s, not Bound", namespace, sourcePVC, source.Status.Phase)
+	}
+	if pv, err := vm.clientset.CoreV1().PersistentVolumes().Get(ctx, source.Spec.VolumeName, metav1.GetOptions{}); err == nil &&
+		pv.Spec.CSI != nil && pv.Spec.CSI.Driver == "driver.longhorn.io" {
+		return "", fmt.Errorf("PVC %s/%s is already a Longhorn volume (%s); use copy instead", namespace, sourcePVC, pv.Spec.CSI.VolumeHandle)
+	}
+
+	sc, err := vm.clientset.StorageV1().StorageClasses().Get(ctx, storageClass, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("storage class %s not found: %w", storageClass, err)
+	}
+	if sc.Provisioner != "driver.longhorn.io" {
+		return "", fmt.Errorf("storage class %s is provisioned by %s, not driver.longhorn.io", storageClass, sc.Provisioner)
+	}
+	if _, err := pvcs.Get(ctx, destPVC, metav1.GetOptions{}); err == nil {
+		return "", fmt.Errorf("PVC %s/%s already exists", namespace, destPVC)
+	} else if !apierrors.IsNotFound(err) {
+		return "", fmt.Errorf("failed to check for PVC %s/%s: %w", namespace, destPVC, err)
+	}
+
+	// Open the source first, so a source that cannot be read leaves nothing
+	// behind
+	sourcePod, sourceMountPath, sourceContainer := "", "", ""
+	inUse, err := vm.IsVolumeInUse(ctx, source.Spec.VolumeName, namespace)
+	if err != nil {
+		return "", fmt.Errorf("failed to check if PVC %s is in use: %w", sourcePVC, err)
+	}
+	if inUse {
+		sourcePod, sourceMountPath, sourceContainer, err = vm.findExistingPodForVolume(ctx, source.Spec.VolumeName, namespace)
+		if err != nil {
+			return "", categorize(ErrVolumeInUse, fmt.Errorf("PVC %s is in use, but the pod using it cannot be found: %w", sourcePVC, err))
+		}
+		vm.printf("Warning: PVC %s is mounted by running pod %s; scale its workload down for a consistent copy\n", sourcePVC, sourcePod)
+	} else {
+		sourcePod, sourceMountPath, sourceContainer, err = vm.createTemporaryPodForPVC(ctx, sourcePVC, namespace)
+		if err != nil {
+			return "", fmt.Errorf("failed to mount source PVC %s: %w", sourcePVC, err)
+		}
+		defer vm.deleteTemporaryPod(ctx, namespace, sourcePod)
+	}
+
+	size := claimSize(source)
+	pvc := claimLike(source, destPVC, storageClass)
+	vm.printf("Creating PVC %s (%s, storage class %s)...\n", destPVC, size.String(), storageClass)
+	if vm.DryRun {
+		vm.dryRunf("create PersistentVolumeClaim %s/%s", namespace, destPVC)
+	} else if _, err := pvcs.Create(ctx, pvc, metav1.CreateOptions{}); err != nil {
+		return "", fmt.Errorf("failed to create PVC %s: %w", destPVC, err)
+	}
+
+	succeeded := false
+	defer func() {
+		if succeeded || vm.DryRun {
+			return
+		}
+		vm.printf("Deleting PVC %s after the failed import\n", destPVC)
+		if err := pvcs.Delete(ctx, destPVC, metav1.DeleteOptions{}); err != nil {
+			vm.printf("Warning: failed to delete PVC %s: %v\n", destPVC, err)
+		}
+	}()
+
+	destPod, destMountPath, destContainer, err := vm.createTemporaryPodForPVC(ctx, destPVC, namespace)
+	if err != nil {
+		return "", fmt.Errorf("failed to mount new PVC %s: %w", destPVC, err)
+	}
+	defer vm.deleteTemporaryPod(ctx, namespace, destPod)
+
+	vm.printf("Streaming data from PVC %s to PVC %s...\n", sourcePVC, destPVC)
+	err = vm.streamCopyWithProgress(ctx, "import", sourcePVC, namespace, sourcePod, sourceContainer, sourceMountPath,
+		destPod, destContainer, destMountPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to copy data: %w", err)
+	}
+	if vm.DryRun {
+		return "", nil
+	}
+
+	created, err := pvcs.Get(ctx, destPVC, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to get PVC %s: %w", destPVC, err)
+	}
+	volumeName, err := vm.pvVolume(ctx, created.Spec.VolumeName)
+	if err != nil {
+		return "", err
+	}
+	succeeded = true
+	return volumeName, nil
+}
@@ -0,0 +1,289 @@
+package longhorntools
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"hash/fnv"
+	"strings"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	watchtools "k8s.io/client-go/tools/watch"
+)
+
+// inClusterCopyTemplate wipes the destination, copies everything from
+// /source, and reports progress every 10 seconds while tar runs. It is
+// completed with a check for GNU tar and the copy pipeline by
+// inClusterCopyScript.
+const inClusterCopyTemplate = `set -e
+%s
+echo "Clearing destination..."
+rm -rf /dest/* /dest/.[!.]* /dest/..?*
+(while true; do sleep 10; echo "progress: $(du -sh /dest | cut -f1) copied"; done) &
+progress=$!
+echo "Copying data..."
+%s
+kill $progress 2>/dev/null || true
+echo "copied $(du -sh /dest | cut -f1)"
+`
+
+// inClusterCopyScript returns the copy Job's script, preserving holes in
+// sparse files if sparse is set.
+func inClusterCopyScript(sparse bool) string {
+	check := ""
+	if sparse {
+		check = `tar --version | grep -q "GNU tar" || { echo "sparse copies need GNU tar in the copy image" >&2; exit 1; }`
+	}
+	pipeline := shellPipeline(strings.Join(tarCreateArgs(sparse), " ")+" -C /source .", "tar -xf - -C /dest")
+	return fmt.Sprintf(inClusterCopyTemplate, check, pipeline)
+}
+
+// claimForVolume returns a PVC in namespace through which a Job can mount
+// the Longhorn volume: its existing bound PVC if there is one, otherwise a
+// temporary PV/PVC pair.
+func (vm *VolumeManager) claimForVolume(ctx context.Context, volumeName, namespace, storageClass string) (string, error) {
+	volume, err := vm.Volume(ctx, volumeName)
+	if err != nil {
+		return "", fmt.Errorf("Longhorn volume %s not found: %w", volumeName, err)
+	}
+
+	if volume.PVName != "" {
+		inUse, err := vm.IsVolumeInUse(ctx, volume.PVName, namespace)
+		if err != nil {
+			return "", fmt.Errorf("failed to check if volume is in use: %w", err)
+		}
+		if inUse {
+			return "", categorize(ErrVolumeInUse, fmt.Errorf("volume %s is in use by a running pod; stop the workload before an in-cluster copy", volumeName))
+		}
+
+		pvcs, err := vm.clientset.CoreV1().PersistentVolumeClaims(namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return "", fmt.Errorf("failed to list PVCs: %w", err)
+		}
+		for _, pvc := range pvcs.Items {
+			if pvc.Spec.VolumeName == volume.PVName && pvc.Status.Phase == corev1.ClaimBound {
+				return pvc.Name, nil
+			}
+		}
+	}
+
+	return vm.ensureTemporaryPVC(ctx, volumeName, namespace, storageClass)
+}
+
+// copyJobName derives a short, stable Job name for a source/dest pair.
+func copyJobName(sourceVolume, destVolume string) string {
+	h := fnv.New32a()
+	h.Write([]byte(sourceVolume + "/" + destVolume))
+	return fmt.Sprintf("lhc-temp-copy-%08x", h.Sum32())
+}
+
+// CopyVolumeInCluster copies sourceVolume to destVolume with a Kubernetes
+// Job that mounts both volumes, so data never leaves the cluster. The CLI
+// only follows the Job's logs and waits for it to finish. The temporary
+// resources are removed before the volume locks are released.
+func (vm *VolumeManager) CopyVolumeInCluster(ctx context.Context, sourceVolume, destVolume, namespace, storageClass string) error {
+	return vm.withVolumeLocks(ctx, []string{sourceVolume, destVolume}, func() error {
+		err := observeOperation("copy_in_cluster", func() error {
+			return vm.copyVolumeInCluster(ctx, sourceVolume, destVolume, namespace, storageClass)
+		})
+		vm.recordCopyResult(ctx, sourceVolume, destVolume, err)
+		return vm.cleanupLocked(ctx, namespace, err, sourceVolume, destVolume)
+	})
+}
+
+func (vm *VolumeManager) copyVolumeInCluster(ctx context.Context, sourceVolume, destVolume, namespace, storageClass string) error {
+	sourcePVC, err := vm.claimForVolume(ctx, sourceVolume, namespace, storageClass)
+	if err != nil {
+		return fmt.Errorf("source volume error: %w", err)
+	}
+	destPVC, err := vm.claimForVolume(ctx, destVolume, namespace, storageClass)
+	if err != nil {
+		return fmt.Errorf("destination volume error: %w", err)
+	}
+
+	jobName := copyJobName(sourceVolume, destVolume)
+	vm.printf("Source Volume: %s (PVC %s)\n", sourceVolume, sourcePVC)
+	vm.printf("Destination Volume: %s (PVC %s)\n", destVolume, destPVC)
+	vm.printf("Job: %s\n\n", jobName)
+
+	backoffLimit := int32(0)
+	ttl := int32(3600)
+	labels := map[string]string{"app": "lhc-temp", "lhc-copy-job": jobName}
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        jobName,
+			Namespace:   namespace,
+			Labels:      labels,
+			Annotations: vm.tempAnnotations(sourceVolume, destVolume),
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit:            &backoffLimit,
+			TTLSecondsAfterFinished: &ttl,
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: corev1.PodSpec{
+					RestartPolicy: corev1.RestartPolicyNever,
+					Containers: []corev1.Container{{
+						Name:    "copy",
+						Image:   vm.tempPodImage(),
+						Command: []string{"sh", "-c", inClusterCopyScript(vm.Sparse)},
+						VolumeMounts: []corev1.VolumeMount{
+							{Name: "source", MountPath: "/source", ReadOnly: true},
+							{Name: "dest", MountPath: "/dest"},
+						},
+					}},
+					Volumes: []corev1.Volume{
+						{
+							Name: "source",
+							VolumeSource: corev1.VolumeSource{
+								PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: sourcePVC, ReadOnly: true},
+							},
+						},
+						{
+							Name: "dest",
+							VolumeSource: corev1.VolumeSource{
+								PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: destPVC},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	vm.applyTempPodOptions(ctx, &job.Spec.Template.Spec, sourceVolume, destVolume)
+
+	if vm.DryRun {
+		vm.dryRunf("create Job %s/%s mounting PVC %s read-only at /source and PVC %s at /dest, running:\n%s",
+			namespace, jobName, sourcePVC, destPVC, inClusterCopyScript(vm.Sparse))
+		return nil
+	}
+
+	// The job script clears the destination before copying
+	vm.recordVolumeEvent(ctx, destVolume, corev1.EventTypeNormal, "Wiped", fmt.Sprintf("contents deleted before in-cluster copy from %s", sourceVolume))
+
+	_, err = vm.clientset.BatchV1().Jobs(namespace).Create(ctx, job, metav1.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to create copy job: %w", err)
+	}
+	vm.trackTemporary("job", namespace, job)
+	defer func() {
+		propagation := metav1.DeletePropagationBackground
+		err := vm.clientset.BatchV1().Jobs(namespace).Delete(ctx, jobName, metav1.DeleteOptions{PropagationPolicy: &propagation})
+		if err != nil {
+			vm.printf("Warning: failed to delete copy job %s: %v\n", jobName, err)
+		}
+	}()
+
+	podName, err := vm.waitForJobPod(ctx, namespace, jobName)
+	if err != nil {
+		return err
+	}
+
+	vm.printf("Following logs of pod %s...\n", podName)
+	if err := vm.followPodLogs(ctx, namespace, podName); err != nil {
+		vm.printf("Warning: log stream ended: %v\n", err)
+	}
+
+	return vm.waitForJobCompletion(ctx, namespace, jobName)
+}
+
+// waitForJobPod watches the Job's pods until one has started (or
+// finished) and returns its name, printing each pod's state changes. On
+// timeout the error includes the Job's events and the status of its pods.
+func (vm *VolumeManager) waitForJobPod(ctx context.Context, namespace, jobName string) (string, error) {
+	timeout := vm.waitTimeoutOr(defaultJobStartTimeout) // attach and scheduling can be slow
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	pods := vm.clientset.CoreV1().Pods(namespace)
+	lw := newListWatch(metav1.ListOptions{LabelSelector: "lhc-copy-job=" + jobName},
+		func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+			return pods.List(ctx, opts)
+		},
+		func(ctx context.Context, opts metav1.ListOptions) (watch.Interface, error) {
+			return pods.Watch(ctx, opts)
+		})
+
+	vm.printf("Waiting for job %s to start...\n", jobName)
+	seen := map[string]*corev1.Pod{}
+	states := map[string]string{}
+	podName := ""
+	_, err := watchtools.UntilWithSync(waitCtx, lw, &corev1.Pod{}, nil, func(event watch.Event) (bool, error) {
+		pod, ok := event.Object.(*corev1.Pod)
+		if !ok || event.Type == watch.Deleted {
+			return false, nil
+		}
+		seen[pod.Name] = pod
+		if state := podState(pod); state != states[pod.Name] {
+			states[pod.Name] = state
+			vm.printf("  Pod %s: %s\n", pod.Name, state)
+		}
+		switch pod.Status.Phase {
+		case corev1.PodRunning, corev1.PodSucceeded, corev1.PodFailed:
+			podName = pod.Name
+			return true, nil
+		}
+		return false, nil
+	})
+	if err == nil {
+		return podName, nil
+	}
+	if waitCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+		diagnostics := vm.eventDiagnostics(ctx, "Job", namespace, jobName)
+		for _, pod := range seen {
+			diagnostics += vm.podDiagnostics(ctx, pod)
+		}
+		return "", categorize(ErrAttachTimeout, fmt.Errorf("job %s did not start within %s (use --wait-timeout to wait longer)%s", jobName, timeout, diagnostics))
+	}
+	return "", fmt.Errorf("failed waiting for job %s: %w", jobName, err)
+}
+
+// followPodLogs streams a pod's logs to stdout until the container exits.
+func (vm *VolumeManager) followPodLogs(ctx context.Context, namespace, podName string) error {
+	stream, err := vm.clientset.CoreV1().Pods(namespace).GetLogs(podName, &corev1.PodLogOptions{Follow: true}).Stream(ctx)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	scanner := bufio.NewScanner(stream)
+	for scanner.Scan() {
+		vm.printf("  [%s] %s\n", podName, scanner.Text())
+	}
+	return scanner.Err()
+}
+
+// waitForJobCompletion watches the Job until it succeeds or fails.
+func (vm *VolumeManager) waitForJobCompletion(ctx context.Context, namespace, jobName string) error {
+	jobs := vm.clientset.BatchV1().Jobs(namespace)
+	lw := newListWatch(metav1.ListOptions{FieldSelector: fields.OneTermEqualSelector("metadata.name", jobName).String()},
+		func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+			return jobs.List(ctx, opts)
+		},
+		func(ctx context.Context, opts metav1.ListOptions) (watch.Interface, error) {
+			return jobs.Watch(ctx, opts)
+		})
+
+	_, err := watchtools.UntilWithSync(ctx, lw, &batchv1.Job{}, nil, func(event watch.Event) (bool, error) {
+		job, ok := event.Object.(*batchv1.Job)
+		if !ok {
+			return false, nil
+		}
+		if event.Type == watch.Deleted {
+			return false, fmt.Errorf("copy job %s was deleted before it finished", jobName)
+		}
+		if job.Status.Succeeded > 0 {
+			return true, nil
+		}
+		if job.Status.Failed > 0 {
+			return false, fmt.Errorf("copy job %s failed; see logs above", jobName)
+		}
+		return false, nil
+	})
+	return err
+}
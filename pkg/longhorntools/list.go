@@ -0,0 +1,172 @@
+package longhorntools
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// VolumeSortKeys are the fields SortVolumes can order by.
+var VolumeSortKeys = []string{"name", "size", "state", "created"}
+
+// VolumeFilter selects volumes for list output. Zero fields match every
+// volume.
+type VolumeFilter struct {
+	// States matches any of the given volume states (attached, detached,
+	// ...) or robustness values (healthy, degraded, faulted, unknown).
+	States []string
+
+	// Bound, if set, keeps only volumes that have (true) or lack (false)
+	// a PersistentVolume.
+	Bound *bool
+
+	// Node keeps volumes attached to this node.
+	Node string
+
+	// PVCNamespace keeps volumes whose PVC is in this namespace.
+	PVCNamespace string
+}
+
+// Match reports whether volume passes every set field of the filter.
+func (f VolumeFilter) Match(volume LonghornVolume) bool {
+	if len(f.States) > 0 {
+		matched := false
+		for _, state := range f.States {
+			if strings.EqualFold(state, volume.State) || strings.EqualFold(state, volume.Robustness) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if f.Bound != nil && *f.Bound != (volume.PVName != "") {
+		return false
+	}
+	if f.Node != "" && f.Node != volume.NodeID {
+		return false
+	}
+	if f.PVCNamespace != "" && f.PVCNamespace != volume.PVCNamespace {
+		return false
+	}
+	return true
+}
+
+// FilterVolumes returns the volumes that match f, in their original order.
+func FilterVolumes(volumes []LonghornVolume, f VolumeFilter) []LonghornVolume {
+	var matched []LonghornVolume
+	for _, volume := range volumes {
+		if f.Match(volume) {
+			matched = append(matched, volume)
+		}
+	}
+	return matched
+}
+
+// SizeBytes returns the volume size in bytes, or -1 if it is unknown.
+// Longhorn reports sizes as a byte count, but quantities such as "2Gi" are
+// accepted too.
+func (v LonghornVolume) SizeBytes() int64 {
+	q, err := resource.ParseQuantity(v.Size)
+	if err != nil {
+		return -1
+	}
+	return q.Value()
+}
+
+// SortVolumes orders volumes in place by one of VolumeSortKeys. Sizes
+// compare numerically, and ties are broken by name.
+func SortVolumes(volumes []LonghornVolume, by string, descending bool) error {
+	var less func(a, b LonghornVolume) bool
+	switch by {
+	case "name":
+		less = func(a, b LonghornVolume) bool { return false }
+	case "size":
+		less = func(a, b LonghornVolume) bool { return a.SizeBytes() < b.SizeBytes() }
+	case "state":
+		less = func(a, b LonghornVolume) bool { return a.State < b.State }
+	case "created":
+		less = func(a, b LonghornVolume) bool { return a.Created.Before(b.Created) }
+	default:
+		return fmt.Errorf("unknown sort key %q (expected one of %s)", by, strings.Join(VolumeSortKeys, ", "))
+	}
+
+	sort.SliceStable(volumes, func(i, j int) bool {
+		a, b := volumes[i], volumes[j]
+		if descending {
+			a, b = b, a
+		}
+		if less(a, b) {
+			return true
+		}
+		if less(b, a) {
+			return false
+		}
+		return a.Name < b.Name
+	})
+	return nil
+}
+
+// WatchVolumes calls update with the full set of Longhorn volumes, first
+// with the current list and again after every change, until ctx is
+// cancelled. The watch is re-established whenever the API server closes it.
+func (vm *VolumeManager) WatchVolumes(ctx context.Context, update func([]LonghornVolume)) error {
+	client := vm.dynamicClient.Resource(longhornVolumeGVR).Namespace("longhorn-system")
+	for ctx.Err() == nil {
+		list, err := client.List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to list Longhorn volumes: %w", err)
+		}
+		current := make(map[string]LonghornVolume, len(list.Items))
+		for _, item := range list.Items {
+			current[item.GetName()] = parseLonghornVolume(&item)
+		}
+		update(volumeSnapshot(current))
+
+		w, err := client.Watch(ctx, metav1.ListOptions{ResourceVersion: list.GetResourceVersion()})
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			vm.printf("Failed to watch Longhorn volumes: %v (retrying)\n", err)
+			time.Sleep(5 * time.Second)
+			continue
+		}
+
+		for event := range w.ResultChan() {
+			obj, ok := event.Object.(*unstructured.Unstructured)
+			if !ok {
+				continue
+			}
+			switch event.Type {
+			case watch.Added, watch.Modified:
+				current[obj.GetName()] = parseLonghornVolume(obj)
+			case watch.Deleted:
+				delete(current, obj.GetName())
+			default:
+				continue
+			}
+			update(volumeSnapshot(current))
+		}
+		w.Stop()
+	}
+	return nil
+}
+
+// volumeSnapshot returns the volumes in m sorted by name.
+func volumeSnapshot(m map[string]LonghornVolume) []LonghornVolume {
+	volumes := make([]LonghornVolume, 0, len(m))
+	for _, volume := range m {
+		volumes = append(volumes, volume)
+	}
+	sort.Slice(volumes, func(i, j int) bool { return volumes[i].Name < volumes[j].Name })
+	return volumes
+}
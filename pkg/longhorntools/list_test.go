@@ -0,0 +1,82 @@
+package longhorntools
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func volumeNames(volumes []LonghornVolume) []string {
+	names := make([]string, 0, len(volumes))
+	for _, v := range volumes {
+		names = append(names, v.Name)
+	}
+	return names
+}
+
+func TestFilterVolumes(t *testing.T) {
+	volumes := []LonghornVolume{
+		{Name: "a", State: "attached", Robustness: "healthy", PVName: "pv-a", PVCNamespace: "apps", NodeID: "node-1"},
+		{Name: "b", State: "attached", Robustness: "degraded", PVName: "pv-b", PVCNamespace: "db", NodeID: "node-2"},
+		{Name: "c", State: "detached", Robustness: "unknown"},
+	}
+	bound, unbound := true, false
+
+	tests := []struct {
+		filter VolumeFilter
+		want   []string
+	}{
+		{VolumeFilter{}, []string{"a", "b", "c"}},
+		{VolumeFilter{States: []string{"detached"}}, []string{"c"}},
+		{VolumeFilter{States: []string{"Degraded"}}, []string{"b"}},
+		{VolumeFilter{States: []string{"healthy", "detached"}}, []string{"a", "c"}},
+		{VolumeFilter{Bound: &bound}, []string{"a", "b"}},
+		{VolumeFilter{Bound: &unbound}, []string{"c"}},
+		{VolumeFilter{Node: "node-2"}, []string{"b"}},
+		{VolumeFilter{PVCNamespace: "apps"}, []string{"a"}},
+		{VolumeFilter{States: []string{"attached"}, PVCNamespace: "db"}, []string{"b"}},
+		{VolumeFilter{States: []string{"faulted"}}, []string{}},
+	}
+	for _, tt := range tests {
+		if got := volumeNames(FilterVolumes(volumes, tt.filter)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("FilterVolumes(%+v) = %v, want %v", tt.filter, got, tt.want)
+		}
+	}
+}
+
+func TestSortVolumes(t *testing.T) {
+	now := time.Now()
+	volumes := []LonghornVolume{
+		{Name: "c", Size: "2Gi", State: "attached", Created: now},
+		{Name: "a", Size: "10737418240", State: "detached", Created: now.Add(-time.Hour)},
+		{Name: "b", Size: "2147483648", State: "attached", Created: now.Add(-2 * time.Hour)},
+	}
+
+	tests := []struct {
+		by         string
+		descending bool
+		want       []string
+	}{
+		{"name", false, []string{"a", "b", "c"}},
+		{"name", true, []string{"c", "b", "a"}},
+		// Sizes compare as numbers, and equal ones by name
+		{"size", false, []string{"b", "c", "a"}},
+		{"size", true, []string{"a", "c", "b"}},
+		{"state", false, []string{"b", "c", "a"}},
+		{"created", false, []string{"b", "a", "c"}},
+		{"created", true, []string{"c", "a", "b"}},
+	}
+	for _, tt := range tests {
+		sorted := append([]LonghornVolume(nil), volumes...)
+		if err := SortVolumes(sorted, tt.by, tt.descending); err != nil {
+			t.Fatalf("SortVolumes(%s): %v", tt.by, err)
+		}
+		if got := volumeNames(sorted); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SortVolumes(%s, descending=%v) = %v, want %v", tt.by, tt.descending, got, tt.want)
+		}
+	}
+
+	if err := SortVolumes(volumes, "replicas", false); err == nil {
+		t.Error("SortVolumes(replicas) succeeded, want an error for the unknown key")
+	}
+}
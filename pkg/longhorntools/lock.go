@@ -0,0 +1,206 @@
+package longhorntools
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// lockNamespace holds the per-volume Leases. Temporary PVs are
+	// cluster-scoped, so locks must not depend on the -n namespace.
+	lockNamespace = "longhorn-system"
+	// lockLeaseDuration is how long a lock survives without renewal, so a
+	// crashed run does not block a volume forever.
+	lockLeaseDuration = 60 * time.Second
+)
+
+// lockLeaseName returns the Lease guarding volumeName.
+func lockLeaseName(volumeName string) string {
+	return "lhc-lock-" + volumeName
+}
+
+// lockHolder identifies this process as a Lease holder.
+func lockHolder() string {
+	return fmt.Sprintf("%s/%d", auditActor(), os.Getpid())
+}
+
+// acquireVolumeLock takes the Lease for volumeName, waiting up to
+// vm.LockTimeout for another holder to release it. The returned function
+// stops renewal and releases the lock.
+func (vm *VolumeManager) acquireVolumeLock(ctx context.Context, volumeName string) (func(), error) {
+	if vm.DryRun {
+		return func() {}, nil
+	}
+
+	leases := vm.clientset.CoordinationV1().Leases(lockNamespace)
+	name := lockLeaseName(volumeName)
+	holder := lockHolder()
+	durationSeconds := int32(lockLeaseDuration.Seconds())
+	deadline := time.Now().Add(vm.LockTimeout)
+	waiting := false
+
+	for {
+		now := metav1.NewMicroTime(time.Now())
+		lease, err := leases.Get(ctx, name, metav1.GetOptions{})
+		switch {
+		case errors.IsNotFound(err):
+			_, err = leases.Create(ctx, &coordinationv1.Lease{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      name,
+					Namespace: lockNamespace,
+					Labels:    map[string]string{"app": "lhc-lock"},
+				},
+				Spec: coordinationv1.LeaseSpec{
+					HolderIdentity:       &holder,
+					LeaseDurationSeconds: &durationSeconds,
+					AcquireTime:          &now,
+					RenewTime:            &now,
+				},
+			}, metav1.CreateOptions{})
+			if err == nil {
+				vm.track("lease", lockNamespace, name)
+				return vm.holdVolumeLock(ctx, volumeName, holder), nil
+			}
+			if !errors.IsAlreadyExists(err) {
+				return nil, fmt.Errorf("failed to create lock for volume %s: %w", volumeName, err)
+			}
+
+		case err != nil:
+			return nil, fmt.Errorf("failed to get lock for volume %s: %w", volumeName, err)
+
+		case leaseExpired(lease):
+			// The previous holder stopped renewing; take over
+			lease.Spec.HolderIdentity = &holder
+			lease.Spec.LeaseDurationSeconds = &durationSeconds
+			lease.Spec.AcquireTime = &now
+			lease.Spec.RenewTime = &now
+			_, err = leases.Update(ctx, lease, metav1.UpdateOptions{})
+			if err == nil {
+				vm.track("lease", lockNamespace, name)
+				return vm.holdVolumeLock(ctx, volumeName, holder), nil
+			}
+			if !errors.IsConflict(err) {
+				return nil, fmt.Errorf("failed to take over lock for volume %s: %w", volumeName, err)
+			}
+
+		default:
+			owner := "unknown"
+			if lease.Spec.HolderIdentity != nil {
+				owner = *lease.Spec.HolderIdentity
+			}
+			if !time.Now().Before(deadline) {
+				return nil, categorize(ErrVolumeInUse, fmt.Errorf("volume %s is locked by %s (use --lock-timeout to wait, or delete lease %s/%s if it is stale)",
+					volumeName, owner, lockNamespace, name))
+			}
+			if !waiting {
+				vm.printf("Volume %s is locked by %s, waiting up to %s...\n", volumeName, owner, vm.LockTimeout)
+				waiting = true
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(2 * time.Second):
+		}
+	}
+}
+
+// leaseExpired reports whether the holder has stopped renewing the Lease.
+func leaseExpired(lease *coordinationv1.Lease) bool {
+	if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity == "" {
+		return true
+	}
+	if lease.Spec.RenewTime == nil || lease.Spec.LeaseDurationSeconds == nil {
+		return true
+	}
+	expiry := lease.Spec.RenewTime.Add(time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second)
+	return time.Now().After(expiry)
+}
+
+// holdVolumeLock renews the Lease in the background until the returned
+// release function is called, which then deletes it. The expiry of the
+// volume's temporary resources is renewed along with it, a quarter of the
+// TTL at a time.
+func (vm *VolumeManager) holdVolumeLock(ctx context.Context, volumeName, holder string) func() {
+	leases := vm.clientset.CoordinationV1().Leases(lockNamespace)
+	name := lockLeaseName(volumeName)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(lockLeaseDuration / 3)
+		defer ticker.Stop()
+		renewed := time.Now()
+		warned := false
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				lease, err := leases.Get(ctx, name, metav1.GetOptions{})
+				if err != nil || lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity != holder {
+					vm.printf("Warning: lost lock on volume %s\n", volumeName)
+					return
+				}
+				now := metav1.NewMicroTime(time.Now())
+				lease.Spec.RenewTime = &now
+				if _, err := leases.Update(ctx, lease, metav1.UpdateOptions{}); err != nil {
+					vm.printf("Warning: failed to renew lock on volume %s: %v\n", volumeName, err)
+				}
+				if time.Since(renewed) < vm.tempTTLOrDefault()/4 {
+					continue
+				}
+				renewed = time.Now()
+				if err := vm.renewTemporary(ctx, volumeName); err != nil && !warned {
+					vm.printf("Warning: %v\n", err)
+					warned = true
+				}
+			}
+		}
+	}()
+
+	return func() {
+		close(stop)
+		<-done
+		lease, err := leases.Get(ctx, name, metav1.GetOptions{})
+		if err != nil || lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity != holder {
+			return
+		}
+		err = leases.Delete(ctx, name, metav1.DeleteOptions{
+			Preconditions: &metav1.Preconditions{ResourceVersion: &lease.ResourceVersion},
+		})
+		if err != nil && !errors.IsNotFound(err) {
+			vm.printf("Warning: failed to release lock on volume %s: %v\n", volumeName, err)
+		}
+	}
+}
+
+// withVolumeLocks runs fn while holding the locks of all given volumes.
+// Locks are taken in sorted order so two copies in opposite directions
+// cannot deadlock.
+func (vm *VolumeManager) withVolumeLocks(ctx context.Context, volumes []string, fn func() error) error {
+	sorted := append([]string(nil), volumes...)
+	sort.Strings(sorted)
+
+	for i, volumeName := range sorted {
+		if i > 0 && volumeName == sorted[i-1] {
+			continue
+		}
+		release, err := vm.acquireVolumeLock(ctx, volumeName)
+		if err != nil {
+			return err
+		}
+		defer release()
+	}
+
+	return fn()
+}
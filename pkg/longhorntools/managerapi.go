@@ -0,0 +1,356 @@
+package longhorntools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/rest"
+)
+
+// Backends for the operations the Longhorn manager API supports
+// (--backend).
+const (
+	// BackendKubernetes reads and writes Longhorn's custom resources.
+	BackendKubernetes = "kubernetes"
+	// BackendAPI calls the longhorn-manager REST API instead, through the
+	// API server's service proxy or at ManagerURL, to list volumes,
+	// snapshots, and backups. Everything else, including reading files,
+	// still uses custom resources and temporary pods, since the manager
+	// API has no access to a volume's filesystem.
+	BackendAPI = "api"
+)
+
+// ValidateBackend checks a --backend value.
+func ValidateBackend(backend string) error {
+	switch backend {
+	case BackendKubernetes, BackendAPI:
+		return nil
+	default:
+		return fmt.Errorf("unsupported backend %q (expected %s or %s)", backend, BackendKubernetes, BackendAPI)
+	}
+}
+
+// The longhorn-manager API service and its port.
+const (
+	managerService = "longhorn-backend"
+	managerPort    = "9500"
+)
+
+// useManagerAPI reports whether the manager API backend is selected.
+func (vm *VolumeManager) useManagerAPI() bool {
+	return vm.Backend == BackendAPI
+}
+
+// managerCall calls the Longhorn manager API: it GETs path when action is
+// empty, and otherwise POSTs input to the action on path. The response is
+// decoded into out unless out is nil.
+func (vm *VolumeManager) managerCall(ctx context.Context, path, action string, input, out interface{}) error {
+	method := http.MethodGet
+	var body []byte
+	if action != "" {
+		method = http.MethodPost
+		if input == nil {
+			input = map[string]interface{}{}
+		}
+		var err error
+		if body, err = json.Marshal(input); err != nil {
+			return err
+		}
+	}
+
+	var data []byte
+	var err error
+	if vm.ManagerURL != "" {
+		data, err = vm.managerCallURL(ctx, method, path, action, body)
+	} else {
+		data, err = vm.managerCallProxy(ctx, method, path, action, body)
+	}
+	what := path
+	if action != "" {
+		what += "?action=" + action
+	}
+	if err != nil {
+		return fmt.Errorf("Longhorn manager API %s %s failed: %w", method, what, err)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("failed to parse Longhorn manager API response to %s: %w", what, err)
+	}
+	return nil
+}
+
+// managerCallProxy reaches the manager through the API server's service
+// proxy, with the manager's credentials, retries, and rate limits.
+func (vm *VolumeManager) managerCallProxy(ctx context.Context, method, path, action string, body []byte) ([]byte, error) {
+	client := vm.clientset.CoreV1().RESTClient()
+	if rc, ok := client.(*rest.RESTClient); !ok || rc == nil {
+		return nil, fmt.Errorf("this client cannot proxy to the %s service; set ManagerURL", managerService)
+	}
+	req := client.Verb(method).
+		AbsPath("/api/v1/namespaces/longhorn-system/services", managerService+":"+managerPort, "proxy", path).
+		SetHeader("Accept", "application/json")
+	if action != "" {
+		req = req.Param("action", action).SetHeader("Content-Type", "application/json").Body(body)
+	}
+	data, err := req.DoRaw(ctx)
+	if err != nil {
+		// The API server wraps a response it cannot parse as a Status
+		if status, ok := err.(apierrors.APIStatus); ok && status.Status().Details != nil {
+			for _, cause := range status.Status().Details.Causes {
+				if message := managerErrorMessage([]byte(cause.Message)); message != "" {
+					return nil, fmt.Errorf("%s", message)
+				}
+			}
+		}
+		return nil, err
+	}
+	return data, nil
+}
+
+// managerCallURL reaches the manager directly at ManagerURL, such as a
+// kubectl port-forward to the longhorn-backend service.
+func (vm *VolumeManager) managerCallURL(ctx context.Context, method, path, action string, body []byte) ([]byte, error) {
+	u := strings.TrimSuffix(vm.ManagerURL, "/") + path
+	if action != "" {
+		u += "?action=" + url.QueryEscape(action)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		if message := managerErrorMessage(data); message != "" {
+			return nil, fmt.Errorf("%s: %s", resp.Status, message)
+		}
+		return nil, fmt.Errorf("%s", resp.Status)
+	}
+	return data, nil
+}
+
+// managerErrorMessage extracts the message of an error the manager API
+// returned, if data is one.
+func managerErrorMessage(data []byte) string {
+	var apiErr struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(data, &apiErr) != nil || apiErr.Type != "error" {
+		return ""
+	}
+	return apiErr.Message
+}
+
+// managerVolume is the part of the manager API's volume used here.
+type managerVolume struct {
+	Name             string `json:"name"`
+	Size             string `json:"size"`
+	State            string `json:"state"`
+	Robustness       string `json:"robustness"`
+	NumberOfReplicas int64  `json:"numberOfReplicas"`
+	Frontend         string `json:"frontend"`
+	CurrentImage     string `json:"currentImage"`
+	Created          string `json:"created"`
+	KubernetesStatus struct {
+		PVName    string `json:"pvName"`
+		Namespace string `json:"namespace"`
+		PVCName   string `json:"pvcName"`
+	} `json:"kubernetesStatus"`
+	Controllers []struct {
+		HostID     string `json:"hostId"`
+		ActualSize string `json:"actualSize"`
+	} `json:"controllers"`
+}
+
+func (v *managerVolume) longhornVolume() LonghornVolume {
+	volume := LonghornVolume{
+		Name:         v.Name,
+		Size:         v.Size,
+		State:        v.State,
+		Robustness:   v.Robustness,
+		PVName:       v.KubernetesStatus.PVName,
+		PVCNamespace: v.KubernetesStatus.Namespace,
+		PVCName:      v.KubernetesStatus.PVCName,
+		Replicas:     v.NumberOfReplicas,
+		Frontend:     v.Frontend,
+		EngineImage:  v.CurrentImage,
+	}
+	if volume.State == "" {
+		volume.State = "Unknown"
+	}
+	if volume.Size == "" {
+		volume.Size = "Unknown"
+	}
+	for _, c := range v.Controllers {
+		if c.HostID != "" && volume.NodeID == "" {
+			volume.NodeID = c.HostID
+		}
+		if size, err := strconv.ParseInt(c.ActualSize, 10, 64); err == nil && size > volume.ActualSize {
+			volume.ActualSize = size
+		}
+	}
+	volume.Created, _ = time.Parse(time.RFC3339, v.Created)
+	return volume
+}
+
+// managerVolumes lists the Longhorn volumes through the manager API.
+func (vm *VolumeManager) managerVolumes(ctx context.Context) ([]LonghornVolume, error) {
+	var list struct {
+		Data []managerVolume `json:"data"`
+	}
+	if err := vm.managerCall(ctx, "/v1/volumes", "", nil, &list); err != nil {
+		return nil, fmt.Errorf("failed to list Longhorn volumes: %w", err)
+	}
+	volumes := make([]LonghornVolume, 0, len(list.Data))
+	for i := range list.Data {
+		volumes = append(volumes, list.Data[i].longhornVolume())
+	}
+	return volumes, nil
+}
+
+// managerVolumeSnapshots lists the snapshots of volumeName through the
+// manager API, which asks the volume's engine, so the volume must be
+// attached.
+func (vm *VolumeManager) managerVolumeSnapshots(ctx context.Context, volumeName string) ([]Snapshot, error) {
+	var list struct {
+		Data []struct {
+			Name        string `json:"name"`
+			Parent      string `json:"parent"`
+			Created     string `json:"created"`
+			Size        string `json:"size"`
+			UserCreated bool   `json:"usercreated"`
+			Removed     bool   `json:"removed"`
+		} `json:"data"`
+	}
+	err := vm.managerCall(ctx, "/v1/volumes/"+url.PathEscape(volumeName), "snapshotList", nil, &list)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snapshots of volume %s: %w", volumeName, err)
+	}
+	snapshots := make([]Snapshot, 0, len(list.Data))
+	for _, s := range list.Data {
+		// The live head is not a snapshot, and removed ones await purging
+		if s.Name == "volume-head" || s.Removed {
+			continue
+		}
+		size, _ := strconv.ParseInt(s.Size, 10, 64)
+		snapshots = append(snapshots, Snapshot{
+			Name:        s.Name,
+			Parent:      s.Parent,
+			Created:     s.Created,
+			Size:        size,
+			UserCreated: s.UserCreated,
+			ReadyToUse:  true,
+		})
+	}
+	sort.SliceStable(snapshots, func(i, j int) bool { return snapshots[i].Created < snapshots[j].Created })
+	return snapshots, nil
+}
+
+// managerBackupVolumes lists the volumes in the backupstore through the
+// manager API. Longhorn before 1.8 has a single target and names a backup
+// volume after its volume.
+func (vm *VolumeManager) managerBackupVolumes(ctx context.Context) ([]BackupVolume, error) {
+	var list struct {
+		Data []struct {
+			Name             string `json:"name"`
+			VolumeName       string `json:"volumeName"`
+			BackupTargetName string `json:"backupTargetName"`
+			Size             string `json:"size"`
+			DataStored       string `json:"dataStored"`
+			LastBackupName   string `json:"lastBackupName"`
+			LastBackupAt     string `json:"lastBackupAt"`
+			Created          string `json:"created"`
+		} `json:"data"`
+	}
+	if err := vm.managerCall(ctx, "/v1/backupvolumes", "", nil, &list); err != nil {
+		return nil, fmt.Errorf("failed to list Longhorn backup volumes: %w", err)
+	}
+	volumes := make([]BackupVolume, 0, len(list.Data))
+	for _, item := range list.Data {
+		bv := BackupVolume{
+			Name:           item.Name,
+			Volume:         item.VolumeName,
+			Target:         item.BackupTargetName,
+			LastBackupName: item.LastBackupName,
+		}
+		if bv.Volume == "" {
+			bv.Volume = item.Name
+		}
+		if bv.Target == "" {
+			bv.Target = DefaultBackupTarget
+		}
+		bv.Size, _ = strconv.ParseInt(item.Size, 10, 64)
+		bv.DataStored, _ = strconv.ParseInt(item.DataStored, 10, 64)
+		bv.LastBackupAt, _ = time.Parse(time.RFC3339, item.LastBackupAt)
+		bv.Created, _ = time.Parse(time.RFC3339, item.Created)
+		volumes = append(volumes, bv)
+	}
+	return volumes, nil
+}
+
+// managerBackups lists the backups of the backup volumes on target and of
+// volumeName, either of which may be empty, through the manager API.
+func (vm *VolumeManager) managerBackups(ctx context.Context, target, volumeName string) ([]Backup, error) {
+	volumes, err := vm.managerBackupVolumes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var backups []Backup
+	for _, bv := range volumes {
+		if (target != "" && bv.Target != target) || (volumeName != "" && bv.Volume != volumeName) {
+			continue
+		}
+		var list struct {
+			Data []struct {
+				Name         string `json:"name"`
+				SnapshotName string `json:"snapshotName"`
+				State        string `json:"state"`
+				Size         string `json:"size"`
+				URL          string `json:"url"`
+				Created      string `json:"created"`
+			} `json:"data"`
+		}
+		err := vm.managerCall(ctx, "/v1/backupvolumes/"+url.PathEscape(bv.Name), "backupList", nil, &list)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list backups of %s: %w", bv.Name, err)
+		}
+		for _, item := range list.Data {
+			b := Backup{
+				Name:     item.Name,
+				Volume:   bv.Volume,
+				Target:   bv.Target,
+				Snapshot: item.SnapshotName,
+				State:    item.State,
+				URL:      item.URL,
+			}
+			b.Size, _ = strconv.ParseInt(item.Size, 10, 64)
+			b.Created, _ = time.Parse(time.RFC3339, item.Created)
+			backups = append(backups, b)
+		}
+	}
+	return backups, nil
+}
@@ -0,0 +1,305 @@
+package longhorntools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// MigrateOptions controls MigrateStorageClass.
+type MigrateOptions struct {
+	// Rebind moves the volume's PVC onto the new volume afterwards, keeping
+	// its name, so workloads need no changes. Nothing may use the PVC.
+	Rebind bool
+
+	// DestPVC names the new claim when not rebinding. It defaults to the
+	// PVC's name followed by the storage class.
+	DestPVC string
+}
+
+// MigrateResult describes a finished storage class migration.
+type MigrateResult struct {
+	Namespace    string `json:"namespace"`
+	SourcePVC    string `json:"sourcePVC"`
+	SourceVolume string `json:"sourceVolume"`
+	// DestPVC is the claim of the new volume: the source PVC's name after
+	// a rebind.
+	DestPVC    string `json:"destPVC"`
+	DestVolume string `json:"destVolume"`
+	Rebound    bool   `json:"rebound"`
+	// OldPV is the PersistentVolume of the source volume, retained after a
+	// rebind until it is deleted by hand.
+	OldPV string `json:"oldPV,omitempty"`
+}
+
+// MigrateStorageClass copies volumeName into a new volume provisioned from
+// the Longhorn storageClass, for parameters such as the replica count, data
+// locality, or encryption that cannot be changed in place. The new volume
+// gets its own PVC of the same size and access modes next to the volume's
+// PVC; with opts.Rebind the volume's PVC is then recreated on the new
+// volume, and the old volume is kept until deleted by hand.
+func (vm *VolumeManager) MigrateStorageClass(ctx context.Context, volumeName, storageClass string, opts MigrateOptions) (*MigrateResult, error) {
+	var result *MigrateResult
+	err := vm.withVolumeLocks(ctx, []string{volumeName}, func() error {
+		return observeOperation("migrate-sc", func() error {
+			var err error
+			result, err = vm.migrateStorageClass(ctx, volumeName, storageClass, opts)
+			vm.recordOperationResult(ctx, volumeName, "Migrated", "MigrationFailed", fmt.Sprintf("migration to storage class %s", storageClass), err)
+			return err
+		})
+	})
+	return result, err
+}
+
+func (vm *VolumeManager) migrateStorageClass(ctx context.Context, volumeName, storageClass string, opts MigrateOptions) (*MigrateResult, error) {
+	volume, err := vm.Volume(ctx, volumeName)
+	if err != nil {
+		return nil, err
+	}
+	if volume.PVCName == "" {
+		return nil, fmt.Errorf("volume %s has no PVC; migrate-sc needs one to size and name the new volume", volumeName)
+	}
+	namespace := volume.PVCNamespace
+	pvcs := vm.clientset.CoreV1().PersistentVolumeClaims(namespace)
+	source, err := pvcs.Get(ctx, volume.PVCName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get PVC %s/%s: %w", namespace, volume.PVCName, err)
+	}
+	sourceClass := ""
+	if source.Spec.StorageClassName != nil {
+		sourceClass = *source.Spec.StorageClassName
+	}
+	if sourceClass == storageClass {
+		return nil, fmt.Errorf("PVC %s/%s already uses storage class %s", namespace, source.Name, storageClass)
+	}
+
+	sc, err := vm.clientset.StorageV1().StorageClasses().Get(ctx, storageClass, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("storage class %s not found: %w", storageClass, err)
+	}
+	if sc.Provisioner != "driver.longhorn.io" {
+		return nil, fmt.Errorf("storage class %s is provisioned by %s, not driver.longhorn.io", storageClass, sc.Provisioner)
+	}
+
+	if opts.Rebind {
+		pods, err := vm.podsUsingClaim(ctx, namespace, source.Name)
+		if err != nil {
+			return nil, err
+		}
+		for _, pod := range pods {
+			if pod.Status.Phase != corev1.PodSucceeded && pod.Status.Phase != corev1.PodFailed {
+				return nil, categorize(ErrVolumeInUse, fmt.Errorf("pod %s/%s uses PVC %s; scale its workload down before migrating with --rebind", namespace, pod.Name, source.Name))
+			}
+		}
+	}
+
+	destPVC := opts.DestPVC
+	switch {
+	case opts.Rebind:
+		destPVC = "lhc-migrate-" + source.Name
+	case destPVC == "":
+		destPVC = source.Name + "-" + storageClass
+	}
+	if _, err := pvcs.Get(ctx, destPVC, metav1.GetOptions{}); err == nil {
+		return nil, fmt.Errorf("PVC %s/%s already exists", namespace, destPVC)
+	} else if !apierrors.IsNotFound(err) {
+		return nil, fmt.Errorf("failed to check for PVC %s/%s: %w", namespace, destPVC, err)
+	}
+
+	// Open the source first, so a source that cannot be read leaves nothing
+	// behind
+	sourcePod, sourceMountPath, sourceContainer, err := vm.getVolumeInfo(ctx, volumeName, namespace, sourceClass)
+	if err != nil {
+		return nil, fmt.Errorf("source volume error: %w", err)
+	}
+	cleaned := false
+	cleanupSource := func() {
+		if !cleaned {
+			cleaned = true
+			vm.CleanupVolumeResources(ctx, volumeName, namespace)
+		}
+	}
+	defer cleanupSource()
+
+	size := claimSize(source)
+	pvc := claimLike(source, destPVC, storageClass)
+	if opts.Rebind {
+		// The claim is only a vehicle until the rebind
+		pvc.Labels = nil
+	}
+	vm.printf("Creating PVC %s (%s, storage class %s)...\n", destPVC, size.String(), storageClass)
+	if vm.DryRun {
+		vm.dryRunf("create PersistentVolumeClaim %s/%s", namespace, destPVC)
+	} else if _, err := pvcs.Create(ctx, pvc, metav1.CreateOptions{}); err != nil {
+		return nil, fmt.Errorf("failed to create PVC %s: %w", destPVC, err)
+	}
+
+	succeeded := false
+	defer func() {
+		if succeeded || vm.DryRun {
+			return
+		}
+		vm.printf("Deleting PVC %s after the failed migration\n", destPVC)
+		if err := pvcs.Delete(ctx, destPVC, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			vm.printf("Warning: failed to delete PVC %s: %v\n", destPVC, err)
+		}
+	}()
+
+	destPod, destMountPath, destContainer, err := vm.createTemporaryPodForPVC(ctx, destPVC, namespace, volumeName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to mount new PVC %s: %w", destPVC, err)
+	}
+	vm.printf("Copying volume %s into PVC %s...\n", volumeName, destPVC)
+	err = vm.streamCopyWithProgress(ctx, "migrate", volumeName, namespace, sourcePod, sourceContainer, sourceMountPath,
+		destPod, destContainer, destMountPath)
+	vm.deleteTemporaryPod(ctx, namespace, destPod)
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy data: %w", err)
+	}
+
+	result := &MigrateResult{
+		Namespace:    namespace,
+		SourcePVC:    source.Name,
+		SourceVolume: volumeName,
+		DestPVC:      destPVC,
+	}
+	if vm.DryRun {
+		if opts.Rebind {
+			vm.dryRunf("recreate PersistentVolumeClaim %s/%s on the new volume, retaining PV %s", namespace, source.Name, source.Spec.VolumeName)
+		}
+		return result, nil
+	}
+
+	created, err := pvcs.Get(ctx, destPVC, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get PVC %s: %w", destPVC, err)
+	}
+	if result.DestVolume, err = vm.pvVolume(ctx, created.Spec.VolumeName); err != nil {
+		return nil, err
+	}
+	succeeded = true
+	if !opts.Rebind {
+		return result, nil
+	}
+
+	// The source volume's temporary pod must be gone before its PVC can be
+	// deleted
+	cleanupSource()
+	if err := vm.rebindClaim(ctx, source, created); err != nil {
+		return nil, err
+	}
+	result.DestPVC = source.Name
+	result.Rebound = true
+	result.OldPV = source.Spec.VolumeName
+	return result, nil
+}
+
+// rebindClaim recreates the claim source on the PersistentVolume of dest,
+// which is released for it. Both PersistentVolumes are retained first, so
+// deleting the claims removes neither volume.
+func (vm *VolumeManager) rebindClaim(ctx context.Context, source, dest *corev1.PersistentVolumeClaim) error {
+	namespace := source.Namespace
+	pvcs := vm.clientset.CoreV1().PersistentVolumeClaims(namespace)
+	pvs := vm.clientset.CoreV1().PersistentVolumes()
+
+	retain, _ := json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{
+			"persistentVolumeReclaimPolicy": corev1.PersistentVolumeReclaimRetain,
+		},
+	})
+	for _, pv := range []string{source.Spec.VolumeName, dest.Spec.VolumeName} {
+		if _, err := pvs.Patch(ctx, pv, types.MergePatchType, retain, metav1.PatchOptions{}); err != nil {
+			return fmt.Errorf("failed to retain PV %s: %w", pv, err)
+		}
+	}
+
+	vm.printf("Releasing PV %s from PVC %s...\n", dest.Spec.VolumeName, dest.Name)
+	if err := pvcs.Delete(ctx, dest.Name, metav1.DeleteOptions{}); err != nil {
+		return fmt.Errorf("failed to delete PVC %s: %w", dest.Name, err)
+	}
+	if err := vm.waitForPVCDeleted(ctx, namespace, dest.Name); err != nil {
+		return err
+	}
+	release, _ := json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{"claimRef": nil},
+	})
+	if _, err := pvs.Patch(ctx, dest.Spec.VolumeName, types.MergePatchType, release, metav1.PatchOptions{}); err != nil {
+		return fmt.Errorf("failed to release PV %s: %w", dest.Spec.VolumeName, err)
+	}
+
+	return vm.recreateClaim(ctx, source, dest.Spec.VolumeName, *dest.Spec.StorageClassName)
+}
+
+// recreateClaim deletes the claim source and creates it again, bound to the
+// available PersistentVolume pvName. The PersistentVolume source is bound
+// to must be retained, or deleting the claim deletes its volume.
+func (vm *VolumeManager) recreateClaim(ctx context.Context, source *corev1.PersistentVolumeClaim, pvName, storageClass string) error {
+	namespace := source.Namespace
+	pvcs := vm.clientset.CoreV1().PersistentVolumeClaims(namespace)
+
+	vm.printf("Recreating PVC %s on PV %s...\n", source.Name, pvName)
+	if err := pvcs.Delete(ctx, source.Name, metav1.DeleteOptions{}); err != nil {
+		return fmt.Errorf("failed to delete PVC %s: %w", source.Name, err)
+	}
+	if err := vm.waitForPVCDeleted(ctx, namespace, source.Name); err != nil {
+		return err
+	}
+
+	pvc := claimLike(source, source.Name, storageClass)
+	pvc.Spec.VolumeName = pvName
+	for key, value := range source.Annotations {
+		// Binding annotations belong to the old volume
+		if !strings.HasPrefix(key, "pv.kubernetes.io/") && !strings.HasPrefix(key, "volume.kubernetes.io/") &&
+			!strings.HasPrefix(key, "volume.beta.kubernetes.io/") {
+			if pvc.Annotations == nil {
+				pvc.Annotations = map[string]string{}
+			}
+			pvc.Annotations[key] = value
+		}
+	}
+	if _, err := pvcs.Create(ctx, pvc, metav1.CreateOptions{}); err != nil {
+		return fmt.Errorf("failed to recreate PVC %s on PV %s (the data is safe on that PV and on retained PV %s): %w",
+			source.Name, pvName, source.Spec.VolumeName, err)
+	}
+	return vm.waitForPVCBound(ctx, namespace, source.Name)
+}
+
+// claimLike returns a claim named name, provisioned from storageClass, with
+// the labels, access modes, volume mode, and size of source.
+func claimLike(source *corev1.PersistentVolumeClaim, name, storageClass string) *corev1.PersistentVolumeClaim {
+	accessModes := source.Spec.AccessModes
+	if len(accessModes) == 0 {
+		accessModes = []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce}
+	}
+	return &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: source.Namespace,
+			Labels:    source.Labels,
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes: accessModes,
+			Resources: corev1.VolumeResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceStorage: claimSize(source)},
+			},
+			StorageClassName: &storageClass,
+			VolumeMode:       source.Spec.VolumeMode,
+		},
+	}
+}
+
+// claimSize returns the capacity of a bound claim, which can exceed its
+// request and may all be in use, or else its request.
+func claimSize(pvc *corev1.PersistentVolumeClaim) resource.Quantity {
+	if size, ok := pvc.Status.Capacity[corev1.ResourceStorage]; ok {
+		return size
+	}
+	return pvc.Spec.Resources.Requests[corev1.ResourceStorage]
+}
@@ -0,0 +1,98 @@
+package longhorntools
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// claimPod returns a pod in phase that mounts claim.
+func claimPod(namespace, name, claim string, phase corev1.PodPhase) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Spec: corev1.PodSpec{Volumes: []corev1.Volume{{
+			Name:         "data",
+			VolumeSource: corev1.VolumeSource{PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: claim}},
+		}}},
+		Status: corev1.PodStatus{Phase: phase},
+	}
+}
+
+func classClaim(namespace, name, pvName, storageClass string) *corev1.PersistentVolumeClaim {
+	pvc := boundPVC(namespace, name, pvName)
+	pvc.Spec.StorageClassName = &storageClass
+	return pvc
+}
+
+func TestMigrateStorageClassChecks(t *testing.T) {
+	vm := newFakeVolumeManager(
+		[]*unstructured.Unstructured{
+			newFakeVolume("vol-a", "detached", "apps", "data"),
+			newFakeVolume("vol-b", "detached", "apps", "busy"),
+			newFakeVolume("vol-c", "detached", "apps", "taken"),
+			newFakeVolume("vol-unbound", "detached", "", ""),
+		},
+		classClaim("apps", "data", "pv-vol-a", "longhorn"),
+		classClaim("apps", "busy", "pv-vol-b", "longhorn"),
+		classClaim("apps", "taken", "pv-vol-c", "longhorn"),
+		classClaim("apps", "taken-longhorn-ssd", "", "longhorn-ssd"),
+		claimPod("apps", "db-0", "busy", corev1.PodRunning),
+		&storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "longhorn-ssd"}, Provisioner: "driver.longhorn.io"},
+		&storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "local-path"}, Provisioner: "rancher.io/local-path"},
+	)
+
+	tests := []struct {
+		volume       string
+		storageClass string
+		opts         MigrateOptions
+		want         string
+	}{
+		{"vol-unbound", "longhorn-ssd", MigrateOptions{}, "has no PVC"},
+		{"vol-a", "longhorn", MigrateOptions{}, "already uses storage class longhorn"},
+		{"vol-a", "missing", MigrateOptions{}, "storage class missing not found"},
+		{"vol-a", "local-path", MigrateOptions{}, "not driver.longhorn.io"},
+		{"vol-b", "longhorn-ssd", MigrateOptions{Rebind: true}, "pod apps/db-0 uses PVC busy"},
+		{"vol-c", "longhorn-ssd", MigrateOptions{}, "PVC apps/taken-longhorn-ssd already exists"},
+	}
+	for _, tt := range tests {
+		_, err := vm.MigrateStorageClass(context.Background(), tt.volume, tt.storageClass, tt.opts)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("MigrateStorageClass(%s, %s) = %v, want an error containing %q", tt.volume, tt.storageClass, err, tt.want)
+		}
+	}
+}
+
+func TestClaimLike(t *testing.T) {
+	block := corev1.PersistentVolumeBlock
+	source := boundPVC("apps", "data", "pv-a")
+	source.Labels = map[string]string{"app": "db"}
+	source.Spec.VolumeMode = &block
+	source.Spec.Resources.Requests = corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("1Gi")}
+
+	pvc := claimLike(source, "data-ssd", "longhorn-ssd")
+	if pvc.Namespace != "apps" || pvc.Name != "data-ssd" || *pvc.Spec.StorageClassName != "longhorn-ssd" {
+		t.Errorf("claimLike = %s/%s on %s", pvc.Namespace, pvc.Name, *pvc.Spec.StorageClassName)
+	}
+	if pvc.Labels["app"] != "db" || pvc.Spec.VolumeMode != &block {
+		t.Errorf("claimLike did not keep the labels and volume mode: %+v", pvc)
+	}
+	if len(pvc.Spec.AccessModes) != 1 || pvc.Spec.AccessModes[0] != corev1.ReadWriteOnce {
+		t.Errorf("access modes = %v, want [ReadWriteOnce]", pvc.Spec.AccessModes)
+	}
+	if size := pvc.Spec.Resources.Requests[corev1.ResourceStorage]; size.String() != "1Gi" {
+		t.Errorf("size = %s, want the request 1Gi", size.String())
+	}
+
+	// A bound claim's capacity can exceed its request, and all of it may be
+	// in use
+	source.Status.Capacity = corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("2Gi")}
+	if size := claimSize(source); size.String() != "2Gi" {
+		t.Errorf("claimSize = %s, want the capacity 2Gi", size.String())
+	}
+}
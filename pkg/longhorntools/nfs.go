@@ -0,0 +1,358 @@
+package longhorntools
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/tools/portforward"
+	"k8s.io/client-go/transport/spdy"
+)
+
+// DefaultNFSImage serves a directory over NFSv4 with the kernel NFS
+// server. It reads the export path, options, and allowed clients from the
+// SHARED_DIRECTORY, READ_ONLY, and PERMITTED environment variables, and
+// needs a privileged container.
+const DefaultNFSImage = "itsthenetwork/nfs-server-alpine:12"
+
+const (
+	// nfsExportPath is where the volume is mounted and exported from in
+	// the NFS server pod; clients mount it as the NFSv4 root, "/".
+	nfsExportPath = "/nfsshare"
+	// nfsPort is the only port NFSv4 needs.
+	nfsPort = 2049
+)
+
+// NFSExportOptions controls ExportNFS.
+type NFSExportOptions struct {
+	// ReadWrite exports the volume writable. By default it is read-only.
+	ReadWrite bool
+
+	// Clients restricts access to these hosts or networks, e.g.
+	// "10.0.0.0/8"; empty allows all.
+	Clients string
+
+	// ServiceType exposes the server through a Service of this type:
+	// ClusterIP (the default), NodePort, or LoadBalancer.
+	ServiceType corev1.ServiceType
+
+	// LocalPort, if set, also forwards this local port to the server, for
+	// clients on the machine running the export.
+	LocalPort int
+
+	// Image overrides DefaultNFSImage.
+	Image string
+}
+
+// NFSExport is a running NFS export of a volume.
+type NFSExport struct {
+	Volume    string `json:"volume"`
+	Namespace string `json:"namespace"`
+	Pod       string `json:"pod"`
+	Service   string `json:"service"`
+	ReadOnly  bool   `json:"readOnly"`
+	// Endpoints are the host:port addresses clients can mount from, such
+	// as the Service's cluster IP and the forwarded local port.
+	Endpoints []string `json:"endpoints"`
+	// Expires is when the export ends and its resources may be reaped.
+	Expires time.Time `json:"expires"`
+}
+
+// MountCommand returns a command that mounts the export from endpoint.
+func (e *NFSExport) MountCommand(endpoint string) string {
+	host, port := endpoint, fmt.Sprint(nfsPort)
+	if i := strings.LastIndex(endpoint, ":"); i >= 0 {
+		host, port = endpoint[:i], endpoint[i+1:]
+	}
+	options := "vers=4,port=" + port
+	if e.ReadOnly {
+		options += ",ro"
+	}
+	return fmt.Sprintf("mount -t nfs -o %s %s:/ /mnt/%s", options, host, e.Volume)
+}
+
+// ValidateServiceType checks an NFS export Service type.
+func ValidateServiceType(serviceType corev1.ServiceType) error {
+	switch serviceType {
+	case "", corev1.ServiceTypeClusterIP, corev1.ServiceTypeNodePort, corev1.ServiceTypeLoadBalancer:
+		return nil
+	default:
+		return fmt.Errorf("unsupported service type %q (expected %s, %s, or %s)", serviceType,
+			corev1.ServiceTypeClusterIP, corev1.ServiceTypeNodePort, corev1.ServiceTypeLoadBalancer)
+	}
+}
+
+// ExportNFS serves volumeName over NFS from a temporary pod in namespace,
+// so systems outside the cluster can read it directly, e.g. during a
+// migration. Once the export is up, ready is called with its endpoints.
+// The export lasts until ctx is cancelled or the temporary resources' TTL
+// passes, and the volume stays locked for as long. It then removes the pod
+// and its PVC and PV.
+//
+// The kernel NFS server needs a privileged container, so the export does
+// not work with the restricted security profile. The volume must not be
+// in use by a pod, as with the other operations that mount it.
+func (vm *VolumeManager) ExportNFS(ctx context.Context, volumeName, namespace, storageClass string, opts NFSExportOptions, ready func(*NFSExport)) error {
+	return vm.withVolumeLocks(ctx, []string{volumeName}, func() error {
+		err := vm.exportNFS(ctx, volumeName, namespace, storageClass, opts, ready)
+		vm.recordOperationResult(ctx, volumeName, "NFSExported", "NFSExportFailed", "NFS export", err)
+		return err
+	})
+}
+
+func (vm *VolumeManager) exportNFS(ctx context.Context, volumeName, namespace, storageClass string, opts NFSExportOptions, ready func(*NFSExport)) error {
+	if vm.SecurityProfile == SecurityProfileRestricted {
+		return fmt.Errorf("an NFS export needs a privileged pod, which the %s security profile forbids", SecurityProfileRestricted)
+	}
+	if err := ValidateServiceType(opts.ServiceType); err != nil {
+		return err
+	}
+	volume, err := vm.Volume(ctx, volumeName)
+	if err != nil {
+		return err
+	}
+	if volume.PVCName != "" {
+		pods, err := vm.podsUsingClaim(ctx, volume.PVCNamespace, volume.PVCName)
+		if err != nil {
+			return err
+		}
+		for _, pod := range pods {
+			if pod.Status.Phase != corev1.PodSucceeded && pod.Status.Phase != corev1.PodFailed {
+				return categorize(ErrVolumeInUse, fmt.Errorf("pod %s/%s uses PVC %s; delete it or scale down its workload before exporting volume %s",
+					pod.Namespace, pod.Name, volume.PVCName, volumeName))
+			}
+		}
+	}
+
+	podName := "lhc-temp-nfs-" + volumeName
+	pvcName := fmt.Sprintf("lhc-temp-pvc-%s", volumeName)
+	pvName := fmt.Sprintf("lhc-temp-pv-%s", volumeName)
+	defer func() {
+		// ctx is usually cancelled by now
+		cleanupCtx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		vm.printf("Stopping the NFS export of volume %s...\n", volumeName)
+		vm.deleteTemporaryPodAndVolume(cleanupCtx, namespace, podName, pvcName, pvName)
+	}()
+	if _, err := vm.ensureTemporaryPVC(ctx, volumeName, namespace, storageClass); err != nil {
+		return err
+	}
+
+	image := opts.Image
+	if image == "" {
+		image = DefaultNFSImage
+	}
+	env := []corev1.EnvVar{{Name: "SHARED_DIRECTORY", Value: nfsExportPath}}
+	mode := "read-write"
+	if !opts.ReadWrite {
+		// The image exports read-only when READ_ONLY is set at all
+		env = append(env, corev1.EnvVar{Name: "READ_ONLY", Value: "true"})
+		mode = "read-only"
+	}
+	clients := opts.Clients
+	if clients == "" {
+		clients = "*"
+	}
+	labels := map[string]string{"app": "lhc-temp", "lhc.io/nfs-export": volumeName}
+	// The export lasts for the TTL; the pod stops serving then even if
+	// lhc is gone
+	deadline := int64(vm.tempTTLOrDefault().Seconds())
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        podName,
+			Namespace:   namespace,
+			Labels:      labels,
+			Annotations: vm.tempAnnotations(volumeName),
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{
+				Name:  "nfs",
+				Image: image,
+				Env:   append(env, corev1.EnvVar{Name: "PERMITTED", Value: clients}),
+				Ports: []corev1.ContainerPort{{Name: "nfs", ContainerPort: nfsPort, Protocol: corev1.ProtocolTCP}},
+				VolumeMounts: []corev1.VolumeMount{{
+					Name:      "volume",
+					MountPath: nfsExportPath,
+					ReadOnly:  !opts.ReadWrite,
+				}},
+			}},
+			Volumes: []corev1.Volume{{
+				Name: "volume",
+				VolumeSource: corev1.VolumeSource{
+					PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: pvcName},
+				},
+			}},
+			RestartPolicy:         corev1.RestartPolicyNever,
+			ActiveDeadlineSeconds: &deadline,
+		},
+	}
+	vm.applyTempPodOptions(ctx, &pod.Spec, volumeName)
+	pod.Spec.Containers[0].SecurityContext = &corev1.SecurityContext{Privileged: boolPtr(true)}
+
+	export := &NFSExport{
+		Volume:    volumeName,
+		Namespace: namespace,
+		Pod:       podName,
+		Service:   podName,
+		ReadOnly:  !opts.ReadWrite,
+		Expires:   time.Now().Add(vm.tempTTLOrDefault()),
+	}
+	if vm.DryRun {
+		vm.dryRunf("create privileged NFS server pod %s/%s exporting PVC %s %s", namespace, podName, pvcName, mode)
+		vm.dryRunf("create Service %s/%s for port %d", namespace, podName, nfsPort)
+		return nil
+	}
+	created, err := vm.clientset.CoreV1().Pods(namespace).Create(ctx, pod, metav1.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to create NFS server pod: %w", err)
+	}
+	vm.trackTemporary("pod", namespace, pod)
+
+	// Owned by the pod, so it goes away with it
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      podName,
+			Namespace: namespace,
+			Labels:    labels,
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: "v1",
+				Kind:       "Pod",
+				Name:       podName,
+				UID:        created.UID,
+			}},
+		},
+		Spec: corev1.ServiceSpec{
+			Type:     opts.ServiceType,
+			Selector: labels,
+			Ports: []corev1.ServicePort{{
+				Name:       "nfs",
+				Port:       nfsPort,
+				TargetPort: intstr.FromInt32(nfsPort),
+				Protocol:   corev1.ProtocolTCP,
+			}},
+		},
+	}
+	if _, err := vm.clientset.CoreV1().Services(namespace).Create(ctx, service, metav1.CreateOptions{}); err != nil {
+		return fmt.Errorf("failed to create NFS Service: %w", err)
+	}
+	if err := vm.waitForPodRunning(ctx, namespace, podName); err != nil {
+		return err
+	}
+	vm.recordVolumeEvent(ctx, volumeName, corev1.EventTypeNormal, "Mounted", fmt.Sprintf("exported over NFS from temporary pod %s/%s", namespace, podName))
+
+	export.Endpoints, err = vm.nfsEndpoints(ctx, namespace, podName, opts.ServiceType)
+	if err != nil {
+		return err
+	}
+
+	waitCtx, cancel := context.WithDeadline(ctx, export.Expires)
+	defer cancel()
+	forwardErr := make(chan error, 1)
+	if opts.LocalPort > 0 {
+		forwardReady := make(chan struct{})
+		go func() {
+			forwardErr <- vm.portForward(waitCtx, namespace, podName, opts.LocalPort, nfsPort, forwardReady)
+		}()
+		select {
+		case <-forwardReady:
+			export.Endpoints = append(export.Endpoints, fmt.Sprintf("127.0.0.1:%d", opts.LocalPort))
+		case err := <-forwardErr:
+			return fmt.Errorf("failed to forward local port %d: %w", opts.LocalPort, err)
+		}
+	}
+	if ready != nil {
+		ready(export)
+	}
+
+	select {
+	case <-waitCtx.Done():
+		if ctx.Err() == nil {
+			vm.printf("The NFS export of volume %s reached its TTL of %s\n", volumeName, vm.tempTTLOrDefault())
+		}
+		return nil
+	case err := <-forwardErr:
+		return fmt.Errorf("port forwarding stopped: %w", err)
+	}
+}
+
+// nfsEndpoints returns where the NFS Service of an export can be reached:
+// its cluster IP, its node port on the pod's node, or its load balancer,
+// waiting for the load balancer to be provisioned.
+func (vm *VolumeManager) nfsEndpoints(ctx context.Context, namespace, name string, serviceType corev1.ServiceType) ([]string, error) {
+	timeout := vm.waitTimeoutOr(2 * time.Minute)
+	deadline := time.Now().Add(timeout)
+	for {
+		service, err := vm.clientset.CoreV1().Services(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get NFS Service: %w", err)
+		}
+		var endpoints []string
+		switch serviceType {
+		case corev1.ServiceTypeLoadBalancer:
+			for _, ingress := range service.Status.LoadBalancer.Ingress {
+				host := ingress.IP
+				if host == "" {
+					host = ingress.Hostname
+				}
+				endpoints = append(endpoints, fmt.Sprintf("%s:%d", host, nfsPort))
+			}
+		case corev1.ServiceTypeNodePort:
+			pod, err := vm.clientset.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				return nil, fmt.Errorf("failed to get NFS server pod: %w", err)
+			}
+			if pod.Status.HostIP != "" && len(service.Spec.Ports) > 0 {
+				endpoints = append(endpoints, fmt.Sprintf("%s:%d", pod.Status.HostIP, service.Spec.Ports[0].NodePort))
+			}
+		default:
+			endpoints = append(endpoints, fmt.Sprintf("%s:%d", service.Spec.ClusterIP, nfsPort))
+		}
+		if len(endpoints) > 0 {
+			return endpoints, nil
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("the %s Service %s/%s got no address within %s (use --wait-timeout to wait longer)", serviceType, namespace, name, timeout)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(2 * time.Second):
+		}
+	}
+}
+
+// portForward forwards localPort to podPort of a pod until ctx is done,
+// closing ready once it listens.
+func (vm *VolumeManager) portForward(ctx context.Context, namespace, podName string, localPort, podPort int, ready chan struct{}) error {
+	if vm.restConfig == nil {
+		return fmt.Errorf("port forwarding needs a cluster connection")
+	}
+	transport, upgrader, err := spdy.RoundTripperFor(vm.restConfig)
+	if err != nil {
+		return err
+	}
+	req := vm.clientset.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(namespace).
+		Name(podName).
+		SubResource("portforward")
+	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: transport}, http.MethodPost, req.URL())
+
+	stop := make(chan struct{})
+	go func() {
+		<-ctx.Done()
+		close(stop)
+	}()
+	forwarder, err := portforward.NewOnAddresses(dialer, []string{"127.0.0.1"},
+		[]string{fmt.Sprintf("%d:%d", localPort, podPort)}, stop, ready, io.Discard, vm.output())
+	if err != nil {
+		return err
+	}
+	return forwarder.ForwardPorts()
+}
@@ -0,0 +1,124 @@
+package longhorntools
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// longhornNodeGVR identifies Longhorn's Node custom resource.
+var longhornNodeGVR = schema.GroupVersionResource{
+	Group:    "longhorn.io",
+	Version:  "v1beta2",
+	Resource: "nodes",
+}
+
+// LonghornNode is a node as seen by Longhorn.
+type LonghornNode struct {
+	Name string `json:"name"`
+	// Ready and Schedulable mirror the node's conditions; AllowScheduling
+	// is the administrator's setting.
+	Ready           bool           `json:"ready"`
+	Schedulable     bool           `json:"schedulable"`
+	AllowScheduling bool           `json:"allowScheduling"`
+	Tags            []string       `json:"tags,omitempty"`
+	Disks           []LonghornDisk `json:"disks"`
+}
+
+// LonghornDisk is one disk of a Longhorn node. Storage values are in bytes.
+type LonghornDisk struct {
+	Name             string   `json:"name"`
+	Path             string   `json:"path"`
+	AllowScheduling  bool     `json:"allowScheduling"`
+	Tags             []string `json:"tags,omitempty"`
+	StorageMaximum   int64    `json:"storageMaximum"`
+	StorageAvailable int64    `json:"storageAvailable"`
+	StorageReserved  int64    `json:"storageReserved"`
+	StorageScheduled int64    `json:"storageScheduled"`
+	// Problems lists the disk's conditions that are not True, as
+	// "<type>: <reason>".
+	Problems []string `json:"problems,omitempty"`
+}
+
+// Storage sums the storage of a node's disks.
+func (n LonghornNode) Storage() (maximum, available, reserved, scheduled int64) {
+	for _, d := range n.Disks {
+		maximum += d.StorageMaximum
+		available += d.StorageAvailable
+		reserved += d.StorageReserved
+		scheduled += d.StorageScheduled
+	}
+	return maximum, available, reserved, scheduled
+}
+
+// Nodes lists the Longhorn nodes and their disks, sorted by name.
+func (vm *VolumeManager) Nodes(ctx context.Context) ([]LonghornNode, error) {
+	list, err := vm.dynamicClient.Resource(longhornNodeGVR).Namespace("longhorn-system").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list Longhorn nodes: %w", err)
+	}
+
+	nodes := make([]LonghornNode, 0, len(list.Items))
+	for _, item := range list.Items {
+		nodes = append(nodes, parseLonghornNode(&item))
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Name < nodes[j].Name })
+	return nodes, nil
+}
+
+func parseLonghornNode(item *unstructured.Unstructured) LonghornNode {
+	node := LonghornNode{Name: item.GetName()}
+	node.AllowScheduling, _, _ = unstructured.NestedBool(item.Object, "spec", "allowScheduling")
+	node.Tags, _, _ = unstructured.NestedStringSlice(item.Object, "spec", "tags")
+
+	conditions, _, _ := unstructured.NestedSlice(item.Object, "status", "conditions")
+	for _, c := range conditions {
+		condition, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		switch condition["type"] {
+		case "Ready":
+			node.Ready = condition["status"] == "True"
+		case "Schedulable":
+			node.Schedulable = condition["status"] == "True"
+		}
+	}
+
+	specDisks, _, _ := unstructured.NestedMap(item.Object, "spec", "disks")
+	diskStatus, _, _ := unstructured.NestedMap(item.Object, "status", "diskStatus")
+	for name, value := range specDisks {
+		spec, _ := value.(map[string]interface{})
+		disk := LonghornDisk{Name: name}
+		disk.Path, _, _ = unstructured.NestedString(spec, "path")
+		disk.AllowScheduling, _, _ = unstructured.NestedBool(spec, "allowScheduling")
+		disk.Tags, _, _ = unstructured.NestedStringSlice(spec, "tags")
+		disk.StorageReserved, _, _ = unstructured.NestedInt64(spec, "storageReserved")
+
+		if status, ok := diskStatus[name].(map[string]interface{}); ok {
+			disk.StorageMaximum, _, _ = unstructured.NestedInt64(status, "storageMaximum")
+			disk.StorageAvailable, _, _ = unstructured.NestedInt64(status, "storageAvailable")
+			disk.StorageScheduled, _, _ = unstructured.NestedInt64(status, "storageScheduled")
+
+			conditions, _, _ := unstructured.NestedSlice(status, "conditions")
+			for _, c := range conditions {
+				condition, ok := c.(map[string]interface{})
+				if !ok || condition["status"] == "True" {
+					continue
+				}
+				problem := fmt.Sprint(condition["type"])
+				if reason, _ := condition["reason"].(string); reason != "" {
+					problem += ": " + reason
+				}
+				disk.Problems = append(disk.Problems, problem)
+			}
+		}
+		node.Disks = append(node.Disks, disk)
+	}
+	sort.Slice(node.Disks, func(i, j int) bool { return node.Disks[i].Name < node.Disks[j].Name })
+	return node
+}
@@ -0,0 +1,270 @@
+package longhorntools
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilrand "k8s.io/apimachinery/pkg/util/rand"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/kubernetes/scheme"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+// offlineContentsDir holds one recorded listing per volume in a fixture
+// directory: contents/<volume>.txt.
+const offlineContentsDir = "contents"
+
+// NewOfflineVolumeManager returns a manager backed by in-memory fake
+// clients loaded from the recorded objects in dir, so list and contents can
+// run without a cluster.
+//
+// Every .yaml, .yml, and .json file in dir is read. Files may hold several
+// documents and List objects, such as the output of
+// "kubectl get volumes.longhorn.io -n longhorn-system -o yaml". Pods created
+// in offline mode start out running and PVCs bound. Commands run in pods
+// are answered from contents/<volume>.txt, which holds one
+// "<size> <mtime> <mode> <path>" line per file with paths relative to the
+// volume root; only the file listing used by VolumeContents, the df used
+// by VolumeUsage, and the fstrim used by TrimVolume are supported.
+func NewOfflineVolumeManager(dir string) (*VolumeManager, error) {
+	typed, untyped, err := loadFixtures(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	clientset := fake.NewSimpleClientset(typed...)
+	// Nothing runs in offline mode, so new pods and claims skip straight
+	// to the state the waits look for
+	clientset.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		pod := action.(k8stesting.CreateAction).GetObject().(*corev1.Pod)
+		pod.Status.Phase = corev1.PodRunning
+		return false, nil, nil
+	})
+	clientset.PrependReactor("create", "persistentvolumeclaims", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		pvc := action.(k8stesting.CreateAction).GetObject().(*corev1.PersistentVolumeClaim)
+		pvc.Status.Phase = corev1.ClaimBound
+		return false, nil, nil
+	})
+	// The fake tracker does not implement generateName
+	clientset.PrependReactor("create", "events", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		event := action.(k8stesting.CreateAction).GetObject().(*corev1.Event)
+		if event.Name == "" && event.GenerateName != "" {
+			event.Name = event.GenerateName + utilrand.String(5)
+		}
+		return false, nil, nil
+	})
+
+	listKinds := map[schema.GroupVersionResource]string{
+		longhornVolumeGVR:       "VolumeList",
+		longhornReplicaGVR:      "ReplicaList",
+		longhornEngineGVR:       "EngineList",
+		longhornSnapshotGVR:     "SnapshotList",
+		longhornNodeGVR:         "NodeList",
+		longhornOrphanGVR:       "OrphanList",
+		longhornEngineImageGVR:  "EngineImageList",
+		longhornSettingGVR:      "SettingList",
+		longhornRecurringJobGVR: "RecurringJobList",
+		longhornBackupTargetGVR: "BackupTargetList",
+		longhornBackupVolumeGVR: "BackupVolumeList",
+		longhornBackupGVR:       "BackupList",
+		volumeCopyGVR:           "VolumeCopyList",
+		volumeExportGVR:         "VolumeExportList",
+	}
+	for _, obj := range untyped {
+		gvk := obj.GetObjectKind().GroupVersionKind()
+		gvr, _ := meta.UnsafeGuessKindToResource(gvk)
+		listKinds[gvr] = gvk.Kind + "List"
+	}
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), listKinds, untyped...)
+
+	executor := &fixtureExecutor{dir: dir, clientset: clientset}
+	return NewVolumeManagerWithClients(clientset, dynamicClient, executor), nil
+}
+
+// loadFixtures decodes the objects in dir's manifest files. Kinds the
+// Kubernetes client knows are converted to typed objects for the fake
+// clientset; the rest, such as Longhorn volumes, stay unstructured for the
+// fake dynamic client.
+func loadFixtures(dir string) (typed []runtime.Object, untyped []runtime.Object, err error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read fixture directory: %w", err)
+	}
+
+	for _, entry := range entries {
+		switch filepath.Ext(entry.Name()) {
+		case ".yaml", ".yml", ".json":
+		default:
+			continue
+		}
+		if entry.IsDir() {
+			continue
+		}
+
+		objects, err := decodeFixtureFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, u := range objects {
+			obj, err := scheme.Scheme.New(u.GroupVersionKind())
+			if err != nil {
+				untyped = append(untyped, u)
+				continue
+			}
+			if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, obj); err != nil {
+				return nil, nil, fmt.Errorf("invalid %s %s in %s: %w", u.GetKind(), u.GetName(), entry.Name(), err)
+			}
+			typed = append(typed, obj)
+		}
+	}
+	return typed, untyped, nil
+}
+
+// decodeFixtureFile returns every object in path, expanding Lists.
+func decodeFixtureFile(path string) ([]*unstructured.Unstructured, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fixture: %w", err)
+	}
+
+	var objects []*unstructured.Unstructured
+	decoder := utilyaml.NewYAMLOrJSONDecoder(bytes.NewReader(data), 4096)
+	for {
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		if len(bytes.TrimSpace(raw)) == 0 || string(raw) == "null" {
+			continue
+		}
+
+		// The unstructured scheme keeps integers as int64, as the real
+		// dynamic client does
+		obj, _, err := unstructured.UnstructuredJSONScheme.Decode(raw, nil, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		switch obj := obj.(type) {
+		case *unstructured.UnstructuredList:
+			for i := range obj.Items {
+				objects = append(objects, &obj.Items[i])
+			}
+		case *unstructured.Unstructured:
+			objects = append(objects, obj)
+		}
+	}
+	return objects, nil
+}
+
+// fixtureExecutor answers the file listing command of VolumeContents, the
+// df of VolumeUsage, and the fstrim of TrimVolume from the recorded
+// listings in a fixture directory.
+type fixtureExecutor struct {
+	dir       string
+	clientset kubernetes.Interface
+}
+
+func (f *fixtureExecutor) Exec(ctx context.Context, namespace, podName, containerName string, command []string, streams remotecommand.StreamOptions) error {
+	if len(command) < 2 || (command[0] != "find" && command[0] != "df" && command[0] != "fstrim") {
+		return fmt.Errorf("offline mode cannot run %s", formatCommand(command))
+	}
+
+	volumeName, capacity, err := f.podVolume(ctx, namespace, podName)
+	if err != nil {
+		return err
+	}
+	listing, err := os.ReadFile(filepath.Join(f.dir, offlineContentsDir, volumeName+".txt"))
+	if err != nil {
+		return fmt.Errorf("no recorded contents for volume %s: %w", volumeName, err)
+	}
+
+	// Recorded paths are relative; the caller expects them under the
+	// mount path it searched
+	mountPath := command[len(command)-1]
+	if command[0] == "find" {
+		mountPath = command[1]
+	}
+	var used int64
+	scanner := bufio.NewScanner(bytes.NewReader(listing))
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), " ", 4)
+		if len(fields) != 4 {
+			continue
+		}
+		if command[0] != "find" {
+			size, _ := strconv.ParseInt(fields[0], 10, 64)
+			used += size
+			continue
+		}
+		fields[3] = path.Join(mountPath, fields[3])
+		if _, err := fmt.Fprintln(streams.Stdout, strings.Join(fields, " ")); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	switch command[0] {
+	case "find":
+		return nil
+	case "fstrim":
+		// Everything not taken by a recorded file counts as trimmed
+		_, err = fmt.Fprintf(streams.Stdout, "%s: %d bytes trimmed\n", mountPath, max(capacity-used, 0))
+		return err
+	}
+
+	// Usage is approximated from the recorded file sizes
+	usedKB := (used + 1023) / 1024
+	totalKB := capacity / 1024
+	_, err = fmt.Fprintf(streams.Stdout, "Filesystem 1024-blocks Used Available Capacity Mounted on\n/dev/longhorn/%s %d %d %d %d%% %s\n",
+		volumeName, totalKB, usedKB, max(totalKB-usedKB, 0), usedKB*100/max(totalKB, 1), mountPath)
+	return err
+}
+
+// podVolume returns the Longhorn volume mounted by a pod and its capacity,
+// following the pod's claims to their CSI persistent volumes.
+func (f *fixtureExecutor) podVolume(ctx context.Context, namespace, podName string) (string, int64, error) {
+	pod, err := f.clientset.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to get pod %s: %w", podName, err)
+	}
+
+	for _, volume := range pod.Spec.Volumes {
+		if volume.PersistentVolumeClaim == nil {
+			continue
+		}
+		pvc, err := f.clientset.CoreV1().PersistentVolumeClaims(namespace).Get(ctx, volume.PersistentVolumeClaim.ClaimName, metav1.GetOptions{})
+		if err != nil || pvc.Spec.VolumeName == "" {
+			continue
+		}
+		pv, err := f.clientset.CoreV1().PersistentVolumes().Get(ctx, pvc.Spec.VolumeName, metav1.GetOptions{})
+		if err != nil || pv.Spec.CSI == nil {
+			continue
+		}
+		capacity := pv.Spec.Capacity[corev1.ResourceStorage]
+		return strings.TrimPrefix(pv.Spec.CSI.VolumeHandle, "lhc-temp-rwx-"), capacity.Value(), nil
+	}
+	return "", 0, fmt.Errorf("pod %s does not mount a Longhorn volume", podName)
+}
@@ -0,0 +1,335 @@
+package longhorntools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/util/retry"
+)
+
+// Custom resources served by the operator. See deploy/crds.yaml.
+var (
+	volumeCopyGVR = schema.GroupVersionResource{
+		Group:    "lhc.io",
+		Version:  "v1alpha1",
+		Resource: "volumecopies",
+	}
+	volumeExportGVR = schema.GroupVersionResource{
+		Group:    "lhc.io",
+		Version:  "v1alpha1",
+		Resource: "volumeexports",
+	}
+)
+
+// Phases reported in the status of operator-managed resources.
+const (
+	phasePending   = "Pending"
+	phaseRunning   = "Running"
+	phaseSucceeded = "Succeeded"
+	phaseFailed    = "Failed"
+)
+
+// Operator reconciles VolumeCopy and VolumeExport resources by running the
+// corresponding VolumeManager operations.
+type Operator struct {
+	vm           *VolumeManager
+	storageClass string
+
+	mu       sync.Mutex
+	inFlight map[string]bool
+}
+
+func NewOperator(vm *VolumeManager, storageClass string) *Operator {
+	return &Operator{
+		vm:           vm,
+		storageClass: storageClass,
+		inFlight:     make(map[string]bool),
+	}
+}
+
+// Run watches both resource types until ctx is cancelled.
+func (o *Operator) Run(ctx context.Context) error {
+	log.Printf("Operator started")
+
+	var wg sync.WaitGroup
+	for _, gvr := range []schema.GroupVersionResource{volumeCopyGVR, volumeExportGVR} {
+		o.failInterrupted(ctx, gvr)
+		wg.Add(1)
+		go func(gvr schema.GroupVersionResource) {
+			defer wg.Done()
+			o.watchLoop(ctx, gvr)
+		}(gvr)
+	}
+	wg.Wait()
+	return nil
+}
+
+// watchLoop keeps a watch open on gvr, re-establishing it whenever the API
+// server closes the stream.
+func (o *Operator) watchLoop(ctx context.Context, gvr schema.GroupVersionResource) {
+	for ctx.Err() == nil {
+		w, err := o.vm.dynamicClient.Resource(gvr).Namespace(metav1.NamespaceAll).Watch(ctx, metav1.ListOptions{})
+		if err != nil {
+			log.Printf("Failed to watch %s: %v (retrying)", gvr.Resource, err)
+			time.Sleep(5 * time.Second)
+			continue
+		}
+
+		for event := range w.ResultChan() {
+			if event.Type != watch.Added && event.Type != watch.Modified {
+				continue
+			}
+			obj, ok := event.Object.(*unstructured.Unstructured)
+			if !ok {
+				continue
+			}
+			o.maybeStart(ctx, gvr, obj)
+		}
+		w.Stop()
+	}
+}
+
+// failInterrupted marks the resources left Running by an earlier operator
+// process as Failed: their operation died with it and is not resumed.
+func (o *Operator) failInterrupted(ctx context.Context, gvr schema.GroupVersionResource) {
+	list, err := o.vm.dynamicClient.Resource(gvr).Namespace(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		log.Printf("Failed to list %s: %v", gvr.Resource, err)
+		return
+	}
+	for i := range list.Items {
+		obj := &list.Items[i]
+		if phase, _, _ := unstructured.NestedString(obj.Object, "status", "phase"); phase != phaseRunning {
+			continue
+		}
+		log.Printf("Marking %s/%s/%s failed: interrupted by an operator restart", gvr.Resource, obj.GetNamespace(), obj.GetName())
+		o.setStatus(ctx, gvr, obj, phaseFailed, "interrupted by an operator restart; recreate the resource to retry", false)
+	}
+}
+
+// maybeStart launches processing for obj if it has not been handled yet.
+func (o *Operator) maybeStart(ctx context.Context, gvr schema.GroupVersionResource, obj *unstructured.Unstructured) {
+	phase, _, _ := unstructured.NestedString(obj.Object, "status", "phase")
+	if phase != "" && phase != phasePending {
+		return
+	}
+
+	key := fmt.Sprintf("%s/%s/%s", gvr.Resource, obj.GetNamespace(), obj.GetName())
+	o.mu.Lock()
+	if o.inFlight[key] {
+		o.mu.Unlock()
+		return
+	}
+	o.inFlight[key] = true
+	o.mu.Unlock()
+
+	go func() {
+		defer func() {
+			o.mu.Lock()
+			delete(o.inFlight, key)
+			o.mu.Unlock()
+		}()
+
+		log.Printf("Processing %s", key)
+		o.setStatus(ctx, gvr, obj, phaseRunning, "", true)
+
+		var err error
+		switch gvr.Resource {
+		case volumeCopyGVR.Resource:
+			err = o.runCopy(ctx, obj)
+		case volumeExportGVR.Resource:
+			err = o.runExport(ctx, obj)
+		}
+
+		if err != nil {
+			log.Printf("%s failed: %v", key, err)
+			o.setStatus(ctx, gvr, obj, phaseFailed, err.Error(), false)
+			return
+		}
+		log.Printf("%s succeeded", key)
+		o.setStatus(ctx, gvr, obj, phaseSucceeded, "completed", false)
+	}()
+}
+
+// setStatus writes phase and message to the resource's status subresource.
+func (o *Operator) setStatus(ctx context.Context, gvr schema.GroupVersionResource, obj *unstructured.Unstructured, phase, message string, starting bool) {
+	client := o.vm.dynamicClient.Resource(gvr).Namespace(obj.GetNamespace())
+
+	// Re-read so the update applies to the latest resourceVersion, and
+	// again if another writer got there first
+	now := time.Now().UTC().Format(time.RFC3339)
+	err := retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+		current, err := client.Get(ctx, obj.GetName(), metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+
+		unstructured.SetNestedField(current.Object, phase, "status", "phase")
+		unstructured.SetNestedField(current.Object, message, "status", "message")
+		if starting {
+			unstructured.SetNestedField(current.Object, now, "status", "startTime")
+		} else {
+			unstructured.SetNestedField(current.Object, now, "status", "completionTime")
+		}
+
+		_, err = client.UpdateStatus(ctx, current, metav1.UpdateOptions{})
+		return err
+	})
+	if err != nil {
+		log.Printf("Failed to update status of %s/%s: %v", obj.GetNamespace(), obj.GetName(), err)
+	}
+}
+
+// specString reads a string field from the resource spec.
+func specString(obj *unstructured.Unstructured, field string) string {
+	value, _, _ := unstructured.NestedString(obj.Object, "spec", field)
+	return value
+}
+
+func (o *Operator) storageClassFor(obj *unstructured.Unstructured) string {
+	if sc := specString(obj, "storageClass"); sc != "" {
+		return sc
+	}
+	return o.storageClass
+}
+
+// specVolume returns the Longhorn volume behind the PVC named by a spec
+// field. Only PVCs in the resource's own namespace are accepted, so that
+// whoever may create the resource there cannot reach other namespaces'
+// volumes.
+func (o *Operator) specVolume(ctx context.Context, obj *unstructured.Unstructured, field string) (string, error) {
+	name := specString(obj, field)
+	if name == "" {
+		return "", fmt.Errorf("spec.%s is required", field)
+	}
+	if strings.ContainsAny(name, "/:") {
+		return "", fmt.Errorf("spec.%s must name a PVC in namespace %s, got %q", field, obj.GetNamespace(), name)
+	}
+	return o.vm.pvcVolume(ctx, obj.GetNamespace(), name)
+}
+
+// runCopy handles a VolumeCopy between two PVCs in its namespace:
+//
+//	spec:
+//	  source: <pvc>
+//	  destination: <pvc>
+//	  inCluster: true   # optional, run the copy as a Job
+func (o *Operator) runCopy(ctx context.Context, obj *unstructured.Unstructured) error {
+	source, err := o.specVolume(ctx, obj, "source")
+	if err != nil {
+		return err
+	}
+	dest, err := o.specVolume(ctx, obj, "destination")
+	if err != nil {
+		return err
+	}
+
+	namespace := obj.GetNamespace()
+	storageClass := o.storageClassFor(obj)
+	inCluster, _, _ := unstructured.NestedBool(obj.Object, "spec", "inCluster")
+
+	if inCluster {
+		return o.vm.CopyVolumeInCluster(ctx, source, dest, namespace, storageClass)
+	}
+	return o.vm.CopyVolume(ctx, source, dest, namespace, storageClass)
+}
+
+// runExport handles a VolumeExport, writing an archive of the volume of a
+// PVC onto another PVC, both in the resource's namespace:
+//
+//	spec:
+//	  volume: <pvc>
+//	  targetPVC: <pvc>
+//	  path: <file name on the target>   # optional
+func (o *Operator) runExport(ctx context.Context, obj *unstructured.Unstructured) error {
+	claim := specString(obj, "volume")
+	volume, err := o.specVolume(ctx, obj, "volume")
+	if err != nil {
+		return err
+	}
+	targetPVC := specString(obj, "targetPVC")
+	if targetPVC == "" {
+		return fmt.Errorf("spec.targetPVC is required")
+	}
+
+	path := specString(obj, "path")
+	if path == "" {
+		path = fmt.Sprintf("%s-%s.tar.gz", claim, time.Now().UTC().Format("20060102-150405"))
+	}
+
+	return o.vm.ExportVolumeToPVC(ctx, volume, obj.GetNamespace(), targetPVC, path, o.storageClassFor(obj))
+}
+
+// ExportVolumeToPVC streams a tar.gz of volumeName into a file on
+// targetPVC, entirely within the cluster, and removes the temporary
+// resources it used.
+func (vm *VolumeManager) ExportVolumeToPVC(ctx context.Context, volumeName, namespace, targetPVC, path, storageClass string) error {
+	return vm.withVolumeLocks(ctx, []string{volumeName}, func() error {
+		err := observeOperation("export", func() error {
+			return vm.exportVolumeToPVC(ctx, volumeName, namespace, targetPVC, path, storageClass)
+		})
+		vm.recordOperationResult(ctx, volumeName, "Exported", "ExportFailed", fmt.Sprintf("export to %s/%s:%s", namespace, targetPVC, path), err)
+		return vm.cleanupLocked(ctx, namespace, err, volumeName)
+	})
+}
+
+func (vm *VolumeManager) exportVolumeToPVC(ctx context.Context, volumeName, namespace, targetPVC, path, storageClass string) error {
+	sourcePod, sourceMountPath, sourceContainer, err := vm.getVolumeInfo(ctx, volumeName, namespace, storageClass)
+	if err != nil {
+		return fmt.Errorf("source volume error: %w", err)
+	}
+
+	targetPod, targetMountPath, targetContainer, err := vm.createTemporaryPodForPVC(ctx, targetPVC, namespace, volumeName)
+	if err != nil {
+		return fmt.Errorf("target PVC error: %w", err)
+	}
+	defer vm.deleteTemporaryPod(ctx, namespace, targetPod)
+
+	vm.printf("Exporting volume %s to %s:%s\n", volumeName, targetPVC, path)
+
+	// The archive is written under a temporary name and only moved into
+	// place once both ends succeeded, so a failed export leaves no
+	// truncated archive behind
+	target := targetMountPath + "/" + path
+	partial := target + ".partial"
+
+	reader, writer := io.Pipe()
+	errChan := make(chan error, 2)
+
+	go func() {
+		err := vm.execInPodWithOutput(ctx, namespace, sourcePod, sourceContainer,
+			[]string{"sh", "-c", shellPipeline(fmt.Sprintf("tar -cf - -C %s .", shellQuote(sourceMountPath)), "gzip -n")}, writer)
+		writer.CloseWithError(err)
+		errChan <- err
+	}()
+
+	go func() {
+		err := vm.execInPodWithInput(ctx, namespace, targetPod, targetContainer,
+			[]string{"sh", "-c", fmt.Sprintf("mkdir -p \"$(dirname %s)\" && cat > %s", shellQuote(target), shellQuote(partial))}, reader)
+		reader.CloseWithError(err)
+		errChan <- err
+	}()
+
+	for i := 0; i < 2; i++ {
+		err = errors.Join(err, <-errChan)
+	}
+	if err == nil {
+		err = vm.execInPod(ctx, namespace, targetPod, targetContainer,
+			[]string{"mv", "-f", partial, target})
+	}
+	if err != nil {
+		vm.execInPod(context.WithoutCancel(ctx), namespace, targetPod, targetContainer, []string{"rm", "-f", partial})
+		return fmt.Errorf("export failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package longhorntools
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestOperatorSpecVolume(t *testing.T) {
+	vm := newFakeVolumeManager(
+		[]*unstructured.Unstructured{newFakeVolume("vol-a", "detached", "", ""), newFakeVolume("vol-b", "detached", "", "")},
+		longhornPV("pv-a", "vol-a"),
+		longhornPV("pv-b", "vol-b"),
+		boundPVC("apps", "data", "pv-a"),
+		boundPVC("other", "secret", "pv-b"),
+	)
+	o := NewOperator(vm, "")
+
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{source: "data", want: "vol-a"},
+		// Only PVCs in the resource's namespace are accepted
+		{source: "secret"},
+		{source: "other/secret"},
+		{source: "pvc:other/secret"},
+		{source: "pv:pv-b"},
+		{source: "vol-b"},
+		{source: ""},
+	}
+	for _, tt := range tests {
+		obj := &unstructured.Unstructured{Object: map[string]interface{}{
+			"metadata": map[string]interface{}{"name": "copy", "namespace": "apps"},
+			"spec":     map[string]interface{}{"source": tt.source},
+		}}
+		got, err := o.specVolume(context.Background(), obj, "source")
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("specVolume(%q) = %q, want an error", tt.source, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("specVolume(%q) = %q, %v; want %q", tt.source, got, err, tt.want)
+		}
+	}
+}
+
+func TestOperatorFailInterrupted(t *testing.T) {
+	copyWithPhase := func(name, phase string) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "lhc.io/v1alpha1",
+			"kind":       "VolumeCopy",
+			"metadata":   map[string]interface{}{"name": name, "namespace": "apps"},
+			"status":     map[string]interface{}{"phase": phase},
+		}}
+	}
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{volumeCopyGVR: "VolumeCopyList"},
+		copyWithPhase("running", phaseRunning), copyWithPhase("done", phaseSucceeded))
+	o := NewOperator(NewVolumeManagerWithClients(fake.NewSimpleClientset(), dynamicClient, nil), "")
+
+	o.failInterrupted(context.Background(), volumeCopyGVR)
+
+	for name, want := range map[string]string{"running": phaseFailed, "done": phaseSucceeded} {
+		obj, err := dynamicClient.Resource(volumeCopyGVR).Namespace("apps").Get(context.Background(), name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("get %s: %v", name, err)
+		}
+		if phase, _, _ := unstructured.NestedString(obj.Object, "status", "phase"); phase != want {
+			t.Errorf("%s: phase %q, want %q", name, phase, want)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package longhorntools
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// longhornOrphanGVR identifies Longhorn's Orphan custom resource, which
+// records replica data left on a disk with no replica to own it.
+var longhornOrphanGVR = schema.GroupVersionResource{
+	Group:    "longhorn.io",
+	Version:  "v1beta2",
+	Resource: "orphans",
+}
+
+// StalePV is a Longhorn PersistentVolume whose volume no longer exists.
+type StalePV struct {
+	Name   string `json:"name"`
+	Volume string `json:"volume"`
+	Phase  string `json:"phase"`
+	// Claim is the namespace/name of the PVC the PV was bound to, if any.
+	Claim string `json:"claim,omitempty"`
+}
+
+// OrphanData is a Longhorn Orphan: replica data on a node's disk that no
+// replica references.
+type OrphanData struct {
+	Name     string `json:"name"`
+	Node     string `json:"node"`
+	Type     string `json:"type"`
+	DataName string `json:"dataName"`
+	DiskPath string `json:"diskPath"`
+}
+
+// OrphanReport lists resources that nothing references any more.
+type OrphanReport struct {
+	// UnboundVolumes are Longhorn volumes without a bound PV and PVC.
+	UnboundVolumes []LonghornVolume `json:"unboundVolumes"`
+	StalePVs       []StalePV        `json:"stalePVs"`
+	OrphanData     []OrphanData     `json:"orphanData"`
+}
+
+// Total returns the number of findings in the report.
+func (r *OrphanReport) Total() int {
+	return len(r.UnboundVolumes) + len(r.StalePVs) + len(r.OrphanData)
+}
+
+// FindOrphans reports Longhorn volumes with no bound PV or PVC, Longhorn
+// PVs whose volume is gone, and Longhorn Orphan resources. Temporary
+// resources created by this tool are not reported; see
+// FindTemporaryResources.
+func (vm *VolumeManager) FindOrphans(ctx context.Context) (*OrphanReport, error) {
+	volumes, err := vm.Volumes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &OrphanReport{}
+	exists := make(map[string]bool, len(volumes))
+	for _, volume := range volumes {
+		exists[volume.Name] = true
+		if volume.PVName == "" || volume.PVCName == "" {
+			report.UnboundVolumes = append(report.UnboundVolumes, volume)
+		}
+	}
+
+	pvs, err := vm.clientset.CoreV1().PersistentVolumes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list PVs: %w", err)
+	}
+	for _, pv := range pvs.Items {
+		if pv.Spec.CSI == nil || pv.Spec.CSI.Driver != "driver.longhorn.io" || strings.HasPrefix(pv.Name, "lhc-temp-") {
+			continue
+		}
+		if exists[pv.Spec.CSI.VolumeHandle] {
+			continue
+		}
+		stale := StalePV{Name: pv.Name, Volume: pv.Spec.CSI.VolumeHandle, Phase: string(pv.Status.Phase)}
+		if ref := pv.Spec.ClaimRef; ref != nil {
+			stale.Claim = ref.Namespace + "/" + ref.Name
+		}
+		report.StalePVs = append(report.StalePVs, stale)
+	}
+
+	orphans, err := vm.dynamicClient.Resource(longhornOrphanGVR).Namespace("longhorn-system").List(ctx, metav1.ListOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		// Longhorn before 1.3 has no Orphan resource
+		return nil, fmt.Errorf("failed to list Longhorn orphans: %w", err)
+	}
+	if err == nil {
+		for _, item := range orphans.Items {
+			orphan := OrphanData{Name: item.GetName()}
+			orphan.Node, _, _ = unstructured.NestedString(item.Object, "spec", "nodeID")
+			orphan.Type, _, _ = unstructured.NestedString(item.Object, "spec", "orphanType")
+			orphan.DataName, _, _ = unstructured.NestedString(item.Object, "spec", "parameters", "DataName")
+			orphan.DiskPath, _, _ = unstructured.NestedString(item.Object, "spec", "parameters", "DiskPath")
+			report.OrphanData = append(report.OrphanData, orphan)
+		}
+		sort.Slice(report.OrphanData, func(i, j int) bool { return report.OrphanData[i].Name < report.OrphanData[j].Name })
+	}
+
+	return report, nil
+}
+
+// DeleteLonghornVolume deletes a Longhorn volume and, with it, its data.
+func (vm *VolumeManager) DeleteLonghornVolume(ctx context.Context, volumeName string) error {
+	if vm.DryRun {
+		vm.dryRunf("delete Longhorn volume %s", volumeName)
+		return nil
+	}
+	err := vm.dynamicClient.Resource(longhornVolumeGVR).Namespace("longhorn-system").Delete(ctx, volumeName, metav1.DeleteOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to delete Longhorn volume %s: %w", volumeName, err)
+	}
+	return nil
+}
+
+// DeletePV deletes a PersistentVolume.
+func (vm *VolumeManager) DeletePV(ctx context.Context, pvName string) error {
+	if vm.DryRun {
+		vm.dryRunf("delete PersistentVolume %s", pvName)
+		return nil
+	}
+	err := vm.clientset.CoreV1().PersistentVolumes().Delete(ctx, pvName, metav1.DeleteOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to delete PV %s: %w", pvName, err)
+	}
+	return nil
+}
+
+// DeleteOrphanData deletes a Longhorn Orphan, which makes Longhorn remove
+// the orphaned data from the node's disk.
+func (vm *VolumeManager) DeleteOrphanData(ctx context.Context, orphanName string) error {
+	if vm.DryRun {
+		vm.dryRunf("delete Longhorn orphan %s", orphanName)
+		return nil
+	}
+	err := vm.dynamicClient.Resource(longhornOrphanGVR).Namespace("longhorn-system").Delete(ctx, orphanName, metav1.DeleteOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to delete Longhorn orphan %s: %w", orphanName, err)
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package longhorntools
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func newFakeOrphan(name, node, dataName string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "longhorn.io/v1beta2",
+		"kind":       "Orphan",
+		"metadata":   map[string]interface{}{"name": name, "namespace": "longhorn-system"},
+		"spec": map[string]interface{}{
+			"nodeID":     node,
+			"orphanType": "replica",
+			"parameters": map[string]interface{}{"DataName": dataName, "DiskPath": "/var/lib/longhorn"},
+		},
+	}}
+}
+
+func TestFindOrphans(t *testing.T) {
+	released := longhornPV("pv-gone", "vol-gone")
+	released.Status.Phase = corev1.VolumeReleased
+	released.Spec.ClaimRef = &corev1.ObjectReference{Namespace: "apps", Name: "old-data"}
+
+	vm := newFakeVolumeManager(
+		[]*unstructured.Unstructured{
+			newFakeVolume("vol-bound", "attached", "apps", "data"),
+			newFakeVolume("vol-unbound", "detached", "", ""),
+			newFakeOrphan("orphan-2", "node-2", "vol-x-r-2"),
+			newFakeOrphan("orphan-1", "node-1", "vol-x-r-1"),
+		},
+		longhornPV("pv-vol-bound", "vol-bound"),
+		released,
+		// Temporary PVs and PVs of other drivers are not findings
+		longhornPV("lhc-temp-pv-vol-gone", "vol-gone"),
+		&corev1.PersistentVolume{ObjectMeta: metav1.ObjectMeta{Name: "pv-nfs"}},
+	)
+
+	report, err := vm.FindOrphans(context.Background())
+	if err != nil {
+		t.Fatalf("FindOrphans: %v", err)
+	}
+	if got := volumeNames(report.UnboundVolumes); !reflect.DeepEqual(got, []string{"vol-unbound"}) {
+		t.Errorf("unbound volumes = %v, want [vol-unbound]", got)
+	}
+	wantPVs := []StalePV{{Name: "pv-gone", Volume: "vol-gone", Phase: "Released", Claim: "apps/old-data"}}
+	if !reflect.DeepEqual(report.StalePVs, wantPVs) {
+		t.Errorf("stale PVs = %+v, want %+v", report.StalePVs, wantPVs)
+	}
+	wantData := []OrphanData{
+		{Name: "orphan-1", Node: "node-1", Type: "replica", DataName: "vol-x-r-1", DiskPath: "/var/lib/longhorn"},
+		{Name: "orphan-2", Node: "node-2", Type: "replica", DataName: "vol-x-r-2", DiskPath: "/var/lib/longhorn"},
+	}
+	if !reflect.DeepEqual(report.OrphanData, wantData) {
+		t.Errorf("orphan data = %+v, want %+v", report.OrphanData, wantData)
+	}
+	if report.Total() != 4 {
+		t.Errorf("Total() = %d, want 4", report.Total())
+	}
+}
+
+func TestDeleteOrphans(t *testing.T) {
+	ctx := context.Background()
+	vm := newFakeVolumeManager(
+		[]*unstructured.Unstructured{newFakeVolume("vol-unbound", "detached", "", ""), newFakeOrphan("orphan-1", "node-1", "r-1")},
+		longhornPV("pv-gone", "vol-gone"),
+	)
+
+	// A dry run deletes nothing
+	vm.DryRun = true
+	if err := vm.DeleteLonghornVolume(ctx, "vol-unbound"); err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.DeletePV(ctx, "pv-gone"); err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.DeleteOrphanData(ctx, "orphan-1"); err != nil {
+		t.Fatal(err)
+	}
+	report, err := vm.FindOrphans(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Total() != 3 {
+		t.Fatalf("dry run deleted findings: %+v", report)
+	}
+
+	vm.DryRun = false
+	if err := vm.DeleteLonghornVolume(ctx, "vol-unbound"); err != nil {
+		t.Errorf("DeleteLonghornVolume: %v", err)
+	}
+	if err := vm.DeletePV(ctx, "pv-gone"); err != nil {
+		t.Errorf("DeletePV: %v", err)
+	}
+	if err := vm.DeleteOrphanData(ctx, "orphan-1"); err != nil {
+		t.Errorf("DeleteOrphanData: %v", err)
+	}
+	if report, err = vm.FindOrphans(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if report.Total() != 0 {
+		t.Errorf("findings left after deleting them: %+v", report)
+	}
+	if err := vm.DeleteOrphanData(ctx, "orphan-1"); err == nil {
+		t.Error("deleting a missing orphan succeeded")
+	}
+}
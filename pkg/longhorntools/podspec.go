@@ -0,0 +1,268 @@
+package longhorntools
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// DefaultTempImage runs the temporary pods and in-cluster copy Jobs. It
+// only needs sh, sleep, tar, gzip, and the usual coreutils.
+const DefaultTempImage = "busybox:latest"
+
+// tempPodImage returns the image for temporary pods (--temp-image).
+func (vm *VolumeManager) tempPodImage() string {
+	if vm.TempImage != "" {
+		return vm.TempImage
+	}
+	return DefaultTempImage
+}
+
+// Security profiles for temporary pods (--security-profile).
+const (
+	// SecurityProfileDefault leaves the pod security context unset, so the
+	// image runs as its default user (root for busybox).
+	SecurityProfileDefault = "default"
+	// SecurityProfileRestricted satisfies the "restricted" Pod Security
+	// Standard: non-root, no privilege escalation, all capabilities
+	// dropped, and the RuntimeDefault seccomp profile.
+	SecurityProfileRestricted = "restricted"
+)
+
+// restrictedUID runs restricted temporary pods as "nobody", which exists in
+// busybox and most base images.
+const restrictedUID int64 = 65534
+
+// ValidateSecurityProfile checks a --security-profile value.
+func ValidateSecurityProfile(profile string) error {
+	switch profile {
+	case SecurityProfileDefault, SecurityProfileRestricted:
+		return nil
+	default:
+		return fmt.Errorf("unsupported security profile %q (expected %s or %s)", profile, SecurityProfileDefault, SecurityProfileRestricted)
+	}
+}
+
+// applySecurityProfile sets the pod and container security contexts for
+// the configured profile. --fs-group applies with either profile so the
+// pod can write to volumes with strict group ownership.
+func (vm *VolumeManager) applySecurityProfile(spec *corev1.PodSpec) {
+	if vm.SecurityProfile == SecurityProfileRestricted {
+		uid := restrictedUID
+		fsGroup := restrictedUID
+		if vm.FSGroup >= 0 {
+			fsGroup = vm.FSGroup
+		}
+		spec.SecurityContext = &corev1.PodSecurityContext{
+			RunAsNonRoot:   boolPtr(true),
+			RunAsUser:      &uid,
+			RunAsGroup:     &uid,
+			FSGroup:        &fsGroup,
+			SeccompProfile: &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault},
+		}
+		for i := range spec.Containers {
+			spec.Containers[i].SecurityContext = &corev1.SecurityContext{
+				AllowPrivilegeEscalation: boolPtr(false),
+				Capabilities:             &corev1.Capabilities{Drop: []corev1.Capability{"ALL"}},
+			}
+		}
+		return
+	}
+
+	if vm.FSGroup >= 0 {
+		fsGroup := vm.FSGroup
+		if spec.SecurityContext == nil {
+			spec.SecurityContext = &corev1.PodSecurityContext{}
+		}
+		spec.SecurityContext.FSGroup = &fsGroup
+	}
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+// Default resources for temporary pods: enough for tar and gzip without
+// being rejected by typical LimitRanges. Set a flag to "" to omit it.
+const (
+	DefaultCPURequest    = "100m"
+	DefaultMemoryRequest = "64Mi"
+	DefaultCPULimit      = "1"
+	DefaultMemoryLimit   = "256Mi"
+)
+
+// ParseResources builds container resources from --cpu-request,
+// --memory-request, --cpu-limit, and --memory-limit. Empty values are left
+// out.
+func ParseResources(cpuRequest, memoryRequest, cpuLimit, memoryLimit string) (corev1.ResourceRequirements, error) {
+	var resources corev1.ResourceRequirements
+	for _, r := range []struct {
+		flag  string
+		value string
+		list  *corev1.ResourceList
+		name  corev1.ResourceName
+	}{
+		{"--cpu-request", cpuRequest, &resources.Requests, corev1.ResourceCPU},
+		{"--memory-request", memoryRequest, &resources.Requests, corev1.ResourceMemory},
+		{"--cpu-limit", cpuLimit, &resources.Limits, corev1.ResourceCPU},
+		{"--memory-limit", memoryLimit, &resources.Limits, corev1.ResourceMemory},
+	} {
+		if r.value == "" {
+			continue
+		}
+		quantity, err := resource.ParseQuantity(r.value)
+		if err != nil {
+			return resources, fmt.Errorf("invalid %s %q: %w", r.flag, r.value, err)
+		}
+		if *r.list == nil {
+			*r.list = corev1.ResourceList{}
+		}
+		(*r.list)[r.name] = quantity
+	}
+
+	// A request above its limit is rejected by the API server
+	for name, request := range resources.Requests {
+		if limit, ok := resources.Limits[name]; ok && request.Cmp(limit) > 0 {
+			return resources, fmt.Errorf("%s request %s is above its limit %s", name, request.String(), limit.String())
+		}
+	}
+	return resources, nil
+}
+
+// ParseNodeSelector turns repeated --node-selector key=value flags into a
+// map.
+func ParseNodeSelector(values []string) (map[string]string, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+	selector := map[string]string{}
+	for _, value := range values {
+		key, val, ok := strings.Cut(value, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid node selector %q (expected key=value)", value)
+		}
+		selector[key] = val
+	}
+	return selector, nil
+}
+
+// ParseToleration parses a --toleration flag: key[=value][:effect], where a
+// missing value means any value and a missing effect means any effect. "*"
+// tolerates every taint.
+func ParseToleration(value string) (corev1.Toleration, error) {
+	if value == "*" {
+		return corev1.Toleration{Operator: corev1.TolerationOpExists}, nil
+	}
+
+	spec, effect, _ := strings.Cut(value, ":")
+	key, val, hasValue := strings.Cut(spec, "=")
+	if key == "" {
+		return corev1.Toleration{}, fmt.Errorf("invalid toleration %q (expected key[=value][:effect])", value)
+	}
+
+	toleration := corev1.Toleration{Key: key, Operator: corev1.TolerationOpExists}
+	if hasValue {
+		toleration.Operator = corev1.TolerationOpEqual
+		toleration.Value = val
+	}
+	switch corev1.TaintEffect(effect) {
+	case "", corev1.TaintEffectNoSchedule, corev1.TaintEffectPreferNoSchedule, corev1.TaintEffectNoExecute:
+		toleration.Effect = corev1.TaintEffect(effect)
+	default:
+		return corev1.Toleration{}, fmt.Errorf("invalid toleration effect %q (expected NoSchedule, PreferNoSchedule, or NoExecute)", effect)
+	}
+	return toleration, nil
+}
+
+// LoadAffinity reads a Pod affinity stanza from a YAML or JSON file.
+func LoadAffinity(path string) (*corev1.Affinity, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read affinity file: %w", err)
+	}
+	affinity := &corev1.Affinity{}
+	if err := yaml.UnmarshalStrict(data, affinity); err != nil {
+		return nil, fmt.Errorf("failed to parse affinity file %s: %w", path, err)
+	}
+	return affinity, nil
+}
+
+// applyTempPodOptions sets the configured resources, image registry and
+// overrides, security context, ServiceAccount, image pull secrets, node
+// selector, tolerations, and affinity on a temporary pod spec. With
+// pinning enabled, the pod is also required to run on the node each of
+// volumeNames is attached to, since Longhorn cannot attach an attached
+// volume elsewhere.
+func (vm *VolumeManager) applyTempPodOptions(ctx context.Context, spec *corev1.PodSpec, volumeNames ...string) {
+	for i := range spec.Containers {
+		spec.Containers[i].Resources = *vm.TempResources.DeepCopy()
+		spec.Containers[i].Image = vm.resolveImage(spec.Containers[i].Image)
+	}
+	vm.applySecurityProfile(spec)
+	if vm.ServiceAccount != "" {
+		spec.ServiceAccountName = vm.ServiceAccount
+	}
+	for _, secret := range vm.ImagePullSecrets {
+		spec.ImagePullSecrets = append(spec.ImagePullSecrets, corev1.LocalObjectReference{Name: secret})
+	}
+
+	if len(vm.NodeSelector) > 0 {
+		spec.NodeSelector = map[string]string{}
+		for key, value := range vm.NodeSelector {
+			spec.NodeSelector[key] = value
+		}
+	}
+	spec.Tolerations = append(spec.Tolerations, vm.Tolerations...)
+	if vm.Affinity != nil {
+		spec.Affinity = vm.Affinity.DeepCopy()
+	}
+
+	if !vm.PinToNode {
+		return
+	}
+	for _, volumeName := range volumeNames {
+		volume, err := vm.Volume(ctx, volumeName)
+		if err != nil || volume.NodeID == "" {
+			continue
+		}
+		vm.printf("Volume %s is attached to node %s; scheduling the temporary pod there\n", volumeName, volume.NodeID)
+		requireNode(spec, volume.NodeID)
+	}
+}
+
+// requireNode adds a required node affinity for nodeName. Longhorn's node
+// ID is the Node object's name, which need not match its hostname label, so
+// the requirement matches the metadata.name field. Node selector terms are
+// ORed, so the requirement is added to every existing term.
+func requireNode(spec *corev1.PodSpec, nodeName string) {
+	requirement := corev1.NodeSelectorRequirement{
+		Key:      metav1.ObjectNameField,
+		Operator: corev1.NodeSelectorOpIn,
+		Values:   []string{nodeName},
+	}
+
+	if spec.Affinity == nil {
+		spec.Affinity = &corev1.Affinity{}
+	}
+	if spec.Affinity.NodeAffinity == nil {
+		spec.Affinity.NodeAffinity = &corev1.NodeAffinity{}
+	}
+	required := spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution
+	if required == nil || len(required.NodeSelectorTerms) == 0 {
+		spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution = &corev1.NodeSelector{
+			NodeSelectorTerms: []corev1.NodeSelectorTerm{{
+				MatchFields: []corev1.NodeSelectorRequirement{requirement},
+			}},
+		}
+		return
+	}
+	for i := range required.NodeSelectorTerms {
+		required.NodeSelectorTerms[i].MatchFields = append(required.NodeSelectorTerms[i].MatchFields, requirement)
+	}
+}
@@ -0,0 +1,222 @@
+package longhorntools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Progress modes of downloads and copies.
+const (
+	// ProgressPlain prints a line of text at every interval, without
+	// redrawing, so it reads well in CI logs.
+	ProgressPlain = "plain"
+	// ProgressJSON prints a ProgressRecord per line at every interval and
+	// whenever the phase changes.
+	ProgressJSON = "json"
+	// ProgressNone prints no progress.
+	ProgressNone = "none"
+)
+
+// DefaultProgressInterval is how often progress is reported.
+const DefaultProgressInterval = 10 * time.Second
+
+// ValidateProgress checks a progress mode.
+func ValidateProgress(mode string) error {
+	switch mode {
+	case "", ProgressPlain, ProgressJSON, ProgressNone:
+		return nil
+	default:
+		return fmt.Errorf("unsupported progress mode %q (expected %s, %s, or %s)", mode, ProgressPlain, ProgressJSON, ProgressNone)
+	}
+}
+
+// ProgressRecord is one progress report of a transfer, as printed in json
+// mode.
+type ProgressRecord struct {
+	Time      time.Time `json:"time"`
+	Operation string    `json:"operation"`
+	Volume    string    `json:"volume"`
+	// Phase is what the transfer is doing: "stream" while data moves,
+	// then "done" or "failed".
+	Phase string `json:"phase"`
+	// Bytes is how much has been streamed out of the source pod.
+	Bytes int64 `json:"bytes"`
+	// Total estimates Bytes at the end from the source filesystem's
+	// usage. It is omitted when the stream is compressed in the pod.
+	Total int64 `json:"total,omitempty"`
+	// Percent is Bytes of Total, kept below 100 until the transfer is
+	// done. It is omitted with Total.
+	Percent        float64 `json:"percent,omitempty"`
+	BytesPerSecond float64 `json:"bytesPerSecond"`
+	ElapsedSeconds float64 `json:"elapsedSeconds"`
+}
+
+// Progress phases.
+const (
+	progressStream = "stream"
+	progressDone   = "done"
+	progressFailed = "failed"
+)
+
+// progressReporter reports the bytes counted in bytes every interval
+// until finished.
+type progressReporter struct {
+	vm        *VolumeManager
+	operation string
+	volume    string
+	total     int64
+	start     time.Time
+	bytes     atomic.Int64
+
+	stop     chan struct{}
+	stopped  sync.WaitGroup
+	finished sync.Once
+}
+
+// startProgress starts reporting a transfer of about total bytes, or of
+// an unknown amount if total is zero. Count the transferred bytes in the
+// reporter's bytes, and call finish when it ends.
+func (vm *VolumeManager) startProgress(operation, volume string, total int64) *progressReporter {
+	p := &progressReporter{
+		vm:        vm,
+		operation: operation,
+		volume:    volume,
+		total:     total,
+		start:     time.Now(),
+		stop:      make(chan struct{}),
+	}
+	if vm.progressMode() == ProgressNone || vm.DryRun {
+		return p
+	}
+	p.report(progressStream)
+	interval := vm.ProgressInterval
+	if interval <= 0 {
+		interval = DefaultProgressInterval
+	}
+	p.stopped.Add(1)
+	go func() {
+		defer p.stopped.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-p.stop:
+				return
+			case <-ticker.C:
+				p.report(progressStream)
+			}
+		}
+	}()
+	return p
+}
+
+// finish stops the periodic reports and reports the outcome of err.
+func (p *progressReporter) finish(err error) {
+	p.finished.Do(func() {
+		close(p.stop)
+		p.stopped.Wait()
+		if p.vm.progressMode() == ProgressNone || p.vm.DryRun {
+			return
+		}
+		if err != nil {
+			p.report(progressFailed)
+		} else {
+			p.report(progressDone)
+		}
+	})
+}
+
+func (p *progressReporter) record(phase string) ProgressRecord {
+	now := time.Now()
+	r := ProgressRecord{
+		Time:           now.UTC(),
+		Operation:      p.operation,
+		Volume:         p.volume,
+		Phase:          phase,
+		Bytes:          p.bytes.Load(),
+		Total:          p.total,
+		ElapsedSeconds: now.Sub(p.start).Round(time.Millisecond).Seconds(),
+	}
+	if r.ElapsedSeconds > 0 {
+		r.BytesPerSecond = math.Round(float64(r.Bytes) / r.ElapsedSeconds)
+	}
+	if r.Total > 0 {
+		r.Percent = math.Round(float64(r.Bytes)*1000/float64(r.Total)) / 10
+		switch {
+		case phase == progressDone:
+			r.Percent = 100
+		case r.Percent > 99:
+			// The total is only an estimate
+			r.Percent = 99
+		}
+	}
+	return r
+}
+
+func (p *progressReporter) report(phase string) {
+	r := p.record(phase)
+	if p.vm.progressMode() == ProgressJSON {
+		line, _ := json.Marshal(r)
+		p.vm.println(string(line))
+		return
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Progress: %s %s", p.operation, p.volume)
+	switch phase {
+	case progressDone:
+		b.WriteString(" done,")
+	case progressFailed:
+		b.WriteString(" failed after")
+	}
+	fmt.Fprintf(&b, " %s", formatBytes(r.Bytes))
+	if r.Total > 0 {
+		fmt.Fprintf(&b, " of ~%s (%.0f%%)", formatBytes(r.Total), r.Percent)
+	}
+	fmt.Fprintf(&b, ", %s/s, %s elapsed", formatBytes(int64(r.BytesPerSecond)), time.Since(p.start).Round(time.Second))
+	p.vm.println(b.String())
+}
+
+func (vm *VolumeManager) progressMode() string {
+	if vm.Progress == "" {
+		return ProgressPlain
+	}
+	return vm.Progress
+}
+
+// estimateTransfer returns the bytes in use on the filesystem mounted at
+// mountPath, which a tar stream of it comes close to, or zero if df
+// fails.
+func (vm *VolumeManager) estimateTransfer(ctx context.Context, namespace, podName, containerName, mountPath string) int64 {
+	if vm.progressMode() == ProgressNone || vm.DryRun {
+		return 0
+	}
+	var out strings.Builder
+	if err := vm.streamExec(ctx, namespace, podName, containerName, []string{"df", "-P", "-k", mountPath}, nil, &out); err != nil {
+		return 0
+	}
+	usage, err := parseDF(out.String())
+	if err != nil {
+		return 0
+	}
+	return usage.Used
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
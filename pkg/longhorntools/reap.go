@@ -0,0 +1,265 @@
+package longhorntools
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// annotationExpiresAt marks when a temporary resource may be reaped.
+	annotationExpiresAt = "lhc.io/expires-at"
+	// annotationVolumes lists, comma-separated, the Longhorn volumes a
+	// temporary resource serves. The reaper leaves it alone while any of
+	// their locks is held.
+	annotationVolumes = "lhc.io/volumes"
+	// DefaultTempTTL applies when --ttl is not set, and to resources
+	// created before expiry annotations existed.
+	DefaultTempTTL = time.Hour
+	// tempPodSleepSeconds keeps temporary pods running until they are
+	// deleted: the largest value every sleep implementation accepts.
+	// Abandoned pods are the reaper's job, so the sleep does not follow
+	// the TTL and cannot end a long transfer.
+	tempPodSleepSeconds = "2147483647"
+)
+
+// tempTTLOrDefault returns the configured lifetime of temporary resources.
+func (vm *VolumeManager) tempTTLOrDefault() time.Duration {
+	if vm.TempTTL > 0 {
+		return vm.TempTTL
+	}
+	return DefaultTempTTL
+}
+
+// tempAnnotations returns the annotations put on every temporary resource
+// created for volumes.
+func (vm *VolumeManager) tempAnnotations(volumes ...string) map[string]string {
+	annotations := map[string]string{annotationExpiresAt: vm.tempExpiry()}
+	if len(volumes) > 0 {
+		annotations[annotationVolumes] = strings.Join(volumes, ",")
+	}
+	return annotations
+}
+
+// tempExpiry returns the expiry of a temporary resource created or
+// renewed now.
+func (vm *VolumeManager) tempExpiry() string {
+	return time.Now().Add(vm.tempTTLOrDefault()).UTC().Format(time.RFC3339)
+}
+
+// tempVolumes returns the volumes a temporary resource was created for.
+func tempVolumes(meta metav1.Object) []string {
+	value := meta.GetAnnotations()[annotationVolumes]
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
+
+// renewTemporary pushes back the expiry of the temporary resources this
+// run created for volumeName, so the reaper does not take them while an
+// operation that outlasts the TTL still uses them. Resources that are gone
+// stop being tracked.
+func (vm *VolumeManager) renewTemporary(ctx context.Context, volumeName string) error {
+	patch := []byte(fmt.Sprintf(`{"metadata":{"annotations":{%q:%q}}}`, annotationExpiresAt, vm.tempExpiry()))
+
+	var firstErr error
+	for _, r := range vm.trackedFor(volumeName) {
+		var err error
+		switch r.kind {
+		case "pod":
+			_, err = vm.clientset.CoreV1().Pods(r.namespace).Patch(ctx, r.name, types.MergePatchType, patch, metav1.PatchOptions{})
+		case "pvc":
+			_, err = vm.clientset.CoreV1().PersistentVolumeClaims(r.namespace).Patch(ctx, r.name, types.MergePatchType, patch, metav1.PatchOptions{})
+		case "pv":
+			_, err = vm.clientset.CoreV1().PersistentVolumes().Patch(ctx, r.name, types.MergePatchType, patch, metav1.PatchOptions{})
+		case "job":
+			_, err = vm.clientset.BatchV1().Jobs(r.namespace).Patch(ctx, r.name, types.MergePatchType, patch, metav1.PatchOptions{})
+		}
+		if apierrors.IsNotFound(err) {
+			vm.untrack(r)
+			continue
+		}
+		if err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("failed to renew %s %s: %w", r.kind, r.name, err)
+		}
+	}
+	return firstErr
+}
+
+// heldVolumeLocks returns the volumes whose lock Lease is currently held.
+func (vm *VolumeManager) heldVolumeLocks(ctx context.Context) (map[string]bool, error) {
+	leases, err := vm.clientset.CoordinationV1().Leases(lockNamespace).List(ctx, metav1.ListOptions{LabelSelector: "app=lhc-lock"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list volume locks: %w", err)
+	}
+	held := make(map[string]bool, len(leases.Items))
+	for i := range leases.Items {
+		if !leaseExpired(&leases.Items[i]) {
+			held[strings.TrimPrefix(leases.Items[i].Name, lockLeaseName(""))] = true
+		}
+	}
+	return held, nil
+}
+
+// inUse reports whether an operation holding the lock of one of the
+// resource's volumes may still be using it.
+func inUse(meta metav1.Object, held map[string]bool) bool {
+	for _, volume := range tempVolumes(meta) {
+		if held[volume] {
+			return true
+		}
+	}
+	return false
+}
+
+// expired reports whether a temporary object is past its expiry time.
+// Objects without the annotation fall back to creation time plus the
+// default TTL.
+func expired(meta metav1.Object, now time.Time) bool {
+	if value, ok := meta.GetAnnotations()[annotationExpiresAt]; ok {
+		if expiresAt, err := time.Parse(time.RFC3339, value); err == nil {
+			return now.After(expiresAt)
+		}
+	}
+	return now.After(meta.GetCreationTimestamp().Add(DefaultTempTTL))
+}
+
+// ReapExpiredResources deletes temporary pods, Jobs, PVCs, and PVs whose
+// TTL has passed, plus temporary pods that have already exited. Resources
+// of a volume whose lock is held are left alone. An empty namespace covers
+// all namespaces.
+func (vm *VolumeManager) ReapExpiredResources(ctx context.Context, namespace string) error {
+	now := time.Now()
+	selector := metav1.ListOptions{LabelSelector: "app=lhc-temp"}
+	reaped := 0
+
+	held, err := vm.heldVolumeLocks(ctx)
+	if err != nil {
+		return err
+	}
+
+	pods, err := vm.clientset.CoreV1().Pods(namespace).List(ctx, selector)
+	if err != nil {
+		return fmt.Errorf("failed to list temporary pods: %w", err)
+	}
+	for _, pod := range pods.Items {
+		// Job pods are left to their Job, which tracks them
+		if metav1.GetControllerOf(&pod) != nil || inUse(&pod, held) {
+			continue
+		}
+		finished := pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed
+		if !finished && !expired(&pod, now) {
+			continue
+		}
+		if vm.DryRun {
+			vm.dryRunf("delete pod %s/%s", pod.Namespace, pod.Name)
+			continue
+		}
+		vm.printf("Reaping pod %s/%s (%s)\n", pod.Namespace, pod.Name, pod.Status.Phase)
+		if err := vm.clientset.CoreV1().Pods(pod.Namespace).Delete(ctx, pod.Name, metav1.DeleteOptions{}); err != nil {
+			vm.printf("Warning: failed to delete pod %s/%s: %v\n", pod.Namespace, pod.Name, err)
+			continue
+		}
+		reaped++
+	}
+
+	// In-cluster copy Jobs; deleting one also deletes its pods
+	jobs, err := vm.clientset.BatchV1().Jobs(namespace).List(ctx, selector)
+	if err != nil {
+		return fmt.Errorf("failed to list temporary jobs: %w", err)
+	}
+	propagation := metav1.DeletePropagationBackground
+	for _, job := range jobs.Items {
+		if !expired(&job, now) || inUse(&job, held) {
+			continue
+		}
+		if vm.DryRun {
+			vm.dryRunf("delete job %s/%s", job.Namespace, job.Name)
+			continue
+		}
+		vm.printf("Reaping job %s/%s\n", job.Namespace, job.Name)
+		err := vm.clientset.BatchV1().Jobs(job.Namespace).Delete(ctx, job.Name, metav1.DeleteOptions{PropagationPolicy: &propagation})
+		if err != nil {
+			vm.printf("Warning: failed to delete job %s/%s: %v\n", job.Namespace, job.Name, err)
+			continue
+		}
+		reaped++
+	}
+
+	// Kubernetes keeps a PVC that is still mounted until its pod is gone,
+	// so deleting expired claims is safe even if a pod outlived its TTL
+	pvcs, err := vm.clientset.CoreV1().PersistentVolumeClaims(namespace).List(ctx, selector)
+	if err != nil {
+		return fmt.Errorf("failed to list temporary PVCs: %w", err)
+	}
+	for _, pvc := range pvcs.Items {
+		if !expired(&pvc, now) || inUse(&pvc, held) {
+			continue
+		}
+		if vm.DryRun {
+			vm.dryRunf("delete PersistentVolumeClaim %s/%s", pvc.Namespace, pvc.Name)
+			continue
+		}
+		vm.printf("Reaping PVC %s/%s\n", pvc.Namespace, pvc.Name)
+		if err := vm.clientset.CoreV1().PersistentVolumeClaims(pvc.Namespace).Delete(ctx, pvc.Name, metav1.DeleteOptions{}); err != nil {
+			vm.printf("Warning: failed to delete PVC %s/%s: %v\n", pvc.Namespace, pvc.Name, err)
+			continue
+		}
+		reaped++
+	}
+
+	// PVs are cluster-scoped; only reap those whose claim is gone or lives
+	// in the namespace being reaped
+	pvs, err := vm.clientset.CoreV1().PersistentVolumes().List(ctx, selector)
+	if err != nil {
+		return fmt.Errorf("failed to list temporary PVs: %w", err)
+	}
+	for _, pv := range pvs.Items {
+		if !expired(&pv, now) || inUse(&pv, held) {
+			continue
+		}
+		if namespace != "" && pv.Spec.ClaimRef != nil && pv.Spec.ClaimRef.Namespace != namespace && pv.Status.Phase == corev1.VolumeBound {
+			continue
+		}
+		if vm.DryRun {
+			vm.dryRunf("delete PersistentVolume %s", pv.Name)
+			continue
+		}
+		vm.printf("Reaping PV %s\n", pv.Name)
+		if err := vm.clientset.CoreV1().PersistentVolumes().Delete(ctx, pv.Name, metav1.DeleteOptions{}); err != nil {
+			vm.printf("Warning: failed to delete PV %s: %v\n", pv.Name, err)
+			continue
+		}
+		reaped++
+	}
+
+	if !vm.DryRun {
+		vm.printf("Reaped %d expired temporary resources\n", reaped)
+	}
+	return nil
+}
+
+// ReapLoop runs ReapExpiredResources every interval until the run's
+// context is cancelled.
+func (vm *VolumeManager) ReapLoop(ctx context.Context, namespace string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := vm.ReapExpiredResources(ctx, namespace); err != nil {
+			log.Printf("Reaper: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package longhorntools
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// tempObjectMeta returns the metadata of a temporary resource of volume
+// that expired at expiresAt.
+func tempObjectMeta(name, volume string, expiresAt time.Time) metav1.ObjectMeta {
+	return metav1.ObjectMeta{
+		Name:      name,
+		Namespace: "default",
+		Labels:    map[string]string{"app": "lhc-temp"},
+		Annotations: map[string]string{
+			annotationExpiresAt: expiresAt.UTC().Format(time.RFC3339),
+			annotationVolumes:   volume,
+		},
+	}
+}
+
+func heldLease(volume string) *coordinationv1.Lease {
+	holder := "someone/1"
+	duration := int32(lockLeaseDuration.Seconds())
+	now := metav1.NewMicroTime(time.Now())
+	return &coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{Name: lockLeaseName(volume), Namespace: lockNamespace, Labels: map[string]string{"app": "lhc-lock"}},
+		Spec:       coordinationv1.LeaseSpec{HolderIdentity: &holder, LeaseDurationSeconds: &duration, RenewTime: &now},
+	}
+}
+
+func TestReapExpiredResources(t *testing.T) {
+	past := time.Now().Add(-time.Minute)
+	future := time.Now().Add(time.Hour)
+	controller := true
+	jobPod := &corev1.Pod{ObjectMeta: tempObjectMeta("job-pod", "", past)}
+	jobPod.OwnerReferences = []metav1.OwnerReference{{APIVersion: "batch/v1", Kind: "Job", Name: "copy", UID: "1", Controller: &controller}}
+
+	clientset := fake.NewSimpleClientset(
+		heldLease("vol-busy"),
+		&corev1.Pod{ObjectMeta: tempObjectMeta("expired", "vol-idle", past)},
+		&corev1.Pod{ObjectMeta: tempObjectMeta("fresh", "vol-idle", future)},
+		&corev1.Pod{ObjectMeta: tempObjectMeta("busy", "vol-busy", past)},
+		jobPod,
+		&corev1.PersistentVolumeClaim{ObjectMeta: tempObjectMeta("busy-pvc", "vol-busy", past)},
+		&corev1.PersistentVolumeClaim{ObjectMeta: tempObjectMeta("expired-pvc", "vol-idle", past)},
+		&batchv1.Job{ObjectMeta: tempObjectMeta("busy-job", "vol-idle,vol-busy", past)},
+	)
+	vm := NewVolumeManagerWithClients(clientset, nil, nil)
+
+	if err := vm.ReapExpiredResources(context.Background(), "default"); err != nil {
+		t.Fatalf("ReapExpiredResources: %v", err)
+	}
+
+	pods, _ := clientset.CoreV1().Pods("default").List(context.Background(), metav1.ListOptions{})
+	var podNames []string
+	for _, pod := range pods.Items {
+		podNames = append(podNames, pod.Name)
+	}
+	if want := []string{"busy", "fresh", "job-pod"}; !reflect.DeepEqual(podNames, want) {
+		t.Errorf("pods left %v, want %v", podNames, want)
+	}
+	if _, err := clientset.CoreV1().PersistentVolumeClaims("default").Get(context.Background(), "busy-pvc", metav1.GetOptions{}); err != nil {
+		t.Errorf("PVC of a locked volume was reaped: %v", err)
+	}
+	if _, err := clientset.CoreV1().PersistentVolumeClaims("default").Get(context.Background(), "expired-pvc", metav1.GetOptions{}); err == nil {
+		t.Errorf("expired PVC was not reaped")
+	}
+	if _, err := clientset.BatchV1().Jobs("default").Get(context.Background(), "busy-job", metav1.GetOptions{}); err != nil {
+		t.Errorf("Job of a locked volume was reaped: %v", err)
+	}
+}
+
+func TestRenewTemporary(t *testing.T) {
+	past := time.Now().Add(-time.Minute)
+	pod := &corev1.Pod{ObjectMeta: tempObjectMeta("pod", "vol-a", past)}
+	other := &corev1.Pod{ObjectMeta: tempObjectMeta("other", "vol-b", past)}
+	clientset := fake.NewSimpleClientset(pod, other)
+	vm := NewVolumeManagerWithClients(clientset, nil, nil)
+	vm.trackTemporary("pod", "default", pod)
+	vm.trackTemporary("pod", "default", other)
+	vm.trackTemporary("pvc", "default", &corev1.PersistentVolumeClaim{ObjectMeta: tempObjectMeta("gone", "vol-a", past)})
+
+	if err := vm.renewTemporary(context.Background(), "vol-a"); err != nil {
+		t.Fatalf("renewTemporary: %v", err)
+	}
+
+	now := time.Now()
+	for name, wantExpired := range map[string]bool{"pod": false, "other": true} {
+		got, err := clientset.CoreV1().Pods("default").Get(context.Background(), name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("get %s: %v", name, err)
+		}
+		if expired(got, now) != wantExpired {
+			t.Errorf("%s: expired = %v, want %v", name, !wantExpired, wantExpired)
+		}
+	}
+	if got := vm.trackedFor("vol-a"); len(got) != 1 || got[0].name != "pod" {
+		t.Errorf("tracked for vol-a = %+v, want only the pod", got)
+	}
+}
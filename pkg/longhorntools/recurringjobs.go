@@ -0,0 +1,283 @@
+package longhorntools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// longhornRecurringJobGVR identifies Longhorn's RecurringJob custom
+// resource.
+var longhornRecurringJobGVR = schema.GroupVersionResource{
+	Group:    "longhorn.io",
+	Version:  "v1beta2",
+	Resource: "recurringjobs",
+}
+
+// Volumes opt into recurring jobs and groups with labels of the form
+// recurring-job.longhorn.io/<job>=enabled and
+// recurring-job-group.longhorn.io/<group>=enabled. A volume without any
+// such label belongs to the default group.
+const (
+	recurringJobLabelPrefix      = "recurring-job.longhorn.io/"
+	recurringJobGroupLabelPrefix = "recurring-job-group.longhorn.io/"
+	recurringJobLabelEnabled     = "enabled"
+	DefaultRecurringJobGroup     = "default"
+)
+
+// RecurringJobTasks lists the tasks a recurring job can run.
+var RecurringJobTasks = []string{
+	"snapshot",
+	"snapshot-force-create",
+	"snapshot-cleanup",
+	"snapshot-delete",
+	"backup",
+	"backup-force-create",
+	"filesystem-trim",
+}
+
+// RecurringJob is a Longhorn snapshot or backup schedule.
+type RecurringJob struct {
+	Name string `json:"name"`
+	Task string `json:"task"`
+	Cron string `json:"cron"`
+	// Retain is how many snapshots or backups the job keeps.
+	Retain int64 `json:"retain"`
+	// Concurrency is how many volumes the job processes at once.
+	Concurrency int64             `json:"concurrency"`
+	Groups      []string          `json:"groups,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	// Volumes are the volumes the job applies to, directly or through a
+	// group. It is filled in by RecurringJobs.
+	Volumes []string `json:"volumes,omitempty"`
+}
+
+// RecurringJobs lists Longhorn's recurring jobs with the volumes each
+// applies to.
+func (vm *VolumeManager) RecurringJobs(ctx context.Context) ([]RecurringJob, error) {
+	list, err := vm.dynamicClient.Resource(longhornRecurringJobGVR).Namespace("longhorn-system").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list Longhorn recurring jobs: %w", err)
+	}
+	bindings, err := vm.recurringJobBindings(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := make([]RecurringJob, 0, len(list.Items))
+	for _, item := range list.Items {
+		job := RecurringJob{Name: item.GetName()}
+		job.Task, _, _ = unstructured.NestedString(item.Object, "spec", "task")
+		job.Cron, _, _ = unstructured.NestedString(item.Object, "spec", "cron")
+		job.Retain, _, _ = unstructured.NestedInt64(item.Object, "spec", "retain")
+		job.Concurrency, _, _ = unstructured.NestedInt64(item.Object, "spec", "concurrency")
+		job.Groups, _, _ = unstructured.NestedStringSlice(item.Object, "spec", "groups")
+		job.Labels, _, _ = unstructured.NestedStringMap(item.Object, "spec", "labels")
+
+		for volume, b := range bindings {
+			if b.applies(job) {
+				job.Volumes = append(job.Volumes, volume)
+			}
+		}
+		sort.Strings(job.Volumes)
+		jobs = append(jobs, job)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Name < jobs[j].Name })
+	return jobs, nil
+}
+
+// recurringJobBinding is the set of jobs and groups a volume has opted into.
+type recurringJobBinding struct {
+	jobs   map[string]bool
+	groups map[string]bool
+}
+
+func (b recurringJobBinding) applies(job RecurringJob) bool {
+	if b.jobs[job.Name] {
+		return true
+	}
+	for _, group := range job.Groups {
+		if b.groups[group] {
+			return true
+		}
+	}
+	return false
+}
+
+// recurringJobBindings reads the recurring job labels of every volume.
+func (vm *VolumeManager) recurringJobBindings(ctx context.Context) (map[string]recurringJobBinding, error) {
+	list, err := vm.dynamicClient.Resource(longhornVolumeGVR).Namespace("longhorn-system").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list Longhorn volumes: %w", err)
+	}
+
+	bindings := make(map[string]recurringJobBinding, len(list.Items))
+	for _, item := range list.Items {
+		b := recurringJobBinding{jobs: map[string]bool{}, groups: map[string]bool{}}
+		for key, value := range item.GetLabels() {
+			if value != recurringJobLabelEnabled {
+				continue
+			}
+			if name, ok := strings.CutPrefix(key, recurringJobLabelPrefix); ok {
+				b.jobs[name] = true
+			} else if name, ok := strings.CutPrefix(key, recurringJobGroupLabelPrefix); ok {
+				b.groups[name] = true
+			}
+		}
+		if len(b.jobs) == 0 && len(b.groups) == 0 {
+			b.groups[DefaultRecurringJobGroup] = true
+		}
+		bindings[item.GetName()] = b
+	}
+	return bindings, nil
+}
+
+// VolumeRecurringJobs returns the jobs and groups volumeName has opted into
+// by label. A volume without any belongs to the default group, which is
+// reported as such.
+func (vm *VolumeManager) VolumeRecurringJobs(ctx context.Context, volumeName string) (jobs, groups []string, err error) {
+	bindings, err := vm.recurringJobBindings(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	b, ok := bindings[volumeName]
+	if !ok {
+		return nil, nil, fmt.Errorf("Longhorn volume %s not found", volumeName)
+	}
+	for name := range b.jobs {
+		jobs = append(jobs, name)
+	}
+	for name := range b.groups {
+		groups = append(groups, name)
+	}
+	sort.Strings(jobs)
+	sort.Strings(groups)
+	return jobs, groups, nil
+}
+
+// CreateRecurringJob creates a Longhorn recurring job. Concurrency defaults
+// to 1.
+func (vm *VolumeManager) CreateRecurringJob(ctx context.Context, job RecurringJob) error {
+	if err := validateRecurringJob(&job); err != nil {
+		return err
+	}
+
+	spec := map[string]interface{}{
+		"name":        job.Name,
+		"task":        job.Task,
+		"cron":        job.Cron,
+		"retain":      job.Retain,
+		"concurrency": job.Concurrency,
+	}
+	if len(job.Groups) > 0 {
+		groups := make([]interface{}, len(job.Groups))
+		for i, group := range job.Groups {
+			groups[i] = group
+		}
+		spec["groups"] = groups
+	}
+	if len(job.Labels) > 0 {
+		labels := make(map[string]interface{}, len(job.Labels))
+		for key, value := range job.Labels {
+			labels[key] = value
+		}
+		spec["labels"] = labels
+	}
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": longhornRecurringJobGVR.GroupVersion().String(),
+		"kind":       "RecurringJob",
+		"metadata": map[string]interface{}{
+			"name":      job.Name,
+			"namespace": "longhorn-system",
+		},
+		"spec": spec,
+	}}
+
+	if vm.DryRun {
+		vm.dryRunf("create recurring job %s (%s at %q, retain %d)", job.Name, job.Task, job.Cron, job.Retain)
+		return nil
+	}
+	_, err := vm.dynamicClient.Resource(longhornRecurringJobGVR).Namespace("longhorn-system").Create(ctx, obj, metav1.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to create recurring job %s: %w", job.Name, err)
+	}
+	return nil
+}
+
+// validateRecurringJob checks a job before it is created and fills in the
+// default concurrency.
+func validateRecurringJob(job *RecurringJob) error {
+	if job.Name == "" {
+		return fmt.Errorf("recurring job name is required")
+	}
+	known := false
+	for _, task := range RecurringJobTasks {
+		known = known || task == job.Task
+	}
+	if !known {
+		return fmt.Errorf("unsupported task %q (expected one of %s)", job.Task, strings.Join(RecurringJobTasks, ", "))
+	}
+	// Longhorn accepts standard five-field cron expressions and
+	// descriptors such as @daily
+	if fields := strings.Fields(job.Cron); len(fields) != 5 && !(len(fields) == 1 && strings.HasPrefix(job.Cron, "@")) {
+		return fmt.Errorf("invalid cron expression %q", job.Cron)
+	}
+	if job.Retain < 0 {
+		return fmt.Errorf("retain must not be negative")
+	}
+	if job.Concurrency == 0 {
+		job.Concurrency = 1
+	}
+	if job.Concurrency < 0 {
+		return fmt.Errorf("concurrency must be positive")
+	}
+	return nil
+}
+
+// AssignRecurringJob adds volumeName to the recurring job or the group
+// named name, or with remove takes it out again, by setting or removing the
+// volume's label. Removing the last label puts a volume back into the
+// default group.
+func (vm *VolumeManager) AssignRecurringJob(ctx context.Context, volumeName, name string, group, remove bool) error {
+	key := recurringJobLabelPrefix + name
+	kind := "recurring job"
+	if group {
+		key = recurringJobGroupLabelPrefix + name
+		kind = "recurring job group"
+	} else if !remove {
+		_, err := vm.dynamicClient.Resource(longhornRecurringJobGVR).Namespace("longhorn-system").Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("recurring job %s not found: %w", name, err)
+		}
+	}
+
+	// A null value deletes the label in a merge patch
+	var value interface{}
+	action := "remove volume %s from %s %s"
+	if !remove {
+		value = recurringJobLabelEnabled
+		action = "add volume %s to %s %s"
+	}
+	if vm.DryRun {
+		vm.dryRunf(action, volumeName, kind, name)
+		return nil
+	}
+
+	patch, _ := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"labels": map[string]interface{}{key: value},
+		},
+	})
+	_, err := vm.dynamicClient.Resource(longhornVolumeGVR).Namespace("longhorn-system").Patch(ctx, volumeName, types.MergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to label volume %s: %w", volumeName, err)
+	}
+	return nil
+}
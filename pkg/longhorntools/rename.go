@@ -0,0 +1,327 @@
+package longhorntools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// renameSpecFields are the settings of a Longhorn volume a renamed copy
+// inherits. Everything else in the spec is runtime state.
+var renameSpecFields = []string{
+	"size",
+	"numberOfReplicas",
+	"frontend",
+	"accessMode",
+	"dataLocality",
+	"dataEngine",
+	"encrypted",
+	"migratable",
+	"staleReplicaTimeout",
+	"diskSelector",
+	"nodeSelector",
+	"replicaAutoBalance",
+	"snapshotDataIntegrity",
+	"backupCompressionMethod",
+}
+
+// digestScript prints the number of files under a mount path and a SHA-256
+// over the checksums of all of them, sorted by path.
+const digestScript = `cd %s && n=$(find . -path ./lost+found -prune -o -type f -print | wc -l) &&
+s=$(find . -path ./lost+found -prune -o -type f -exec sha256sum {} + | sort -k 2 | sha256sum) && echo "$n ${s%%%% *}"`
+
+// RenameOptions controls RenameVolume.
+type RenameOptions struct {
+	// DeleteOld deletes the old volume and its PersistentVolume once the
+	// copy is verified and the claim moved.
+	DeleteOld bool
+	// Namespace and StorageClass are used for the temporary pods that
+	// mount volumes without a PVC.
+	Namespace    string
+	StorageClass string
+}
+
+// RenameResult describes a finished rename.
+type RenameResult struct {
+	OldVolume string `json:"oldVolume"`
+	NewVolume string `json:"newVolume"`
+	// PV is the PersistentVolume created for the new volume, if the old
+	// one had a PV.
+	PV string `json:"pv,omitempty"`
+	// PVC is the claim moved to the new volume, as namespace/name.
+	PVC string `json:"pvc,omitempty"`
+	// Files is the number of files copied and verified.
+	Files      int  `json:"files"`
+	OldDeleted bool `json:"oldDeleted"`
+}
+
+// RenameVolume gives a volume a new name. Longhorn cannot rename volumes,
+// so a volume named newName is created with the settings and labels of
+// oldName, the data is copied and verified by checksum, and the old
+// volume's PV and PVC are recreated on the new one. The old volume is kept,
+// retained, unless opts.DeleteOld is set. No pod may use the volume.
+func (vm *VolumeManager) RenameVolume(ctx context.Context, oldName, newName string, opts RenameOptions) (*RenameResult, error) {
+	if errs := validation.IsDNS1123Label(newName); len(errs) > 0 {
+		return nil, fmt.Errorf("invalid volume name %q: %s", newName, strings.Join(errs, "; "))
+	}
+	if oldName == newName {
+		return nil, fmt.Errorf("volume %s already has that name", oldName)
+	}
+	var result *RenameResult
+	err := vm.withVolumeLocks(ctx, []string{oldName, newName}, func() error {
+		return observeOperation("rename", func() error {
+			var err error
+			result, err = vm.renameVolume(ctx, oldName, newName, opts)
+			if err != nil {
+				vm.recordOperationResult(ctx, oldName, "Renamed", "RenameFailed", fmt.Sprintf("rename to %s", newName), err)
+			} else {
+				// The old volume may be gone by now
+				vm.recordOperationResult(ctx, newName, "Renamed", "RenameFailed", fmt.Sprintf("rename from %s", oldName), nil)
+			}
+			return err
+		})
+	})
+	return result, err
+}
+
+func (vm *VolumeManager) renameVolume(ctx context.Context, oldName, newName string, opts RenameOptions) (*RenameResult, error) {
+	volumes := vm.dynamicClient.Resource(longhornVolumeGVR).Namespace("longhorn-system")
+	old, err := volumes.Get(ctx, oldName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("Longhorn volume %s not found: %w", oldName, err)
+	}
+	if _, err := volumes.Get(ctx, newName, metav1.GetOptions{}); err == nil {
+		return nil, fmt.Errorf("Longhorn volume %s already exists", newName)
+	} else if !apierrors.IsNotFound(err) {
+		return nil, fmt.Errorf("failed to check for Longhorn volume %s: %w", newName, err)
+	}
+	volume, err := vm.Volume(ctx, oldName)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &RenameResult{OldVolume: oldName, NewVolume: newName}
+	namespace := opts.Namespace
+	var oldPV *corev1.PersistentVolume
+	var claim *corev1.PersistentVolumeClaim
+	if volume.PVName != "" {
+		oldPV, err = vm.clientset.CoreV1().PersistentVolumes().Get(ctx, volume.PVName, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get PV %s: %w", volume.PVName, err)
+		}
+		if _, err := vm.clientset.CoreV1().PersistentVolumes().Get(ctx, newName, metav1.GetOptions{}); err == nil {
+			return nil, fmt.Errorf("PV %s already exists", newName)
+		}
+		result.PV = newName
+	}
+	if volume.PVCName != "" {
+		namespace = volume.PVCNamespace
+		claim, err = vm.clientset.CoreV1().PersistentVolumeClaims(namespace).Get(ctx, volume.PVCName, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get PVC %s/%s: %w", namespace, volume.PVCName, err)
+		}
+		pods, err := vm.podsUsingClaim(ctx, namespace, claim.Name)
+		if err != nil {
+			return nil, err
+		}
+		for _, pod := range pods {
+			if pod.Status.Phase != corev1.PodSucceeded && pod.Status.Phase != corev1.PodFailed {
+				return nil, categorize(ErrVolumeInUse, fmt.Errorf("pod %s/%s uses PVC %s; scale its workload down before renaming", namespace, pod.Name, claim.Name))
+			}
+		}
+		result.PVC = namespace + "/" + claim.Name
+	}
+
+	if err := vm.createRenamedVolume(ctx, old, newName); err != nil {
+		return nil, err
+	}
+	succeeded := false
+	defer func() {
+		if succeeded || vm.DryRun {
+			return
+		}
+		vm.printf("Deleting volume %s after the failed rename\n", newName)
+		if err := volumes.Delete(ctx, newName, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			vm.printf("Warning: failed to delete volume %s: %v\n", newName, err)
+		}
+	}()
+	if !vm.DryRun {
+		if err := vm.waitForVolumeReady(ctx, newName); err != nil {
+			return nil, err
+		}
+	}
+
+	if result.Files, err = vm.copyAndVerify(ctx, oldName, newName, namespace, opts.StorageClass); err != nil {
+		return nil, err
+	}
+
+	// The new volume holds a verified copy from here on, so it is kept even
+	// if moving the claim fails
+	succeeded = true
+	if oldPV != nil {
+		if err := vm.moveVolumeBinding(ctx, oldPV, claim, newName); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.DeleteOld {
+		if oldPV != nil {
+			vm.printf("Deleting old PV %s...\n", oldPV.Name)
+			if err := vm.DeletePV(ctx, oldPV.Name); err != nil {
+				return result, err
+			}
+		}
+		vm.printf("Deleting old volume %s...\n", oldName)
+		if err := vm.DeleteLonghornVolume(ctx, oldName); err != nil {
+			return result, err
+		}
+		result.OldDeleted = true
+	}
+	return result, nil
+}
+
+// createRenamedVolume creates newName with the settings and labels of old.
+func (vm *VolumeManager) createRenamedVolume(ctx context.Context, old *unstructured.Unstructured, newName string) error {
+	spec := map[string]interface{}{}
+	for _, field := range renameSpecFields {
+		if value, found, _ := unstructured.NestedFieldCopy(old.Object, "spec", field); found {
+			spec[field] = value
+		}
+	}
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": longhornVolumeGVR.GroupVersion().String(),
+		"kind":       "Volume",
+		"metadata": map[string]interface{}{
+			"name":      newName,
+			"namespace": "longhorn-system",
+		},
+		"spec": spec,
+	}}
+	// Labels carry recurring job assignments and the like
+	obj.SetLabels(old.GetLabels())
+
+	if vm.DryRun {
+		vm.dryRunf("create Longhorn volume %s with the settings of %s", newName, old.GetName())
+		return nil
+	}
+	vm.printf("Creating Longhorn volume %s with the settings of %s...\n", newName, old.GetName())
+	if _, err := vm.dynamicClient.Resource(longhornVolumeGVR).Namespace("longhorn-system").Create(ctx, obj, metav1.CreateOptions{}); err != nil {
+		return fmt.Errorf("failed to create Longhorn volume %s: %w", newName, err)
+	}
+	return nil
+}
+
+// copyAndVerify copies sourceVolume into the empty destVolume and compares
+// checksums of all files on both sides. It returns the number of files.
+func (vm *VolumeManager) copyAndVerify(ctx context.Context, sourceVolume, destVolume, namespace, storageClass string) (int, error) {
+	sourcePod, sourceMountPath, sourceContainer, err := vm.getVolumeInfo(ctx, sourceVolume, namespace, storageClass)
+	if err != nil {
+		return 0, fmt.Errorf("source volume error: %w", err)
+	}
+	defer vm.CleanupVolumeResources(ctx, sourceVolume, namespace)
+	if vm.DryRun {
+		// The destination volume does not exist to be mounted
+		vm.dryRunf("copy volume %s into %s and compare checksums of all files", sourceVolume, destVolume)
+		return 0, nil
+	}
+	destPod, destMountPath, destContainer, err := vm.getVolumeInfo(ctx, destVolume, namespace, storageClass)
+	if err != nil {
+		return 0, fmt.Errorf("destination volume error: %w", err)
+	}
+	defer vm.CleanupVolumeResources(ctx, destVolume, namespace)
+
+	vm.printf("Copying volume %s to %s...\n", sourceVolume, destVolume)
+	err = vm.streamCopyWithProgress(ctx, "rename", sourceVolume, namespace, sourcePod, sourceContainer, sourceMountPath,
+		destPod, destContainer, destMountPath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to copy data: %w", err)
+	}
+
+	vm.printf("Verifying the copy...\n")
+	sourceFiles, sourceSum, err := vm.mountDigest(ctx, namespace, sourcePod, sourceContainer, sourceMountPath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to checksum volume %s: %w", sourceVolume, err)
+	}
+	destFiles, destSum, err := vm.mountDigest(ctx, namespace, destPod, destContainer, destMountPath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to checksum volume %s: %w", destVolume, err)
+	}
+	if sourceFiles != destFiles || sourceSum != destSum {
+		return 0, categorize(ErrVerification, fmt.Errorf("verification failed: volume %s has %d file(s) with checksum %s, but its copy %s has %d with checksum %s",
+			sourceVolume, sourceFiles, sourceSum, destVolume, destFiles, destSum))
+	}
+	vm.printf("Verified %d file(s)\n", sourceFiles)
+	return sourceFiles, nil
+}
+
+// mountDigest runs digestScript in a pod.
+func (vm *VolumeManager) mountDigest(ctx context.Context, namespace, podName, containerName, mountPath string) (int, string, error) {
+	var out bytes.Buffer
+	err := vm.execInPodWithOutput(ctx, namespace, podName, containerName,
+		[]string{"sh", "-c", fmt.Sprintf(digestScript, shellQuote(mountPath))}, &out)
+	if err != nil {
+		return 0, "", err
+	}
+	var files int
+	var sum string
+	if _, err := fmt.Sscan(out.String(), &files, &sum); err != nil {
+		return 0, "", fmt.Errorf("unexpected checksum output %q", strings.TrimSpace(out.String()))
+	}
+	return files, sum, nil
+}
+
+// moveVolumeBinding creates a PersistentVolume named newName for the
+// volume of the same name, like oldPV, and recreates claim, if any, on it.
+// oldPV is retained first, so the old volume outlives its claim.
+func (vm *VolumeManager) moveVolumeBinding(ctx context.Context, oldPV *corev1.PersistentVolume, claim *corev1.PersistentVolumeClaim, newName string) error {
+	pv := &corev1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        newName,
+			Labels:      oldPV.Labels,
+			Annotations: oldPV.Annotations,
+		},
+		Spec: *oldPV.Spec.DeepCopy(),
+	}
+	pv.Spec.ClaimRef = nil
+	if pv.Spec.CSI == nil {
+		return fmt.Errorf("PV %s is not a CSI volume", oldPV.Name)
+	}
+	pv.Spec.CSI.VolumeHandle = newName
+
+	if vm.DryRun {
+		vm.dryRunf("create PersistentVolume %s for volume %s", newName, newName)
+		if claim != nil {
+			vm.dryRunf("recreate PersistentVolumeClaim %s/%s on PV %s, retaining PV %s", claim.Namespace, claim.Name, newName, oldPV.Name)
+		}
+		return nil
+	}
+
+	pvs := vm.clientset.CoreV1().PersistentVolumes()
+	if claim != nil {
+		retain, _ := json.Marshal(map[string]interface{}{
+			"spec": map[string]interface{}{
+				"persistentVolumeReclaimPolicy": corev1.PersistentVolumeReclaimRetain,
+			},
+		})
+		if _, err := pvs.Patch(ctx, oldPV.Name, types.MergePatchType, retain, metav1.PatchOptions{}); err != nil {
+			return fmt.Errorf("failed to retain PV %s: %w", oldPV.Name, err)
+		}
+	}
+	vm.printf("Creating PV %s...\n", newName)
+	if _, err := pvs.Create(ctx, pv, metav1.CreateOptions{}); err != nil {
+		return fmt.Errorf("failed to create PV %s: %w", newName, err)
+	}
+	if claim == nil {
+		return nil
+	}
+	return vm.recreateClaim(ctx, claim, newName, pv.Spec.StorageClassName)
+}
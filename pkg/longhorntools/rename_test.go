@@ -0,0 +1,127 @@
+package longhorntools
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestRenameVolumeChecks(t *testing.T) {
+	vm := newFakeVolumeManager(
+		[]*unstructured.Unstructured{
+			newFakeVolume("vol-a", "detached", "apps", "data"),
+			newFakeVolume("vol-b", "detached", "", ""),
+		},
+		longhornPV("pv-vol-a", "vol-a"),
+		boundPVC("apps", "data", "pv-vol-a"),
+		claimPod("apps", "db-0", "data", corev1.PodRunning),
+	)
+
+	tests := []struct {
+		oldName, newName string
+		want             string
+	}{
+		{"vol-b", "Bad_Name", "invalid volume name"},
+		{"vol-b", "vol-b", "already has that name"},
+		{"vol-b", "vol-a", "Longhorn volume vol-a already exists"},
+		{"missing", "vol-new", "not found"},
+		{"vol-a", "vol-new", "pod apps/db-0 uses PVC data"},
+	}
+	for _, tt := range tests {
+		_, err := vm.RenameVolume(context.Background(), tt.oldName, tt.newName, RenameOptions{})
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("RenameVolume(%s, %s) = %v, want an error containing %q", tt.oldName, tt.newName, err, tt.want)
+		}
+	}
+	if _, err := vm.dynamicClient.Resource(longhornVolumeGVR).Namespace("longhorn-system").Get(context.Background(), "vol-new", metav1.GetOptions{}); err == nil {
+		t.Error("a failed rename left volume vol-new behind")
+	}
+}
+
+func TestCreateRenamedVolume(t *testing.T) {
+	old := newFakeVolume("vol-a", "attached", "apps", "data")
+	old.SetLabels(map[string]string{"recurring-job-group.longhorn.io/default": "enabled"})
+	unstructured.SetNestedField(old.Object, "best-effort", "spec", "dataLocality")
+	unstructured.SetNestedField(old.Object, "worker-1", "spec", "nodeID")
+	vm := newFakeVolumeManager([]*unstructured.Unstructured{old})
+
+	if err := vm.createRenamedVolume(context.Background(), old, "vol-b"); err != nil {
+		t.Fatalf("createRenamedVolume: %v", err)
+	}
+	created, err := vm.dynamicClient.Resource(longhornVolumeGVR).Namespace("longhorn-system").Get(context.Background(), "vol-b", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec, _, _ := unstructured.NestedMap(created.Object, "spec")
+	want := map[string]interface{}{
+		"size":             "1073741824",
+		"numberOfReplicas": int64(3),
+		"frontend":         "blockdev",
+		"dataLocality":     "best-effort",
+	}
+	if len(spec) != len(want) {
+		t.Errorf("spec = %v, want %v", spec, want)
+	}
+	for key, value := range want {
+		if spec[key] != value {
+			t.Errorf("spec.%s = %v, want %v", key, spec[key], value)
+		}
+	}
+	if created.GetLabels()["recurring-job-group.longhorn.io/default"] != "enabled" {
+		t.Errorf("labels = %v, want those of vol-a", created.GetLabels())
+	}
+}
+
+func TestMoveVolumeBinding(t *testing.T) {
+	oldPV := longhornPV("pv-vol-a", "vol-a")
+	oldPV.Spec.PersistentVolumeReclaimPolicy = corev1.PersistentVolumeReclaimDelete
+	oldPV.Spec.ClaimRef = &corev1.ObjectReference{Namespace: "apps", Name: "data"}
+	oldPV.Spec.StorageClassName = "longhorn"
+	claim := boundPVC("apps", "data", "pv-vol-a")
+	claim.Annotations = map[string]string{"pv.kubernetes.io/bind-completed": "yes", "team": "db"}
+	vm := newFakeVolumeManager(nil, oldPV, claim)
+
+	// Kubernetes binds the recreated claim to the PV it names
+	vm.clientset.(*fake.Clientset).PrependReactor("create", "persistentvolumeclaims", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		action.(k8stesting.CreateAction).GetObject().(*corev1.PersistentVolumeClaim).Status.Phase = corev1.ClaimBound
+		return false, nil, nil
+	})
+
+	ctx := context.Background()
+	if err := vm.moveVolumeBinding(ctx, oldPV, claim, "vol-b"); err != nil {
+		t.Fatalf("moveVolumeBinding: %v", err)
+	}
+	pvs := vm.clientset.CoreV1().PersistentVolumes()
+	retained, err := pvs.Get(ctx, "pv-vol-a", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if retained.Spec.PersistentVolumeReclaimPolicy != corev1.PersistentVolumeReclaimRetain {
+		t.Errorf("old PV reclaim policy = %s, want Retain", retained.Spec.PersistentVolumeReclaimPolicy)
+	}
+	newPV, err := pvs.Get(ctx, "vol-b", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("new PV: %v", err)
+	}
+	if newPV.Spec.CSI.VolumeHandle != "vol-b" || newPV.Spec.ClaimRef != nil {
+		t.Errorf("new PV handle %s, claim %v; want vol-b and no claim", newPV.Spec.CSI.VolumeHandle, newPV.Spec.ClaimRef)
+	}
+	recreated, err := vm.clientset.CoreV1().PersistentVolumeClaims("apps").Get(ctx, "data", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("recreated PVC: %v", err)
+	}
+	if recreated.Spec.VolumeName != "vol-b" || *recreated.Spec.StorageClassName != "longhorn" {
+		t.Errorf("recreated PVC on %s with class %s, want vol-b and longhorn", recreated.Spec.VolumeName, *recreated.Spec.StorageClassName)
+	}
+	// Binding annotations belong to the old PV
+	if _, ok := recreated.Annotations["pv.kubernetes.io/bind-completed"]; ok || recreated.Annotations["team"] != "db" {
+		t.Errorf("recreated PVC annotations = %v", recreated.Annotations)
+	}
+}
@@ -0,0 +1,115 @@
+package longhorntools
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DefaultMinHealthyReplicas is how many healthy replicas a volume must keep
+// before its stale replicas are removed.
+const DefaultMinHealthyReplicas = 1
+
+// StaleReplica is a replica that no longer serves its volume: failed, in
+// an error state, or on a node Longhorn no longer has.
+type StaleReplica struct {
+	Replica
+	// Reasons says why the replica is stale, e.g. "node worker-4 removed".
+	Reasons []string `json:"reasons"`
+	// Keep is set, with the reason, when the replica is stale but must not
+	// be removed because its volume has too few healthy replicas.
+	Keep string `json:"keep,omitempty"`
+	// Healthy is the number of healthy replicas of the volume.
+	Healthy int `json:"healthy"`
+}
+
+// FindStaleReplicas returns the stale replicas of volumeName, or of every
+// volume if volumeName is empty. The replicas of a volume with fewer than
+// minHealthy healthy replicas are marked to be kept, since they may be all
+// that is left to salvage it from. A replica is healthy when it is in RW
+// mode or, on a detached volume with no engine to report a mode, when it
+// has not failed.
+func (vm *VolumeManager) FindStaleReplicas(ctx context.Context, volumeName string, minHealthy int) ([]StaleReplica, error) {
+	replicas, err := vm.VolumeReplicas(ctx, volumeName)
+	if err != nil {
+		return nil, err
+	}
+	nodes, err := vm.Nodes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	volumes, err := vm.Volumes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	nodeExists := make(map[string]bool, len(nodes))
+	for _, n := range nodes {
+		nodeExists[n.Name] = true
+	}
+	detached := make(map[string]bool, len(volumes))
+	for _, v := range volumes {
+		detached[v.Name] = v.State == "detached"
+	}
+
+	healthy := make(map[string]int)
+	var stale []StaleReplica
+	for _, r := range replicas {
+		var reasons []string
+		if r.FailedAt != "" {
+			reasons = append(reasons, "failed at "+r.FailedAt)
+		}
+		if r.State == "error" {
+			reasons = append(reasons, "error state")
+		}
+		if r.Mode == "ERR" {
+			reasons = append(reasons, "ERR mode")
+		}
+		if r.Node != "" && !nodeExists[r.Node] {
+			reasons = append(reasons, fmt.Sprintf("node %s removed", r.Node))
+		}
+		if len(reasons) > 0 {
+			stale = append(stale, StaleReplica{Replica: r, Reasons: reasons})
+			continue
+		}
+		if r.Mode == "RW" || (r.Mode == "" && detached[r.Volume]) {
+			healthy[r.Volume]++
+		}
+	}
+
+	for i := range stale {
+		s := &stale[i]
+		s.Healthy = healthy[s.Volume]
+		if s.Healthy < minHealthy {
+			s.Keep = fmt.Sprintf("volume has %d healthy replica(s), fewer than %d", s.Healthy, minHealthy)
+		}
+	}
+	sort.SliceStable(stale, func(i, j int) bool {
+		if stale[i].Volume != stale[j].Volume {
+			return stale[i].Volume < stale[j].Volume
+		}
+		return stale[i].Name < stale[j].Name
+	})
+	return stale, nil
+}
+
+// DeleteReplica deletes a replica of volumeName, and its data with it.
+// Longhorn rebuilds a replacement if the volume is short of replicas.
+func (vm *VolumeManager) DeleteReplica(ctx context.Context, volumeName, replicaName string, reasons []string) error {
+	return vm.withVolumeLocks(ctx, []string{volumeName}, func() error {
+		if vm.DryRun {
+			vm.dryRunf("delete replica longhorn-system/%s", replicaName)
+			return nil
+		}
+		err := vm.dynamicClient.Resource(longhornReplicaGVR).Namespace("longhorn-system").Delete(ctx, replicaName, metav1.DeleteOptions{})
+		if err != nil {
+			err = fmt.Errorf("failed to delete replica %s: %w", replicaName, err)
+		}
+		vm.recordOperationResult(ctx, volumeName, "ReplicaDeleted", "ReplicaDeleteFailed",
+			fmt.Sprintf("deletion of stale replica %s (%s)", replicaName, strings.Join(reasons, ", ")), err)
+		return err
+	})
+}
@@ -0,0 +1,120 @@
+package longhorntools
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func newFakeNode(name string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "longhorn.io/v1beta2",
+		"kind":       "Node",
+		"metadata":   map[string]interface{}{"name": name, "namespace": "longhorn-system"},
+	}}
+}
+
+// newFakeEngine returns the engine of volume reporting the given replica
+// modes.
+func newFakeEngine(volume string, modes map[string]interface{}) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "longhorn.io/v1beta2",
+		"kind":       "Engine",
+		"metadata": map[string]interface{}{
+			"name":      volume + "-e-0",
+			"namespace": "longhorn-system",
+			"labels":    map[string]interface{}{"longhornvolume": volume},
+		},
+		"status": map[string]interface{}{"replicaModeMap": modes},
+	}}
+}
+
+func TestFindStaleReplicas(t *testing.T) {
+	errorReplica := newFakeReplica("vol-c-r-2", "vol-c", "node-1", "")
+	unstructured.SetNestedField(errorReplica.Object, "error", "status", "currentState")
+	vm := newFakeVolumeManager([]*unstructured.Unstructured{
+		newFakeNode("node-1"),
+		newFakeNode("node-2"),
+		newFakeVolume("vol-a", "attached", "", ""),
+		newFakeVolume("vol-b", "attached", "", ""),
+		newFakeVolume("vol-c", "detached", "", ""),
+		newFakeEngine("vol-a", map[string]interface{}{"vol-a-r-1": "RW"}),
+		newFakeEngine("vol-b", map[string]interface{}{"vol-b-r-1": "ERR"}),
+		newFakeReplica("vol-a-r-1", "vol-a", "node-1", ""),
+		newFakeReplica("vol-a-r-2", "vol-a", "node-2", "2024-05-01T10:00:00Z"),
+		newFakeReplica("vol-a-r-3", "vol-a", "node-gone", ""),
+		newFakeReplica("vol-b-r-1", "vol-b", "node-1", ""),
+		// Detached volumes have no engine to report modes
+		newFakeReplica("vol-c-r-1", "vol-c", "node-2", ""),
+		errorReplica,
+	})
+
+	type finding struct {
+		name    string
+		reasons []string
+		keep    bool
+		healthy int
+	}
+	summarize := func(stale []StaleReplica) []finding {
+		var got []finding
+		for _, s := range stale {
+			got = append(got, finding{s.Name, s.Reasons, s.Keep != "", s.Healthy})
+		}
+		return got
+	}
+
+	stale, err := vm.FindStaleReplicas(context.Background(), "", DefaultMinHealthyReplicas)
+	if err != nil {
+		t.Fatalf("FindStaleReplicas: %v", err)
+	}
+	want := []finding{
+		{"vol-a-r-2", []string{"failed at 2024-05-01T10:00:00Z"}, false, 1},
+		{"vol-a-r-3", []string{"node node-gone removed"}, false, 1},
+		// The only replica of vol-b is kept, since it may be all there is
+		{"vol-b-r-1", []string{"ERR mode"}, true, 0},
+		{"vol-c-r-2", []string{"error state"}, false, 1},
+	}
+	if got := summarize(stale); !reflect.DeepEqual(got, want) {
+		t.Errorf("FindStaleReplicas = %+v, want %+v", got, want)
+	}
+
+	stale, err = vm.FindStaleReplicas(context.Background(), "vol-a", 2)
+	if err != nil {
+		t.Fatalf("FindStaleReplicas(vol-a): %v", err)
+	}
+	want = []finding{
+		{"vol-a-r-2", []string{"failed at 2024-05-01T10:00:00Z"}, true, 1},
+		{"vol-a-r-3", []string{"node node-gone removed"}, true, 1},
+	}
+	if got := summarize(stale); !reflect.DeepEqual(got, want) {
+		t.Errorf("FindStaleReplicas(vol-a, 2) = %+v, want %+v", got, want)
+	}
+}
+
+func TestDeleteReplica(t *testing.T) {
+	ctx := context.Background()
+	vm := newFakeVolumeManager([]*unstructured.Unstructured{
+		newFakeVolume("vol-a", "attached", "", ""),
+		newFakeReplica("vol-a-r-2", "vol-a", "node-2", "2024-05-01T10:00:00Z"),
+	})
+	replicas := vm.dynamicClient.Resource(longhornReplicaGVR).Namespace("longhorn-system")
+
+	vm.DryRun = true
+	if err := vm.DeleteReplica(ctx, "vol-a", "vol-a-r-2", []string{"failed"}); err != nil {
+		t.Fatalf("DeleteReplica (dry run): %v", err)
+	}
+	if _, err := replicas.Get(ctx, "vol-a-r-2", metav1.GetOptions{}); err != nil {
+		t.Fatalf("dry run deleted the replica: %v", err)
+	}
+
+	vm.DryRun = false
+	if err := vm.DeleteReplica(ctx, "vol-a", "vol-a-r-2", []string{"failed"}); err != nil {
+		t.Fatalf("DeleteReplica: %v", err)
+	}
+	if _, err := replicas.Get(ctx, "vol-a-r-2", metav1.GetOptions{}); err == nil {
+		t.Error("replica still exists after DeleteReplica")
+	}
+}
@@ -0,0 +1,108 @@
+package longhorntools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Replica is one Longhorn replica of a volume.
+type Replica struct {
+	Name     string `json:"name"`
+	Volume   string `json:"volume"`
+	Node     string `json:"node"`
+	DiskPath string `json:"diskPath"`
+	State    string `json:"state"`
+	// Mode is the engine's view of the replica: RW, WO while rebuilding,
+	// or ERR. It is empty when no engine reports the replica.
+	Mode     string `json:"mode,omitempty"`
+	FailedAt string `json:"failedAt,omitempty"`
+	// Rebuilding is set while the engine rebuilds this replica, with
+	// RebuildProgress in percent.
+	Rebuilding      bool      `json:"rebuilding"`
+	RebuildProgress int64     `json:"rebuildProgress,omitempty"`
+	Created         time.Time `json:"created"`
+}
+
+// Healthy reports whether the replica is running in RW mode and has not
+// failed.
+func (r Replica) Healthy() bool {
+	return r.FailedAt == "" && r.State == "running" && r.Mode == "RW"
+}
+
+// rebuildStatus is one entry of an engine's status.rebuildStatus.
+type rebuildStatus struct {
+	rebuilding bool
+	progress   int64
+}
+
+// VolumeReplicas returns the replicas of volumeName, or of every volume if
+// volumeName is empty, with their mode and rebuild progress as reported by
+// the volume's engine.
+func (vm *VolumeManager) VolumeReplicas(ctx context.Context, volumeName string) ([]Replica, error) {
+	items, err := vm.volumeResources(ctx, longhornReplicaGVR, volumeName)
+	if err != nil {
+		return nil, err
+	}
+
+	// Engines report modes by replica name and rebuilds by replica address
+	modes := make(map[string]string)
+	rebuilds := make(map[string]rebuildStatus)
+	if engines, err := vm.volumeResources(ctx, longhornEngineGVR, volumeName); err == nil {
+		for _, engine := range engines {
+			modeMap, _, _ := unstructured.NestedStringMap(engine.Object, "status", "replicaModeMap")
+			for replica, mode := range modeMap {
+				modes[replica] = mode
+			}
+			statusMap, _, _ := unstructured.NestedMap(engine.Object, "status", "rebuildStatus")
+			for address, value := range statusMap {
+				status, ok := value.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				var rs rebuildStatus
+				rs.rebuilding, _, _ = unstructured.NestedBool(status, "isRebuilding")
+				rs.progress, _, _ = unstructured.NestedInt64(status, "progress")
+				rebuilds[strings.TrimPrefix(address, "tcp://")] = rs
+			}
+		}
+	}
+
+	replicas := make([]Replica, 0, len(items))
+	for _, item := range items {
+		replica := Replica{
+			Name:    item.GetName(),
+			Volume:  item.GetLabels()["longhornvolume"],
+			Mode:    modes[item.GetName()],
+			Created: item.GetCreationTimestamp().Time,
+		}
+		replica.Node, _, _ = unstructured.NestedString(item.Object, "spec", "nodeID")
+		replica.DiskPath, _, _ = unstructured.NestedString(item.Object, "spec", "diskPath")
+		replica.State, _, _ = unstructured.NestedString(item.Object, "status", "currentState")
+		replica.FailedAt, _, _ = unstructured.NestedString(item.Object, "spec", "failedAt")
+
+		port, _, _ := unstructured.NestedInt64(item.Object, "status", "port")
+		for _, field := range []string{"storageIP", "ip"} {
+			ip, _, _ := unstructured.NestedString(item.Object, "status", field)
+			if ip == "" {
+				continue
+			}
+			if rs, ok := rebuilds[fmt.Sprintf("%s:%d", ip, port)]; ok {
+				replica.Rebuilding = rs.rebuilding
+				replica.RebuildProgress = rs.progress
+				break
+			}
+		}
+		if replica.Mode == "WO" {
+			// Write-only replicas are being rebuilt even before the engine
+			// reports progress
+			replica.Rebuilding = true
+		}
+
+		replicas = append(replicas, replica)
+	}
+	return replicas, nil
+}
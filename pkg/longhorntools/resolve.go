@@ -0,0 +1,89 @@
+package longhorntools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Prefixes of volume identifiers that name a PVC or a PV.
+const (
+	pvcIdentifierPrefix = "pvc:"
+	pvIdentifierPrefix  = "pv:"
+)
+
+// ResolveVolume returns the name of the Longhorn volume an identifier
+// refers to:
+//
+//	pvc:<namespace>/<name>   the volume bound to that PVC
+//	pvc:<name>               the same, with the PVC in namespace
+//	pv:<name>                the volume backing that PV
+//	<name>                   a Longhorn volume, or else a PVC in namespace,
+//	                         or else a PV
+func (vm *VolumeManager) ResolveVolume(ctx context.Context, identifier, namespace string) (string, error) {
+	if rest, ok := strings.CutPrefix(identifier, pvcIdentifierPrefix); ok {
+		pvcNamespace, pvcName, found := strings.Cut(rest, "/")
+		if !found {
+			pvcNamespace, pvcName = namespace, rest
+		}
+		if pvcName == "" {
+			return "", fmt.Errorf("invalid volume identifier %q (expected pvc:<namespace>/<name>)", identifier)
+		}
+		return vm.pvcVolume(ctx, pvcNamespace, pvcName)
+	}
+	if pvName, ok := strings.CutPrefix(identifier, pvIdentifierPrefix); ok {
+		return vm.pvVolume(ctx, pvName)
+	}
+
+	volumes, err := vm.Volumes(ctx)
+	if err != nil {
+		return "", err
+	}
+	for _, volume := range volumes {
+		if volume.Name == identifier {
+			return identifier, nil
+		}
+	}
+
+	if _, err := vm.clientset.CoreV1().PersistentVolumeClaims(namespace).Get(ctx, identifier, metav1.GetOptions{}); err == nil {
+		return vm.pvcVolume(ctx, namespace, identifier)
+	}
+	if _, err := vm.clientset.CoreV1().PersistentVolumes().Get(ctx, identifier, metav1.GetOptions{}); err == nil {
+		return vm.pvVolume(ctx, identifier)
+	}
+	return "", categorize(ErrVolumeNotFound, fmt.Errorf("no Longhorn volume, PVC in namespace %s, or PV named %s", namespace, identifier))
+}
+
+// pvcVolume returns the Longhorn volume behind a bound PVC.
+func (vm *VolumeManager) pvcVolume(ctx context.Context, namespace, pvcName string) (string, error) {
+	pvc, err := vm.clientset.CoreV1().PersistentVolumeClaims(namespace).Get(ctx, pvcName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return "", categorize(ErrVolumeNotFound, fmt.Errorf("PVC %s/%s not found", namespace, pvcName))
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get PVC %s/%s: %w", namespace, pvcName, err)
+	}
+	if pvc.Spec.VolumeName == "" {
+		return "", fmt.Errorf("PVC %s/%s is not bound to a PV", namespace, pvcName)
+	}
+	return vm.pvVolume(ctx, pvc.Spec.VolumeName)
+}
+
+// pvVolume returns the Longhorn volume backing a PV, which must be
+// provisioned by the Longhorn CSI driver.
+func (vm *VolumeManager) pvVolume(ctx context.Context, pvName string) (string, error) {
+	pv, err := vm.clientset.CoreV1().PersistentVolumes().Get(ctx, pvName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return "", categorize(ErrVolumeNotFound, fmt.Errorf("PV %s not found", pvName))
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get PV %s: %w", pvName, err)
+	}
+	if pv.Spec.CSI == nil || pv.Spec.CSI.Driver != "driver.longhorn.io" {
+		return "", fmt.Errorf("PV %s is not provisioned by driver.longhorn.io", pvName)
+	}
+	return pv.Spec.CSI.VolumeHandle, nil
+}
@@ -0,0 +1,121 @@
+package longhorntools
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"time"
+)
+
+// resumeOverlap is how many already-downloaded bytes are re-requested on
+// resume and compared against the local copy, to detect that the volume
+// changed since the interrupted download.
+const resumeOverlap = 1 << 20
+
+// downloadState is stored next to an in-progress download so an interrupted
+// transfer can be continued with --resume.
+type downloadState struct {
+	Volume    string    `json:"volume"`
+	Namespace string    `json:"namespace"`
+	ChunkSize int64     `json:"chunkSize,omitempty"`
+	Started   time.Time `json:"started"`
+}
+
+// resumableDownload reports whether a download compressed with algo can
+// be resumed: only unencrypted gzip or plain archives are reproduced byte
+// for byte, and per-file checksums need the whole stream.
+func resumableDownload(algo string, opts DownloadOptions) bool {
+	return opts.Encrypt == "" && !opts.FileChecksums && (algo == CompressGzip || algo == CompressNone)
+}
+
+func downloadStatePath(outputFile string) string {
+	return outputFile + ".state.json"
+}
+
+func saveDownloadState(outputFile string, state downloadState) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode download state: %w", err)
+	}
+	if err := os.WriteFile(downloadStatePath(outputFile), append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write download state: %w", err)
+	}
+	return nil
+}
+
+func loadDownloadState(outputFile string) (*downloadState, error) {
+	data, err := os.ReadFile(downloadStatePath(outputFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("no resumable download found for %s", outputFile)
+		}
+		return nil, fmt.Errorf("failed to read download state: %w", err)
+	}
+
+	var state downloadState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse download state: %w", err)
+	}
+	return &state, nil
+}
+
+func removeDownloadState(outputFile string) {
+	os.Remove(downloadStatePath(outputFile))
+}
+
+// primeFromExisting feeds the already-downloaded bytes into h and returns
+// their total length along with the trailing resumeOverlap bytes.
+func primeFromExisting(r io.Reader, h hash.Hash) (int64, []byte, error) {
+	var tail []byte
+	buf := make([]byte, 64*1024)
+	var total int64
+
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			h.Write(buf[:n])
+			total += int64(n)
+			tail = append(tail, buf[:n]...)
+			if len(tail) > resumeOverlap {
+				tail = tail[len(tail)-resumeOverlap:]
+			}
+		}
+		if err == io.EOF {
+			return total, tail, nil
+		}
+		if err != nil {
+			return total, nil, fmt.Errorf("failed to read partial download: %w", err)
+		}
+	}
+}
+
+// overlapVerifier compares the first len(expected) bytes written to it
+// against expected and forwards only the bytes after that to out.
+type overlapVerifier struct {
+	expected []byte
+	out      io.Writer
+}
+
+func (v *overlapVerifier) Write(p []byte) (int, error) {
+	n := len(p)
+	if len(v.expected) > 0 {
+		k := len(v.expected)
+		if len(p) < k {
+			k = len(p)
+		}
+		if !bytes.Equal(p[:k], v.expected[:k]) {
+			return 0, categorize(ErrVerification, fmt.Errorf("volume contents changed since the interrupted download; remove the partial file and start over"))
+		}
+		v.expected = v.expected[k:]
+		p = p[k:]
+	}
+	if len(p) > 0 {
+		if _, err := v.out.Write(p); err != nil {
+			return 0, err
+		}
+	}
+	return n, nil
+}
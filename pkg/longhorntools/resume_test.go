@@ -0,0 +1,30 @@
+package longhorntools
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestOverlapVerifier(t *testing.T) {
+	var out bytes.Buffer
+	v := &overlapVerifier{expected: []byte("hello"), out: &out}
+	// The overlap arrives split across writes, followed by new data
+	for _, p := range []string{"he", "llo wor", "ld"} {
+		if n, err := v.Write([]byte(p)); err != nil || n != len(p) {
+			t.Fatalf("Write(%q) = %d, %v", p, n, err)
+		}
+	}
+	if out.String() != " world" {
+		t.Errorf("forwarded %q, want %q", out.String(), " world")
+	}
+
+	out.Reset()
+	v = &overlapVerifier{expected: []byte("hello"), out: &out}
+	if _, err := v.Write([]byte("help!")); !errors.Is(err, ErrVerification) {
+		t.Errorf("Write of changed data = %v, want ErrVerification", err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("forwarded %q after a mismatch", out.String())
+	}
+}
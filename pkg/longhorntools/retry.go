@@ -0,0 +1,189 @@
+package longhorntools
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+const (
+	// DefaultRetries is how many times a transient failure is retried.
+	DefaultRetries = 5
+	// DefaultRetryBackoff is the first retry delay; it doubles on each
+	// attempt up to maxRetryBackoff.
+	DefaultRetryBackoff = time.Second
+	maxRetryBackoff     = 30 * time.Second
+)
+
+// retryDelay returns the wait before retry number attempt (starting at 1).
+func (vm *VolumeManager) retryDelay(attempt int) time.Duration {
+	delay := vm.RetryBackoff
+	for i := 1; i < attempt && delay < maxRetryBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, maxRetryBackoff)
+}
+
+// sleepBeforeRetry waits before the next attempt, returning false if the
+// run is interrupted in the meantime.
+func (vm *VolumeManager) sleepBeforeRetry(ctx context.Context, attempt int) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(vm.retryDelay(attempt)):
+		return true
+	}
+}
+
+// isTransient reports whether err is worth retrying as is: throttling,
+// server timeouts and unavailability, and dropped or refused connections,
+// including failures to upgrade an exec stream. Conflicts are not
+// included; they need a fresh read first (see retry.RetryOnConflict).
+func isTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+	if apierrors.IsTooManyRequests(err) || apierrors.IsServerTimeout(err) ||
+		apierrors.IsTimeout(err) || apierrors.IsServiceUnavailable(err) || apierrors.IsInternalError(err) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	msg := err.Error()
+	for _, s := range []string{
+		"connection refused",
+		"connection reset by peer",
+		"broken pipe",
+		"unable to upgrade connection",
+		"error dialing backend",
+		"http2: client connection lost",
+		"TLS handshake timeout",
+	} {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// retryingTransport retries API requests that fail with a dropped
+// connection or a throttling/unavailable response. Streaming upgrades
+// (exec, port-forward) are passed through; execWithRetry handles those.
+type retryingTransport struct {
+	vm   *VolumeManager
+	next http.RoundTripper
+}
+
+func (t *retryingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("Upgrade") != "" || (req.Body != nil && req.GetBody == nil) {
+		return t.next.RoundTrip(req)
+	}
+
+	for attempt := 1; ; attempt++ {
+		if attempt > 1 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+
+		resp, err := t.next.RoundTrip(req)
+		if err == nil {
+			t.vm.reportServerThrottling(req, resp)
+		}
+		retryable := false
+		switch {
+		case err != nil:
+			retryable = isTransient(err)
+		case resp.StatusCode == http.StatusTooManyRequests && resp.Header.Get("Retry-After") == "":
+			// client-go already honors Retry-After itself
+			retryable = true
+		case resp.StatusCode == http.StatusBadGateway, resp.StatusCode == http.StatusServiceUnavailable,
+			resp.StatusCode == http.StatusGatewayTimeout:
+			retryable = resp.Header.Get("Retry-After") == ""
+		}
+
+		if !retryable || attempt > t.vm.Retries || req.Context().Err() != nil {
+			return resp, err
+		}
+
+		reason := ""
+		if err != nil {
+			reason = err.Error()
+		} else {
+			reason = resp.Status
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		t.vm.printf("Transient API error on %s %s: %s (retry %d/%d in %s)\n",
+			req.Method, req.URL.Path, reason, attempt, t.vm.Retries, t.vm.retryDelay(attempt))
+
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(t.vm.retryDelay(attempt)):
+		}
+	}
+}
+
+// execWithRetry runs an exec session, retrying transient failures as long
+// as no data has moved in either direction yet. Once the remote command
+// has produced output or consumed input, retrying could duplicate or lose
+// data, so the error is returned as is.
+func (vm *VolumeManager) execWithRetry(ctx context.Context, podName string, stream func(started *atomic.Bool) error) error {
+	for attempt := 1; ; attempt++ {
+		var started atomic.Bool
+		err := stream(&started)
+		if err == nil || started.Load() || !isTransient(err) || attempt > vm.Retries {
+			return err
+		}
+
+		vm.printf("Failed to start exec session in pod %s: %v (retry %d/%d in %s)\n",
+			podName, err, attempt, vm.Retries, vm.retryDelay(attempt))
+		if !vm.sleepBeforeRetry(ctx, attempt) {
+			return err
+		}
+	}
+}
+
+// startedWriter and startedReader flag the first byte through an exec
+// stream.
+type startedWriter struct {
+	w       io.Writer
+	started *atomic.Bool
+}
+
+func (s startedWriter) Write(p []byte) (int, error) {
+	if len(p) > 0 {
+		s.started.Store(true)
+	}
+	return s.w.Write(p)
+}
+
+type startedReader struct {
+	r       io.Reader
+	started *atomic.Bool
+}
+
+func (s startedReader) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	if n > 0 {
+		s.started.Store(true)
+	}
+	return n, err
+}
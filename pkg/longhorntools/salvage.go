@@ -0,0 +1,113 @@
+package longhorntools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// defaultSalvageTimeout bounds the wait for a salvaged volume to recover
+// when --wait-timeout is not set.
+const defaultSalvageTimeout = 5 * time.Minute
+
+// FailedReplicas returns the replicas of volumeName that Longhorn has
+// marked failed, most recently failed first. That one usually holds the
+// newest data.
+func (vm *VolumeManager) FailedReplicas(ctx context.Context, volumeName string) ([]Replica, error) {
+	replicas, err := vm.VolumeReplicas(ctx, volumeName)
+	if err != nil {
+		return nil, err
+	}
+
+	var failed []Replica
+	for _, r := range replicas {
+		if r.FailedAt != "" {
+			failed = append(failed, r)
+		}
+	}
+	sort.SliceStable(failed, func(i, j int) bool { return failed[i].FailedAt > failed[j].FailedAt })
+	return failed, nil
+}
+
+// SalvageVolume recovers a faulted volume the way Longhorn's salvage action
+// does: it clears the failure of the named replicas so Longhorn can attach
+// the volume from them again, then waits for the volume to leave the
+// faulted state. The volume must be detached and every named replica must
+// belong to it and have failed.
+func (vm *VolumeManager) SalvageVolume(ctx context.Context, volumeName string, replicaNames []string) error {
+	return vm.withVolumeLocks(ctx, []string{volumeName}, func() error {
+		err := vm.salvageVolume(ctx, volumeName, replicaNames)
+		vm.recordOperationResult(ctx, volumeName, "Salvaged", "SalvageFailed",
+			fmt.Sprintf("salvage from replicas %s", strings.Join(replicaNames, ", ")), err)
+		return err
+	})
+}
+
+func (vm *VolumeManager) salvageVolume(ctx context.Context, volumeName string, replicaNames []string) error {
+	if len(replicaNames) == 0 {
+		return fmt.Errorf("no replicas to salvage")
+	}
+	volume, err := vm.Volume(ctx, volumeName)
+	if err != nil {
+		return err
+	}
+	if volume.Robustness != "faulted" {
+		return fmt.Errorf("volume %s is not faulted (robustness %s); only faulted volumes can be salvaged", volumeName, volume.Robustness)
+	}
+	if volume.State != "detached" {
+		return fmt.Errorf("volume %s is %s; it must be detached before it can be salvaged", volumeName, volume.State)
+	}
+
+	failed, err := vm.FailedReplicas(ctx, volumeName)
+	if err != nil {
+		return err
+	}
+	known := make(map[string]bool, len(failed))
+	for _, r := range failed {
+		known[r.Name] = true
+	}
+	for _, name := range replicaNames {
+		if !known[name] {
+			return fmt.Errorf("replica %s is not a failed replica of volume %s", name, volumeName)
+		}
+	}
+
+	// Longhorn's salvage action resets the same fields
+	patch, _ := json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{
+			"failedAt":          "",
+			"rebuildRetryCount": 0,
+		},
+	})
+	replicas := vm.dynamicClient.Resource(longhornReplicaGVR).Namespace("longhorn-system")
+	for _, name := range replicaNames {
+		if vm.DryRun {
+			vm.dryRunf("patch replica longhorn-system/%s to clear its failure", name)
+			continue
+		}
+		vm.printf("Salvaging replica %s...\n", name)
+		if _, err := replicas.Patch(ctx, name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+			return fmt.Errorf("failed to patch replica %s: %w", name, err)
+		}
+	}
+	if vm.DryRun {
+		return nil
+	}
+
+	vm.printf("Waiting for volume %s to recover...\n", volumeName)
+	return vm.waitForVolume(ctx, volumeName, "recovered", defaultSalvageTimeout, func(obj *unstructured.Unstructured) bool {
+		robustness, _, _ := unstructured.NestedString(obj.Object, "status", "robustness")
+		if robustness == "faulted" {
+			return false
+		}
+		vm.printf("Volume %s is no longer faulted (robustness %s)\n", volumeName, robustness)
+		return true
+	})
+}
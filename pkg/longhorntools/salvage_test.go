@@ -0,0 +1,105 @@
+package longhorntools
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func newFakeReplica(name, volume, node, failedAt string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "longhorn.io/v1beta2",
+		"kind":       "Replica",
+		"metadata": map[string]interface{}{
+			"name":      name,
+			"namespace": "longhorn-system",
+			"labels":    map[string]interface{}{"longhornvolume": volume},
+		},
+		"spec":   map[string]interface{}{"nodeID": node, "failedAt": failedAt},
+		"status": map[string]interface{}{"currentState": "stopped"},
+	}}
+}
+
+// faultedVolume returns a detached volume whose replicas have all failed.
+func faultedVolume(name string) *unstructured.Unstructured {
+	volume := newFakeVolume(name, "detached", "", "")
+	unstructured.SetNestedField(volume.Object, "faulted", "status", "robustness")
+	return volume
+}
+
+func TestFailedReplicas(t *testing.T) {
+	vm := newFakeVolumeManager([]*unstructured.Unstructured{
+		faultedVolume("vol-a"),
+		newFakeReplica("vol-a-r-1", "vol-a", "node-1", "2024-05-01T10:00:00Z"),
+		newFakeReplica("vol-a-r-2", "vol-a", "node-2", "2024-05-01T12:00:00Z"),
+		newFakeReplica("vol-a-r-3", "vol-a", "node-3", ""),
+		newFakeReplica("vol-b-r-1", "vol-b", "node-1", "2024-05-01T13:00:00Z"),
+	})
+
+	failed, err := vm.FailedReplicas(context.Background(), "vol-a")
+	if err != nil {
+		t.Fatalf("FailedReplicas: %v", err)
+	}
+	var names []string
+	for _, r := range failed {
+		names = append(names, r.Name)
+	}
+	// The most recently failed replica comes first
+	if want := []string{"vol-a-r-2", "vol-a-r-1"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("FailedReplicas = %v, want %v", names, want)
+	}
+}
+
+func TestSalvageVolume(t *testing.T) {
+	ctx := context.Background()
+	attached := faultedVolume("vol-attached")
+	unstructured.SetNestedField(attached.Object, "attached", "status", "state")
+	vm := newFakeVolumeManager([]*unstructured.Unstructured{
+		faultedVolume("vol-a"),
+		newFakeVolume("vol-healthy", "detached", "", ""),
+		attached,
+		newFakeReplica("vol-a-r-1", "vol-a", "node-1", "2024-05-01T10:00:00Z"),
+		newFakeReplica("vol-a-r-2", "vol-a", "node-2", ""),
+	})
+
+	for _, tt := range []struct {
+		volume   string
+		replicas []string
+		want     string
+	}{
+		{"vol-a", nil, "no replicas"},
+		{"vol-healthy", []string{"r"}, "not faulted"},
+		{"vol-attached", []string{"r"}, "must be detached"},
+		{"vol-a", []string{"vol-a-r-2"}, "not a failed replica"},
+		{"vol-a", []string{"vol-b-r-1"}, "not a failed replica"},
+	} {
+		if err := vm.SalvageVolume(ctx, tt.volume, tt.replicas); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("SalvageVolume(%s, %v) = %v, want an error containing %q", tt.volume, tt.replicas, err, tt.want)
+		}
+	}
+
+	// Longhorn recovers the volume once a replica's failure is cleared
+	dynamicClient := vm.dynamicClient.(*dynamicfake.FakeDynamicClient)
+	dynamicClient.PrependReactor("patch", "replicas", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		volume := faultedVolume("vol-a")
+		unstructured.SetNestedField(volume.Object, "degraded", "status", "robustness")
+		return false, nil, dynamicClient.Tracker().Update(longhornVolumeGVR, volume, "longhorn-system")
+	})
+	if err := vm.SalvageVolume(ctx, "vol-a", []string{"vol-a-r-1"}); err != nil {
+		t.Fatalf("SalvageVolume: %v", err)
+	}
+	replica, err := vm.dynamicClient.Resource(longhornReplicaGVR).Namespace("longhorn-system").Get(ctx, "vol-a-r-1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if failedAt, _, _ := unstructured.NestedString(replica.Object, "spec", "failedAt"); failedAt != "" {
+		t.Errorf("failedAt = %q after salvage, want it cleared", failedAt)
+	}
+}
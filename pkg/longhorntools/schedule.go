@@ -0,0 +1,263 @@
+package longhorntools
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/yaml"
+)
+
+// ScheduleOptions describes a recurring in-cluster export.
+type ScheduleOptions struct {
+	// Name is used for the CronJob and its RBAC objects.
+	Name string
+	// Schedule is a standard cron expression.
+	Schedule string
+	// Image is a container image that contains the lhc binary.
+	Image string
+	// Action is "download" or "copy".
+	Action string
+	// Volumes are downloaded into TargetPVC when Action is "download".
+	Volumes   []string
+	TargetPVC string
+	// Source and Dest are used when Action is "copy".
+	Source string
+	Dest   string
+	// ExtraArgs are appended to the lhc invocation (e.g. --compress zstd).
+	ExtraArgs []string
+	// ImagePullSecrets are set on the CronJob's pods, for an Image in a
+	// private registry.
+	ImagePullSecrets []string
+}
+
+// buildScheduleObjects returns the ServiceAccount, RBAC, and CronJob needed
+// to run this tool on a schedule inside the cluster.
+func buildScheduleObjects(namespace, storageClass string, opts ScheduleOptions) ([]runtime.Object, error) {
+	if opts.Schedule == "" {
+		return nil, fmt.Errorf("--schedule is required")
+	}
+	if opts.Image == "" {
+		return nil, fmt.Errorf("--image is required")
+	}
+
+	labels := map[string]string{"app": "lhc-schedule", "lhc-schedule": opts.Name}
+
+	var args []string
+	var volumes []corev1.Volume
+	var mounts []corev1.VolumeMount
+	switch opts.Action {
+	case "download":
+		if len(opts.Volumes) == 0 || opts.TargetPVC == "" {
+			return nil, fmt.Errorf("download schedules require at least one -v and --target-pvc")
+		}
+		// Each run writes into its own timestamped directory on the target
+		args = []string{"download", "-n", namespace, "-c", storageClass, "-o", "/backups/$(date +%Y%m%d-%H%M%S)/"}
+		for _, v := range opts.Volumes {
+			args = append(args, "-v", v)
+		}
+		volumes = []corev1.Volume{{
+			Name: "backups",
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: opts.TargetPVC},
+			},
+		}}
+		mounts = []corev1.VolumeMount{{Name: "backups", MountPath: "/backups"}}
+
+	case "copy":
+		if opts.Source == "" || opts.Dest == "" {
+			return nil, fmt.Errorf("copy schedules require -s and -d")
+		}
+		// The Job has no terminal to confirm the destination wipe on
+		args = []string{"copy", "-n", namespace, "-c", storageClass, "-s", opts.Source, "-d", opts.Dest, "--yes"}
+
+	default:
+		return nil, fmt.Errorf("unsupported schedule action %q (expected download or copy)", opts.Action)
+	}
+	args = append(args, opts.ExtraArgs...)
+
+	// Run through sh so the timestamp in the output path is expanded
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		if strings.Contains(a, "$(") {
+			quoted[i] = `"` + a + `"`
+		} else {
+			quoted[i] = shellQuote(a)
+		}
+	}
+	script := "lhc " + strings.Join(quoted, " ")
+
+	var pullSecrets []corev1.LocalObjectReference
+	for _, secret := range opts.ImagePullSecrets {
+		pullSecrets = append(pullSecrets, corev1.LocalObjectReference{Name: secret})
+	}
+
+	serviceAccount := &corev1.ServiceAccount{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ServiceAccount"},
+		ObjectMeta: metav1.ObjectMeta{Name: opts.Name, Namespace: namespace, Labels: labels},
+	}
+
+	// PersistentVolumes are cluster-scoped, so a ClusterRole is required
+	clusterRole := &rbacv1.ClusterRole{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "ClusterRole"},
+		ObjectMeta: metav1.ObjectMeta{Name: opts.Name, Labels: labels},
+		Rules: []rbacv1.PolicyRule{
+			{
+				APIGroups: []string{""},
+				Resources: []string{"pods", "persistentvolumeclaims", "persistentvolumes"},
+				Verbs:     []string{"get", "list", "watch", "create", "patch", "delete"},
+			},
+			{
+				APIGroups: []string{""},
+				Resources: []string{"pods/exec"},
+				Verbs:     []string{"create"},
+			},
+			{
+				APIGroups: []string{"longhorn.io"},
+				Resources: []string{"volumes"},
+				Verbs:     []string{"get", "list", "patch"},
+			},
+			{
+				APIGroups: []string{""},
+				Resources: []string{"events"},
+				Verbs:     []string{"create", "list"},
+			},
+			{
+				APIGroups: []string{"coordination.k8s.io"},
+				Resources: []string{"leases"},
+				Verbs:     []string{"get", "create", "update", "delete"},
+			},
+		},
+	}
+
+	binding := &rbacv1.ClusterRoleBinding{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "ClusterRoleBinding"},
+		ObjectMeta: metav1.ObjectMeta{Name: opts.Name, Labels: labels},
+		RoleRef: rbacv1.RoleRef{
+			APIGroup: "rbac.authorization.k8s.io",
+			Kind:     "ClusterRole",
+			Name:     opts.Name,
+		},
+		Subjects: []rbacv1.Subject{{
+			Kind:      "ServiceAccount",
+			Name:      opts.Name,
+			Namespace: namespace,
+		}},
+	}
+
+	backoffLimit := int32(0)
+	cronJob := &batchv1.CronJob{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "batch/v1", Kind: "CronJob"},
+		ObjectMeta: metav1.ObjectMeta{Name: opts.Name, Namespace: namespace, Labels: labels},
+		Spec: batchv1.CronJobSpec{
+			Schedule:          opts.Schedule,
+			ConcurrencyPolicy: batchv1.ForbidConcurrent,
+			JobTemplate: batchv1.JobTemplateSpec{
+				Spec: batchv1.JobSpec{
+					BackoffLimit: &backoffLimit,
+					Template: corev1.PodTemplateSpec{
+						ObjectMeta: metav1.ObjectMeta{Labels: labels},
+						Spec: corev1.PodSpec{
+							ServiceAccountName: opts.Name,
+							RestartPolicy:      corev1.RestartPolicyNever,
+							Containers: []corev1.Container{{
+								Name:         "lhc",
+								Image:        opts.Image,
+								Command:      []string{"sh", "-c", script},
+								VolumeMounts: mounts,
+							}},
+							Volumes:          volumes,
+							ImagePullSecrets: pullSecrets,
+						},
+					},
+				},
+			},
+		},
+	}
+
+	return []runtime.Object{serviceAccount, clusterRole, binding, cronJob}, nil
+}
+
+// WriteScheduleManifests renders the schedule objects as a multi-document
+// YAML stream.
+func WriteScheduleManifests(w io.Writer, namespace, storageClass string, opts ScheduleOptions) error {
+	objects, err := buildScheduleObjects(namespace, storageClass, opts)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	for i, obj := range objects {
+		data, err := yaml.Marshal(obj)
+		if err != nil {
+			return fmt.Errorf("failed to encode manifest: %w", err)
+		}
+		if i > 0 {
+			buf.WriteString("---\n")
+		}
+		buf.Write(data)
+	}
+
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+// ApplySchedule creates (or updates) the schedule objects in the cluster.
+func (vm *VolumeManager) ApplySchedule(ctx context.Context, namespace, storageClass string, opts ScheduleOptions) error {
+	objects, err := buildScheduleObjects(namespace, storageClass, opts)
+	if err != nil {
+		return err
+	}
+
+	for _, obj := range objects {
+		if vm.DryRun {
+			vm.dryRunf("apply %s %s", obj.GetObjectKind().GroupVersionKind().Kind, obj.(metav1.Object).GetName())
+			continue
+		}
+		switch o := obj.(type) {
+		case *corev1.ServiceAccount:
+			_, err = vm.clientset.CoreV1().ServiceAccounts(namespace).Create(ctx, o, metav1.CreateOptions{})
+			if errors.IsAlreadyExists(err) {
+				err = nil
+			}
+		case *rbacv1.ClusterRole:
+			_, err = vm.clientset.RbacV1().ClusterRoles().Create(ctx, o, metav1.CreateOptions{})
+			if errors.IsAlreadyExists(err) {
+				_, err = vm.clientset.RbacV1().ClusterRoles().Update(ctx, o, metav1.UpdateOptions{})
+			}
+		case *rbacv1.ClusterRoleBinding:
+			_, err = vm.clientset.RbacV1().ClusterRoleBindings().Create(ctx, o, metav1.CreateOptions{})
+			if errors.IsAlreadyExists(err) {
+				err = nil
+			}
+		case *batchv1.CronJob:
+			_, err = vm.clientset.BatchV1().CronJobs(namespace).Create(ctx, o, metav1.CreateOptions{})
+			if errors.IsAlreadyExists(err) {
+				err = retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+					existing, err := vm.clientset.BatchV1().CronJobs(namespace).Get(ctx, o.Name, metav1.GetOptions{})
+					if err != nil {
+						return err
+					}
+					o.ResourceVersion = existing.ResourceVersion
+					_, err = vm.clientset.BatchV1().CronJobs(namespace).Update(ctx, o, metav1.UpdateOptions{})
+					return err
+				})
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("failed to apply %s: %w", obj.GetObjectKind().GroupVersionKind().Kind, err)
+		}
+		vm.printf("Applied %s\n", obj.GetObjectKind().GroupVersionKind().Kind)
+	}
+
+	return nil
+}
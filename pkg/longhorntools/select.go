@@ -0,0 +1,139 @@
+package longhorntools
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// SelectedVolume is a Longhorn volume matched by a label selector, with the
+// PVC bound to it if there is one.
+type SelectedVolume struct {
+	Volume       string
+	PVCNamespace string
+	PVCName      string
+}
+
+// SelectVolumes returns the Longhorn volumes whose own labels match
+// selector, followed by those bound to matching PVCs in namespace. Each
+// volume appears once.
+func (vm *VolumeManager) SelectVolumes(ctx context.Context, selector, namespace string) ([]SelectedVolume, error) {
+	if _, err := labels.Parse(selector); err != nil {
+		return nil, fmt.Errorf("invalid selector %q: %w", selector, err)
+	}
+	opts := metav1.ListOptions{LabelSelector: selector}
+
+	var selected []SelectedVolume
+	seen := make(map[string]bool)
+
+	volumes, err := vm.dynamicClient.Resource(longhornVolumeGVR).Namespace("longhorn-system").List(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list Longhorn volumes: %w", err)
+	}
+	for _, item := range volumes.Items {
+		volume := SelectedVolume{Volume: item.GetName()}
+		volume.PVCNamespace, _, _ = unstructured.NestedString(item.Object, "status", "kubernetesStatus", "namespace")
+		volume.PVCName, _, _ = unstructured.NestedString(item.Object, "status", "kubernetesStatus", "pvcName")
+		seen[volume.Volume] = true
+		selected = append(selected, volume)
+	}
+
+	pvcs, err := vm.clientset.CoreV1().PersistentVolumeClaims(namespace).List(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list PVCs: %w", err)
+	}
+	for _, pvc := range pvcs.Items {
+		if pvc.Spec.VolumeName == "" {
+			continue
+		}
+		// PVCs from other provisioners are not errors, just not ours
+		volumeName, err := vm.pvVolume(ctx, pvc.Spec.VolumeName)
+		if err != nil || seen[volumeName] {
+			continue
+		}
+		seen[volumeName] = true
+		selected = append(selected, SelectedVolume{Volume: volumeName, PVCNamespace: pvc.Namespace, PVCName: pvc.Name})
+	}
+
+	return selected, nil
+}
+
+// IsVolumePattern reports whether a volume argument is a glob pattern
+// rather than a name.
+func IsVolumePattern(s string) bool {
+	return strings.ContainsAny(s, "*?[")
+}
+
+// MatchVolumes returns the Longhorn volumes whose names match pattern, a
+// shell glob such as "pvc-9a*", or with regex a regular expression that must
+// match the whole name.
+func (vm *VolumeManager) MatchVolumes(ctx context.Context, pattern string, regex bool) ([]string, error) {
+	match := func(name string) bool {
+		ok, _ := path.Match(pattern, name)
+		return ok
+	}
+	if regex {
+		re, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression %q: %w", pattern, err)
+		}
+		match = re.MatchString
+	} else if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+
+	volumes, err := vm.Volumes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, volume := range volumes {
+		if match(volume.Name) {
+			names = append(names, volume.Name)
+		}
+	}
+	return names, nil
+}
+
+// ForVolumes returns the subset of the temporary resources that were
+// created for one of volumes.
+func (t *TemporaryResources) ForVolumes(volumes []string) *TemporaryResources {
+	want := make(map[string]bool, len(volumes))
+	for _, v := range volumes {
+		want[v] = true
+	}
+	// Temporary resources are named lhc-temp-<kind>-<volume>, where the
+	// volume may itself be a snapshot-based lhc-temp-rwx-<volume>
+	match := func(name string) bool {
+		rest, ok := strings.CutPrefix(name, "lhc-temp-")
+		if !ok {
+			return false
+		}
+		_, volume, _ := strings.Cut(rest, "-")
+		return want[strings.TrimPrefix(volume, "lhc-temp-rwx-")]
+	}
+
+	res := &TemporaryResources{}
+	for _, pod := range t.Pods {
+		if match(pod.Name) {
+			res.Pods = append(res.Pods, pod)
+		}
+	}
+	for _, pvc := range t.PVCs {
+		if match(pvc.Name) {
+			res.PVCs = append(res.PVCs, pvc)
+		}
+	}
+	for _, pv := range t.PVs {
+		if match(pv.Name) {
+			res.PVs = append(res.PVs, pv)
+		}
+	}
+	return res
+}
@@ -0,0 +1,64 @@
+package longhorntools
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestMatchVolumes(t *testing.T) {
+	vm := newFakeVolumeManager([]*unstructured.Unstructured{
+		newFakeVolume("pvc-9a8b-archive", "detached", "", ""),
+		newFakeVolume("pvc-9a8c-logs", "detached", "", ""),
+		newFakeVolume("pvc-0f1e-app", "attached", "", ""),
+	})
+
+	tests := []struct {
+		pattern string
+		regex   bool
+		want    []string
+	}{
+		{"pvc-9a*", false, []string{"pvc-9a8b-archive", "pvc-9a8c-logs"}},
+		{"pvc-9a8?-logs", false, []string{"pvc-9a8c-logs"}},
+		{"pvc-[0-9]f*", false, []string{"pvc-0f1e-app"}},
+		{"*-app", false, []string{"pvc-0f1e-app"}},
+		{"nothing*", false, nil},
+		{"pvc-9a8[bc]-.*", true, []string{"pvc-9a8b-archive", "pvc-9a8c-logs"}},
+		// A regular expression must match the whole name
+		{"archive", true, nil},
+		{".*archive|.*app", true, []string{"pvc-0f1e-app", "pvc-9a8b-archive"}},
+	}
+	for _, tt := range tests {
+		got, err := vm.MatchVolumes(context.Background(), tt.pattern, tt.regex)
+		if err != nil {
+			t.Errorf("MatchVolumes(%q, %v): %v", tt.pattern, tt.regex, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("MatchVolumes(%q, %v) = %v, want %v", tt.pattern, tt.regex, got, tt.want)
+		}
+	}
+
+	if _, err := vm.MatchVolumes(context.Background(), "pvc-[", false); err == nil {
+		t.Error("MatchVolumes with a malformed glob succeeded")
+	}
+	if _, err := vm.MatchVolumes(context.Background(), "pvc-(", true); err == nil {
+		t.Error("MatchVolumes with a malformed regular expression succeeded")
+	}
+}
+
+func TestIsVolumePattern(t *testing.T) {
+	for s, want := range map[string]bool{
+		"pvc-12345":     false,
+		"pvc:apps/data": false,
+		"pvc-*":         true,
+		"pvc-?":         true,
+		"pvc-[ab]":      true,
+	} {
+		if got := IsVolumePattern(s); got != want {
+			t.Errorf("IsVolumePattern(%q) = %v, want %v", s, got, want)
+		}
+	}
+}
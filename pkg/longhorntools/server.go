@@ -0,0 +1,375 @@
+package longhorntools
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// ServerOptions configures the REST API server.
+type ServerOptions struct {
+	// Listen is the address to bind, e.g. ":8080".
+	Listen string
+	// Token is the bearer token clients must present. If empty, a random
+	// token is generated and printed at startup.
+	Token string
+	// TLSCert and TLSKey enable HTTPS when both are set.
+	TLSCert string
+	TLSKey  string
+	// StorageClass is used when a request does not specify one.
+	StorageClass string
+}
+
+// Server exposes VolumeManager operations over HTTP:
+//
+//	GET  /api/v1/volumes
+//	GET  /api/v1/volumes/{name}/contents
+//	GET  /api/v1/volumes/{name}/download?compress=gzip&level=0
+//	POST /api/v1/copy      {"source": "...", "destination": "...", "inCluster": false}
+//	POST /api/v1/volumes/{name}/cleanup
+//	GET  /metrics
+//
+// Every endpoint accepts ?namespace= (default "default") and
+// ?storageClass= query parameters.
+type Server struct {
+	vm   *VolumeManager
+	opts ServerOptions
+}
+
+func NewServer(vm *VolumeManager, opts ServerOptions) *Server {
+	return &Server{vm: vm, opts: opts}
+}
+
+// apiVolume is the JSON representation of a Longhorn volume.
+type apiVolume struct {
+	Name   string `json:"name"`
+	State  string `json:"state"`
+	Size   string `json:"size"`
+	PVName string `json:"pvName,omitempty"`
+}
+
+// copyRequest is the body of POST /api/v1/copy.
+type copyRequest struct {
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	InCluster   bool   `json:"inCluster"`
+}
+
+// cleanupResponse lists the temporary resources that were removed.
+type cleanupResponse struct {
+	Pods   []string `json:"pods"`
+	PVCs   []string `json:"pvcs"`
+	PVs    []string `json:"pvs"`
+	Failed int      `json:"failed"`
+}
+
+// Run serves the API until the listener fails or ctx is cancelled.
+// Requests run with a context derived from ctx, so an operation stops when
+// its client disconnects.
+func (s *Server) Run(ctx context.Context) error {
+	if s.opts.Token == "" {
+		token, err := generateToken()
+		if err != nil {
+			return err
+		}
+		s.opts.Token = token
+		log.Printf("Generated API token: %s", token)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/volumes", s.handleListVolumes)
+	mux.HandleFunc("GET /api/v1/volumes/{name}/contents", s.handleContents)
+	mux.HandleFunc("GET /api/v1/volumes/{name}/download", s.handleDownload)
+	mux.HandleFunc("POST /api/v1/copy", s.handleCopy)
+	mux.HandleFunc("POST /api/v1/volumes/{name}/cleanup", s.handleCleanup)
+	mux.Handle("GET /metrics", promhttp.Handler())
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+
+	server := &http.Server{
+		Addr:              s.opts.Listen,
+		Handler:           s.authenticate(mux),
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+	}
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+
+	if s.opts.TLSCert != "" && s.opts.TLSKey != "" {
+		log.Printf("API server listening on https://%s", s.opts.Listen)
+		return server.ListenAndServeTLS(s.opts.TLSCert, s.opts.TLSKey)
+	}
+	log.Printf("API server listening on http://%s", s.opts.Listen)
+	return server.ListenAndServe()
+}
+
+// generateToken returns a random 32-byte hex token.
+func generateToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate API token: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// authenticate requires "Authorization: Bearer <token>" on everything but
+// the health check and metrics, and logs each request.
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" && r.URL.Path != "/metrics" {
+			token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.opts.Token)) != 1 {
+				writeError(w, http.StatusUnauthorized, fmt.Errorf("missing or invalid bearer token"))
+				return
+			}
+		}
+		log.Printf("%s %s", r.Method, r.URL.RequestURI())
+		next.ServeHTTP(w, r)
+	})
+}
+
+// namespaceParam and storageClassParam read the common query parameters.
+func namespaceParam(r *http.Request) string {
+	if ns := r.URL.Query().Get("namespace"); ns != "" {
+		return ns
+	}
+	return "default"
+}
+
+func (s *Server) storageClassParam(r *http.Request) string {
+	if sc := r.URL.Query().Get("storageClass"); sc != "" {
+		return sc
+	}
+	return s.opts.StorageClass
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func (s *Server) handleListVolumes(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	volumes, err := s.vm.Volumes(ctx)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, fmt.Errorf("failed to list Longhorn volumes: %w", err))
+		return
+	}
+
+	result := make([]apiVolume, 0, len(volumes))
+	for _, v := range volumes {
+		result = append(result, apiVolume{Name: v.Name, State: v.State, Size: v.Size, PVName: v.PVName})
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// handleContents returns the recursive file listing as JSON.
+func (s *Server) handleContents(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	namespace := namespaceParam(r)
+	volumeName, err := s.vm.ResolveVolume(ctx, r.PathValue("name"), namespace)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+
+	entries, err := s.vm.VolumeContents(ctx, volumeName, namespace, s.storageClassParam(r))
+	if err != nil {
+		writeError(w, http.StatusBadGateway, fmt.Errorf("failed to list contents: %w", err))
+		return
+	}
+	if entries == nil {
+		entries = []FileEntry{}
+	}
+	writeJSON(w, http.StatusOK, entries)
+}
+
+// handleDownload streams the volume archive as the response body.
+func (s *Server) handleDownload(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	namespace := namespaceParam(r)
+	volumeName, err := s.vm.ResolveVolume(ctx, r.PathValue("name"), namespace)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+
+	algo := r.URL.Query().Get("compress")
+	if algo == "" {
+		algo = CompressGzip
+	}
+	level := 0
+	if l := r.URL.Query().Get("level"); l != "" {
+		level, err = strconv.Atoi(l)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid level %q", l))
+			return
+		}
+	}
+	if err := validateCompression(algo, level); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	release, err := s.vm.acquireVolumeLock(ctx, volumeName)
+	if err != nil {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	defer release()
+
+	defer s.vm.CleanupVolumeResources(context.WithoutCancel(ctx), volumeName, namespace)
+	targetPod, mountPath, containerName, err := s.vm.getVolumeInfoWith(ctx, volumeName, namespace, s.storageClassParam(r), s.vm.withCompressImage(algo))
+	if err != nil {
+		writeError(w, http.StatusBadGateway, fmt.Errorf("failed to get volume info: %w", err))
+		return
+	}
+	if s.vm.Sparse {
+		if err := s.vm.requireGNUTar(ctx, namespace, targetPod, containerName); err != nil {
+			writeError(w, http.StatusBadGateway, err)
+			return
+		}
+	}
+	podAlgo := s.vm.podCompression(ctx, namespace, targetPod, containerName, algo)
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", volumeName+CompressionExtension(algo)))
+
+	var out io.Writer = flushWriter{w}
+	var compressor io.WriteCloser
+	if podAlgo != algo {
+		compressor, err = newLocalCompressor(algo, level, out)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		out = compressor
+	}
+
+	err = observeOperation("download", func() error {
+		err := s.vm.execInPodWithOutput(ctx, namespace, targetPod, containerName,
+			[]string{"sh", "-c", podArchiveCommand(podAlgo, level, mountPath, s.vm.Sparse, 0)}, out)
+		if err == nil && compressor != nil {
+			err = compressor.Close()
+		}
+		return err
+	})
+	s.vm.recordOperationResult(ctx, volumeName, "Downloaded", "DownloadFailed", fmt.Sprintf("download to API client %s", r.RemoteAddr), err)
+	if err != nil {
+		// The client sees a truncated body; there is no way to signal
+		// failure once streaming has started
+		log.Printf("Download of %s failed: %v", volumeName, err)
+	}
+}
+
+// handleCopy runs a copy synchronously and reports the result.
+func (s *Server) handleCopy(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var req copyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return
+	}
+	if req.Source == "" || req.Destination == "" {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("source and destination are required"))
+		return
+	}
+
+	namespace := namespaceParam(r)
+	storageClass := s.storageClassParam(r)
+
+	var err error
+	for _, v := range []*string{&req.Source, &req.Destination} {
+		if *v, err = s.vm.ResolveVolume(ctx, *v, namespace); err != nil {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+	}
+
+	if req.InCluster {
+		err = s.vm.CopyVolumeInCluster(ctx, req.Source, req.Destination, namespace, storageClass)
+	} else {
+		err = s.vm.CopyVolume(ctx, req.Source, req.Destination, namespace, storageClass)
+	}
+
+	if err != nil {
+		writeError(w, http.StatusBadGateway, fmt.Errorf("copy failed: %w", err))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "completed"})
+}
+
+// handleCleanup deletes the temporary resources of one volume without the
+// interactive prompt. It holds the volume's lock, so resources that a
+// running operation still uses are left alone.
+func (s *Server) handleCleanup(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	namespace := namespaceParam(r)
+	volumeName, err := s.vm.ResolveVolume(ctx, r.PathValue("name"), namespace)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+
+	release, err := s.vm.acquireVolumeLock(ctx, volumeName)
+	if err != nil {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	defer release()
+
+	res, err := s.vm.FindTemporaryResources(ctx, namespace)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+	res = res.ForVolumes([]string{volumeName})
+
+	resp := cleanupResponse{Pods: []string{}, PVCs: []string{}, PVs: []string{}}
+	for _, pod := range res.Pods {
+		resp.Pods = append(resp.Pods, pod.Name)
+	}
+	for _, pvc := range res.PVCs {
+		resp.PVCs = append(resp.PVCs, pvc.Name)
+	}
+	for _, pv := range res.PVs {
+		resp.PVs = append(resp.PVs, pv.Name)
+	}
+	resp.Failed = s.vm.DeleteTemporaryResources(ctx, namespace, res)
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// flushWriter flushes after every write so streamed responses reach the
+// client as they are produced.
+type flushWriter struct {
+	w http.ResponseWriter
+}
+
+func (f flushWriter) Write(p []byte) (int, error) {
+	n, err := f.w.Write(p)
+	if flusher, ok := f.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return n, err
+}
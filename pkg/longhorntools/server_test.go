@@ -0,0 +1,96 @@
+package longhorntools
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestAuthenticate(t *testing.T) {
+	s := NewServer(nil, ServerOptions{Token: "secret"})
+	handler := s.authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		path          string
+		authorization string
+		want          int
+	}{
+		{"/api/v1/volumes", "Bearer secret", http.StatusNoContent},
+		{"/api/v1/volumes", "", http.StatusUnauthorized},
+		{"/api/v1/volumes", "secret", http.StatusUnauthorized},
+		{"/api/v1/volumes", "Basic secret", http.StatusUnauthorized},
+		{"/api/v1/volumes", "Bearer wrong", http.StatusUnauthorized},
+		{"/api/v1/volumes", "bearer secret", http.StatusUnauthorized},
+		{"/healthz", "", http.StatusNoContent},
+		{"/metrics", "", http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		if tt.authorization != "" {
+			r.Header.Set("Authorization", tt.authorization)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != tt.want {
+			t.Errorf("%s with %q: status %d, want %d", tt.path, tt.authorization, w.Code, tt.want)
+		}
+	}
+}
+
+func TestHandleCleanup(t *testing.T) {
+	temp := func(name string) metav1.ObjectMeta {
+		return metav1.ObjectMeta{Name: name, Namespace: "default", Labels: map[string]string{"app": "lhc-temp"}}
+	}
+	vm := newFakeVolumeManager(
+		[]*unstructured.Unstructured{
+			newFakeVolume("vol-a", "attached", "", ""),
+			newFakeVolume("vol-b", "attached", "", ""),
+		},
+		&corev1.Pod{ObjectMeta: temp("lhc-temp-pod-vol-a")},
+		&corev1.Pod{ObjectMeta: temp("lhc-temp-pod-vol-b")},
+		&corev1.PersistentVolumeClaim{ObjectMeta: temp("lhc-temp-pvc-vol-a")},
+		&corev1.PersistentVolumeClaim{ObjectMeta: temp("lhc-temp-pvc-vol-b")},
+		heldLease("vol-b"),
+	)
+	s := NewServer(vm, ServerOptions{})
+
+	cleanup := func(volume string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/api/v1/volumes/"+volume+"/cleanup", nil)
+		r.SetPathValue("name", volume)
+		w := httptest.NewRecorder()
+		s.handleCleanup(w, r)
+		return w
+	}
+
+	w := cleanup("vol-a")
+	if w.Code != http.StatusOK {
+		t.Fatalf("cleanup of vol-a: status %d: %s", w.Code, w.Body)
+	}
+	var resp cleanupResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Pods) != 1 || resp.Pods[0] != "lhc-temp-pod-vol-a" || len(resp.PVCs) != 1 || resp.PVCs[0] != "lhc-temp-pvc-vol-a" {
+		t.Errorf("cleanup of vol-a removed %+v", resp)
+	}
+	pods := vm.clientset.CoreV1().Pods("default")
+	if _, err := pods.Get(context.Background(), "lhc-temp-pod-vol-b", metav1.GetOptions{}); err != nil {
+		t.Errorf("cleanup of vol-a removed the pod of vol-b: %v", err)
+	}
+
+	// vol-b is locked by a running operation
+	if w := cleanup("vol-b"); w.Code != http.StatusConflict {
+		t.Errorf("cleanup of locked vol-b: status %d, want %d", w.Code, http.StatusConflict)
+	}
+	if _, err := pods.Get(context.Background(), "lhc-temp-pod-vol-b", metav1.GetOptions{}); err != nil {
+		t.Errorf("cleanup removed the pod of locked vol-b: %v", err)
+	}
+}
@@ -0,0 +1,128 @@
+package longhorntools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// MaxReplicas is the largest replica count Longhorn accepts.
+const MaxReplicas = 20
+
+// defaultRebuildTimeout bounds the wait for replicas to rebuild when
+// --wait-timeout is not set. Rebuilding copies the whole volume, so it is
+// generous.
+const defaultRebuildTimeout = time.Hour
+
+// rebuildPollInterval is how often SetReplicas checks rebuild progress.
+const rebuildPollInterval = 2 * time.Second
+
+// SetReplicas changes the number of replicas Longhorn keeps for volumeName.
+// With wait, it then follows the rebuild of new replicas, or the removal of
+// surplus ones, until exactly count healthy replicas remain. Detached
+// volumes are only rebuilt once attached, so they are not waited for.
+func (vm *VolumeManager) SetReplicas(ctx context.Context, volumeName string, count int64, wait bool) error {
+	if count < 1 || count > MaxReplicas {
+		return fmt.Errorf("replica count must be between 1 and %d, got %d", MaxReplicas, count)
+	}
+	return vm.withVolumeLocks(ctx, []string{volumeName}, func() error {
+		err := vm.setReplicas(ctx, volumeName, count, wait)
+		vm.recordOperationResult(ctx, volumeName, "ReplicasChanged", "ReplicasChangeFailed", fmt.Sprintf("replica count change to %d", count), err)
+		return err
+	})
+}
+
+func (vm *VolumeManager) setReplicas(ctx context.Context, volumeName string, count int64, wait bool) error {
+	volume, err := vm.Volume(ctx, volumeName)
+	if err != nil {
+		return err
+	}
+
+	if volume.Replicas == count {
+		vm.printf("Volume %s already has %d replicas\n", volumeName, count)
+	} else if vm.DryRun {
+		vm.dryRunf("patch volume longhorn-system/%s numberOfReplicas from %d to %d", volumeName, volume.Replicas, count)
+		return nil
+	} else {
+		patch, _ := json.Marshal(map[string]interface{}{
+			"spec": map[string]interface{}{
+				"numberOfReplicas": count,
+			},
+		})
+		vm.printf("Changing replicas of volume %s from %d to %d...\n", volumeName, volume.Replicas, count)
+		_, err := vm.dynamicClient.Resource(longhornVolumeGVR).Namespace("longhorn-system").Patch(ctx, volumeName, types.MergePatchType, patch, metav1.PatchOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to patch volume %s: %w", volumeName, err)
+		}
+	}
+
+	if !wait || vm.DryRun {
+		return nil
+	}
+	if volume.State != "attached" {
+		vm.printf("Volume %s is %s; Longhorn adjusts its replicas when it is next attached\n", volumeName, volume.State)
+		return nil
+	}
+	return vm.waitForReplicas(ctx, volumeName, count)
+}
+
+// waitForReplicas polls the volume's replicas until count of them are
+// healthy and none is rebuilding, printing progress as it changes.
+func (vm *VolumeManager) waitForReplicas(ctx context.Context, volumeName string, count int64) error {
+	timeout := vm.waitTimeoutOr(defaultRebuildTimeout)
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	vm.printf("Waiting for volume %s to have %d healthy replicas...\n", volumeName, count)
+	ticker := time.NewTicker(rebuildPollInterval)
+	defer ticker.Stop()
+	last := ""
+	for {
+		replicas, err := vm.VolumeReplicas(waitCtx, volumeName)
+		if err != nil && waitCtx.Err() == nil {
+			return err
+		}
+
+		var healthy int64
+		var rebuilding []string
+		for _, r := range replicas {
+			if r.Rebuilding {
+				progress := "pending"
+				if r.RebuildProgress > 0 {
+					progress = fmt.Sprintf("%d%%", r.RebuildProgress)
+				}
+				rebuilding = append(rebuilding, fmt.Sprintf("%s %s", r.Name, progress))
+			} else if r.Healthy() {
+				healthy++
+			}
+		}
+		sort.Strings(rebuilding)
+		status := fmt.Sprintf("%d/%d replicas healthy", healthy, count)
+		if len(rebuilding) > 0 {
+			status += ", rebuilding " + strings.Join(rebuilding, ", ")
+		}
+		if status != last {
+			vm.printf("  %s\n", status)
+			last = status
+		}
+		if healthy == count && len(rebuilding) == 0 {
+			return nil
+		}
+
+		select {
+		case <-waitCtx.Done():
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("volume %s did not reach %d healthy replicas within %s (%s; use --wait-timeout to wait longer)",
+				volumeName, count, timeout, last)
+		case <-ticker.C:
+		}
+	}
+}
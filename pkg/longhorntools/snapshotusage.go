@@ -0,0 +1,185 @@
+package longhorntools
+
+import (
+	"context"
+	"sort"
+	"strconv"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// volumeHead is the child name Longhorn gives the live data of a volume in
+// its newest snapshot's status.
+const volumeHead = "volume-head"
+
+// SnapshotUsage is the disk space one snapshot of a volume takes.
+type SnapshotUsage struct {
+	Snapshot
+	// Cumulative is Size plus the sizes of every snapshot listed before
+	// this one.
+	Cumulative int64 `json:"cumulative"`
+	// Depth counts the branches between the snapshot and the volume's
+	// oldest snapshot; reverting to a snapshot starts a branch.
+	Depth int `json:"depth"`
+	// Removed snapshots have been deleted, but their data stays on disk
+	// until Longhorn purges the volume's snapshots.
+	Removed bool `json:"removed"`
+	// Live is true for the snapshots the volume's current data is built
+	// on, and Stale for those a revert left behind. Both are false when
+	// Longhorn does not report which snapshot the live data follows.
+	Live  bool `json:"live"`
+	Stale bool `json:"stale"`
+}
+
+// VolumeSnapshotUsage is the result of SnapshotUsage. Sizes are in bytes,
+// per replica.
+type VolumeSnapshotUsage struct {
+	Volume string `json:"volume"`
+	// Size is the volume's size, and ActualSize the space its snapshots
+	// and live data take.
+	Size       int64 `json:"size"`
+	ActualSize int64 `json:"actualSize"`
+	// Snapshots walks the snapshot chain from the oldest snapshot, each
+	// followed by its children, oldest first.
+	Snapshots []SnapshotUsage `json:"snapshots"`
+	// Total is the space all snapshots take. Removed, Stale, and System
+	// are the shares of removed, not live, and system-created snapshots,
+	// each counted in the first of these that applies.
+	Total   int64 `json:"total"`
+	Removed int64 `json:"removed"`
+	System  int64 `json:"system"`
+	Stale   int64 `json:"stale"`
+}
+
+// SnapshotPercent returns Total as a percentage of ActualSize.
+func (u *VolumeSnapshotUsage) SnapshotPercent() float64 {
+	if u.ActualSize <= 0 {
+		return 0
+	}
+	return float64(u.Total) * 100 / float64(u.ActualSize)
+}
+
+// SnapshotUsage walks the snapshot chain of volumeName from Longhorn's
+// Snapshot resources and reports the space each snapshot takes, alone and
+// cumulatively.
+func (vm *VolumeManager) SnapshotUsage(ctx context.Context, volumeName string) (*VolumeSnapshotUsage, error) {
+	volume, err := vm.Volume(ctx, volumeName)
+	if err != nil {
+		return nil, err
+	}
+	items, err := vm.volumeResources(ctx, longhornSnapshotGVR, volumeName)
+	if err != nil {
+		return nil, err
+	}
+	return snapshotUsage(volume, items), nil
+}
+
+// AllSnapshotUsage reports SnapshotUsage for every volume, the volumes
+// whose snapshots take the most space first.
+func (vm *VolumeManager) AllSnapshotUsage(ctx context.Context) ([]VolumeSnapshotUsage, error) {
+	volumes, err := vm.Volumes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	items, err := vm.volumeResources(ctx, longhornSnapshotGVR, "")
+	if err != nil {
+		return nil, err
+	}
+	byVolume := make(map[string][]unstructured.Unstructured)
+	for _, item := range items {
+		volume := item.GetLabels()["longhornvolume"]
+		byVolume[volume] = append(byVolume[volume], item)
+	}
+
+	usage := make([]VolumeSnapshotUsage, 0, len(volumes))
+	for i := range volumes {
+		usage = append(usage, *snapshotUsage(&volumes[i], byVolume[volumes[i].Name]))
+	}
+	sort.SliceStable(usage, func(i, j int) bool {
+		if usage[i].Total != usage[j].Total {
+			return usage[i].Total > usage[j].Total
+		}
+		return usage[i].Volume < usage[j].Volume
+	})
+	return usage, nil
+}
+
+func snapshotUsage(volume *LonghornVolume, items []unstructured.Unstructured) *VolumeSnapshotUsage {
+	size, _ := strconv.ParseInt(volume.Size, 10, 64)
+	u := &VolumeSnapshotUsage{Volume: volume.Name, Size: size, ActualSize: volume.ActualSize}
+
+	snapshots := make(map[string]*SnapshotUsage, len(items))
+	children := make(map[string][]*SnapshotUsage)
+	head := ""
+	for _, item := range items {
+		s := &SnapshotUsage{Snapshot: parseSnapshot(&item)}
+		s.Removed, _, _ = unstructured.NestedBool(item.Object, "status", "markRemoved")
+		if kids, _, _ := unstructured.NestedMap(item.Object, "status", "children"); kids[volumeHead] != nil {
+			head = s.Name
+		}
+		snapshots[s.Name] = s
+	}
+	var roots []*SnapshotUsage
+	for _, s := range snapshots {
+		if snapshots[s.Parent] == nil {
+			roots = append(roots, s)
+		} else {
+			children[s.Parent] = append(children[s.Parent], s)
+		}
+	}
+
+	// Everything from the volume head back to the root is live
+	for name := head; snapshots[name] != nil && !snapshots[name].Live; name = snapshots[name].Parent {
+		snapshots[name].Live = true
+	}
+
+	byCreation := func(list []*SnapshotUsage) {
+		sort.Slice(list, func(i, j int) bool {
+			if list[i].Created != list[j].Created {
+				return list[i].Created < list[j].Created
+			}
+			return list[i].Name < list[j].Name
+		})
+	}
+	var walk func(s *SnapshotUsage, depth int)
+	walk = func(s *SnapshotUsage, depth int) {
+		s.Depth = depth
+		s.Stale = head != "" && !s.Live
+		u.Total += s.Size
+		s.Cumulative = u.Total
+		switch {
+		case s.Removed:
+			u.Removed += s.Size
+		case s.Stale:
+			u.Stale += s.Size
+		case !s.UserCreated:
+			u.System += s.Size
+		}
+		u.Snapshots = append(u.Snapshots, *s)
+
+		// The live child, or else the oldest, continues the chain; the
+		// others start branches
+		kids := children[s.Name]
+		byCreation(kids)
+		next := 0
+		for i, kid := range kids {
+			if kid.Live {
+				next = i
+			}
+		}
+		for i, kid := range kids {
+			if i == next {
+				continue
+			}
+			walk(kid, depth+1)
+		}
+		if len(kids) > 0 {
+			walk(kids[next], depth)
+		}
+	}
+	byCreation(roots)
+	for _, root := range roots {
+		walk(root, 0)
+	}
+	return u
+}
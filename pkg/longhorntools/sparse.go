@@ -0,0 +1,111 @@
+package longhorntools
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// tarCreateArgs returns the tar invocation that archives to stdout. With
+// sparse, holes in sparse files are recorded instead of stored as zeros,
+// which needs GNU tar; extracting such an archive with GNU tar recreates
+// the holes without further flags.
+func tarCreateArgs(sparse bool) []string {
+	if sparse {
+		return []string{"tar", "--sparse", "-cf", "-"}
+	}
+	return []string{"tar", "-cf", "-"}
+}
+
+// requireGNUTar fails unless the container's tar is GNU tar, which is the
+// only one that reads and writes sparse archives. BusyBox tar, as in the
+// default temporary image, does not.
+func (vm *VolumeManager) requireGNUTar(ctx context.Context, namespace, podName, containerName string) error {
+	if vm.DryRun {
+		return nil
+	}
+	var out bytes.Buffer
+	err := vm.streamExec(ctx, namespace, podName, containerName, []string{"tar", "--version"}, nil, &out)
+	if err != nil || !strings.Contains(out.String(), "GNU tar") {
+		return fmt.Errorf("sparse transfers need GNU tar, but pod %s does not have it; use --temp-image with an image that does (e.g. debian:stable-slim)", podName)
+	}
+	return nil
+}
+
+// sparseStreamCopy copies like streamCopyBetweenPods with GNU tar's
+// --sparse on both ends, then reports the logical size of the data against
+// the bytes streamed, which are also counted in streamed if not nil, and
+// the space it takes on either side.
+func (vm *VolumeManager) sparseStreamCopy(ctx context.Context, namespace, sourcePod, sourceContainer, sourcePath, destPod, destContainer, destPath string, streamed *atomic.Int64) error {
+	if err := vm.requireGNUTar(ctx, namespace, sourcePod, sourceContainer); err != nil {
+		return err
+	}
+	if err := vm.requireGNUTar(ctx, namespace, destPod, destContainer); err != nil {
+		return err
+	}
+
+	if streamed == nil {
+		streamed = new(atomic.Int64)
+	}
+	if err := vm.tarStreamCopy(ctx, namespace, sourcePod, sourceContainer, sourcePath, destPod, destContainer, destPath, streamed); err != nil {
+		return err
+	}
+	if vm.DryRun {
+		return nil
+	}
+
+	logical, sourceUsed, err := vm.diskUsage(ctx, namespace, sourcePod, sourceContainer, sourcePath)
+	if err != nil {
+		vm.printf("Warning: cannot measure the source's disk usage: %v\n", err)
+		return nil
+	}
+	_, destUsed, err := vm.diskUsage(ctx, namespace, destPod, destContainer, destPath)
+	if err != nil {
+		vm.printf("Warning: cannot measure the destination's disk usage: %v\n", err)
+		return nil
+	}
+	vm.printf("Sparse copy: %d bytes logical, %d bytes streamed, %d bytes on disk at the source, %d bytes at the destination\n",
+		logical, streamed.Load(), sourceUsed, destUsed)
+	return nil
+}
+
+// diskUsage returns the apparent size of everything under path, holes
+// included, and the space it actually occupies, both in bytes. It needs
+// GNU du, which comes with GNU tar in most images.
+func (vm *VolumeManager) diskUsage(ctx context.Context, namespace, podName, containerName, path string) (apparent, used int64, err error) {
+	var out bytes.Buffer
+	script := fmt.Sprintf("du -s -B1 --apparent-size %s | cut -f1; du -s -B1 %s | cut -f1", shellQuote(path), shellQuote(path))
+	if err := vm.streamExec(ctx, namespace, podName, containerName, []string{"sh", "-c", script}, nil, &out); err != nil {
+		return 0, 0, err
+	}
+	fields := strings.Fields(out.String())
+	if len(fields) != 2 {
+		return 0, 0, fmt.Errorf("unexpected du output %q", out.String())
+	}
+	if apparent, err = strconv.ParseInt(fields[0], 10, 64); err != nil {
+		return 0, 0, fmt.Errorf("unexpected du output %q", out.String())
+	}
+	if used, err = strconv.ParseInt(fields[1], 10, 64); err != nil {
+		return 0, 0, fmt.Errorf("unexpected du output %q", out.String())
+	}
+	return apparent, used, nil
+}
+
+// countWriter adds the bytes written through it to n. A nil n counts
+// nothing.
+type countWriter struct {
+	w io.Writer
+	n *atomic.Int64
+}
+
+func (c countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	if c.n != nil {
+		c.n.Add(int64(n))
+	}
+	return n, err
+}
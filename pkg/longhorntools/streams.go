@@ -0,0 +1,166 @@
+package longhorntools
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// MaxCopyStreams bounds CopyStreams. Every stream holds two exec sessions
+// open through the API server.
+const MaxCopyStreams = 16
+
+// listTopLevelScript prints "<KiB>\t<name>\0" for every entry directly
+// under the current directory, hidden ones included.
+const listTopLevelScript = `for f in .[!.]* ..?* *; do
+  [ -e "$f" ] || [ -L "$f" ] || continue
+  printf '%s\t%s\0' "$(du -sk -- "$f" | cut -f1)" "$f"
+done`
+
+// topLevelEntry is a file or directory directly under a volume's root.
+type topLevelEntry struct {
+	name string
+	kib  int64
+}
+
+// parallelStreamCopy copies sourcePath to destPath like
+// streamCopyBetweenPods, but over up to streams tar pipes at once. The
+// entries under sourcePath are split into buckets of about equal size,
+// largest first, and each bucket is streamed by its own pair of tar
+// processes, all extracting into destPath. A tree with fewer top-level
+// entries than streams uses fewer; one that cannot be split, such as a
+// single large directory, falls back to one stream.
+func (vm *VolumeManager) parallelStreamCopy(ctx context.Context, namespace, sourcePod, sourceContainer, sourcePath, destPod, destContainer, destPath string, streams int, streamed *atomic.Int64) error {
+	entries, err := vm.listTopLevel(ctx, namespace, sourcePod, sourceContainer, sourcePath)
+	if err != nil {
+		vm.printf("Warning: cannot partition %s, copying with one stream: %v\n", sourcePath, err)
+		return vm.singleStreamCopy(ctx, namespace, sourcePod, sourceContainer, sourcePath, destPod, destContainer, destPath, streamed)
+	}
+	buckets := partitionEntries(entries, streams)
+	if len(buckets) < 2 {
+		return vm.singleStreamCopy(ctx, namespace, sourcePod, sourceContainer, sourcePath, destPod, destContainer, destPath, streamed)
+	}
+
+	vm.printf("Copying %d top-level entries over %d streams\n", len(entries), len(buckets))
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	for i, bucket := range buckets {
+		wg.Add(1)
+		go func(i int, names []string) {
+			defer wg.Done()
+			if err := vm.copyBucket(ctx, namespace, sourcePod, sourceContainer, sourcePath, destPod, destContainer, destPath, names, streamed); err != nil {
+				errOnce.Do(func() {
+					firstErr = fmt.Errorf("stream %d: %w", i+1, err)
+					cancel()
+				})
+			}
+		}(i, bucket)
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return fmt.Errorf("stream copy failed: %w", firstErr)
+	}
+	return nil
+}
+
+// copyBucket streams the named entries of sourcePath into destPath over one
+// tar pipe, verified like a single-stream copy. The names go to tar on
+// stdin, so no argument list limit applies.
+func (vm *VolumeManager) copyBucket(ctx context.Context, namespace, sourcePod, sourceContainer, sourcePath, destPod, destContainer, destPath string, names []string, streamed *atomic.Int64) error {
+	var list bytes.Buffer
+	for _, name := range names {
+		// A leading "./" keeps names starting with "-" from being read as
+		// options
+		list.WriteString("./" + name + "\n")
+	}
+
+	reader, writer := io.Pipe()
+	errChan := make(chan error, 2)
+	sent := sha256.New()
+	go func() {
+		err := vm.streamExec(ctx, namespace, sourcePod, sourceContainer,
+			append(tarCreateArgs(vm.Sparse), "-C", sourcePath, "-T", "-"), &list,
+			countingWriter{w: countWriter{w: io.MultiWriter(sent, writer), n: streamed}, counter: bytesTransferred.WithLabelValues("from_pod")})
+		writer.CloseWithError(err)
+		errChan <- err
+	}()
+	go func() {
+		err := vm.extractVerified(ctx, namespace, destPod, destContainer, destPath, reader, sent)
+		if err != nil {
+			reader.CloseWithError(err)
+		}
+		errChan <- err
+	}()
+	for i := 0; i < 2; i++ {
+		if err := <-errChan; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// listTopLevel lists the entries directly under path with their disk usage.
+func (vm *VolumeManager) listTopLevel(ctx context.Context, namespace, podName, containerName, path string) ([]topLevelEntry, error) {
+	var out bytes.Buffer
+	err := vm.streamExec(ctx, namespace, podName, containerName,
+		[]string{"sh", "-c", "cd " + shellQuote(path) + " && " + listTopLevelScript}, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	var entries []topLevelEntry
+	for _, record := range strings.Split(out.String(), "\x00") {
+		if record == "" {
+			continue
+		}
+		size, name, ok := strings.Cut(record, "\t")
+		if !ok {
+			return nil, fmt.Errorf("unexpected listing %q", record)
+		}
+		// tar -T reads one name per line
+		if strings.Contains(name, "\n") {
+			return nil, fmt.Errorf("entry %q contains a newline", name)
+		}
+		kib, _ := strconv.ParseInt(size, 10, 64)
+		entries = append(entries, topLevelEntry{name: name, kib: kib})
+	}
+	return entries, nil
+}
+
+// partitionEntries spreads entries over at most n buckets of about equal
+// total size by placing each, largest first, in the emptiest bucket.
+func partitionEntries(entries []topLevelEntry, n int) [][]string {
+	if n > len(entries) {
+		n = len(entries)
+	}
+	if n < 1 {
+		return nil
+	}
+	sorted := append([]topLevelEntry(nil), entries...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].kib > sorted[j].kib })
+
+	buckets := make([][]string, n)
+	sizes := make([]int64, n)
+	for _, e := range sorted {
+		smallest := 0
+		for i := range sizes {
+			if sizes[i] < sizes[smallest] {
+				smallest = i
+			}
+		}
+		buckets[smallest] = append(buckets[smallest], e.name)
+		sizes[smallest] += e.kib
+	}
+	return buckets
+}
@@ -0,0 +1,36 @@
+package longhorntools
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPartitionEntries(t *testing.T) {
+	entries := []topLevelEntry{
+		{name: "small", kib: 1},
+		{name: "large", kib: 100},
+		{name: "medium", kib: 60},
+		{name: "medium2", kib: 50},
+	}
+
+	tests := []struct {
+		n    int
+		want [][]string
+	}{
+		{n: 0, want: nil},
+		{n: 1, want: [][]string{{"large", "medium", "medium2", "small"}}},
+		{n: 2, want: [][]string{{"large", "small"}, {"medium", "medium2"}}},
+		{n: 3, want: [][]string{{"large"}, {"medium"}, {"medium2", "small"}}},
+		// More buckets than entries leaves none empty
+		{n: 8, want: [][]string{{"large"}, {"medium"}, {"medium2"}, {"small"}}},
+	}
+	for _, tt := range tests {
+		if got := partitionEntries(entries, tt.n); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("partitionEntries(n=%d) = %v, want %v", tt.n, got, tt.want)
+		}
+	}
+
+	if got := partitionEntries(nil, 4); got != nil {
+		t.Errorf("partitionEntries(nil) = %v, want nil", got)
+	}
+}
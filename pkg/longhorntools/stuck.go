@@ -0,0 +1,250 @@
+package longhorntools
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// StuckVolume is a volume that pods are waiting for but that is not
+// attached where they run, or that is stuck attaching or detaching.
+type StuckVolume struct {
+	Volume LonghornVolume `json:"volume"`
+	// PVC is the namespace/name of the volume's claim, if it has one.
+	PVC string `json:"pvc,omitempty"`
+	// Waiting are the pods that mount the PVC and are not running.
+	Waiting []VolumeConsumer `json:"waiting,omitempty"`
+	// Reasons collects what Longhorn's volume conditions, the PV's
+	// VolumeAttachments, and the waiting pods' events say is wrong.
+	Reasons []string `json:"reasons,omitempty"`
+	// StaleAttachments are VolumeAttachments of the PV to nodes that are
+	// gone or not ready, which keep it from attaching elsewhere.
+	StaleAttachments []string `json:"staleAttachments,omitempty"`
+}
+
+// podEventReasons are the pod events that explain a volume that does not
+// attach or mount.
+var podEventReasons = map[string]bool{
+	"FailedAttachVolume": true,
+	"FailedMount":        true,
+	"FailedScheduling":   true,
+}
+
+// StuckVolumes finds volumes that are attaching or detaching, detached
+// while pods wait for them, or attached to another node than the one a
+// waiting pod was scheduled to, as happens after a node failure.
+func (vm *VolumeManager) StuckVolumes(ctx context.Context) ([]StuckVolume, error) {
+	volumes, err := vm.Volumes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	conditions, err := vm.volumeConditionProblems(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	nodeReady := make(map[string]bool)
+	nodes, err := vm.clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %w", err)
+	}
+	for _, node := range nodes.Items {
+		for _, c := range node.Status.Conditions {
+			if c.Type == corev1.NodeReady {
+				nodeReady[node.Name] = c.Status == corev1.ConditionTrue
+			}
+		}
+	}
+	attachments := make(map[string][]storagev1.VolumeAttachment)
+	if list, err := vm.clientset.StorageV1().VolumeAttachments().List(ctx, metav1.ListOptions{}); err == nil {
+		for _, va := range list.Items {
+			if pv := va.Spec.Source.PersistentVolumeName; pv != nil {
+				attachments[*pv] = append(attachments[*pv], va)
+			}
+		}
+	}
+
+	var stuck []StuckVolume
+	for _, volume := range volumes {
+		s := StuckVolume{Volume: volume}
+		if volume.PVCName != "" {
+			pvc, consumers, err := vm.VolumeConsumers(ctx, volume.Name)
+			if err != nil {
+				return nil, err
+			}
+			s.PVC = pvc
+			for _, c := range consumers {
+				if c.Phase != string(corev1.PodRunning) && c.Phase != string(corev1.PodSucceeded) && c.Phase != string(corev1.PodFailed) {
+					s.Waiting = append(s.Waiting, c)
+				}
+			}
+		}
+
+		switch {
+		case volume.State == "attaching" || volume.State == "detaching":
+			s.Reasons = append(s.Reasons, "volume is "+volume.State)
+		case volume.State == "detached" && len(s.Waiting) > 0:
+			s.Reasons = append(s.Reasons, fmt.Sprintf("detached while %d pod(s) wait for it", len(s.Waiting)))
+		case volume.State == "attached" && len(s.Waiting) > 0:
+			for _, c := range s.Waiting {
+				if c.Node != "" && c.Node != volume.NodeID {
+					s.Reasons = append(s.Reasons, fmt.Sprintf("attached to %s, but pod %s is scheduled to %s", volume.NodeID, c.Pod, c.Node))
+				}
+			}
+		}
+		if len(s.Reasons) == 0 {
+			continue
+		}
+		s.Reasons = append(s.Reasons, conditions[volume.Name]...)
+
+		for _, va := range attachments[volume.PVName] {
+			node := va.Spec.NodeName
+			if ready, known := nodeReady[node]; !known || !ready {
+				s.StaleAttachments = append(s.StaleAttachments, va.Name)
+				state := "not ready"
+				if !known {
+					state = "gone"
+				}
+				s.Reasons = append(s.Reasons, fmt.Sprintf("VolumeAttachment %s holds it on node %s, which is %s", va.Name, node, state))
+			}
+			if e := va.Status.AttachError; e != nil && e.Message != "" {
+				s.Reasons = append(s.Reasons, fmt.Sprintf("attach to %s failed: %s", node, e.Message))
+			}
+			if e := va.Status.DetachError; e != nil && e.Message != "" {
+				s.Reasons = append(s.Reasons, fmt.Sprintf("detach from %s failed: %s", node, e.Message))
+			}
+		}
+		stuck = append(stuck, s)
+	}
+
+	if err := vm.addPodEventReasons(ctx, stuck); err != nil {
+		return nil, err
+	}
+	sort.Slice(stuck, func(i, j int) bool { return stuck[i].Volume.Name < stuck[j].Volume.Name })
+	return stuck, nil
+}
+
+// volumeConditionProblems returns, by volume, the Longhorn volume
+// conditions that carry a message, as "<type>: <reason>: <message>".
+// Longhorn only sets one when something is wrong, such as replicas that
+// cannot be scheduled.
+func (vm *VolumeManager) volumeConditionProblems(ctx context.Context) (map[string][]string, error) {
+	list, err := vm.dynamicClient.Resource(longhornVolumeGVR).Namespace("longhorn-system").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list Longhorn volumes: %w", err)
+	}
+	problems := make(map[string][]string)
+	for _, item := range list.Items {
+		conditions, _, _ := unstructured.NestedSlice(item.Object, "status", "conditions")
+		for _, c := range conditions {
+			condition, ok := c.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			message, _ := condition["message"].(string)
+			if message == "" {
+				continue
+			}
+			problem := fmt.Sprint(condition["type"])
+			if reason, _ := condition["reason"].(string); reason != "" {
+				problem += ": " + reason
+			}
+			problems[item.GetName()] = append(problems[item.GetName()], problem+": "+message)
+		}
+	}
+	return problems, nil
+}
+
+// addPodEventReasons adds the latest attach, mount, or scheduling failure
+// of every waiting pod to its volume's reasons.
+func (vm *VolumeManager) addPodEventReasons(ctx context.Context, stuck []StuckVolume) error {
+	waiting := make(map[string]*StuckVolume)
+	for i := range stuck {
+		namespace, _, _ := strings.Cut(stuck[i].PVC, "/")
+		for _, c := range stuck[i].Waiting {
+			waiting[namespace+"/"+c.Pod] = &stuck[i]
+		}
+	}
+	if len(waiting) == 0 {
+		return nil
+	}
+
+	events, err := vm.clientset.CoreV1().Events(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list events: %w", err)
+	}
+	latest := make(map[string]corev1.Event)
+	for _, event := range events.Items {
+		ref := event.InvolvedObject
+		key := ref.Namespace + "/" + ref.Name
+		if ref.Kind != "Pod" || waiting[key] == nil || !podEventReasons[event.Reason] {
+			continue
+		}
+		if previous, ok := latest[key]; !ok || eventTime(event).After(eventTime(previous)) {
+			latest[key] = event
+		}
+	}
+	keys := make([]string, 0, len(latest))
+	for key := range latest {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		event := latest[key]
+		s := waiting[key]
+		s.Reasons = append(s.Reasons, fmt.Sprintf("pod %s: %s: %s", event.InvolvedObject.Name, event.Reason, event.Message))
+	}
+	return nil
+}
+
+// ReattachVolume gets a stuck volume attached where its pods run: it
+// deletes the VolumeAttachments that hold it on a failed node, so
+// Kubernetes can attach it elsewhere, and deletes the waiting pods that a
+// controller will recreate, so their volumes are attached and mounted
+// afresh. It returns what was done, and hints for what it leaves alone,
+// such as pods without a controller.
+func (vm *VolumeManager) ReattachVolume(ctx context.Context, stuck StuckVolume) (actions []string, err error) {
+	err = vm.withVolumeLocks(ctx, []string{stuck.Volume.Name}, func() error {
+		for _, name := range stuck.StaleAttachments {
+			if vm.DryRun {
+				vm.dryRunf("delete VolumeAttachment %s", name)
+				continue
+			}
+			err := vm.clientset.StorageV1().VolumeAttachments().Delete(ctx, name, metav1.DeleteOptions{})
+			if err != nil {
+				return fmt.Errorf("failed to delete VolumeAttachment %s: %w", name, err)
+			}
+			actions = append(actions, "deleted VolumeAttachment "+name)
+		}
+
+		namespace, _, _ := strings.Cut(stuck.PVC, "/")
+		for _, c := range stuck.Waiting {
+			if c.Workload.Kind == "Pod" {
+				actions = append(actions, fmt.Sprintf("hint: pod %s/%s has no controller; delete and recreate it yourself", namespace, c.Pod))
+				continue
+			}
+			if vm.DryRun {
+				vm.dryRunf("delete pod %s/%s for %s to recreate", namespace, c.Pod, c.Workload)
+				continue
+			}
+			err := vm.clientset.CoreV1().Pods(namespace).Delete(ctx, c.Pod, metav1.DeleteOptions{})
+			if err != nil {
+				return fmt.Errorf("failed to restart pod %s/%s: %w", namespace, c.Pod, err)
+			}
+			actions = append(actions, fmt.Sprintf("restarted pod %s/%s of %s", namespace, c.Pod, c.Workload))
+		}
+
+		if len(stuck.StaleAttachments) == 0 && len(stuck.Waiting) == 0 {
+			actions = append(actions, fmt.Sprintf("hint: no pod waits for %s; check the longhorn-manager logs and lhc events -v %s", stuck.Volume.Name, stuck.Volume.Name))
+		}
+		return nil
+	})
+	vm.recordOperationResult(ctx, stuck.Volume.Name, "Reattached", "ReattachFailed", "reattach", err)
+	return actions, err
+}
@@ -0,0 +1,100 @@
+package longhorntools
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestStuckVolumes(t *testing.T) {
+	attached := newFakeVolume("vol-a", "attached", "apps", "data")
+	unstructured.SetNestedField(attached.Object, "node-1", "status", "currentNodeID")
+	running := newFakeVolume("vol-c", "attached", "apps", "logs")
+	unstructured.SetNestedField(running.Object, "node-2", "status", "currentNodeID")
+
+	controller := true
+	waiting := claimPod("apps", "db-0", "data", corev1.PodPending)
+	waiting.Spec.NodeName = "node-2"
+	waiting.OwnerReferences = []metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "StatefulSet", Name: "db", UID: "1", Controller: &controller}}
+	logger := claimPod("apps", "logger-0", "logs", corev1.PodRunning)
+	logger.Spec.NodeName = "node-2"
+	pvName := "pv-vol-a"
+
+	vm := newFakeVolumeManager(
+		[]*unstructured.Unstructured{attached, newFakeVolume("vol-b", "detaching", "", ""), running},
+		waiting,
+		logger,
+		&corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: "node-1"},
+			Status:     corev1.NodeStatus{Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionUnknown}}},
+		},
+		&corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: "node-2"},
+			Status:     corev1.NodeStatus{Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionTrue}}},
+		},
+		&storagev1.VolumeAttachment{
+			ObjectMeta: metav1.ObjectMeta{Name: "csi-1234"},
+			Spec: storagev1.VolumeAttachmentSpec{
+				NodeName: "node-1",
+				Source:   storagev1.VolumeAttachmentSource{PersistentVolumeName: &pvName},
+			},
+		},
+		&corev1.Event{
+			ObjectMeta:     metav1.ObjectMeta{Namespace: "apps", Name: "db-0.1"},
+			InvolvedObject: corev1.ObjectReference{Kind: "Pod", Namespace: "apps", Name: "db-0"},
+			Reason:         "FailedAttachVolume",
+			Message:        "Multi-Attach error",
+		},
+	)
+
+	stuck, err := vm.StuckVolumes(context.Background())
+	if err != nil {
+		t.Fatalf("StuckVolumes: %v", err)
+	}
+	if len(stuck) != 2 || stuck[0].Volume.Name != "vol-a" || stuck[1].Volume.Name != "vol-b" {
+		t.Fatalf("StuckVolumes = %+v, want vol-a and vol-b", stuck)
+	}
+	wantReasons := []string{
+		"attached to node-1, but pod db-0 is scheduled to node-2",
+		"VolumeAttachment csi-1234 holds it on node node-1, which is not ready",
+		"pod db-0: FailedAttachVolume: Multi-Attach error",
+	}
+	if !reflect.DeepEqual(stuck[0].Reasons, wantReasons) {
+		t.Errorf("vol-a reasons = %q, want %q", stuck[0].Reasons, wantReasons)
+	}
+	if !reflect.DeepEqual(stuck[0].StaleAttachments, []string{"csi-1234"}) {
+		t.Errorf("vol-a stale attachments = %v, want [csi-1234]", stuck[0].StaleAttachments)
+	}
+	if !reflect.DeepEqual(stuck[1].Reasons, []string{"volume is detaching"}) {
+		t.Errorf("vol-b reasons = %q", stuck[1].Reasons)
+	}
+
+	actions, err := vm.ReattachVolume(context.Background(), stuck[0])
+	if err != nil {
+		t.Fatalf("ReattachVolume: %v", err)
+	}
+	wantActions := []string{"deleted VolumeAttachment csi-1234", "restarted pod apps/db-0 of apps/StatefulSet/db"}
+	if !reflect.DeepEqual(actions, wantActions) {
+		t.Errorf("ReattachVolume = %q, want %q", actions, wantActions)
+	}
+	if _, err := vm.clientset.CoreV1().Pods("apps").Get(context.Background(), "db-0", metav1.GetOptions{}); err == nil {
+		t.Error("pod db-0 was not restarted")
+	}
+
+	// A pod without a controller would not come back, so it is left alone
+	stuck[0].StaleAttachments = nil
+	stuck[0].Waiting[0].Workload = Workload{Namespace: "apps", Kind: "Pod", Name: "db-0"}
+	actions, err = vm.ReattachVolume(context.Background(), stuck[0])
+	if err != nil {
+		t.Fatalf("ReattachVolume: %v", err)
+	}
+	if len(actions) != 1 || !strings.HasPrefix(actions[0], "hint: pod apps/db-0 has no controller") {
+		t.Errorf("ReattachVolume of a bare pod = %q", actions)
+	}
+}
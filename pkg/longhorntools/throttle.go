@@ -0,0 +1,114 @@
+package longhorntools
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+const (
+	// DefaultQPS and DefaultBurst are the client-side rate limits for API
+	// requests, the same as kubectl's. client-go's own defaults of 5 and
+	// 10 throttle batch operations across many volumes.
+	DefaultQPS   = 50
+	DefaultBurst = 300
+
+	// throttleReportDelay is how long a request must wait for the
+	// client-side rate limiter before it is reported.
+	throttleReportDelay = time.Second
+	// throttleReportInterval limits throttling messages to one per
+	// interval for each side.
+	throttleReportInterval = 10 * time.Second
+)
+
+// throttleReporter prints a message when requests are throttled, by the
+// client-side rate limiter or by the API server, at most once per
+// throttleReportInterval and side, with the number of requests affected
+// since the last message.
+type throttleReporter struct {
+	vm *VolumeManager
+
+	mu       sync.Mutex
+	lastSent map[string]time.Time
+	pending  map[string]int
+}
+
+func newThrottleReporter(vm *VolumeManager) *throttleReporter {
+	return &throttleReporter{vm: vm, lastSent: map[string]time.Time{}, pending: map[string]int{}}
+}
+
+// report counts a throttled request on side ("client" or "server") and
+// prints msg if the last message for that side is old enough.
+func (t *throttleReporter) report(side string, msg string, args ...interface{}) {
+	apiThrottled.WithLabelValues(side).Inc()
+	t.mu.Lock()
+	t.pending[side]++
+	count := t.pending[side]
+	if time.Since(t.lastSent[side]) < throttleReportInterval {
+		t.mu.Unlock()
+		return
+	}
+	t.lastSent[side] = time.Now()
+	t.pending[side] = 0
+	t.mu.Unlock()
+
+	t.vm.printf(msg, args...)
+	if count > 1 {
+		t.vm.printf("  (%d requests throttled since the last message)\n", count)
+	}
+}
+
+// reportingRateLimiter is the client-side rate limiter of all API clients.
+// It reports requests that wait longer than throttleReportDelay, which
+// client-go only logs at a high verbosity.
+type reportingRateLimiter struct {
+	flowcontrol.RateLimiter
+	burst    int
+	reporter *throttleReporter
+}
+
+func (r *reportingRateLimiter) Wait(ctx context.Context) error {
+	start := time.Now()
+	err := r.RateLimiter.Wait(ctx)
+	if waited := time.Since(start); waited > throttleReportDelay {
+		r.reporter.report("client", "Client-side throttling: an API request waited %s (--qps %g, --burst %d)\n",
+			waited.Round(time.Millisecond), r.QPS(), r.burst)
+	}
+	return err
+}
+
+// applyRateLimits installs one rate limiter on config, shared by every
+// client built from it, that reports throttled requests. A zero QPS or
+// Burst uses DefaultQPS or DefaultBurst.
+func (vm *VolumeManager) applyRateLimits(config *rest.Config) {
+	if config.RateLimiter != nil {
+		return
+	}
+	qps, burst := config.QPS, config.Burst
+	if qps == 0 {
+		qps = DefaultQPS
+	}
+	if burst == 0 {
+		burst = DefaultBurst
+	}
+	config.RateLimiter = &reportingRateLimiter{
+		RateLimiter: flowcontrol.NewTokenBucketRateLimiter(qps, burst),
+		burst:       burst,
+		reporter:    vm.throttle,
+	}
+}
+
+// reportServerThrottling reports a 429 response with Retry-After, which
+// client-go retries on its own without a word. The retrying transport
+// reports the ones without it as it retries them.
+func (vm *VolumeManager) reportServerThrottling(req *http.Request, resp *http.Response) {
+	if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") == "" {
+		return
+	}
+	vm.throttle.report("server", "API server is throttling requests (%s %s: %s, retry after %ss)\n",
+		req.Method, req.URL.Path, resp.Status, resp.Header.Get("Retry-After"))
+}
@@ -0,0 +1,92 @@
+package longhorntools
+
+import (
+	"context"
+	"slices"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// trackedResource is a temporary object created during this run, and the
+// volumes it was created for.
+type trackedResource struct {
+	kind      string
+	namespace string
+	name      string
+	volumes   []string
+}
+
+// trackTemporary records a temporary pod, PVC, PV, or Job so it can be
+// removed by CleanupTracked and renewed while its volumes are locked, and
+// counts it in the metrics.
+func (vm *VolumeManager) trackTemporary(kind, namespace string, obj metav1.Object) {
+	tempResourcesCreated.WithLabelValues(kind).Inc()
+	vm.trackedMu.Lock()
+	defer vm.trackedMu.Unlock()
+	vm.tracked = append(vm.tracked, trackedResource{kind: kind, namespace: namespace, name: obj.GetName(), volumes: tempVolumes(obj)})
+}
+
+// track records an object for CleanupTracked.
+func (vm *VolumeManager) track(kind, namespace, name string) {
+	vm.trackedMu.Lock()
+	defer vm.trackedMu.Unlock()
+	vm.tracked = append(vm.tracked, trackedResource{kind: kind, namespace: namespace, name: name})
+}
+
+// trackedFor returns the tracked temporary resources created for
+// volumeName.
+func (vm *VolumeManager) trackedFor(volumeName string) []trackedResource {
+	vm.trackedMu.Lock()
+	defer vm.trackedMu.Unlock()
+	var resources []trackedResource
+	for _, r := range vm.tracked {
+		if slices.Contains(r.volumes, volumeName) {
+			resources = append(resources, r)
+		}
+	}
+	return resources
+}
+
+// untrack forgets a resource that no longer exists.
+func (vm *VolumeManager) untrack(r trackedResource) {
+	vm.trackedMu.Lock()
+	defer vm.trackedMu.Unlock()
+	vm.tracked = slices.DeleteFunc(vm.tracked, func(t trackedResource) bool {
+		return t.kind == r.kind && t.namespace == r.namespace && t.name == r.name
+	})
+}
+
+// CleanupTracked deletes the temporary resources created so far, in
+// reverse creation order. Call it with a fresh context after cancelling an
+// operation: resources are otherwise left for the reaper.
+func (vm *VolumeManager) CleanupTracked(ctx context.Context) {
+	vm.trackedMu.Lock()
+	tracked := append([]trackedResource(nil), vm.tracked...)
+	vm.trackedMu.Unlock()
+
+	background := metav1.DeletePropagationBackground
+	opts := metav1.DeleteOptions{PropagationPolicy: &background}
+	for i := len(tracked) - 1; i >= 0; i-- {
+		r := tracked[i]
+		var err error
+		switch r.kind {
+		case "pod":
+			err = vm.clientset.CoreV1().Pods(r.namespace).Delete(ctx, r.name, opts)
+		case "pvc":
+			err = vm.clientset.CoreV1().PersistentVolumeClaims(r.namespace).Delete(ctx, r.name, opts)
+		case "pv":
+			err = vm.clientset.CoreV1().PersistentVolumes().Delete(ctx, r.name, opts)
+		case "job":
+			err = vm.clientset.BatchV1().Jobs(r.namespace).Delete(ctx, r.name, opts)
+		case "lease":
+			err = vm.clientset.CoordinationV1().Leases(r.namespace).Delete(ctx, r.name, opts)
+		}
+		switch {
+		case err == nil:
+			vm.printf("Deleted %s %s\n", r.kind, r.name)
+		case !errors.IsNotFound(err):
+			vm.printf("Warning: failed to delete %s %s: %v\n", r.kind, r.name, err)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package longhorntools
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// TrimResult reports what fstrim reclaimed on a volume. All sizes are in
+// bytes.
+type TrimResult struct {
+	Volume  string `json:"volume"`
+	Trimmed int64  `json:"trimmed"`
+	// ActualSizeBefore and ActualSizeAfter are the space the volume took
+	// on its replicas' disks, as Longhorn reports it, before and after the
+	// trim. Longhorn updates the size asynchronously, so After may lag.
+	ActualSizeBefore int64 `json:"actualSizeBefore"`
+	ActualSizeAfter  int64 `json:"actualSizeAfter"`
+}
+
+// Reclaimed returns how much the volume's actual size shrank.
+func (r TrimResult) Reclaimed() int64 {
+	return r.ActualSizeBefore - r.ActualSizeAfter
+}
+
+// fstrimBytes matches the byte count in "fstrim -v" output, which is
+// "<path>: 1.2 GiB (1288490188 bytes) trimmed" with util-linux and
+// "<path>: 1288490188 bytes trimmed" with busybox.
+var fstrimBytes = regexp.MustCompile(`(\d+) bytes\)? trimmed`)
+
+// TrimVolume runs fstrim on volumeName's filesystem so Longhorn can release
+// the blocks of deleted files. The pod already mounting the volume is used
+// if there is one; it needs CAP_SYS_ADMIN for fstrim to work. Otherwise a
+// temporary pod with that capability mounts the volume.
+//
+// Longhorn only reclaims space in the volume head; blocks still held by
+// snapshots stay allocated until those snapshots are removed.
+func (vm *VolumeManager) TrimVolume(ctx context.Context, volumeName, namespace, storageClass string) (*TrimResult, error) {
+	var result *TrimResult
+	err := vm.withVolumeLocks(ctx, []string{volumeName}, func() error {
+		var err error
+		result, err = vm.trimVolume(ctx, volumeName, namespace, storageClass)
+		vm.recordOperationResult(ctx, volumeName, "Trimmed", "TrimFailed", "filesystem trim", err)
+		return vm.cleanupLocked(ctx, namespace, err, volumeName)
+	})
+	return result, err
+}
+
+func (vm *VolumeManager) trimVolume(ctx context.Context, volumeName, namespace, storageClass string) (*TrimResult, error) {
+	volume, err := vm.Volume(ctx, volumeName)
+	if err != nil {
+		return nil, err
+	}
+	result := &TrimResult{Volume: volumeName, ActualSizeBefore: volume.ActualSize}
+
+	inUse := false
+	if volume.PVName != "" {
+		inUse, err = vm.IsVolumeInUse(ctx, volume.PVName, namespace)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check if volume is in use: %w", err)
+		}
+	}
+
+	var podName, mountPath, containerName string
+	if inUse {
+		podName, mountPath, containerName, err = vm.findExistingPodForVolume(ctx, volume.PVName, namespace)
+		if err != nil {
+			return nil, categorize(ErrVolumeInUse, fmt.Errorf("volume %s is in use, but the pod using it cannot be found: %w", volumeName, err))
+		}
+		vm.printf("Trimming volume %s through running pod %s\n", volumeName, podName)
+	} else {
+		if vm.SecurityProfile == SecurityProfileRestricted {
+			return nil, fmt.Errorf("fstrim needs CAP_SYS_ADMIN, which the %s security profile does not allow", SecurityProfileRestricted)
+		}
+		podName, mountPath, containerName, err = vm.createTemporaryPodForLonghornWith(ctx, volumeName, namespace, storageClass, func(spec *corev1.PodSpec) {
+			for i := range spec.Containers {
+				if spec.Containers[i].SecurityContext == nil {
+					spec.Containers[i].SecurityContext = &corev1.SecurityContext{}
+				}
+				spec.Containers[i].SecurityContext.Capabilities = &corev1.Capabilities{
+					Add: []corev1.Capability{"SYS_ADMIN"},
+				}
+			}
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to mount volume %s: %w", volumeName, err)
+		}
+	}
+
+	var out strings.Builder
+	err = vm.execInPodWithOutput(ctx, namespace, podName, containerName, []string{"fstrim", "-v", mountPath}, &out)
+	if err != nil {
+		if inUse {
+			return nil, fmt.Errorf("fstrim failed in pod %s, which may lack CAP_SYS_ADMIN: %w", podName, err)
+		}
+		return nil, fmt.Errorf("fstrim failed: %w", err)
+	}
+	if vm.DryRun {
+		return result, nil
+	}
+
+	match := fstrimBytes.FindStringSubmatch(out.String())
+	if match == nil {
+		return nil, fmt.Errorf("unexpected fstrim output: %q", out.String())
+	}
+	result.Trimmed, _ = strconv.ParseInt(match[1], 10, 64)
+
+	if after, err := vm.Volume(ctx, volumeName); err == nil {
+		result.ActualSizeAfter = after.ActualSize
+	} else {
+		result.ActualSizeAfter = result.ActualSizeBefore
+	}
+	return result, nil
+}
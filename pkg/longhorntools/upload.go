@@ -0,0 +1,52 @@
+package longhorntools
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+)
+
+// uploadArchive streams a local archive into mountPath inside the given pod.
+// The compression is detected from the archive's first bytes; algo is what
+// the archive was recorded with, and a mismatch is only reported. Split
+// archives (inputFile.000, ...) are reassembled on the fly when inputFile
+// itself does not exist.
+func (vm *VolumeManager) uploadArchive(ctx context.Context, namespace, podName, containerName, mountPath, inputFile, algo string) error {
+	var in io.Reader
+	f, err := os.Open(inputFile)
+	switch {
+	case err == nil:
+		defer f.Close()
+		in = f
+	case os.IsNotExist(err) && len(existingChunkParts(inputFile)) > 0:
+		r, closeParts, err := openChunkParts(inputFile)
+		if err != nil {
+			return err
+		}
+		defer closeParts()
+		in = r
+	default:
+		return fmt.Errorf("failed to open archive: %w", err)
+	}
+
+	buffered := bufio.NewReader(in)
+	detected, err := detectCompression(buffered)
+	if err != nil {
+		return fmt.Errorf("%s: %w", inputFile, err)
+	}
+	if algo != "" && detected != algo {
+		vm.printf("Warning: %s is %s, not %s as recorded; extracting it as %s\n",
+			inputFile, CompressionExtension(detected), CompressionExtension(algo), CompressionExtension(detected))
+	}
+	algo = detected
+
+	stream, err := newLocalDecompressor(algo, buffered)
+	if err != nil {
+		return err
+	}
+
+	return vm.execInPodWithInput(ctx, namespace, podName, containerName,
+		podExtractCommand(algo, mountPath), stream)
+}
@@ -0,0 +1,86 @@
+package longhorntools
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// VolumeUsage is the filesystem usage of a volume as reported by df. All
+// sizes are in bytes.
+type VolumeUsage struct {
+	Volume    string `json:"volume"`
+	Size      int64  `json:"size"`
+	Used      int64  `json:"used"`
+	Available int64  `json:"available"`
+}
+
+// UsedPercent returns Used as a percentage of Size.
+func (u VolumeUsage) UsedPercent() float64 {
+	if u.Size <= 0 {
+		return 0
+	}
+	return float64(u.Used) * 100 / float64(u.Size)
+}
+
+// VolumeUsage mounts volumeName (or reuses the pod already mounting it) and
+// reports how much of its filesystem is in use. A temporary pod is removed
+// afterwards.
+func (vm *VolumeManager) VolumeUsage(ctx context.Context, volumeName, namespace, storageClass string) (*VolumeUsage, error) {
+	var usage *VolumeUsage
+	err := vm.withVolumeLocks(ctx, []string{volumeName}, func() error {
+		var err error
+		usage, err = vm.volumeUsage(ctx, volumeName, namespace, storageClass)
+		return vm.cleanupLocked(ctx, namespace, err, volumeName)
+	})
+	return usage, err
+}
+
+func (vm *VolumeManager) volumeUsage(ctx context.Context, volumeName, namespace, storageClass string) (*VolumeUsage, error) {
+	targetPod, mountPath, containerName, err := vm.getVolumeInfo(ctx, volumeName, namespace, storageClass)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get volume info: %w", err)
+	}
+
+	var out strings.Builder
+	err = vm.execInPodWithOutput(ctx, namespace, targetPod, containerName,
+		[]string{"df", "-P", "-k", mountPath}, &out)
+	if err != nil {
+		return nil, err
+	}
+	if vm.DryRun {
+		return &VolumeUsage{Volume: volumeName}, nil
+	}
+
+	usage, err := parseDF(out.String())
+	if err != nil {
+		return nil, err
+	}
+	usage.Volume = volumeName
+	return usage, nil
+}
+
+// parseDF reads the data line of POSIX "df -P -k" output:
+//
+//	Filesystem 1024-blocks Used Available Capacity Mounted on
+func parseDF(output string) (*VolumeUsage, error) {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) < 2 {
+		return nil, fmt.Errorf("unexpected df output: %q", output)
+	}
+
+	fields := strings.Fields(lines[len(lines)-1])
+	if len(fields) < 4 {
+		return nil, fmt.Errorf("unexpected df output: %q", output)
+	}
+	var kb [3]int64
+	for i := range kb {
+		n, err := strconv.ParseInt(fields[i+1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("unexpected df output: %q", output)
+		}
+		kb[i] = n * 1024
+	}
+	return &VolumeUsage{Size: kb[0], Used: kb[1], Available: kb[2]}, nil
+}
@@ -0,0 +1,267 @@
+package longhorntools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/yaml"
+)
+
+// Velero's Backup and Schedule custom resources.
+var (
+	veleroBackupGVR = schema.GroupVersionResource{
+		Group:    "velero.io",
+		Version:  "v1",
+		Resource: "backups",
+	}
+	veleroScheduleGVR = schema.GroupVersionResource{
+		Group:    "velero.io",
+		Version:  "v1",
+		Resource: "schedules",
+	}
+)
+
+// VeleroExportLabel marks the PVCs, and for file-system backups the pods,
+// that a Velero export selects. Its value is the export's name.
+const VeleroExportLabel = "lhc.longhorn.io/velero-export"
+
+// DefaultVeleroNamespace is where Velero is usually installed.
+const DefaultVeleroNamespace = "velero"
+
+// VeleroExportOptions describes a Velero Backup, or Schedule, of a set of
+// volumes.
+type VeleroExportOptions struct {
+	// Name names the Backup or Schedule and is the value of
+	// VeleroExportLabel on the selected resources.
+	Name string
+	// Namespace is the namespace Velero runs in.
+	Namespace string
+	// Schedule, if set, makes the export a Velero Schedule with this cron
+	// expression instead of a one-off Backup.
+	Schedule string
+	// StorageLocation is the Velero BackupStorageLocation; empty uses
+	// Velero's default.
+	StorageLocation string
+	// TTL is how long Velero keeps the backup; zero uses Velero's default.
+	TTL time.Duration
+	// FSBackup has Velero's node agent copy the files of the volumes through
+	// the pods mounting them, instead of taking CSI snapshots.
+	FSBackup bool
+	// SnapshotMoveData uploads CSI snapshot data to the storage location,
+	// so the backup does not depend on Longhorn snapshots.
+	SnapshotMoveData bool
+}
+
+// VeleroClaim is a volume's PVC selected for a Velero export, with the
+// running pods that mount it.
+type VeleroClaim struct {
+	Volume    string   `json:"volume"`
+	Namespace string   `json:"namespace"`
+	PVC       string   `json:"pvc"`
+	Pods      []string `json:"pods,omitempty"`
+}
+
+// VeleroClaims finds the PVCs of volumes. Velero backs volumes up through
+// their claims, so each volume must have one. With fsBackup, a running pod
+// must also mount it, as file-system backups read the files through it.
+func (vm *VolumeManager) VeleroClaims(ctx context.Context, volumes []string, fsBackup bool) ([]VeleroClaim, error) {
+	claims := make([]VeleroClaim, 0, len(volumes))
+	for _, volumeName := range volumes {
+		volume, err := vm.Volume(ctx, volumeName)
+		if err != nil {
+			return nil, err
+		}
+		if volume.PVCName == "" {
+			return nil, fmt.Errorf("volume %s has no PVC; Velero can only back up volumes bound to a claim", volumeName)
+		}
+		claim := VeleroClaim{Volume: volumeName, Namespace: volume.PVCNamespace, PVC: volume.PVCName}
+
+		if fsBackup {
+			pods, err := vm.podsUsingClaim(ctx, claim.Namespace, claim.PVC)
+			if err != nil {
+				return nil, err
+			}
+			for _, pod := range pods {
+				if pod.Status.Phase == corev1.PodRunning {
+					claim.Pods = append(claim.Pods, pod.Name)
+				}
+			}
+			if len(claim.Pods) == 0 {
+				return nil, fmt.Errorf("no running pod mounts PVC %s/%s, which a file-system backup of volume %s needs", claim.Namespace, claim.PVC, volumeName)
+			}
+		}
+		claims = append(claims, claim)
+	}
+	return claims, nil
+}
+
+// LabelVeleroClaims puts VeleroExportLabel on the claims, and their pods,
+// so the export's label selector picks them up.
+func (vm *VolumeManager) LabelVeleroClaims(ctx context.Context, claims []VeleroClaim, name string) error {
+	patch, _ := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"labels": map[string]interface{}{VeleroExportLabel: name},
+		},
+	})
+	for _, claim := range claims {
+		if vm.DryRun {
+			vm.dryRunf("label PersistentVolumeClaim %s/%s %s=%s", claim.Namespace, claim.PVC, VeleroExportLabel, name)
+		} else {
+			_, err := vm.clientset.CoreV1().PersistentVolumeClaims(claim.Namespace).Patch(ctx, claim.PVC, types.MergePatchType, patch, metav1.PatchOptions{})
+			if err != nil {
+				return fmt.Errorf("failed to label PVC %s/%s: %w", claim.Namespace, claim.PVC, err)
+			}
+		}
+		for _, pod := range claim.Pods {
+			if vm.DryRun {
+				vm.dryRunf("label pod %s/%s %s=%s", claim.Namespace, pod, VeleroExportLabel, name)
+				continue
+			}
+			_, err := vm.clientset.CoreV1().Pods(claim.Namespace).Patch(ctx, pod, types.MergePatchType, patch, metav1.PatchOptions{})
+			if err != nil {
+				return fmt.Errorf("failed to label pod %s/%s: %w", claim.Namespace, pod, err)
+			}
+		}
+	}
+	return nil
+}
+
+// buildVeleroExport returns the Velero Backup, or Schedule, that selects
+// the labeled claims. Velero adds the PersistentVolume bound to each claim
+// by itself.
+func buildVeleroExport(claims []VeleroClaim, opts VeleroExportOptions) (*unstructured.Unstructured, error) {
+	if opts.Name == "" {
+		return nil, fmt.Errorf("a name is required")
+	}
+	if len(claims) == 0 {
+		return nil, fmt.Errorf("no volumes selected")
+	}
+	if opts.FSBackup && opts.SnapshotMoveData {
+		return nil, fmt.Errorf("file-system backups take no snapshots whose data could be moved")
+	}
+
+	seen := map[string]bool{}
+	var namespaces []interface{}
+	for _, claim := range claims {
+		if !seen[claim.Namespace] {
+			seen[claim.Namespace] = true
+			namespaces = append(namespaces, claim.Namespace)
+		}
+	}
+	sort.Slice(namespaces, func(i, j int) bool { return namespaces[i].(string) < namespaces[j].(string) })
+
+	resources := []interface{}{"persistentvolumeclaims", "persistentvolumes"}
+	if opts.FSBackup {
+		resources = append(resources, "pods")
+	}
+	spec := map[string]interface{}{
+		"includedNamespaces": namespaces,
+		"includedResources":  resources,
+		"labelSelector": map[string]interface{}{
+			"matchLabels": map[string]interface{}{VeleroExportLabel: opts.Name},
+		},
+		"snapshotVolumes":          !opts.FSBackup,
+		"defaultVolumesToFsBackup": opts.FSBackup,
+	}
+	if opts.SnapshotMoveData {
+		spec["snapshotMoveData"] = true
+	}
+	if opts.StorageLocation != "" {
+		spec["storageLocation"] = opts.StorageLocation
+	}
+	if opts.TTL > 0 {
+		spec["ttl"] = opts.TTL.String()
+	}
+
+	kind := "Backup"
+	if opts.Schedule != "" {
+		kind = "Schedule"
+		spec = map[string]interface{}{
+			"schedule": opts.Schedule,
+			"template": spec,
+		}
+	}
+	namespace := opts.Namespace
+	if namespace == "" {
+		namespace = DefaultVeleroNamespace
+	}
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": veleroBackupGVR.GroupVersion().String(),
+		"kind":       kind,
+		"metadata": map[string]interface{}{
+			"name":      opts.Name,
+			"namespace": namespace,
+			"labels":    map[string]interface{}{"app": "lhc-velero-export"},
+		},
+		"spec": spec,
+	}}, nil
+}
+
+// WriteVeleroExport renders the Velero Backup or Schedule for claims as
+// YAML.
+func WriteVeleroExport(w io.Writer, claims []VeleroClaim, opts VeleroExportOptions) error {
+	obj, err := buildVeleroExport(claims, opts)
+	if err != nil {
+		return err
+	}
+	data, err := yaml.Marshal(obj.Object)
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// ApplyVeleroExport labels claims and creates the Velero Backup or Schedule
+// that selects them. An existing Schedule is updated; Backups cannot be
+// changed once created.
+func (vm *VolumeManager) ApplyVeleroExport(ctx context.Context, claims []VeleroClaim, opts VeleroExportOptions) error {
+	obj, err := buildVeleroExport(claims, opts)
+	if err != nil {
+		return err
+	}
+	if err := vm.LabelVeleroClaims(ctx, claims, opts.Name); err != nil {
+		return err
+	}
+	if vm.DryRun {
+		vm.dryRunf("create Velero %s %s/%s", obj.GetKind(), obj.GetNamespace(), obj.GetName())
+		return nil
+	}
+
+	gvr := veleroBackupGVR
+	if obj.GetKind() == "Schedule" {
+		gvr = veleroScheduleGVR
+	}
+	resource := vm.dynamicClient.Resource(gvr).Namespace(obj.GetNamespace())
+	_, err = resource.Create(ctx, obj, metav1.CreateOptions{})
+	if errors.IsAlreadyExists(err) {
+		if gvr == veleroBackupGVR {
+			return fmt.Errorf("Velero backup %s already exists; choose another name", obj.GetName())
+		}
+		existing, getErr := resource.Get(ctx, obj.GetName(), metav1.GetOptions{})
+		if getErr != nil {
+			return fmt.Errorf("failed to get Velero schedule %s: %w", obj.GetName(), getErr)
+		}
+		obj.SetResourceVersion(existing.GetResourceVersion())
+		_, err = resource.Update(ctx, obj, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		if errors.IsNotFound(err) {
+			// The API server reports a missing CRD as a missing resource
+			return fmt.Errorf("Velero does not appear to be installed: %w", err)
+		}
+		return fmt.Errorf("failed to create Velero %s %s: %w", obj.GetKind(), obj.GetName(), err)
+	}
+	vm.printf("Created Velero %s %s/%s\n", obj.GetKind(), obj.GetNamespace(), obj.GetName())
+	return nil
+}
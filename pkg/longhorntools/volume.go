@@ -0,0 +1,1647 @@
+package longhorntools
+
+// Make the copy command take into account the src/dst namespaces AI?
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+// longhornVolumeGVR identifies Longhorn's Volume custom resource.
+var longhornVolumeGVR = schema.GroupVersionResource{
+	Group:    "longhorn.io",
+	Version:  "v1beta2",
+	Resource: "volumes",
+}
+
+// VolumeManager runs volume operations against one cluster. Create it with
+// NewVolumeManager and adjust the exported fields before first use; they
+// must not change while operations are running.
+type VolumeManager struct {
+	clientset     kubernetes.Interface
+	dynamicClient dynamic.Interface
+	executor      PodExecutor
+
+	// Output receives progress messages and the output of remote
+	// commands. Nil discards them.
+	Output io.Writer
+
+	// Annotate records the last operation as annotations on Longhorn
+	// volumes in addition to emitting Events.
+	Annotate bool
+
+	// WaitTimeout overrides how long to wait for temporary PVCs to bind
+	// and pods to start. Zero keeps the per-wait defaults.
+	WaitTimeout time.Duration
+
+	// Retries and RetryBackoff control how transient API and exec
+	// session failures are retried; see retry.go.
+	Retries      int
+	RetryBackoff time.Duration
+
+	// LockTimeout is how long to wait for another run's lock on a volume
+	// before giving up. Zero fails immediately.
+	LockTimeout time.Duration
+
+	// DryRun reports every create, delete, and exec instead of performing
+	// it. Read-only API calls still go to the cluster.
+	DryRun     bool
+	dryRunMu   sync.Mutex
+	dryRunSeen map[string]bool
+
+	// TempImage overrides the image of temporary pods and copy Jobs.
+	TempImage string
+
+	// TempResources are the requests and limits of every temporary pod
+	// container.
+	TempResources corev1.ResourceRequirements
+
+	// SecurityProfile is "default" or "restricted"; FSGroup overrides the
+	// pod's fsGroup when zero or more.
+	SecurityProfile string
+	FSGroup         int64
+
+	// ImageRegistry moves every helper image to a private registry, and
+	// ImageOverrides replaces or pins individual images; see
+	// ResolveImage.
+	ImageRegistry  string
+	ImageOverrides map[string]string
+
+	// ServiceAccount and ImagePullSecrets are set on temporary pods and
+	// copy Jobs; both must exist in the target namespace.
+	ServiceAccount   string
+	ImagePullSecrets []string
+
+	// Placement of temporary pods and copy Jobs. With PinToNode, pods for
+	// an attached volume are required to run on its node.
+	NodeSelector map[string]string
+	Tolerations  []corev1.Toleration
+	Affinity     *corev1.Affinity
+	PinToNode    bool
+
+	// TempTTL is how long temporary resources outlive their last renewal
+	// before the reaper may delete them. Resources are renewed while the
+	// lock of their volume is held.
+	TempTTL time.Duration
+
+	// Sparse makes tar record holes in sparse files instead of streaming
+	// them as zeros, for copies between pods and downloads. Both ends need
+	// GNU tar, which the default TempImage lacks.
+	Sparse bool
+
+	// Backend is BackendKubernetes or BackendAPI, which lists volumes,
+	// snapshots, and backups through the Longhorn manager API. ManagerURL,
+	// if set, is where that API is reached, such as a port-forward;
+	// otherwise it is reached through the API server's service proxy.
+	Backend    string
+	ManagerURL string
+
+	// CopyStreams is the number of tar pipes a copy between two pods runs
+	// at once; see parallelStreamCopy. Below 2, one pipe is used.
+	CopyStreams int
+
+	// Progress is how downloads and copies report their progress:
+	// ProgressPlain (the default), ProgressJSON, or ProgressNone.
+	// ProgressInterval is how often; zero means DefaultProgressInterval.
+	Progress         string
+	ProgressInterval time.Duration
+
+	// restConfig is the unwrapped cluster connection, for port forwarding;
+	// nil for managers built from clients.
+	restConfig *rest.Config
+
+	// throttle reports API throttling; see throttle.go.
+	throttle *throttleReporter
+
+	// tracked lists the temporary resources created so far; see
+	// CleanupTracked.
+	trackedMu sync.Mutex
+	tracked   []trackedResource
+}
+
+type LonghornVolume struct {
+	Name         string    `json:"name"`
+	Size         string    `json:"size"`
+	State        string    `json:"state"`
+	Robustness   string    `json:"robustness"`
+	PVName       string    `json:"kubernetesStatus.pvName"`
+	PVCNamespace string    `json:"kubernetesStatus.namespace"`
+	PVCName      string    `json:"kubernetesStatus.pvcName"`
+	NodeID       string    `json:"currentNodeID"`
+	Replicas     int64     `json:"numberOfReplicas"`
+	ActualSize   int64     `json:"actualSize"`
+	Frontend     string    `json:"frontend"`
+	EngineImage  string    `json:"currentImage"`
+	Created      time.Time `json:"creationTimestamp"`
+}
+
+// DownloadOptions controls how a volume archive is written locally.
+type DownloadOptions struct {
+	// Encrypt is an optional "age:<recipient>" or "gpg:<keyid>" spec. When
+	// set, the archive is encrypted before it is written to disk.
+	Encrypt string
+
+	// ChunkSize splits the archive into parts of at most this many bytes
+	// (outputFile.000, outputFile.001, ...) plus a manifest. Zero disables
+	// splitting.
+	ChunkSize int64
+
+	// FileChecksums additionally writes outputFile.SHA256SUMS with a hash
+	// of every regular file in the archive.
+	FileChecksums bool
+
+	// Resume continues an interrupted download of the same volume instead
+	// of starting over.
+	Resume bool
+
+	// Compression is one of none, gzip (default), zstd, or xz.
+	Compression string
+
+	// CompressionLevel overrides the algorithm's default level when non-zero.
+	CompressionLevel int
+}
+
+// NewVolumeManager connects to the cluster described by config with the
+// default settings.
+func NewVolumeManager(config *rest.Config) (*VolumeManager, error) {
+	vm := newVolumeManager()
+	execConfig := rest.CopyConfig(config)
+	config = rest.CopyConfig(config)
+	vm.applyRateLimits(config)
+	config.WrapTransport = func(rt http.RoundTripper) http.RoundTripper {
+		return &retryingTransport{vm: vm, next: rt}
+	}
+
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create clientset: %w", err)
+	}
+	vm.clientset = clientset
+
+	vm.dynamicClient, err = dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dynamic client: %w", err)
+	}
+
+	// Exec sessions use the unwrapped config; execWithRetry retries them
+	vm.executor = &spdyExecutor{clientset: clientset, config: execConfig}
+	vm.restConfig = execConfig
+	return vm, nil
+}
+
+// NewVolumeManagerWithClients returns a manager with the default settings
+// that uses the given clients, such as the fakes from client-go's fake
+// packages. Requests made through them are not retried.
+func NewVolumeManagerWithClients(clientset kubernetes.Interface, dynamicClient dynamic.Interface, executor PodExecutor) *VolumeManager {
+	vm := newVolumeManager()
+	vm.clientset = clientset
+	vm.dynamicClient = dynamicClient
+	vm.executor = executor
+	return vm
+}
+
+func newVolumeManager() *VolumeManager {
+	vm := &VolumeManager{
+		Retries:         DefaultRetries,
+		RetryBackoff:    DefaultRetryBackoff,
+		SecurityProfile: SecurityProfileDefault,
+		Backend:         BackendKubernetes,
+		FSGroup:         -1,
+		PinToNode:       true,
+	}
+	vm.throttle = newThrottleReporter(vm)
+	return vm
+}
+
+// Clientset returns the Kubernetes client the manager uses, for callers
+// that need objects this package does not wrap.
+func (vm *VolumeManager) Clientset() kubernetes.Interface {
+	return vm.clientset
+}
+
+// output returns where progress messages go.
+func (vm *VolumeManager) output() io.Writer {
+	if vm.Output == nil {
+		return io.Discard
+	}
+	return vm.Output
+}
+
+func (vm *VolumeManager) printf(format string, args ...interface{}) {
+	fmt.Fprintf(vm.output(), format, args...)
+}
+
+func (vm *VolumeManager) println(args ...interface{}) {
+	fmt.Fprintln(vm.output(), args...)
+}
+
+// IsVolumeInUse reports whether a running pod in namespace mounts the PVC
+// bound to the PV pvName.
+func (vm *VolumeManager) IsVolumeInUse(ctx context.Context, pvName, namespace string) (bool, error) {
+	// Get all PVCs in the namespace
+	pvcs, err := vm.clientset.CoreV1().PersistentVolumeClaims(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return false, fmt.Errorf("failed to list PVCs: %w", err)
+	}
+
+	// Find PVC bound to this PV
+	var targetPVC string
+	for _, pvc := range pvcs.Items {
+		if pvc.Spec.VolumeName == pvName && pvc.Status.Phase == corev1.ClaimBound {
+			targetPVC = pvc.Name
+			break
+		}
+	}
+
+	if targetPVC == "" {
+		return false, nil // No PVC bound to this PV
+	}
+
+	// Check if any running pod is using this PVC
+	pods, err := vm.clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return false, fmt.Errorf("failed to list pods: %w", err)
+	}
+
+	for _, pod := range pods.Items {
+		if pod.Status.Phase == corev1.PodRunning {
+			for _, volume := range pod.Spec.Volumes {
+				if volume.PersistentVolumeClaim != nil && volume.PersistentVolumeClaim.ClaimName == targetPVC {
+					return true, nil // Volume is in use
+				}
+			}
+		}
+	}
+
+	return false, nil // Volume is not in use
+}
+
+func (vm *VolumeManager) findExistingPodForVolume(ctx context.Context, pvName, namespace string) (podName, mountPath, containerName string, err error) {
+	// Get all PVCs in the namespace
+	pvcs, err := vm.clientset.CoreV1().PersistentVolumeClaims(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return "", "", "", fmt.Errorf("failed to list PVCs: %w", err)
+	}
+
+	// Find PVC bound to this PV
+	var targetPVC string
+	for _, pvc := range pvcs.Items {
+		if pvc.Spec.VolumeName == pvName && pvc.Status.Phase == corev1.ClaimBound {
+			targetPVC = pvc.Name
+			break
+		}
+	}
+
+	if targetPVC == "" {
+		return "", "", "", fmt.Errorf("no PVC found for PV %s", pvName)
+	}
+
+	// Find the pod using this PVC
+	pods, err := vm.clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return "", "", "", fmt.Errorf("failed to list pods: %w", err)
+	}
+
+	for _, pod := range pods.Items {
+		if pod.Status.Phase == corev1.PodRunning {
+			for _, volume := range pod.Spec.Volumes {
+				if volume.PersistentVolumeClaim != nil && volume.PersistentVolumeClaim.ClaimName == targetPVC {
+					// Find the mount path and container
+					for _, container := range pod.Spec.Containers {
+						for _, mount := range container.VolumeMounts {
+							if mount.Name == volume.Name {
+								return pod.Name, mount.MountPath, container.Name, nil
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+
+	return "", "", "", fmt.Errorf("no running pod found using PVC %s", targetPVC)
+}
+
+func (vm *VolumeManager) createSnapshotBasedAccess(ctx context.Context, volumeName, namespace, storageClass string) (podName, mountPath, containerName string, err error) {
+	// For now, we'll create a temporary volume with ReadWriteMany access mode
+	// In a full implementation, this would create a Longhorn snapshot and restore it to a new volume
+
+	vm.printf("Creating temporary RWX volume for multi-attach access to %s...\n", volumeName)
+
+	// Create a temporary volume name
+	tempVolumeName := fmt.Sprintf("lhc-temp-rwx-%s", volumeName)
+
+	// Get original volume info for sizing
+	volume, err := vm.Volume(ctx, volumeName)
+	if err != nil {
+		return "", "", "", fmt.Errorf("failed to get original volume info: %w", err)
+	}
+
+	// Create temporary PV with RWX access mode
+	_, err = vm.createTemporaryRWXPV(ctx, tempVolumeName, namespace, storageClass, volume.Size)
+	if err != nil {
+		return "", "", "", fmt.Errorf("failed to create temporary RWX PV: %w", err)
+	}
+
+	// Create temporary pod using the RWX volume
+	return vm.createTemporaryPodForRWXVolume(ctx, tempVolumeName, namespace, storageClass, volume.Size)
+}
+
+func (vm *VolumeManager) createTemporaryRWXPV(ctx context.Context, volumeName, namespace, storageClass, size string) (string, error) {
+	pvName := fmt.Sprintf("lhc-temp-pv-%s", volumeName)
+
+	// Check if PV already exists
+	_, err := vm.clientset.CoreV1().PersistentVolumes().Get(ctx, pvName, metav1.GetOptions{})
+	if err == nil {
+		return pvName, nil // PV already exists
+	}
+
+	// Create temporary PV with ReadWriteMany access mode
+	pv := &corev1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: pvName,
+			Labels: map[string]string{
+				"app": "lhc-temp",
+			},
+			Annotations: vm.tempAnnotations(volumeName),
+		},
+		Spec: corev1.PersistentVolumeSpec{
+			Capacity: corev1.ResourceList{
+				corev1.ResourceStorage: resource.MustParse(size),
+			},
+			AccessModes: []corev1.PersistentVolumeAccessMode{
+				corev1.ReadWriteMany, // Use RWX to avoid multi-attach issues
+			},
+			PersistentVolumeReclaimPolicy: corev1.PersistentVolumeReclaimDelete,
+			StorageClassName:              storageClass,
+			PersistentVolumeSource: corev1.PersistentVolumeSource{
+				CSI: &corev1.CSIPersistentVolumeSource{
+					Driver:       "driver.longhorn.io",
+					VolumeHandle: volumeName, // Create a new volume handle
+					FSType:       "ext4",
+					VolumeAttributes: map[string]string{
+						"numberOfReplicas":    "1", // Use fewer replicas for temp volume
+						"staleReplicaTimeout": "2880",
+					},
+				},
+			},
+		},
+	}
+
+	if vm.DryRun {
+		vm.dryRunf("create PersistentVolume %s for Longhorn volume %s", pvName, volumeName)
+		return pvName, nil
+	}
+
+	_, err = vm.clientset.CoreV1().PersistentVolumes().Create(ctx, pv, metav1.CreateOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary RWX PV: %w", err)
+	}
+	vm.trackTemporary("pv", "", pv)
+
+	return pvName, nil
+}
+
+func (vm *VolumeManager) createTemporaryPodForRWXVolume(ctx context.Context, volumeName, namespace, storageClass, size string) (podName, mountPath, containerName string, err error) {
+	// Create a temporary PVC for this volume if it doesn't exist
+	pvcName := fmt.Sprintf("lhc-temp-pvc-%s", volumeName)
+	mountPath = "/mnt/volume"
+	containerName = "temp-container"
+	podName = fmt.Sprintf("lhc-temp-pod-%s", volumeName)
+	pvName := fmt.Sprintf("lhc-temp-pv-%s", volumeName)
+
+	// Check if temporary PVC already exists
+	_, err = vm.clientset.CoreV1().PersistentVolumeClaims(namespace).Get(ctx, pvcName, metav1.GetOptions{})
+	if err != nil && vm.DryRun {
+		vm.dryRunf("create PersistentVolumeClaim %s/%s bound to PV %s", namespace, pvcName, pvName)
+	} else if err != nil {
+		// Create temporary PVC with ReadWriteMany access mode
+		pvc := &corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      pvcName,
+				Namespace: namespace,
+				Labels: map[string]string{
+					"app": "lhc-temp",
+				},
+				Annotations: vm.tempAnnotations(volumeName),
+			},
+			Spec: corev1.PersistentVolumeClaimSpec{
+				AccessModes: []corev1.PersistentVolumeAccessMode{
+					corev1.ReadWriteMany, // Use RWX access mode
+				},
+				Resources: corev1.VolumeResourceRequirements{
+					Requests: corev1.ResourceList{
+						corev1.ResourceStorage: resource.MustParse(size),
+					},
+				},
+				StorageClassName: func() *string { return &storageClass }(),
+				VolumeName:       pvName, // Bind to specific PV
+			},
+		}
+
+		_, err = vm.clientset.CoreV1().PersistentVolumeClaims(namespace).Create(ctx, pvc, metav1.CreateOptions{})
+		if err != nil {
+			return "", "", "", fmt.Errorf("failed to create temporary PVC: %w", err)
+		}
+		vm.trackTemporary("pvc", namespace, pvc)
+
+		// Wait for PVC to be bound
+		if err := vm.waitForPVCBound(ctx, namespace, pvcName); err != nil {
+			return "", "", "", err
+		}
+	}
+
+	// Check if temporary pod already exists and is running
+	existingPod, err := vm.clientset.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
+	if err == nil && existingPod.Status.Phase == corev1.PodRunning {
+		return podName, mountPath, containerName, nil
+	}
+
+	// Create temporary pod
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      podName,
+			Namespace: namespace,
+			Labels: map[string]string{
+				"app": "lhc-temp",
+			},
+			Annotations: vm.tempAnnotations(volumeName),
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name:  containerName,
+					Image: vm.tempPodImage(),
+					Command: []string{
+						"sleep",
+						tempPodSleepSeconds,
+					},
+					VolumeMounts: []corev1.VolumeMount{
+						{
+							Name:      "volume",
+							MountPath: mountPath,
+						},
+					},
+				},
+			},
+			Volumes: []corev1.Volume{
+				{
+					Name: "volume",
+					VolumeSource: corev1.VolumeSource{
+						PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+							ClaimName: pvcName,
+						},
+					},
+				},
+			},
+			RestartPolicy: corev1.RestartPolicyNever,
+		},
+	}
+
+	vm.applyTempPodOptions(ctx, &pod.Spec, volumeName)
+
+	if vm.DryRun {
+		vm.dryRunf("create pod %s/%s mounting PVC %s at %s", namespace, podName, pvcName, mountPath)
+		return podName, mountPath, containerName, nil
+	}
+
+	_, err = vm.clientset.CoreV1().Pods(namespace).Create(ctx, pod, metav1.CreateOptions{})
+	if err != nil {
+		return "", "", "", fmt.Errorf("failed to create temporary pod: %w", err)
+	}
+	vm.trackTemporary("pod", namespace, pod)
+
+	// Wait for pod to be running
+	if err := vm.waitForPodRunning(ctx, namespace, podName); err != nil {
+		return "", "", "", err
+	}
+
+	return podName, mountPath, containerName, nil
+}
+
+// TemporaryResources groups the lhc-temp resources found for a namespace.
+type TemporaryResources struct {
+	Pods []corev1.Pod
+	PVCs []corev1.PersistentVolumeClaim
+	PVs  []corev1.PersistentVolume
+}
+
+func (t *TemporaryResources) Total() int {
+	return len(t.Pods) + len(t.PVCs) + len(t.PVs)
+}
+
+// FindTemporaryResources lists the pods and PVCs in namespace and the
+// cluster-wide PVs labelled as temporary resources of this tool.
+func (vm *VolumeManager) FindTemporaryResources(ctx context.Context, namespace string) (*TemporaryResources, error) {
+	// Find temporary pods
+	pods, err := vm.clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: "app=lhc-temp",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list temporary pods: %w", err)
+	}
+
+	// Find temporary PVCs
+	pvcs, err := vm.clientset.CoreV1().PersistentVolumeClaims(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: "app=lhc-temp",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list temporary PVCs: %w", err)
+	}
+
+	// Find temporary PVs (cluster-wide)
+	pvs, err := vm.clientset.CoreV1().PersistentVolumes().List(ctx, metav1.ListOptions{
+		LabelSelector: "app=lhc-temp",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list temporary PVs: %w", err)
+	}
+
+	return &TemporaryResources{Pods: pods.Items, PVCs: pvcs.Items, PVs: pvs.Items}, nil
+}
+
+// DeleteTemporaryResources deletes pods first, then PVCs, then PVs, and
+// returns how many deletions failed.
+func (vm *VolumeManager) DeleteTemporaryResources(ctx context.Context, namespace string, res *TemporaryResources) int {
+	if vm.DryRun {
+		for _, pod := range res.Pods {
+			vm.dryRunf("delete pod %s/%s", namespace, pod.Name)
+		}
+		for _, pvc := range res.PVCs {
+			vm.dryRunf("delete PersistentVolumeClaim %s/%s", namespace, pvc.Name)
+		}
+		for _, pv := range res.PVs {
+			vm.dryRunf("delete PersistentVolume %s", pv.Name)
+		}
+		return 0
+	}
+
+	failed := 0
+
+	// Delete pods first
+	for _, pod := range res.Pods {
+		vm.printf("Deleting pod %s...\n", pod.Name)
+		err := vm.clientset.CoreV1().Pods(namespace).Delete(ctx, pod.Name, metav1.DeleteOptions{})
+		if err != nil {
+			vm.printf("Warning: failed to delete pod %s: %v\n", pod.Name, err)
+			failed++
+		}
+	}
+
+	// Delete PVCs
+	for _, pvc := range res.PVCs {
+		vm.printf("Deleting PVC %s...\n", pvc.Name)
+		err := vm.clientset.CoreV1().PersistentVolumeClaims(namespace).Delete(ctx, pvc.Name, metav1.DeleteOptions{})
+		if err != nil {
+			vm.printf("Warning: failed to delete PVC %s: %v\n", pvc.Name, err)
+			failed++
+		}
+	}
+
+	// Delete PVs
+	for _, pv := range res.PVs {
+		vm.printf("Deleting PV %s...\n", pv.Name)
+		err := vm.clientset.CoreV1().PersistentVolumes().Delete(ctx, pv.Name, metav1.DeleteOptions{})
+		if err != nil {
+			vm.printf("Warning: failed to delete PV %s: %v\n", pv.Name, err)
+			failed++
+		}
+	}
+
+	return failed
+}
+
+// FileEntry is one regular file in a volume.
+type FileEntry struct {
+	// Path is relative to the volume root.
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	Mode    string    `json:"mode"`
+	ModTime time.Time `json:"modTime"`
+}
+
+// VolumeContents lists every regular file in a volume, recursively, and
+// removes the temporary pod it used.
+func (vm *VolumeManager) VolumeContents(ctx context.Context, volumeName, namespace, storageClass string) ([]FileEntry, error) {
+	var entries []FileEntry
+	err := vm.withVolumeLocks(ctx, []string{volumeName}, func() error {
+		var err error
+		entries, err = vm.volumeContents(ctx, volumeName, namespace, storageClass)
+		return vm.cleanupLocked(ctx, namespace, err, volumeName)
+	})
+	return entries, err
+}
+
+func (vm *VolumeManager) volumeContents(ctx context.Context, volumeName, namespace, storageClass string) ([]FileEntry, error) {
+	// Use the getVolumeInfo method that works with Longhorn volumes
+	targetPod, mountPath, containerName, err := vm.getVolumeInfo(ctx, volumeName, namespace, storageClass)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get volume info: %w", err)
+	}
+
+	vm.printf("Volume: %s\n", volumeName)
+	vm.printf("Pod: %s\n", targetPod)
+	vm.printf("Container: %s\n", containerName)
+	vm.printf("Mount Path: %s\n\n", mountPath)
+
+	// One "size mtime mode path" line per file
+	var listing strings.Builder
+	err = vm.execInPodWithOutput(ctx, namespace, targetPod, containerName,
+		[]string{"find", mountPath, "-type", "f", "-exec", "stat", "-c", "%s %Y %A %n", "{}", ";"}, &listing)
+	if err != nil {
+		return nil, err
+	}
+	return parseFileEntries(listing.String(), mountPath), nil
+}
+
+// parseFileEntries parses stat output from volumeContents. Lines that do
+// not parse, such as the continuation of a name containing a newline, are
+// skipped.
+func parseFileEntries(listing, mountPath string) []FileEntry {
+	var entries []FileEntry
+	for _, line := range strings.Split(listing, "\n") {
+		fields := strings.SplitN(line, " ", 4)
+		if len(fields) != 4 {
+			continue
+		}
+		size, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		mtime, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		entries = append(entries, FileEntry{
+			Path:    strings.TrimPrefix(strings.TrimPrefix(fields[3], mountPath), "/"),
+			Size:    size,
+			Mode:    fields[2],
+			ModTime: time.Unix(mtime, 0),
+		})
+	}
+	return entries
+}
+
+func (vm *VolumeManager) DownloadVolume(ctx context.Context, volumeName, namespace, outputFile, storageClass string, opts DownloadOptions) error {
+	return vm.withVolumeLocks(ctx, []string{volumeName}, func() error {
+		err := observeOperation("download", func() error {
+			return vm.downloadVolume(ctx, volumeName, namespace, outputFile, storageClass, opts)
+		})
+		vm.recordOperationResult(ctx, volumeName, "Downloaded", "DownloadFailed", fmt.Sprintf("download to %s", outputFile), err)
+		return err
+	})
+}
+
+func (vm *VolumeManager) downloadVolume(ctx context.Context, volumeName, namespace, outputFile, storageClass string, opts DownloadOptions) error {
+	algo := opts.Compression
+	if algo == "" {
+		algo = CompressGzip
+	}
+	if err := validateCompression(algo, opts.CompressionLevel); err != nil {
+		return err
+	}
+
+	if opts.Resume && (opts.Encrypt != "" || opts.FileChecksums) {
+		return fmt.Errorf("--resume cannot be combined with --encrypt or --file-checksums")
+	}
+	if opts.Resume && algo != CompressGzip && algo != CompressNone {
+		return fmt.Errorf("--resume is only supported with --compress=gzip or --compress=none")
+	}
+
+	// Use the getVolumeInfo method that works with Longhorn volumes
+	targetPod, mountPath, containerName, err := vm.getVolumeInfoWith(ctx, volumeName, namespace, storageClass, vm.withCompressImage(algo))
+	if err != nil {
+		return fmt.Errorf("failed to get volume info: %w", err)
+	}
+	if vm.Sparse {
+		if err := vm.requireGNUTar(ctx, namespace, targetPod, containerName); err != nil {
+			return err
+		}
+	}
+	podAlgo := vm.podCompression(ctx, namespace, targetPod, containerName, algo)
+
+	vm.printf("Volume: %s\n", volumeName)
+	vm.printf("Pod: %s\n", targetPod)
+	vm.printf("Container: %s\n", containerName)
+	vm.printf("Mount Path: %s\n", mountPath)
+	vm.printf("Output File: %s\n", outputFile)
+	if opts.Encrypt != "" {
+		vm.printf("Encryption: %s\n", opts.Encrypt)
+	}
+	if opts.ChunkSize > 0 {
+		vm.printf("Chunk Size: %d bytes\n", opts.ChunkSize)
+	}
+	vm.println()
+
+	if vm.DryRun {
+		vm.dryRunf("exec in pod %s/%s: %s", namespace, targetPod, podArchiveCommand(podAlgo, opts.CompressionLevel, mountPath, vm.Sparse, 0))
+		vm.dryRunf("write archive to %s", outputFile)
+		return nil
+	}
+
+	vm.printf("Creating %s archive...\n", strings.TrimPrefix(CompressionExtension(algo), "."))
+
+	// Resuming continues from however many bytes are already on disk
+	var offset int64
+	var existingTail []byte
+	archiveHash := sha256.New()
+	if opts.Resume {
+		state, err := loadDownloadState(outputFile)
+		if err != nil {
+			return err
+		}
+		if state.Volume != volumeName || state.ChunkSize != opts.ChunkSize {
+			return fmt.Errorf("partial download %s was started for volume %s with chunk size %d, not volume %s with chunk size %d",
+				outputFile, state.Volume, state.ChunkSize, volumeName, opts.ChunkSize)
+		}
+
+		var existing io.Reader
+		if opts.ChunkSize > 0 {
+			r, closeParts, err := openChunkParts(outputFile)
+			if err != nil {
+				return err
+			}
+			defer closeParts()
+			existing = r
+		} else {
+			f, err := os.Open(outputFile)
+			if err != nil {
+				return fmt.Errorf("failed to open partial download: %w", err)
+			}
+			defer f.Close()
+			existing = f
+		}
+
+		offset, existingTail, err = primeFromExisting(existing, archiveHash)
+		if err != nil {
+			return err
+		}
+		vm.printf("Resuming download at byte %d\n", offset)
+	}
+
+	// Create the output sink: a single file, or a series of fixed-size parts
+	var sink io.WriteCloser
+	switch {
+	case opts.ChunkSize > 0 && offset > 0:
+		sink, err = resumeChunkWriter(outputFile, opts.ChunkSize)
+		if err != nil {
+			return err
+		}
+	case opts.ChunkSize > 0:
+		sink = newChunkWriter(outputFile, opts.ChunkSize)
+	case offset > 0:
+		outFile, err := os.OpenFile(outputFile, os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to reopen output file: %w", err)
+		}
+		sink = outFile
+	default:
+		outFile, err := os.Create(outputFile)
+		if err != nil {
+			return fmt.Errorf("failed to create output file: %w", err)
+		}
+		sink = outFile
+	}
+
+	// A failed transfer must not leave a manifest that presents the parts
+	// written so far as a complete archive. Encrypted downloads cannot be
+	// resumed, so their partial ciphertext is removed as well.
+	var encrypter io.WriteCloser
+	closeFailed := func() {
+		if encrypter != nil {
+			abortEncryption(encrypter)
+		}
+		if chunks, ok := sink.(*chunkWriter); ok {
+			chunks.Abort()
+		} else {
+			sink.Close()
+		}
+		if opts.Encrypt == "" {
+			return
+		}
+		if opts.ChunkSize > 0 {
+			for _, part := range existingChunkParts(outputFile) {
+				os.Remove(part)
+			}
+		} else {
+			os.Remove(outputFile)
+		}
+	}
+
+	// Record enough state to resume the download if the transfer is
+	// interrupted
+	resumable := resumableDownload(algo, opts)
+	if resumable && offset == 0 {
+		err = saveDownloadState(outputFile, downloadState{
+			Volume:    volumeName,
+			Namespace: namespace,
+			ChunkSize: opts.ChunkSize,
+			Started:   time.Now().UTC(),
+		})
+		if err != nil {
+			closeFailed()
+			return err
+		}
+	}
+
+	// Hash the bytes exactly as they land on disk
+	var out io.Writer = io.MultiWriter(sink, archiveHash)
+	if opts.Encrypt != "" {
+		encrypter, err = newEncryptingWriter(opts.Encrypt, out)
+		if err != nil {
+			closeFailed()
+			return err
+		}
+		out = encrypter
+	}
+
+	var compressor io.WriteCloser
+	if podAlgo != algo {
+		compressor, err = newLocalCompressor(algo, opts.CompressionLevel, out)
+		if err != nil {
+			closeFailed()
+			return err
+		}
+		out = compressor
+	}
+
+	var summer *fileSummer
+	if opts.FileChecksums {
+		summer = newFileSummer(podAlgo)
+		out = io.MultiWriter(out, summer)
+	}
+
+	// The archive is byte-for-byte reproducible as long as the volume
+	// contents do not change, which is what makes resuming possible
+	skip := offset - int64(len(existingTail))
+	archiveCmd := podArchiveCommand(podAlgo, opts.CompressionLevel, mountPath, vm.Sparse, skip)
+	if offset > 0 {
+		out = &overlapVerifier{expected: existingTail, out: out}
+	}
+
+	// Percentages need the uncompressed size, which only a stream that
+	// is not compressed in the pod can be compared with
+	var total int64
+	if podAlgo == CompressNone {
+		total = vm.estimateTransfer(ctx, namespace, targetPod, containerName, mountPath)
+	}
+	progress := vm.startProgress("download", volumeName, total)
+	progress.bytes.Store(offset - int64(len(existingTail)))
+
+	// Execute tar command in the pod and stream output to file
+	err = vm.execInPodWithOutput(ctx, namespace, targetPod, containerName,
+		[]string{"sh", "-c", archiveCmd}, countWriter{w: out, n: &progress.bytes})
+	progress.finish(err)
+	if err != nil {
+		if summer != nil {
+			summer.Close(os.DevNull)
+		}
+		closeFailed()
+		if resumable {
+			vm.println("Download interrupted; re-run with --resume to continue where it left off.")
+		}
+		return err
+	}
+
+	if compressor != nil {
+		if err := compressor.Close(); err != nil {
+			closeFailed()
+			return fmt.Errorf("failed to finalize %s stream: %w", algo, err)
+		}
+	}
+
+	if encrypter != nil {
+		if err := encrypter.Close(); err != nil {
+			closeFailed()
+			return fmt.Errorf("failed to finalize encrypted archive: %w", err)
+		}
+	}
+
+	if err := sink.Close(); err != nil {
+		return fmt.Errorf("failed to finalize archive: %w", err)
+	}
+	if chunks, ok := sink.(*chunkWriter); ok {
+		vm.printf("Wrote %d chunk(s) and manifest %s.manifest.json\n", len(chunks.parts), outputFile)
+	}
+	removeDownloadState(outputFile)
+
+	sum := hex.EncodeToString(archiveHash.Sum(nil))
+	if err := writeChecksumFile(outputFile+".sha256", sum, filepath.Base(outputFile)); err != nil {
+		return err
+	}
+	vm.printf("SHA-256: %s\n", sum)
+
+	if summer != nil {
+		if err := summer.Close(outputFile + ".SHA256SUMS"); err != nil {
+			return fmt.Errorf("failed to compute file checksums: %w", err)
+		}
+		vm.printf("Wrote checksums for %d file(s) to %s.SHA256SUMS\n", len(summer.sums), filepath.Base(outputFile))
+	}
+
+	return nil
+}
+
+// CopyVolume replaces the contents of destVolume with those of sourceVolume
+// and removes the temporary resources used before the volume locks are
+// released.
+func (vm *VolumeManager) CopyVolume(ctx context.Context, sourceVolume, destVolume, namespace, storageClass string) error {
+	return vm.withVolumeLocks(ctx, []string{sourceVolume, destVolume}, func() error {
+		err := observeOperation("copy", func() error {
+			return vm.copyVolume(ctx, sourceVolume, destVolume, namespace, storageClass)
+		})
+		vm.recordCopyResult(ctx, sourceVolume, destVolume, err)
+		return vm.cleanupLocked(ctx, namespace, err, sourceVolume, destVolume)
+	})
+}
+
+func (vm *VolumeManager) copyVolume(ctx context.Context, sourceVolume, destVolume, namespace, storageClass string) error {
+	// Verify both volumes exist and get their pod/mount info
+	sourcePod, sourceMountPath, sourceContainer, err := vm.getVolumeInfo(ctx, sourceVolume, namespace, storageClass)
+	if err != nil {
+		return fmt.Errorf("source volume error: %w", err)
+	}
+
+	destPod, destMountPath, destContainer, err := vm.getVolumeInfo(ctx, destVolume, namespace, storageClass)
+	if err != nil {
+		return fmt.Errorf("destination volume error: %w", err)
+	}
+
+	vm.printf("Source Volume: %s\n", sourceVolume)
+	vm.printf("Source Pod: %s, Container: %s, Mount: %s\n", sourcePod, sourceContainer, sourceMountPath)
+	vm.printf("Destination Volume: %s\n", destVolume)
+	vm.printf("Destination Pod: %s, Container: %s, Mount: %s\n\n", destPod, destContainer, destMountPath)
+
+	vm.println("Copying volume contents...")
+
+	// Create a pipe to stream data from source to destination
+	// First, clear the destination directory
+	vm.println("Clearing destination directory...")
+	vm.recordVolumeEvent(ctx, destVolume, corev1.EventTypeNormal, "Wiped", fmt.Sprintf("contents deleted before copy from %s", sourceVolume))
+	err = vm.execInPod(ctx, namespace, destPod, destContainer,
+		[]string{"sh", "-c", fmt.Sprintf("rm -rf %s/* %s/.[^.] %s/..?*", destMountPath, destMountPath, destMountPath)})
+	if err != nil {
+		return fmt.Errorf("failed to clear destination: %w", err)
+	}
+
+	// Use tar to copy from source to destination via streaming
+	vm.println("Streaming data from source to destination...")
+
+	// First, let's verify the source has data
+	vm.println("Checking source volume contents...")
+	err = vm.execInPod(ctx, namespace, sourcePod, sourceContainer, []string{"ls", "-la", sourceMountPath})
+	if err != nil {
+		vm.printf("Warning: failed to list source contents: %v\n", err)
+	}
+
+	// Create a pipe to stream tar data from source to destination
+	err = vm.streamCopyWithProgress(ctx, "copy", sourceVolume, namespace, sourcePod, sourceContainer, sourceMountPath,
+		destPod, destContainer, destMountPath)
+	if err != nil {
+		return fmt.Errorf("failed to copy data: %w", err)
+	}
+
+	// Verify the copy worked
+	vm.println("Verifying destination volume contents...")
+	err = vm.execInPod(ctx, namespace, destPod, destContainer, []string{"ls", "-la", destMountPath})
+	if err != nil {
+		vm.printf("Warning: failed to list destination contents: %v\n", err)
+	}
+
+	return nil
+}
+
+func (vm *VolumeManager) getVolumeInfo(ctx context.Context, volumeName, namespace, storageClass string) (podName, mountPath, containerName string, err error) {
+	return vm.getVolumeInfoWith(ctx, volumeName, namespace, storageClass, nil)
+}
+
+// getVolumeInfoWith is getVolumeInfo with a hook that adjusts the spec of
+// a temporary pod, if one is created; see createTemporaryPodForLonghornWith.
+func (vm *VolumeManager) getVolumeInfoWith(ctx context.Context, volumeName, namespace, storageClass string, customize func(*corev1.PodSpec)) (podName, mountPath, containerName string, err error) {
+	// First, verify the Longhorn volume exists
+	volume, err := vm.Volume(ctx, volumeName)
+	if err != nil {
+		return "", "", "", fmt.Errorf("Longhorn volume %s not found: %w", volumeName, err)
+	}
+
+	// Check if volume already has a PV bound and is in use
+	var pvName string
+	var volumeInUse bool
+
+	if volume.PVName != "" {
+		pvName = volume.PVName
+		// Check if this PV is currently bound to a PVC and in use by a pod
+		volumeInUse, err = vm.IsVolumeInUse(ctx, pvName, namespace)
+		if err != nil {
+			return "", "", "", fmt.Errorf("failed to check if volume is in use: %w", err)
+		}
+	}
+
+	// If volume is in use, we need to handle the multi-attach scenario
+	if volumeInUse {
+		vm.printf("Volume %s is currently in use. Checking for existing access pod...\n", volumeName)
+
+		// Try to find the existing pod that's using this volume
+		podName, mountPath, containerName, err = vm.findExistingPodForVolume(ctx, pvName, namespace)
+		if err == nil {
+			vm.printf("Found existing pod %s using volume %s\n", podName, volumeName)
+			vm.recordVolumeEvent(ctx, volumeName, corev1.EventTypeNormal, "Accessed", fmt.Sprintf("accessed through running pod %s/%s", namespace, podName))
+			return podName, mountPath, containerName, nil
+		}
+
+		// If we can't find or use the existing pod, we need to create a snapshot-based copy
+		vm.printf("Cannot access volume %s directly (multi-attach limitation). Creating temporary snapshot-based access...\n", volumeName)
+		return vm.createSnapshotBasedAccess(ctx, volumeName, namespace, storageClass)
+	}
+
+	// If volume is not in use, proceed with normal temporary PV creation
+	if pvName == "" {
+		// Create temporary PV for this Longhorn volume
+		pvName, err = vm.createTemporaryPV(ctx, volumeName, namespace, storageClass)
+		if err != nil {
+			return "", "", "", fmt.Errorf("failed to create temporary PV: %w", err)
+		}
+	}
+
+	// Create temporary pod to access the volume
+	podName, mountPath, containerName, err = vm.createTemporaryPodForLonghornWith(ctx, volumeName, namespace, storageClass, customize)
+	if err == nil {
+		vm.recordVolumeEvent(ctx, volumeName, corev1.EventTypeNormal, "Mounted", fmt.Sprintf("mounted in temporary pod %s/%s", namespace, podName))
+	}
+	return podName, mountPath, containerName, err
+}
+
+func (vm *VolumeManager) execInPod(ctx context.Context, namespace, podName, containerName string, command []string) error {
+	return vm.streamExec(ctx, namespace, podName, containerName, command, nil, vm.output())
+}
+
+func (vm *VolumeManager) execInPodWithOutput(ctx context.Context, namespace, podName, containerName string, command []string, output io.Writer) error {
+	return vm.streamExec(ctx, namespace, podName, containerName, command, nil,
+		countingWriter{w: output, counter: bytesTransferred.WithLabelValues("from_pod")})
+}
+
+// streamCopyBetweenPods copies the contents of sourcePath in one pod to
+// destPath in another by piping tar between them, over CopyStreams pipes
+// if more than one is configured, and preserving holes if Sparse is set.
+// streamed, if not nil, counts the bytes of the tar streams.
+func (vm *VolumeManager) streamCopyBetweenPods(ctx context.Context, namespace, sourcePod, sourceContainer, sourcePath, destPod, destContainer, destPath string, streamed *atomic.Int64) error {
+	if vm.Sparse {
+		return vm.sparseStreamCopy(ctx, namespace, sourcePod, sourceContainer, sourcePath, destPod, destContainer, destPath, streamed)
+	}
+	return vm.tarStreamCopy(ctx, namespace, sourcePod, sourceContainer, sourcePath, destPod, destContainer, destPath, streamed)
+}
+
+// streamCopyWithProgress is streamCopyBetweenPods, reporting the progress
+// of operation on source, a volume or PVC, as it goes.
+func (vm *VolumeManager) streamCopyWithProgress(ctx context.Context, operation, source, namespace, sourcePod, sourceContainer, sourcePath, destPod, destContainer, destPath string) error {
+	total := vm.estimateTransfer(ctx, namespace, sourcePod, sourceContainer, sourcePath)
+	progress := vm.startProgress(operation, source, total)
+	err := vm.streamCopyBetweenPods(ctx, namespace, sourcePod, sourceContainer, sourcePath, destPod, destContainer, destPath, &progress.bytes)
+	progress.finish(err)
+	return err
+}
+
+// tarStreamCopy picks between one and several tar pipes. streamed, if not
+// nil, counts the bytes of the tar streams.
+func (vm *VolumeManager) tarStreamCopy(ctx context.Context, namespace, sourcePod, sourceContainer, sourcePath, destPod, destContainer, destPath string, streamed *atomic.Int64) error {
+	if vm.CopyStreams > 1 {
+		return vm.parallelStreamCopy(ctx, namespace, sourcePod, sourceContainer, sourcePath, destPod, destContainer, destPath, vm.CopyStreams, streamed)
+	}
+	return vm.singleStreamCopy(ctx, namespace, sourcePod, sourceContainer, sourcePath, destPod, destContainer, destPath, streamed)
+}
+
+func (vm *VolumeManager) singleStreamCopy(ctx context.Context, namespace, sourcePod, sourceContainer, sourcePath, destPod, destContainer, destPath string, streamed *atomic.Int64) error {
+	// Create a pipe for streaming data
+	reader, writer := io.Pipe()
+
+	// Error channel to capture errors from goroutines
+	errChan := make(chan error, 2)
+
+	// Start tar creation in source pod (producer). A failure is passed on
+	// through the pipe so the destination does not mistake a truncated
+	// stream for a complete one. The stream is hashed on its way through.
+	sent := sha256.New()
+	go func() {
+		err := vm.execInPodWithOutput(ctx, namespace, sourcePod, sourceContainer,
+			append(tarCreateArgs(vm.Sparse), "-C", sourcePath, "."), countWriter{w: io.MultiWriter(sent, writer), n: streamed})
+		writer.CloseWithError(err)
+		errChan <- err
+	}()
+
+	// Start tar extraction in destination pod (consumer), which hashes
+	// what it receives for comparison. If it fails, closing the reader
+	// unblocks the source instead of leaving it stuck on a full pipe.
+	go func() {
+		err := vm.extractVerified(ctx, namespace, destPod, destContainer, destPath, reader, sent)
+		if err != nil {
+			reader.CloseWithError(err)
+		}
+		errChan <- err
+	}()
+
+	// Wait for both operations to complete
+	for i := 0; i < 2; i++ {
+		if err := <-errChan; err != nil {
+			return fmt.Errorf("stream copy failed: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (vm *VolumeManager) execInPodWithInput(ctx context.Context, namespace, podName, containerName string, command []string, input io.Reader) error {
+	return vm.streamExec(ctx, namespace, podName, containerName, command,
+		countingReader{r: input, counter: bytesTransferred.WithLabelValues("to_pod")}, vm.output())
+}
+
+// streamExec runs command in the container through the manager's
+// executor, retrying sessions that fail before any data has moved. stdin
+// may be nil. Remote stderr goes to the manager's output, and its tail is
+// kept for the error.
+func (vm *VolumeManager) streamExec(ctx context.Context, namespace, podName, containerName string, command []string, stdin io.Reader, stdout io.Writer) error {
+	if vm.DryRun {
+		vm.dryRunf("exec in pod %s/%s: %s", namespace, podName, formatCommand(command))
+		return nil
+	}
+
+	stderr := newTailBuffer(stderrTailSize)
+	err := vm.execWithRetry(ctx, podName, func(started *atomic.Bool) error {
+		streams := remotecommand.StreamOptions{
+			Stdout: startedWriter{w: stdout, started: started},
+			Stderr: startedWriter{w: io.MultiWriter(vm.output(), stderr), started: started},
+		}
+		if stdin != nil {
+			streams.Stdin = startedReader{r: stdin, started: started}
+		}
+		return vm.executor.Exec(ctx, namespace, podName, containerName, command, streams)
+	})
+	if err != nil {
+		return execFailure(command, err, stderr)
+	}
+
+	return nil
+}
+
+// shellQuote quotes s for safe use as a single word in an sh -c command.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// ensureTemporaryPVC creates (if needed) the temporary PV and PVC that expose
+// a Longhorn volume in namespace, waits for the PVC to bind, and returns its
+// name.
+func (vm *VolumeManager) ensureTemporaryPVC(ctx context.Context, volumeName, namespace, storageClass string) (string, error) {
+	// Get volume info to determine size
+	volume, err := vm.Volume(ctx, volumeName)
+	if err != nil {
+		return "", fmt.Errorf("failed to get Longhorn volume info: %w", err)
+	}
+
+	// Create temporary PV if it doesn't exist
+	_, err = vm.createTemporaryPV(ctx, volumeName, namespace, storageClass)
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary PV: %w", err)
+	}
+
+	// Create a temporary PVC for this volume if it doesn't exist
+	pvcName := fmt.Sprintf("lhc-temp-pvc-%s", volumeName)
+	pvName := fmt.Sprintf("lhc-temp-pv-%s", volumeName)
+
+	// Check if temporary PVC already exists
+	_, err = vm.clientset.CoreV1().PersistentVolumeClaims(namespace).Get(ctx, pvcName, metav1.GetOptions{})
+	if err != nil && vm.DryRun {
+		vm.dryRunf("create PersistentVolumeClaim %s/%s bound to PV %s", namespace, pvcName, pvName)
+	} else if err != nil {
+		// Create temporary PVC that specifically binds to our temporary PV
+		pvc := &corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      pvcName,
+				Namespace: namespace,
+				Labels: map[string]string{
+					"app": "lhc-temp",
+				},
+				Annotations: vm.tempAnnotations(volumeName),
+			},
+			Spec: corev1.PersistentVolumeClaimSpec{
+				AccessModes: []corev1.PersistentVolumeAccessMode{
+					corev1.ReadWriteMany,
+				},
+				Resources: corev1.VolumeResourceRequirements{
+					Requests: corev1.ResourceList{
+						corev1.ResourceStorage: resource.MustParse(volume.Size),
+					},
+				},
+				StorageClassName: func() *string { return &storageClass }(),
+				VolumeName:       pvName, // Bind to specific PV
+			},
+		}
+
+		_, err = vm.clientset.CoreV1().PersistentVolumeClaims(namespace).Create(ctx, pvc, metav1.CreateOptions{})
+		if err != nil {
+			return "", fmt.Errorf("failed to create temporary PVC: %w", err)
+		}
+		vm.trackTemporary("pvc", namespace, pvc)
+
+		// Wait for PVC to be bound
+		if err := vm.waitForPVCBound(ctx, namespace, pvcName); err != nil {
+			return "", err
+		}
+	}
+
+	return pvcName, nil
+}
+
+func (vm *VolumeManager) createTemporaryPodForLonghorn(ctx context.Context, volumeName, namespace, storageClass string) (podName, mountPath, containerName string, err error) {
+	return vm.createTemporaryPodForLonghornWith(ctx, volumeName, namespace, storageClass, nil)
+}
+
+// createTemporaryPodForLonghornWith is createTemporaryPodForLonghorn with a
+// hook that adjusts the pod spec after the configured options are applied,
+// for operations that need more than file access. An already running
+// temporary pod is reused as is.
+func (vm *VolumeManager) createTemporaryPodForLonghornWith(ctx context.Context, volumeName, namespace, storageClass string, customize func(*corev1.PodSpec)) (podName, mountPath, containerName string, err error) {
+	pvcName, err := vm.ensureTemporaryPVC(ctx, volumeName, namespace, storageClass)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	mountPath = "/mnt/volume"
+	containerName = "temp-container"
+	podName = fmt.Sprintf("lhc-temp-pod-%s", volumeName)
+
+	// Check if temporary pod already exists and is running
+	existingPod, err := vm.clientset.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
+	if err == nil && existingPod.Status.Phase == corev1.PodRunning {
+		return podName, mountPath, containerName, nil
+	}
+
+	// Create temporary pod
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      podName,
+			Namespace: namespace,
+			Labels: map[string]string{
+				"app": "lhc-temp",
+			},
+			Annotations: vm.tempAnnotations(volumeName),
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name:  containerName,
+					Image: vm.tempPodImage(),
+					Command: []string{
+						"sleep",
+						tempPodSleepSeconds,
+					},
+					VolumeMounts: []corev1.VolumeMount{
+						{
+							Name:      "volume",
+							MountPath: mountPath,
+						},
+					},
+				},
+			},
+			Volumes: []corev1.Volume{
+				{
+					Name: "volume",
+					VolumeSource: corev1.VolumeSource{
+						PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+							ClaimName: pvcName,
+						},
+					},
+				},
+			},
+			RestartPolicy: corev1.RestartPolicyNever,
+		},
+	}
+
+	vm.applyTempPodOptions(ctx, &pod.Spec, volumeName)
+	if customize != nil {
+		customize(&pod.Spec)
+	}
+
+	if vm.DryRun {
+		vm.dryRunf("create pod %s/%s mounting PVC %s at %s", namespace, podName, pvcName, mountPath)
+		return podName, mountPath, containerName, nil
+	}
+
+	_, err = vm.clientset.CoreV1().Pods(namespace).Create(ctx, pod, metav1.CreateOptions{})
+	if err != nil {
+		return "", "", "", fmt.Errorf("failed to create temporary pod: %w", err)
+	}
+	vm.trackTemporary("pod", namespace, pod)
+
+	// Wait for pod to be running
+	if err := vm.waitForPodRunning(ctx, namespace, podName); err != nil {
+		return "", "", "", err
+	}
+
+	return podName, mountPath, containerName, nil
+}
+
+// createTemporaryPodForPVC starts a temporary pod that mounts an existing
+// PVC directly. Binding happens as the pod is scheduled, so this also works
+// for storage classes using WaitForFirstConsumer.
+func (vm *VolumeManager) createTemporaryPodForPVC(ctx context.Context, pvcName, namespace string, volumes ...string) (podName, mountPath, containerName string, err error) {
+	mountPath = "/mnt/volume"
+	containerName = "temp-container"
+	podName = fmt.Sprintf("lhc-temp-pod-%s", pvcName)
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      podName,
+			Namespace: namespace,
+			Labels: map[string]string{
+				"app": "lhc-temp",
+			},
+			Annotations: vm.tempAnnotations(volumes...),
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name:  containerName,
+					Image: vm.tempPodImage(),
+					Command: []string{
+						"sleep",
+						tempPodSleepSeconds,
+					},
+					VolumeMounts: []corev1.VolumeMount{
+						{
+							Name:      "volume",
+							MountPath: mountPath,
+						},
+					},
+				},
+			},
+			Volumes: []corev1.Volume{
+				{
+					Name: "volume",
+					VolumeSource: corev1.VolumeSource{
+						PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+							ClaimName: pvcName,
+						},
+					},
+				},
+			},
+			RestartPolicy: corev1.RestartPolicyNever,
+		},
+	}
+
+	vm.applyTempPodOptions(ctx, &pod.Spec)
+
+	if vm.DryRun {
+		vm.dryRunf("create pod %s/%s mounting PVC %s at %s", namespace, podName, pvcName, mountPath)
+		return podName, mountPath, containerName, nil
+	}
+
+	_, err = vm.clientset.CoreV1().Pods(namespace).Create(ctx, pod, metav1.CreateOptions{})
+	if err != nil {
+		return "", "", "", fmt.Errorf("failed to create temporary pod: %w", err)
+	}
+	vm.trackTemporary("pod", namespace, pod)
+
+	// Wait for pod to be running
+	if err := vm.waitForPodRunning(ctx, namespace, podName); err != nil {
+		return "", "", "", err
+	}
+
+	return podName, mountPath, containerName, nil
+}
+
+// Volumes lists the Longhorn volumes in the cluster.
+func (vm *VolumeManager) Volumes(ctx context.Context) ([]LonghornVolume, error) {
+	if vm.useManagerAPI() {
+		return vm.managerVolumes(ctx)
+	}
+	// Use dynamic client to get Longhorn volumes
+	result, err := vm.dynamicClient.Resource(longhornVolumeGVR).Namespace("longhorn-system").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list Longhorn volumes: %w", err)
+	}
+
+	volumes := make([]LonghornVolume, 0, len(result.Items))
+	for _, item := range result.Items {
+		volumes = append(volumes, parseLonghornVolume(&item))
+	}
+
+	return volumes, nil
+}
+
+// parseLonghornVolume extracts the fields of a Longhorn Volume resource.
+func parseLonghornVolume(item *unstructured.Unstructured) LonghornVolume {
+	volume := LonghornVolume{
+		Name:    item.GetName(),
+		State:   "Unknown",
+		Size:    "Unknown",
+		Created: item.GetCreationTimestamp().Time,
+	}
+
+	// Extract status
+	if status, found, err := unstructured.NestedMap(item.Object, "status"); found && err == nil {
+		if state, found, err := unstructured.NestedString(status, "state"); found && err == nil {
+			volume.State = state
+		}
+		if nodeID, found, err := unstructured.NestedString(status, "currentNodeID"); found && err == nil {
+			volume.NodeID = nodeID
+		}
+		if robustness, found, err := unstructured.NestedString(status, "robustness"); found && err == nil {
+			volume.Robustness = robustness
+		}
+		if actualSize, found, err := unstructured.NestedInt64(status, "actualSize"); found && err == nil {
+			volume.ActualSize = actualSize
+		}
+		if image, found, err := unstructured.NestedString(status, "currentImage"); found && err == nil {
+			volume.EngineImage = image
+		}
+	}
+
+	// Extract spec
+	if spec, found, err := unstructured.NestedMap(item.Object, "spec"); found && err == nil {
+		if size, found, err := unstructured.NestedString(spec, "size"); found && err == nil {
+			volume.Size = size
+		}
+		if replicas, found, err := unstructured.NestedInt64(spec, "numberOfReplicas"); found && err == nil {
+			volume.Replicas = replicas
+		}
+		if frontend, found, err := unstructured.NestedString(spec, "frontend"); found && err == nil {
+			volume.Frontend = frontend
+		}
+	}
+
+	// Extract PV name from kubernetesStatus
+	if status, found, err := unstructured.NestedMap(item.Object, "status"); found && err == nil {
+		if kubernetesStatus, found, err := unstructured.NestedMap(status, "kubernetesStatus"); found && err == nil {
+			if pvName, found, err := unstructured.NestedString(kubernetesStatus, "pvName"); found && err == nil {
+				volume.PVName = pvName
+			}
+			if pvcNamespace, found, err := unstructured.NestedString(kubernetesStatus, "namespace"); found && err == nil {
+				volume.PVCNamespace = pvcNamespace
+			}
+			if pvcName, found, err := unstructured.NestedString(kubernetesStatus, "pvcName"); found && err == nil {
+				volume.PVCName = pvcName
+			}
+		}
+	}
+
+	return volume
+}
+
+// Volume returns one Longhorn volume by name.
+func (vm *VolumeManager) Volume(ctx context.Context, volumeName string) (*LonghornVolume, error) {
+	volumes, err := vm.Volumes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, volume := range volumes {
+		if volume.Name == volumeName {
+			return &volume, nil
+		}
+	}
+
+	return nil, categorize(ErrVolumeNotFound, fmt.Errorf("Longhorn volume %s not found", volumeName))
+}
+
+func (vm *VolumeManager) createTemporaryPV(ctx context.Context, volumeName, namespace, storageClass string) (string, error) {
+	pvName := fmt.Sprintf("lhc-temp-pv-%s", volumeName)
+
+	// Check if PV already exists
+	_, err := vm.clientset.CoreV1().PersistentVolumes().Get(ctx, pvName, metav1.GetOptions{})
+	if err == nil {
+		return pvName, nil // PV already exists
+	}
+
+	// Get volume info
+	volume, err := vm.Volume(ctx, volumeName)
+	if err != nil {
+		return "", fmt.Errorf("failed to get Longhorn volume info: %w", err)
+	}
+
+	// Create temporary PV that references the existing Longhorn volume
+	pv := &corev1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: pvName,
+			Labels: map[string]string{
+				"app": "lhc-temp",
+			},
+			Annotations: vm.tempAnnotations(volumeName),
+		},
+		Spec: corev1.PersistentVolumeSpec{
+			Capacity: corev1.ResourceList{
+				corev1.ResourceStorage: resource.MustParse(volume.Size),
+			},
+			AccessModes: []corev1.PersistentVolumeAccessMode{
+				corev1.ReadWriteMany,
+			},
+			PersistentVolumeReclaimPolicy: corev1.PersistentVolumeReclaimRetain,
+			StorageClassName:              storageClass,
+			PersistentVolumeSource: corev1.PersistentVolumeSource{
+				CSI: &corev1.CSIPersistentVolumeSource{
+					Driver:       "driver.longhorn.io",
+					VolumeHandle: volumeName, // This should match the Longhorn volume name exactly
+					FSType:       "ext4",
+					VolumeAttributes: map[string]string{
+						"numberOfReplicas":    "3",
+						"staleReplicaTimeout": "2880",
+					},
+				},
+			},
+		},
+	}
+
+	if vm.DryRun {
+		vm.dryRunf("create PersistentVolume %s for Longhorn volume %s", pvName, volumeName)
+		return pvName, nil
+	}
+
+	_, err = vm.clientset.CoreV1().PersistentVolumes().Create(ctx, pv, metav1.CreateOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary PV: %w", err)
+	}
+	vm.trackTemporary("pv", "", pv)
+
+	return pvName, nil
+}
+
+// cleanupLocked deletes the temporary resources of volumes while the
+// caller still holds their locks, so that a run waiting for a lock is never
+// handed a temporary pod that is about to be deleted. Leftovers only fail
+// an operation that succeeded otherwise.
+func (vm *VolumeManager) cleanupLocked(ctx context.Context, namespace string, err error, volumes ...string) error {
+	ctx = context.WithoutCancel(ctx)
+	var cleanupErr error
+	for _, volumeName := range volumes {
+		cleanupErr = errors.Join(cleanupErr, vm.CleanupVolumeResources(ctx, volumeName, namespace))
+	}
+	if err != nil {
+		return err
+	}
+	return cleanupErr
+}
+
+// CleanupVolumeResources deletes the temporary pod, PVC, and PV created
+// for volumeName in namespace, if they exist. It fails with
+// ErrPartialCleanup if any of them remains.
+func (vm *VolumeManager) CleanupVolumeResources(ctx context.Context, volumeName, namespace string) error {
+	pvcName := fmt.Sprintf("lhc-temp-pvc-%s", volumeName)
+	podName := fmt.Sprintf("lhc-temp-pod-%s", volumeName)
+	pvName := fmt.Sprintf("lhc-temp-pv-%s", volumeName)
+
+	if vm.DryRun {
+		vm.dryRunf("delete pod %s/%s, PersistentVolumeClaim %s/%s, and PersistentVolume %s if present",
+			namespace, podName, namespace, pvcName, pvName)
+		return nil
+	}
+
+	// Resources that were never created are not a failure
+	var failed []string
+
+	// Delete temporary pod
+	err := vm.clientset.CoreV1().Pods(namespace).Delete(ctx, podName, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		vm.printf("Warning: failed to delete temporary pod %s: %v\n", podName, err)
+		failed = append(failed, "pod "+podName)
+	}
+
+	// Delete temporary PVC
+	err = vm.clientset.CoreV1().PersistentVolumeClaims(namespace).Delete(ctx, pvcName, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		vm.printf("Warning: failed to delete temporary PVC %s: %v\n", pvcName, err)
+		failed = append(failed, "PVC "+pvcName)
+	}
+
+	// Delete temporary PV
+	err = vm.clientset.CoreV1().PersistentVolumes().Delete(ctx, pvName, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		vm.printf("Warning: failed to delete temporary PV %s: %v\n", pvName, err)
+		failed = append(failed, "PV "+pvName)
+	}
+
+	if len(failed) > 0 {
+		return categorize(ErrPartialCleanup, fmt.Errorf("failed to delete temporary %s of volume %s", strings.Join(failed, ", "), volumeName))
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+package longhorntools
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// newFakeVolume returns a Longhorn Volume resource as the dynamic client
+// lists it.
+func newFakeVolume(name, state, pvcNamespace, pvcName string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "longhorn.io/v1beta2",
+		"kind":       "Volume",
+		"metadata": map[string]interface{}{
+			"name":      name,
+			"namespace": "longhorn-system",
+		},
+		"spec": map[string]interface{}{
+			"size":             "1073741824",
+			"numberOfReplicas": int64(3),
+			"frontend":         "blockdev",
+		},
+		"status": map[string]interface{}{
+			"state":      state,
+			"robustness": "healthy",
+			"actualSize": int64(4096),
+			"kubernetesStatus": map[string]interface{}{
+				"pvName":    "pv-" + name,
+				"namespace": pvcNamespace,
+				"pvcName":   pvcName,
+			},
+		},
+	}}
+}
+
+// fakeListKinds names the list kind of every Longhorn resource the manager
+// lists, which the fake dynamic client cannot guess.
+var fakeListKinds = map[schema.GroupVersionResource]string{
+	longhornVolumeGVR:  "VolumeList",
+	longhornReplicaGVR: "ReplicaList",
+	longhornEngineGVR:  "EngineList",
+	longhornNodeGVR:    "NodeList",
+	longhornOrphanGVR:  "OrphanList",
+}
+
+// newFakeVolumeManager returns a manager backed by fake clients holding the
+// Longhorn resources in longhorn and the Kubernetes objects in objects.
+func newFakeVolumeManager(longhorn []*unstructured.Unstructured, objects ...runtime.Object) *VolumeManager {
+	dynamicObjects := make([]runtime.Object, 0, len(longhorn))
+	for _, obj := range longhorn {
+		dynamicObjects = append(dynamicObjects, obj)
+	}
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), fakeListKinds, dynamicObjects...)
+	return NewVolumeManagerWithClients(fake.NewSimpleClientset(objects...), dynamicClient, nil)
+}
+
+func longhornPV(name, volumeHandle string) *corev1.PersistentVolume {
+	return &corev1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: corev1.PersistentVolumeSpec{
+			PersistentVolumeSource: corev1.PersistentVolumeSource{
+				CSI: &corev1.CSIPersistentVolumeSource{Driver: "driver.longhorn.io", VolumeHandle: volumeHandle},
+			},
+		},
+	}
+}
+
+func boundPVC(namespace, name, pvName string) *corev1.PersistentVolumeClaim {
+	return &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Spec:       corev1.PersistentVolumeClaimSpec{VolumeName: pvName},
+	}
+}
+
+func TestVolumes(t *testing.T) {
+	vm := newFakeVolumeManager([]*unstructured.Unstructured{
+		newFakeVolume("vol-a", "attached", "apps", "data"),
+		newFakeVolume("vol-b", "detached", "", ""),
+	})
+
+	volumes, err := vm.Volumes(context.Background())
+	if err != nil {
+		t.Fatalf("Volumes: %v", err)
+	}
+	if len(volumes) != 2 {
+		t.Fatalf("got %d volumes, want 2", len(volumes))
+	}
+
+	volume, err := vm.Volume(context.Background(), "vol-a")
+	if err != nil {
+		t.Fatalf("Volume: %v", err)
+	}
+	want := LonghornVolume{
+		Name:         "vol-a",
+		State:        "attached",
+		Size:         "1073741824",
+		Robustness:   "healthy",
+		ActualSize:   4096,
+		Replicas:     3,
+		Frontend:     "blockdev",
+		PVName:       "pv-vol-a",
+		PVCNamespace: "apps",
+		PVCName:      "data",
+		Created:      volume.Created,
+	}
+	if *volume != want {
+		t.Errorf("Volume = %+v, want %+v", *volume, want)
+	}
+
+	if _, err := vm.Volume(context.Background(), "missing"); !errors.Is(err, ErrVolumeNotFound) {
+		t.Errorf("Volume(missing) = %v, want ErrVolumeNotFound", err)
+	}
+}
+
+func TestResolveVolume(t *testing.T) {
+	vm := newFakeVolumeManager(
+		[]*unstructured.Unstructured{newFakeVolume("vol-a", "detached", "", "")},
+		longhornPV("pv-a", "vol-a"),
+		boundPVC("apps", "data", "pv-a"),
+		boundPVC("apps", "pending", ""),
+		&corev1.PersistentVolume{ObjectMeta: metav1.ObjectMeta{Name: "pv-nfs"}},
+	)
+
+	tests := []struct {
+		identifier string
+		want       string
+		category   error
+	}{
+		{identifier: "vol-a", want: "vol-a"},
+		{identifier: "data", want: "vol-a"},
+		{identifier: "pv-a", want: "vol-a"},
+		{identifier: "pvc:data", want: "vol-a"},
+		{identifier: "pvc:apps/data", want: "vol-a"},
+		{identifier: "pv:pv-a", want: "vol-a"},
+		{identifier: "pvc:other/data", category: ErrVolumeNotFound},
+		{identifier: "pv:missing", category: ErrVolumeNotFound},
+		{identifier: "missing", category: ErrVolumeNotFound},
+		{identifier: "pvc:pending"},
+		{identifier: "pv:pv-nfs"},
+		{identifier: "pvc:"},
+	}
+	for _, tt := range tests {
+		got, err := vm.ResolveVolume(context.Background(), tt.identifier, "apps")
+		if tt.want != "" {
+			if err != nil || got != tt.want {
+				t.Errorf("ResolveVolume(%q) = %q, %v; want %q", tt.identifier, got, err, tt.want)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("ResolveVolume(%q) = %q, want an error", tt.identifier, got)
+			continue
+		}
+		if tt.category != nil && !errors.Is(err, tt.category) {
+			t.Errorf("ResolveVolume(%q) = %v, want %v", tt.identifier, err, tt.category)
+		}
+	}
+}
+
+func TestParseFileEntries(t *testing.T) {
+	listing := "12 1700000000 -rw-r--r-- /data/a.txt\n" +
+		"0 1700000001 -rw------- /data/dir/with space.bin\n" +
+		"5 1700000002 -rw-r--r-- /data/name\n" +
+		"continued\n" +
+		"x 1700000003 -rw-r--r-- /data/bad-size\n" +
+		"\n"
+
+	got := parseFileEntries(listing, "/data")
+	want := []FileEntry{
+		{Path: "a.txt", Size: 12, Mode: "-rw-r--r--", ModTime: time.Unix(1700000000, 0)},
+		{Path: "dir/with space.bin", Size: 0, Mode: "-rw-------", ModTime: time.Unix(1700000001, 0)},
+		{Path: "name", Size: 5, Mode: "-rw-r--r--", ModTime: time.Unix(1700000002, 0)},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d entries, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("entry %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package longhorntools
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// eventObject identifies the object an event is about. Namespace is empty
+// for cluster-scoped objects, whose events may be recorded in any
+// namespace.
+type eventObject struct {
+	kind, namespace, name string
+}
+
+// VolumeEvents returns the Kubernetes events about volumeName, or about
+// every Longhorn volume if volumeName is empty, oldest first. Events are
+// gathered for the Longhorn Volume, its engines and replicas, its PV and
+// PVC, the VolumeAttachments of the PV, and the pods using the PVC. Events
+// last seen before since are dropped; a zero since keeps all of them.
+func (vm *VolumeManager) VolumeEvents(ctx context.Context, volumeName string, since time.Time) ([]corev1.Event, error) {
+	var volumes []LonghornVolume
+	if volumeName != "" {
+		volume, err := vm.Volume(ctx, volumeName)
+		if err != nil {
+			return nil, err
+		}
+		volumes = []LonghornVolume{*volume}
+	} else {
+		var err error
+		if volumes, err = vm.Volumes(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	objects := make(map[eventObject]bool)
+	pvNames := make(map[string]bool)
+	for _, volume := range volumes {
+		objects[eventObject{"Volume", "longhorn-system", volume.Name}] = true
+		// Longhorn 1.5+ tracks attach requests in its own VolumeAttachment
+		objects[eventObject{"VolumeAttachment", "longhorn-system", volume.Name}] = true
+		if volume.PVName != "" {
+			objects[eventObject{"PersistentVolume", "", volume.PVName}] = true
+			pvNames[volume.PVName] = true
+		}
+		if volume.PVCName != "" {
+			objects[eventObject{"PersistentVolumeClaim", volume.PVCNamespace, volume.PVCName}] = true
+			pods, err := vm.podsUsingClaim(ctx, volume.PVCNamespace, volume.PVCName)
+			if err != nil {
+				return nil, err
+			}
+			for _, pod := range pods {
+				objects[eventObject{"Pod", pod.Namespace, pod.Name}] = true
+			}
+		}
+	}
+
+	// Replicas and engines are best effort, as in DescribeVolume
+	replicas, err := vm.VolumeReplicas(ctx, volumeName)
+	if err == nil {
+		for _, r := range replicas {
+			objects[eventObject{"Replica", "longhorn-system", r.Name}] = true
+		}
+	}
+	engines, err := vm.VolumeEngines(ctx, volumeName)
+	if err == nil {
+		for _, e := range engines {
+			objects[eventObject{"Engine", "longhorn-system", e.Name}] = true
+		}
+	}
+
+	// CSI attach and detach happen through storage.k8s.io VolumeAttachments
+	if len(pvNames) > 0 {
+		attachments, err := vm.clientset.StorageV1().VolumeAttachments().List(ctx, metav1.ListOptions{})
+		if err == nil {
+			for _, va := range attachments.Items {
+				if pv := va.Spec.Source.PersistentVolumeName; pv != nil && pvNames[*pv] {
+					objects[eventObject{"VolumeAttachment", "", va.Name}] = true
+				}
+			}
+		}
+	}
+
+	events, err := vm.clientset.CoreV1().Events(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list events: %w", err)
+	}
+
+	var result []corev1.Event
+	for _, event := range events.Items {
+		ref := event.InvolvedObject
+		if !objects[eventObject{ref.Kind, ref.Namespace, ref.Name}] && !objects[eventObject{ref.Kind, "", ref.Name}] {
+			continue
+		}
+		if !since.IsZero() && eventTime(event).Before(since) {
+			continue
+		}
+		result = append(result, event)
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return eventTime(result[i]).Before(eventTime(result[j]))
+	})
+	return result, nil
+}
@@ -0,0 +1,324 @@
+package longhorntools
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+	watchtools "k8s.io/client-go/tools/watch"
+)
+
+// Default wait limits, used when --wait-timeout is not set.
+const (
+	defaultPVCBindTimeout  = 60 * time.Second
+	defaultPodReadyTimeout = 2 * time.Minute
+	defaultJobStartTimeout = 5 * time.Minute
+)
+
+// maxDiagnosticEvents caps how many events are included in a wait error.
+const maxDiagnosticEvents = 10
+
+// waitTimeoutOr returns --wait-timeout if set, otherwise def.
+func (vm *VolumeManager) waitTimeoutOr(def time.Duration) time.Duration {
+	if vm.WaitTimeout > 0 {
+		return vm.WaitTimeout
+	}
+	return def
+}
+
+// waitForPVCBound watches the claim until it is bound, printing each phase
+// change. On timeout the error includes the claim's events.
+func (vm *VolumeManager) waitForPVCBound(ctx context.Context, namespace, pvcName string) error {
+	timeout := vm.waitTimeoutOr(defaultPVCBindTimeout)
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	pvcs := vm.clientset.CoreV1().PersistentVolumeClaims(namespace)
+	lw := newListWatch(metav1.ListOptions{FieldSelector: fields.OneTermEqualSelector("metadata.name", pvcName).String()},
+		func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+			return pvcs.List(ctx, opts)
+		},
+		func(ctx context.Context, opts metav1.ListOptions) (watch.Interface, error) {
+			return pvcs.Watch(ctx, opts)
+		})
+
+	vm.printf("Waiting for PVC %s to be bound...\n", pvcName)
+	var phase corev1.PersistentVolumeClaimPhase
+	_, err := watchtools.UntilWithSync(waitCtx, lw, &corev1.PersistentVolumeClaim{}, nil, func(event watch.Event) (bool, error) {
+		// The fake clients of offline mode ignore the field selector
+		pvc, ok := event.Object.(*corev1.PersistentVolumeClaim)
+		if !ok || pvc.Name != pvcName {
+			return false, nil
+		}
+		if event.Type == watch.Deleted {
+			return false, fmt.Errorf("PVC %s was deleted while waiting for it to bind", pvcName)
+		}
+		if pvc.Status.Phase != phase {
+			phase = pvc.Status.Phase
+			vm.printf("  PVC %s: %s\n", pvcName, phase)
+		}
+		if pvc.Status.Phase == corev1.ClaimBound {
+			vm.printf("PVC %s is now bound to PV %s\n", pvcName, pvc.Spec.VolumeName)
+			return true, nil
+		}
+		return false, nil
+	})
+	if err == nil {
+		return nil
+	}
+	if waitCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+		return categorize(ErrAttachTimeout, fmt.Errorf("PVC %s was not bound within %s (phase %s; use --wait-timeout to wait longer)%s",
+			pvcName, timeout, phase, vm.eventDiagnostics(ctx, "PersistentVolumeClaim", namespace, pvcName)))
+	}
+	return fmt.Errorf("failed waiting for PVC %s: %w", pvcName, err)
+}
+
+// waitForPVCDeleted polls until the claim is gone. Deletion waits for the
+// pods using the claim to go away, so this can take a while.
+func (vm *VolumeManager) waitForPVCDeleted(ctx context.Context, namespace, pvcName string) error {
+	timeout := vm.waitTimeoutOr(defaultPVCBindTimeout)
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		_, err := vm.clientset.CoreV1().PersistentVolumeClaims(namespace).Get(waitCtx, pvcName, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		select {
+		case <-waitCtx.Done():
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("PVC %s was not deleted within %s (use --wait-timeout to wait longer)%s",
+				pvcName, timeout, vm.eventDiagnostics(ctx, "PersistentVolumeClaim", namespace, pvcName))
+		case <-ticker.C:
+		}
+	}
+}
+
+// waitForPodRunning watches the pod until it is running, printing each
+// state change. If it times out or the pod exits first, the error includes
+// the pod's status and the events of the pod and the claims it mounts.
+func (vm *VolumeManager) waitForPodRunning(ctx context.Context, namespace, podName string) error {
+	timeout := vm.waitTimeoutOr(defaultPodReadyTimeout)
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	pods := vm.clientset.CoreV1().Pods(namespace)
+	lw := newListWatch(metav1.ListOptions{FieldSelector: fields.OneTermEqualSelector("metadata.name", podName).String()},
+		func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+			return pods.List(ctx, opts)
+		},
+		func(ctx context.Context, opts metav1.ListOptions) (watch.Interface, error) {
+			return pods.Watch(ctx, opts)
+		})
+
+	vm.printf("Waiting for temporary pod %s to be ready...\n", podName)
+	var last *corev1.Pod
+	state := ""
+	_, err := watchtools.UntilWithSync(waitCtx, lw, &corev1.Pod{}, nil, func(event watch.Event) (bool, error) {
+		pod, ok := event.Object.(*corev1.Pod)
+		if !ok || pod.Name != podName {
+			return false, nil
+		}
+		if event.Type == watch.Deleted {
+			return false, fmt.Errorf("temporary pod %s was deleted while waiting for it to start", podName)
+		}
+		last = pod
+		if s := podState(pod); s != state {
+			state = s
+			vm.printf("  Pod %s: %s\n", podName, state)
+		}
+		switch pod.Status.Phase {
+		case corev1.PodRunning:
+			return true, nil
+		case corev1.PodSucceeded, corev1.PodFailed:
+			return false, fmt.Errorf("temporary pod %s exited before becoming ready%s", podName, vm.podDiagnostics(ctx, pod))
+		}
+		return false, nil
+	})
+	if err == nil {
+		return nil
+	}
+	if waitCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+		diagnostics := ""
+		if last != nil {
+			diagnostics = vm.podDiagnostics(ctx, last)
+		}
+		return categorize(ErrAttachTimeout, fmt.Errorf("temporary pod %s did not become ready within %s (use --wait-timeout to wait longer)%s",
+			podName, timeout, diagnostics))
+	}
+	return err
+}
+
+// waitForVolume watches the Longhorn volume until done reports true for
+// it. what completes the timeout message "volume %s was not <what>".
+func (vm *VolumeManager) waitForVolume(ctx context.Context, volumeName, what string, def time.Duration, done func(*unstructured.Unstructured) bool) error {
+	timeout := vm.waitTimeoutOr(def)
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	volumes := vm.dynamicClient.Resource(longhornVolumeGVR).Namespace("longhorn-system")
+	lw := newListWatch(metav1.ListOptions{FieldSelector: fields.OneTermEqualSelector("metadata.name", volumeName).String()},
+		func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+			return volumes.List(ctx, opts)
+		},
+		func(ctx context.Context, opts metav1.ListOptions) (watch.Interface, error) {
+			return volumes.Watch(ctx, opts)
+		})
+
+	_, err := watchtools.UntilWithSync(waitCtx, lw, &unstructured.Unstructured{}, nil, func(event watch.Event) (bool, error) {
+		// The fake clients of offline mode ignore the field selector
+		obj, ok := event.Object.(*unstructured.Unstructured)
+		if !ok || obj.GetName() != volumeName {
+			return false, nil
+		}
+		if event.Type == watch.Deleted {
+			return false, fmt.Errorf("volume %s was deleted while waiting", volumeName)
+		}
+		return done(obj), nil
+	})
+	if err == nil {
+		return nil
+	}
+	if waitCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+		return fmt.Errorf("volume %s was not %s within %s (use --wait-timeout to wait longer)%s",
+			volumeName, what, timeout, vm.eventDiagnostics(ctx, "Volume", "longhorn-system", volumeName))
+	}
+	return fmt.Errorf("failed waiting for volume %s: %w", volumeName, err)
+}
+
+// newListWatch builds a ListerWatcher from typed List and Watch calls,
+// restricted to the selectors in opts.
+func newListWatch(opts metav1.ListOptions, list cache.ListWithContextFunc, watchFn cache.WatchFuncWithContext) *cache.ListWatch {
+	return &cache.ListWatch{
+		ListWithContextFunc: func(ctx context.Context, options metav1.ListOptions) (runtime.Object, error) {
+			options.FieldSelector = opts.FieldSelector
+			options.LabelSelector = opts.LabelSelector
+			return list(ctx, options)
+		},
+		WatchFuncWithContext: func(ctx context.Context, options metav1.ListOptions) (watch.Interface, error) {
+			options.FieldSelector = opts.FieldSelector
+			options.LabelSelector = opts.LabelSelector
+			return watchFn(ctx, options)
+		},
+	}
+}
+
+// podState summarizes a pod's progress for status output, e.g.
+// "Pending (ContainerCreating)" or "Pending (Unschedulable)".
+func podState(pod *corev1.Pod) string {
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.State.Waiting != nil && status.State.Waiting.Reason != "" {
+			return fmt.Sprintf("%s (%s)", pod.Status.Phase, status.State.Waiting.Reason)
+		}
+	}
+	for _, cond := range pod.Status.Conditions {
+		if cond.Status != corev1.ConditionTrue && cond.Reason != "" {
+			return fmt.Sprintf("%s (%s)", pod.Status.Phase, cond.Reason)
+		}
+	}
+	return string(pod.Status.Phase)
+}
+
+// podDiagnostics describes why a pod is not running: its phase, unmet
+// conditions, waiting or terminated containers, and recent events for the
+// pod and its PVCs. The result starts with a newline so it can be appended
+// to an error message.
+func (vm *VolumeManager) podDiagnostics(ctx context.Context, pod *corev1.Pod) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "\n  Pod phase: %s", pod.Status.Phase)
+
+	for _, cond := range pod.Status.Conditions {
+		if cond.Status == corev1.ConditionTrue {
+			continue
+		}
+		fmt.Fprintf(&b, "\n  Condition %s=%s", cond.Type, cond.Status)
+		if cond.Reason != "" {
+			fmt.Fprintf(&b, ": %s", cond.Reason)
+		}
+		if cond.Message != "" {
+			fmt.Fprintf(&b, " (%s)", cond.Message)
+		}
+	}
+
+	for _, status := range pod.Status.ContainerStatuses {
+		switch {
+		case status.State.Waiting != nil:
+			fmt.Fprintf(&b, "\n  Container %s waiting: %s", status.Name, status.State.Waiting.Reason)
+			if status.State.Waiting.Message != "" {
+				fmt.Fprintf(&b, " (%s)", status.State.Waiting.Message)
+			}
+		case status.State.Terminated != nil:
+			fmt.Fprintf(&b, "\n  Container %s terminated: %s (exit code %d)", status.Name,
+				status.State.Terminated.Reason, status.State.Terminated.ExitCode)
+		}
+	}
+
+	b.WriteString(vm.eventDiagnostics(ctx, "Pod", pod.Namespace, pod.Name))
+	for _, volume := range pod.Spec.Volumes {
+		if volume.PersistentVolumeClaim != nil {
+			b.WriteString(vm.eventDiagnostics(ctx, "PersistentVolumeClaim", pod.Namespace, volume.PersistentVolumeClaim.ClaimName))
+		}
+	}
+
+	return b.String()
+}
+
+// eventDiagnostics formats the most recent events for an object, oldest
+// first, or returns "" if there are none. Failures to list events are
+// ignored; the diagnostics are best effort.
+func (vm *VolumeManager) eventDiagnostics(ctx context.Context, kind, namespace, name string) string {
+	selector := fields.Set{
+		"involvedObject.kind": kind,
+		"involvedObject.name": name,
+	}.AsSelector().String()
+
+	events, err := vm.clientset.CoreV1().Events(namespace).List(ctx, metav1.ListOptions{FieldSelector: selector})
+	if err != nil || len(events.Items) == 0 {
+		return ""
+	}
+
+	items := events.Items
+	sort.Slice(items, func(i, j int) bool {
+		return eventTime(items[i]).Before(eventTime(items[j]))
+	})
+	if len(items) > maxDiagnosticEvents {
+		items = items[len(items)-maxDiagnosticEvents:]
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "\n  Events for %s %s:", kind, name)
+	for _, event := range items {
+		fmt.Fprintf(&b, "\n    %s %s: %s", event.Type, event.Reason, strings.TrimSpace(event.Message))
+		if event.Count > 1 {
+			fmt.Fprintf(&b, " (x%d)", event.Count)
+		}
+	}
+	return b.String()
+}
+
+// eventTime returns when an event last occurred.
+func eventTime(event corev1.Event) time.Time {
+	switch {
+	case !event.LastTimestamp.IsZero():
+		return event.LastTimestamp.Time
+	case !event.EventTime.IsZero():
+		return event.EventTime.Time
+	default:
+		return event.CreationTimestamp.Time
+	}
+}
@@ -0,0 +1,217 @@
+package longhorntools
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DefaultWebDAVImage serves a directory over WebDAV with
+// "rclone serve webdav". It runs unprivileged, so it also works with the
+// restricted security profile.
+const DefaultWebDAVImage = "rclone/rclone:1"
+
+const (
+	// webDAVPath is where the volume is mounted in the WebDAV server pod.
+	webDAVPath = "/data"
+	// webDAVPort is the port the server listens on in the pod.
+	webDAVPort = 8080
+)
+
+// WebDAVOptions controls ServeWebDAV.
+type WebDAVOptions struct {
+	// ReadOnly serves the volume without write access.
+	ReadOnly bool
+
+	// LocalPort is the port on 127.0.0.1 forwarded to the server; 0 picks
+	// a free one.
+	LocalPort int
+
+	// Image is the WebDAV server image; empty means DefaultWebDAVImage.
+	Image string
+}
+
+// WebDAVServer describes a running WebDAV server of a volume.
+type WebDAVServer struct {
+	Volume    string `json:"volume"`
+	Namespace string `json:"namespace"`
+	Pod       string `json:"pod"`
+	ReadOnly  bool   `json:"readOnly"`
+	// URL is the forwarded address on this machine.
+	URL string `json:"url"`
+	// Expires is when the server stops and its resources may be reaped.
+	Expires time.Time `json:"expires"`
+}
+
+// ServeWebDAV serves volumeName over WebDAV from a temporary pod in
+// namespace and forwards a local port to it, so the volume can be mounted
+// on this machine. Once the server is reachable, ready is called with its
+// URL; the function it returns, if any, is called before the server is
+// stopped, e.g. to unmount it. The server runs until ctx is cancelled or
+// the temporary resources' TTL passes, and the volume stays locked for as
+// long. It then removes the pod and its PVC and PV.
+//
+// The volume must not be in use by a pod, as with the other operations
+// that mount it.
+func (vm *VolumeManager) ServeWebDAV(ctx context.Context, volumeName, namespace, storageClass string, opts WebDAVOptions, ready func(*WebDAVServer) func()) error {
+	return vm.withVolumeLocks(ctx, []string{volumeName}, func() error {
+		err := vm.serveWebDAV(ctx, volumeName, namespace, storageClass, opts, ready)
+		vm.recordOperationResult(ctx, volumeName, "WebDAVServed", "WebDAVFailed", "WebDAV mount", err)
+		return err
+	})
+}
+
+func (vm *VolumeManager) serveWebDAV(ctx context.Context, volumeName, namespace, storageClass string, opts WebDAVOptions, ready func(*WebDAVServer) func()) error {
+	volume, err := vm.Volume(ctx, volumeName)
+	if err != nil {
+		return err
+	}
+	if volume.PVCName != "" {
+		pods, err := vm.podsUsingClaim(ctx, volume.PVCNamespace, volume.PVCName)
+		if err != nil {
+			return err
+		}
+		for _, pod := range pods {
+			if pod.Status.Phase != corev1.PodSucceeded && pod.Status.Phase != corev1.PodFailed {
+				return categorize(ErrVolumeInUse, fmt.Errorf("pod %s/%s uses PVC %s; delete it or scale down its workload before mounting volume %s",
+					pod.Namespace, pod.Name, volume.PVCName, volumeName))
+			}
+		}
+	}
+
+	localPort := opts.LocalPort
+	if localPort == 0 && !vm.DryRun {
+		if localPort, err = freeLocalPort(); err != nil {
+			return fmt.Errorf("cannot find a free local port: %w", err)
+		}
+	}
+
+	podName := "lhc-temp-webdav-" + volumeName
+	pvcName := fmt.Sprintf("lhc-temp-pvc-%s", volumeName)
+	pvName := fmt.Sprintf("lhc-temp-pv-%s", volumeName)
+	defer func() {
+		// ctx is usually cancelled by now
+		cleanupCtx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		vm.printf("Stopping the WebDAV server of volume %s...\n", volumeName)
+		vm.deleteTemporaryPodAndVolume(cleanupCtx, namespace, podName, pvcName, pvName)
+	}()
+	if _, err := vm.ensureTemporaryPVC(ctx, volumeName, namespace, storageClass); err != nil {
+		return err
+	}
+
+	image := opts.Image
+	if image == "" {
+		image = DefaultWebDAVImage
+	}
+	args := []string{"serve", "webdav", webDAVPath, "--addr", fmt.Sprintf(":%d", webDAVPort)}
+	mode := "read-write"
+	if opts.ReadOnly {
+		args = append(args, "--read-only")
+		mode = "read-only"
+	}
+	// The export lasts for the TTL; the pod stops serving then even if
+	// lhc is gone
+	deadline := int64(vm.tempTTLOrDefault().Seconds())
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        podName,
+			Namespace:   namespace,
+			Labels:      map[string]string{"app": "lhc-temp", "lhc.io/webdav": volumeName},
+			Annotations: vm.tempAnnotations(volumeName),
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{
+				Name:  "webdav",
+				Image: image,
+				Args:  args,
+				// rclone writes its config and cache under HOME
+				Env:   []corev1.EnvVar{{Name: "HOME", Value: "/tmp"}},
+				Ports: []corev1.ContainerPort{{Name: "webdav", ContainerPort: webDAVPort, Protocol: corev1.ProtocolTCP}},
+				VolumeMounts: []corev1.VolumeMount{{
+					Name:      "volume",
+					MountPath: webDAVPath,
+					ReadOnly:  opts.ReadOnly,
+				}},
+			}},
+			Volumes: []corev1.Volume{{
+				Name: "volume",
+				VolumeSource: corev1.VolumeSource{
+					PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: pvcName},
+				},
+			}},
+			RestartPolicy:         corev1.RestartPolicyNever,
+			ActiveDeadlineSeconds: &deadline,
+		},
+	}
+	vm.applyTempPodOptions(ctx, &pod.Spec, volumeName)
+
+	if vm.DryRun {
+		vm.dryRunf("create WebDAV server pod %s/%s serving PVC %s %s", namespace, podName, pvcName, mode)
+		if localPort == 0 {
+			vm.dryRunf("forward a free local port to port %d of pod %s/%s", webDAVPort, namespace, podName)
+		} else {
+			vm.dryRunf("forward local port %d to port %d of pod %s/%s", localPort, webDAVPort, namespace, podName)
+		}
+		return nil
+	}
+	if _, err := vm.clientset.CoreV1().Pods(namespace).Create(ctx, pod, metav1.CreateOptions{}); err != nil {
+		return fmt.Errorf("failed to create WebDAV server pod: %w", err)
+	}
+	vm.trackTemporary("pod", namespace, pod)
+	if err := vm.waitForPodRunning(ctx, namespace, podName); err != nil {
+		return err
+	}
+	vm.recordVolumeEvent(ctx, volumeName, corev1.EventTypeNormal, "Mounted", fmt.Sprintf("served over WebDAV from temporary pod %s/%s", namespace, podName))
+
+	server := &WebDAVServer{
+		Volume:    volumeName,
+		Namespace: namespace,
+		Pod:       podName,
+		ReadOnly:  opts.ReadOnly,
+		URL:       fmt.Sprintf("http://127.0.0.1:%d/", localPort),
+		Expires:   time.Now().Add(vm.tempTTLOrDefault()),
+	}
+	waitCtx, cancel := context.WithDeadline(ctx, server.Expires)
+	defer cancel()
+	forwardErr := make(chan error, 1)
+	forwardReady := make(chan struct{})
+	go func() {
+		forwardErr <- vm.portForward(waitCtx, namespace, podName, localPort, webDAVPort, forwardReady)
+	}()
+	select {
+	case <-forwardReady:
+	case err := <-forwardErr:
+		return fmt.Errorf("failed to forward local port %d: %w", localPort, err)
+	}
+
+	if ready != nil {
+		if stop := ready(server); stop != nil {
+			defer stop()
+		}
+	}
+
+	select {
+	case <-waitCtx.Done():
+		if ctx.Err() == nil {
+			vm.printf("The WebDAV server of volume %s reached its TTL of %s\n", volumeName, vm.tempTTLOrDefault())
+		}
+		return nil
+	case err := <-forwardErr:
+		return fmt.Errorf("port forwarding stopped: %w", err)
+	}
+}
+
+// freeLocalPort returns a port on 127.0.0.1 that nothing listens on.
+func freeLocalPort() (int, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port, nil
+}
@@ -0,0 +1,98 @@
+package longhorntools
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Workload identifies the top-level owner of a pod, such as a Deployment
+// or StatefulSet. A pod without an owner is its own workload.
+type Workload struct {
+	Namespace string `json:"namespace"`
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+}
+
+func (w Workload) String() string {
+	return fmt.Sprintf("%s/%s/%s", w.Namespace, w.Kind, w.Name)
+}
+
+// VolumeConsumer is a pod that mounts a volume's PVC and the workload
+// that owns it.
+type VolumeConsumer struct {
+	Pod      string   `json:"pod"`
+	Phase    string   `json:"phase"`
+	Node     string   `json:"node"`
+	Workload Workload `json:"workload"`
+}
+
+// VolumeConsumers walks a volume's PV and PVC to the pods that mount it and
+// follows their owner references to the workloads that created them. It
+// returns no consumers for a volume without a bound PVC.
+func (vm *VolumeManager) VolumeConsumers(ctx context.Context, volumeName string) (pvc string, consumers []VolumeConsumer, err error) {
+	volume, err := vm.Volume(ctx, volumeName)
+	if err != nil {
+		return "", nil, err
+	}
+
+	namespace, claimName := volume.PVCNamespace, volume.PVCName
+	if claimName == "" && volume.PVName != "" {
+		// Fall back to the PV's claim reference when Longhorn's view is
+		// stale
+		pv, err := vm.clientset.CoreV1().PersistentVolumes().Get(ctx, volume.PVName, metav1.GetOptions{})
+		if err == nil && pv.Spec.ClaimRef != nil && pv.Status.Phase == corev1.VolumeBound {
+			namespace, claimName = pv.Spec.ClaimRef.Namespace, pv.Spec.ClaimRef.Name
+		}
+	}
+	if claimName == "" {
+		return "", nil, nil
+	}
+
+	pods, err := vm.podsUsingClaim(ctx, namespace, claimName)
+	if err != nil {
+		return "", nil, err
+	}
+	for _, pod := range pods {
+		consumers = append(consumers, VolumeConsumer{
+			Pod:      pod.Name,
+			Phase:    string(pod.Status.Phase),
+			Node:     pod.Spec.NodeName,
+			Workload: vm.podWorkload(ctx, &pod),
+		})
+	}
+	sort.Slice(consumers, func(i, j int) bool { return consumers[i].Pod < consumers[j].Pod })
+	return namespace + "/" + claimName, consumers, nil
+}
+
+// podWorkload follows a pod's controller reference up to the top-level
+// workload: ReplicaSets to their Deployment and Jobs to their CronJob.
+// Owners that cannot be read are reported as they are.
+func (vm *VolumeManager) podWorkload(ctx context.Context, pod *corev1.Pod) Workload {
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil {
+		return Workload{Namespace: pod.Namespace, Kind: "Pod", Name: pod.Name}
+	}
+	workload := Workload{Namespace: pod.Namespace, Kind: owner.Kind, Name: owner.Name}
+
+	switch owner.Kind {
+	case "ReplicaSet":
+		rs, err := vm.clientset.AppsV1().ReplicaSets(pod.Namespace).Get(ctx, owner.Name, metav1.GetOptions{})
+		if err == nil {
+			if parent := metav1.GetControllerOf(rs); parent != nil {
+				workload.Kind, workload.Name = parent.Kind, parent.Name
+			}
+		}
+	case "Job":
+		job, err := vm.clientset.BatchV1().Jobs(pod.Namespace).Get(ctx, owner.Name, metav1.GetOptions{})
+		if err == nil {
+			if parent := metav1.GetControllerOf(job); parent != nil {
+				workload.Kind, workload.Name = parent.Kind, parent.Name
+			}
+		}
+	}
+	return workload
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// releaseRepo is the GitHub repository whose releases self-update installs.
+const releaseRepo = "p2c2e/longhorn_tools"
+
+// releasePublicKey is the base64 Ed25519 key that signs each release's
+// SHA256SUMS, set at build time with
+// -ldflags "-X main.releasePublicKey=...". Builds without it only verify
+// checksums.
+var releasePublicKey = ""
+
+// Release assets besides the binaries, as written by build.sh.
+const (
+	checksumsAsset = "SHA256SUMS"
+	signatureAsset = "SHA256SUMS.sig"
+)
+
+// githubRelease is the part of GitHub's release API response used here.
+type githubRelease struct {
+	TagName string `json:"tag_name"`
+	HTMLURL string `json:"html_url"`
+	Assets  []struct {
+		Name string `json:"name"`
+		URL  string `json:"browser_download_url"`
+	} `json:"assets"`
+}
+
+// assetURL returns the download URL of the named asset.
+func (r *githubRelease) assetURL(name string) (string, error) {
+	for _, a := range r.Assets {
+		if a.Name == name {
+			return a.URL, nil
+		}
+	}
+	return "", fmt.Errorf("release %s has no %s", r.TagName, name)
+}
+
+// releaseAssetName is the binary build.sh produces for this platform.
+func releaseAssetName() string {
+	name := fmt.Sprintf("lhc-%s-%s", runtime.GOOS, runtime.GOARCH)
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+// fetchRelease reads the release tagged tag, or the latest one if tag is
+// empty. GITHUB_TOKEN, if set, raises GitHub's rate limit.
+func fetchRelease(ctx context.Context, tag string) (*githubRelease, error) {
+	url := fmt.Sprintf("https://api.github.com/repos/%s/releases/latest", releaseRepo)
+	if tag != "" {
+		url = fmt.Sprintf("https://api.github.com/repos/%s/releases/tags/%s", releaseRepo, tag)
+	}
+	body, err := httpGet(ctx, url, "application/vnd.github+json")
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	release := &githubRelease{}
+	if err := json.NewDecoder(body).Decode(release); err != nil {
+		return nil, fmt.Errorf("failed to parse release: %v", err)
+	}
+	return release, nil
+}
+
+func httpGet(ctx context.Context, url, accept string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	if token := os.Getenv("GITHUB_TOKEN"); token != "" && strings.HasPrefix(url, "https://api.github.com/") {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %v", url, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to fetch %s: %s", url, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+func httpGetAll(ctx context.Context, url string) ([]byte, error) {
+	body, err := httpGet(ctx, url, "")
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return io.ReadAll(body)
+}
+
+// releaseChecksum fetches the release's SHA256SUMS, verifies its signature
+// when releasePublicKey is set, and returns the checksum listed for asset.
+func releaseChecksum(ctx context.Context, release *githubRelease, asset string) (sum string, signed bool, err error) {
+	url, err := release.assetURL(checksumsAsset)
+	if err != nil {
+		return "", false, err
+	}
+	sums, err := httpGetAll(ctx, url)
+	if err != nil {
+		return "", false, err
+	}
+
+	if releasePublicKey != "" {
+		key, err := base64.StdEncoding.DecodeString(releasePublicKey)
+		if err != nil || len(key) != ed25519.PublicKeySize {
+			return "", false, fmt.Errorf("this build has an invalid release public key")
+		}
+		url, err := release.assetURL(signatureAsset)
+		if err != nil {
+			return "", false, fmt.Errorf("%v; refusing to install an unsigned release", err)
+		}
+		sig, err := httpGetAll(ctx, url)
+		if err != nil {
+			return "", false, err
+		}
+		// openssl writes the raw signature; accept it base64 encoded too
+		if len(sig) != ed25519.SignatureSize {
+			if decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(sig))); err == nil {
+				sig = decoded
+			}
+		}
+		if !ed25519.Verify(ed25519.PublicKey(key), sums, sig) {
+			return "", false, fmt.Errorf("signature of %s does not match this build's release key", checksumsAsset)
+		}
+		signed = true
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(string(sums)))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == asset {
+			return fields[0], signed, nil
+		}
+	}
+	return "", false, fmt.Errorf("%s lists no checksum for %s", checksumsAsset, asset)
+}
+
+// downloadVerified downloads url next to target and checks its SHA-256
+// against sum. It returns the path of the downloaded file, which the
+// caller renames or removes.
+func downloadVerified(ctx context.Context, url, target, sum string) (string, error) {
+	body, err := httpGet(ctx, url, "")
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+
+	// In the same directory, so the final rename does not cross devices
+	tmp, err := os.CreateTemp(filepath.Dir(target), "."+filepath.Base(target)+".update-*")
+	if err != nil {
+		return "", fmt.Errorf("cannot write next to %s: %v", target, err)
+	}
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tmp, h), body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("failed to download %s: %v", url, err)
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); got != strings.ToLower(sum) {
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("checksum mismatch for %s: expected %s, got %s", url, sum, got)
+	}
+	if err := os.Chmod(tmp.Name(), 0755); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return tmp.Name(), nil
+}
+
+// replaceExecutable moves newPath over the executable at target. Windows
+// cannot overwrite a running executable, but can rename it, so the old
+// binary is moved aside to target.old there.
+func replaceExecutable(newPath, target string) error {
+	if runtime.GOOS == "windows" {
+		old := target + ".old"
+		os.Remove(old)
+		if err := os.Rename(target, old); err != nil {
+			return fmt.Errorf("failed to move %s aside: %v", target, err)
+		}
+		if err := os.Rename(newPath, target); err != nil {
+			os.Rename(old, target)
+			return fmt.Errorf("failed to replace %s: %v", target, err)
+		}
+		return nil
+	}
+	if err := os.Rename(newPath, target); err != nil {
+		return fmt.Errorf("failed to replace %s: %v", target, err)
+	}
+	return nil
+}
+
+// checkMessage reports how the release tagged tag relates to the running
+// version current, for self-update --check. An unknown version, like the
+// "dev" of local builds, is reported as such rather than as an update.
+func checkMessage(current, tag string) string {
+	cmp, comparable := compareVersions(current, tag)
+	switch {
+	case !comparable:
+		unknown := current
+		if _, ok := compareVersions(tag, tag); !ok {
+			unknown = tag
+		}
+		return fmt.Sprintf("Version %s is unknown, so lhc cannot tell whether %s is newer than this build; run lhc self-update --yes to install the release anyway.", unknown, tag)
+	case cmp < 0:
+		return "An update is available; run lhc self-update to install it."
+	case cmp == 0:
+		return "lhc is up to date."
+	default:
+		return "This build is newer than the release."
+	}
+}
+
+// compareVersions compares dotted numeric versions such as 1.4.0 and
+// v1.10.2, ignoring a leading "v" and any pre-release suffix. ok is false
+// when either is not such a version, like the "dev" of local builds.
+func compareVersions(a, b string) (cmp int, ok bool) {
+	parse := func(v string) ([]int, bool) {
+		v = strings.TrimPrefix(v, "v")
+		v, _, _ = strings.Cut(v, "-")
+		var parts []int
+		for _, p := range strings.Split(v, ".") {
+			n, err := strconv.Atoi(p)
+			if err != nil {
+				return nil, false
+			}
+			parts = append(parts, n)
+		}
+		return parts, true
+	}
+	pa, okA := parse(a)
+	pb, okB := parse(b)
+	if !okA || !okB {
+		return 0, false
+	}
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var x, y int
+		if i < len(pa) {
+			x = pa[i]
+		}
+		if i < len(pb) {
+			y = pb[i]
+		}
+		if x != y {
+			if x < y {
+				return -1, true
+			}
+			return 1, true
+		}
+	}
+	return 0, true
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckMessage(t *testing.T) {
+	tests := []struct {
+		current, tag string
+		want         string
+	}{
+		{"v1.3.0", "v1.4.0", "An update is available"},
+		{"1.4.0", "v1.4.0", "up to date"},
+		{"v1.10.0", "v1.4.0", "newer than the release"},
+		{"dev", "v1.4.0", "Version dev is unknown"},
+		{"v1.4.0", "nightly", "Version nightly is unknown"},
+	}
+	for _, tt := range tests {
+		if got := checkMessage(tt.current, tt.tag); !strings.Contains(got, tt.want) {
+			t.Errorf("checkMessage(%q, %q) = %q, want it to contain %q", tt.current, tt.tag, got, tt.want)
+		}
+	}
+	if got := checkMessage("dev", "v1.4.0"); strings.Contains(got, "update is available") {
+		t.Errorf("checkMessage(dev) claims an update: %q", got)
+	}
+}
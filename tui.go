@@ -0,0 +1,530 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/table"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"longhorn-volume-manager/pkg/longhorntools"
+)
+
+// tuiLogLines is how many lines of operation output stay on screen.
+const tuiLogLines = 8
+
+var (
+	tuiTitleStyle  = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("205"))
+	tuiStatusStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("241"))
+	tuiErrorStyle  = lipgloss.NewStyle().Foreground(lipgloss.Color("196"))
+	tuiLogStyle    = lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).BorderForeground(lipgloss.Color("240")).Padding(0, 1)
+	tuiDetailStyle = lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).BorderForeground(lipgloss.Color("62")).Padding(0, 1)
+)
+
+type tuiMode int
+
+const (
+	tuiModeList tuiMode = iota
+	tuiModeDetail
+	tuiModeInput
+	tuiModeConfirm
+)
+
+// Messages exchanged between the TUI model and background operations.
+type (
+	tuiVolumesMsg struct {
+		volumes []longhorntools.LonghornVolume
+		err     error
+	}
+	tuiDetailMsg struct {
+		text string
+		err  error
+	}
+	tuiCleanupFoundMsg struct {
+		res *longhorntools.TemporaryResources
+		err error
+	}
+	tuiOutputMsg string
+	tuiDoneMsg   struct {
+		op  string
+		err error
+	}
+	tuiTickMsg time.Time
+)
+
+// tuiModel is the bubbletea model behind the "tui" command.
+type tuiModel struct {
+	ctx          context.Context
+	vm           *longhorntools.VolumeManager
+	namespace    string
+	storageClass string
+
+	mode    tuiMode
+	table   table.Model
+	input   textinput.Model
+	volumes []longhorntools.LonghornVolume
+
+	// inputAction is "download" or "copy" while a prompt is open
+	inputAction string
+	inputVolume string
+	cleanup     *longhorntools.TemporaryResources
+	detail      string
+
+	busy       string
+	started    time.Time
+	outputFile string
+	progress   string
+
+	logs   []string
+	status string
+	err    error
+	width  int
+}
+
+func newTUIModel(ctx context.Context, vm *longhorntools.VolumeManager, namespace, storageClass string) tuiModel {
+	columns := []table.Column{
+		{Title: "NAME", Width: 44},
+		{Title: "STATUS", Width: 10},
+		{Title: "SIZE", Width: 10},
+		{Title: "PV_BOUND", Width: 8},
+	}
+	t := table.New(table.WithColumns(columns), table.WithFocused(true), table.WithHeight(15))
+	styles := table.DefaultStyles()
+	styles.Header = styles.Header.BorderStyle(lipgloss.NormalBorder()).BorderBottom(true).Bold(true)
+	styles.Selected = styles.Selected.Foreground(lipgloss.Color("229")).Background(lipgloss.Color("57"))
+	t.SetStyles(styles)
+
+	ti := textinput.New()
+	ti.CharLimit = 256
+
+	return tuiModel{
+		ctx:          ctx,
+		vm:           vm,
+		namespace:    namespace,
+		storageClass: storageClass,
+		table:        t,
+		input:        ti,
+		status:       "Loading volumes...",
+	}
+}
+
+func (m tuiModel) Init() tea.Cmd {
+	return tea.Batch(m.loadVolumes(), tuiTick())
+}
+
+func tuiTick() tea.Cmd {
+	return tea.Tick(time.Second, func(t time.Time) tea.Msg { return tuiTickMsg(t) })
+}
+
+func (m tuiModel) loadVolumes() tea.Cmd {
+	return func() tea.Msg {
+		volumes, err := m.vm.Volumes(m.ctx)
+		return tuiVolumesMsg{volumes: volumes, err: err}
+	}
+}
+
+// loadDetail collects what the tool knows about a volume and its claim.
+func (m tuiModel) loadDetail(volume longhorntools.LonghornVolume) tea.Cmd {
+	return func() tea.Msg {
+		var b strings.Builder
+		fmt.Fprintf(&b, "Name:     %s\n", volume.Name)
+		fmt.Fprintf(&b, "State:    %s\n", volume.State)
+		fmt.Fprintf(&b, "Size:     %s\n", formatVolumeSize(volume.Size))
+		if volume.PVName == "" {
+			fmt.Fprintf(&b, "PV:       <none>\n")
+			return tuiDetailMsg{text: b.String()}
+		}
+		fmt.Fprintf(&b, "PV:       %s\n", volume.PVName)
+
+		pv, err := m.vm.Clientset().CoreV1().PersistentVolumes().Get(m.ctx, volume.PVName, metav1.GetOptions{})
+		if err != nil {
+			return tuiDetailMsg{err: fmt.Errorf("failed to get PV %s: %v", volume.PVName, err)}
+		}
+		fmt.Fprintf(&b, "PV Phase: %s\n", pv.Status.Phase)
+		if pv.Spec.ClaimRef != nil {
+			fmt.Fprintf(&b, "PVC:      %s/%s\n", pv.Spec.ClaimRef.Namespace, pv.Spec.ClaimRef.Name)
+			inUse, err := m.vm.IsVolumeInUse(m.ctx, volume.PVName, pv.Spec.ClaimRef.Namespace)
+			if err == nil {
+				fmt.Fprintf(&b, "In Use:   %t\n", inUse)
+			}
+		}
+		return tuiDetailMsg{text: b.String()}
+	}
+}
+
+// formatVolumeSize renders Longhorn's byte count in binary units.
+func formatVolumeSize(size string) string {
+	q, err := resource.ParseQuantity(size)
+	if err != nil {
+		return size
+	}
+	return fmt.Sprintf("%s (%s)", formatBytes(q.Value()), size)
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// runOperation starts op in the background; its stdout is captured into
+// the log pane by RunTUI.
+func (m *tuiModel) runOperation(name, outputFile string, op func() error) tea.Cmd {
+	m.busy = name
+	m.started = time.Now()
+	m.outputFile = outputFile
+	m.progress = ""
+	m.err = nil
+	m.status = fmt.Sprintf("Running %s...", name)
+	return func() tea.Msg {
+		return tuiDoneMsg{op: name, err: op()}
+	}
+}
+
+func (m tuiModel) selectedVolume() (longhorntools.LonghornVolume, bool) {
+	row := m.table.SelectedRow()
+	if row == nil {
+		return longhorntools.LonghornVolume{}, false
+	}
+	for _, v := range m.volumes {
+		if v.Name == row[0] {
+			return v, true
+		}
+	}
+	return longhorntools.LonghornVolume{}, false
+}
+
+func (m tuiModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width = msg.Width
+		// Leave room for the title, log pane, and help line
+		if h := msg.Height - tuiLogLines - 8; h > 3 {
+			m.table.SetHeight(h)
+		}
+		return m, nil
+
+	case tuiVolumesMsg:
+		if msg.err != nil {
+			m.err = msg.err
+			m.status = ""
+			return m, nil
+		}
+		m.volumes = msg.volumes
+		rows := make([]table.Row, 0, len(msg.volumes))
+		for _, v := range msg.volumes {
+			pvBound := "No"
+			if v.PVName != "" {
+				pvBound = "Yes"
+			}
+			rows = append(rows, table.Row{v.Name, v.State, v.Size, pvBound})
+		}
+		m.table.SetRows(rows)
+		m.status = fmt.Sprintf("%d volumes", len(msg.volumes))
+		return m, nil
+
+	case tuiDetailMsg:
+		if msg.err != nil {
+			m.err = msg.err
+			return m, nil
+		}
+		m.detail = msg.text
+		m.mode = tuiModeDetail
+		return m, nil
+
+	case tuiCleanupFoundMsg:
+		m.busy = ""
+		if msg.err != nil {
+			m.err = msg.err
+			m.status = ""
+			return m, nil
+		}
+		if msg.res.Total() == 0 {
+			m.status = "No temporary resources found"
+			return m, nil
+		}
+		m.cleanup = msg.res
+		m.mode = tuiModeConfirm
+		m.status = ""
+		return m, nil
+
+	case tuiOutputMsg:
+		m.logs = append(m.logs, string(msg))
+		if len(m.logs) > tuiLogLines {
+			m.logs = m.logs[len(m.logs)-tuiLogLines:]
+		}
+		return m, nil
+
+	case tuiTickMsg:
+		if m.busy != "" && m.outputFile != "" {
+			if info, err := os.Stat(m.outputFile); err == nil {
+				elapsed := time.Since(m.started).Seconds()
+				m.progress = fmt.Sprintf("%s written (%s/s)", formatBytes(info.Size()), formatBytes(int64(float64(info.Size())/elapsed)))
+			}
+		}
+		return m, tuiTick()
+
+	case tuiDoneMsg:
+		elapsed := time.Since(m.started).Round(time.Second)
+		m.busy = ""
+		m.progress = ""
+		if msg.err != nil {
+			m.err = fmt.Errorf("%s failed: %v", msg.op, msg.err)
+			m.status = ""
+		} else {
+			m.status = fmt.Sprintf("%s completed in %s", msg.op, elapsed)
+		}
+		return m, m.loadVolumes()
+
+	case tea.KeyMsg:
+		return m.handleKey(msg)
+	}
+
+	var cmd tea.Cmd
+	m.table, cmd = m.table.Update(msg)
+	return m, cmd
+}
+
+func (m tuiModel) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if msg.String() == "ctrl+c" {
+		return m, tea.Quit
+	}
+
+	switch m.mode {
+	case tuiModeInput:
+		switch msg.String() {
+		case "esc":
+			m.mode = tuiModeList
+			return m, nil
+		case "enter":
+			return m.submitInput()
+		}
+		var cmd tea.Cmd
+		m.input, cmd = m.input.Update(msg)
+		return m, cmd
+
+	case tuiModeConfirm:
+		m.mode = tuiModeList
+		if msg.String() != "y" && msg.String() != "Y" {
+			m.status = "Cleanup cancelled"
+			return m, nil
+		}
+		res := m.cleanup
+		cmd := m.runOperation("cleanup", "", func() error {
+			if failed := m.vm.DeleteTemporaryResources(m.ctx, m.namespace, res); failed > 0 {
+				return fmt.Errorf("%d resources could not be deleted", failed)
+			}
+			return nil
+		})
+		return m, cmd
+
+	case tuiModeDetail:
+		switch msg.String() {
+		case "esc", "enter", "q":
+			m.mode = tuiModeList
+		}
+		return m, nil
+	}
+
+	switch msg.String() {
+	case "q":
+		return m, tea.Quit
+	case "r":
+		m.status = "Refreshing..."
+		return m, m.loadVolumes()
+	}
+
+	// Everything below acts on the cluster, one operation at a time
+	if m.busy != "" {
+		return m, nil
+	}
+
+	switch msg.String() {
+	case "enter":
+		if v, ok := m.selectedVolume(); ok {
+			m.err = nil
+			return m, m.loadDetail(v)
+		}
+		return m, nil
+
+	case "c":
+		v, ok := m.selectedVolume()
+		if !ok {
+			return m, nil
+		}
+		cmd := m.runOperation("contents", "", func() error {
+			entries, err := m.vm.VolumeContents(m.ctx, v.Name, m.namespace, m.storageClass)
+			for _, entry := range entries {
+				fmt.Fprintf(m.vm.Output, "%10d  %s\n", entry.Size, entry.Path)
+			}
+			return err
+		})
+		return m, cmd
+
+	case "d":
+		v, ok := m.selectedVolume()
+		if !ok {
+			return m, nil
+		}
+		cmd := m.openInput("download", v.Name, "Output file: ", v.Name+longhorntools.CompressionExtension(longhorntools.CompressGzip))
+		return m, cmd
+
+	case "y":
+		v, ok := m.selectedVolume()
+		if !ok {
+			return m, nil
+		}
+		cmd := m.openInput("copy", v.Name, "Copy "+v.Name+" to volume: ", "")
+		return m, cmd
+
+	case "x":
+		m.busy = "cleanup"
+		m.status = "Searching for temporary resources..."
+		return m, func() tea.Msg {
+			res, err := m.vm.FindTemporaryResources(m.ctx, m.namespace)
+			return tuiCleanupFoundMsg{res: res, err: err}
+		}
+	}
+
+	var cmd tea.Cmd
+	m.table, cmd = m.table.Update(msg)
+	return m, cmd
+}
+
+func (m *tuiModel) openInput(action, volume, prompt, value string) tea.Cmd {
+	m.mode = tuiModeInput
+	m.inputAction = action
+	m.inputVolume = volume
+	m.input.Prompt = prompt
+	m.input.SetValue(value)
+	m.input.CursorEnd()
+	return m.input.Focus()
+}
+
+func (m tuiModel) submitInput() (tea.Model, tea.Cmd) {
+	value := strings.TrimSpace(m.input.Value())
+	m.input.Blur()
+	m.mode = tuiModeList
+	if value == "" {
+		return m, nil
+	}
+
+	volume := m.inputVolume
+	switch m.inputAction {
+	case "download":
+		cmd := m.runOperation("download", value, func() error {
+			return m.vm.DownloadVolume(m.ctx, volume, m.namespace, value, m.storageClass, longhorntools.DownloadOptions{Compression: longhorntools.CompressGzip})
+		})
+		return m, cmd
+	case "copy":
+		cmd := m.runOperation("copy", "", func() error {
+			return m.vm.CopyVolume(m.ctx, volume, value, m.namespace, m.storageClass)
+		})
+		return m, cmd
+	}
+	return m, nil
+}
+
+func (m tuiModel) View() string {
+	var b strings.Builder
+	b.WriteString(tuiTitleStyle.Render(fmt.Sprintf("Longhorn Volume Manager v%s", version)))
+	b.WriteString(tuiStatusStyle.Render(fmt.Sprintf("  namespace: %s  storage class: %s", m.namespace, m.storageClass)))
+	b.WriteString("\n\n")
+
+	switch m.mode {
+	case tuiModeDetail:
+		b.WriteString(tuiDetailStyle.Render(strings.TrimRight(m.detail, "\n")))
+	case tuiModeConfirm:
+		var lines []string
+		for _, pod := range m.cleanup.Pods {
+			lines = append(lines, "pod "+pod.Name)
+		}
+		for _, pvc := range m.cleanup.PVCs {
+			lines = append(lines, "pvc "+pvc.Name)
+		}
+		for _, pv := range m.cleanup.PVs {
+			lines = append(lines, "pv  "+pv.Name)
+		}
+		lines = append(lines, "", fmt.Sprintf("Delete these %d resources? (y/N)", m.cleanup.Total()))
+		b.WriteString(tuiDetailStyle.Render(strings.Join(lines, "\n")))
+	default:
+		b.WriteString(m.table.View())
+	}
+	b.WriteString("\n")
+
+	if m.mode == tuiModeInput {
+		b.WriteString(m.input.View())
+		b.WriteString("\n")
+	}
+
+	status := m.status
+	if m.progress != "" {
+		status = fmt.Sprintf("%s %s", status, m.progress)
+	}
+	if m.err != nil {
+		b.WriteString(tuiErrorStyle.Render("Error: " + m.err.Error()))
+	} else {
+		b.WriteString(tuiStatusStyle.Render(status))
+	}
+	b.WriteString("\n")
+
+	logs := make([]string, tuiLogLines)
+	copy(logs, m.logs)
+	logStyle := tuiLogStyle
+	if m.width > 4 {
+		logStyle = logStyle.Width(m.width - 4)
+	}
+	b.WriteString(logStyle.Render(strings.Join(logs, "\n")))
+	b.WriteString("\n")
+
+	b.WriteString(tuiStatusStyle.Render("enter: details  c: contents  d: download  y: copy  x: cleanup  r: refresh  q: quit"))
+	return b.String()
+}
+
+// RunTUI starts the interactive terminal UI. The volume manager's output,
+// stdout, and stderr are redirected into the log pane while the UI owns the
+// terminal.
+func RunTUI(ctx context.Context, vm *longhorntools.VolumeManager, namespace, storageClass string) error {
+	terminal := os.Stdout
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("failed to create output pipe: %v", err)
+	}
+
+	stdout, stderr, output := os.Stdout, os.Stderr, vm.Output
+	os.Stdout, os.Stderr, vm.Output = writer, writer, writer
+	log.SetOutput(writer)
+	defer func() {
+		os.Stdout, os.Stderr, vm.Output = stdout, stderr, output
+		log.SetOutput(stderr)
+		writer.Close()
+	}()
+
+	p := tea.NewProgram(newTUIModel(ctx, vm, namespace, storageClass), tea.WithAltScreen(), tea.WithOutput(terminal))
+
+	go func() {
+		scanner := bufio.NewScanner(reader)
+		for scanner.Scan() {
+			p.Send(tuiOutputMsg(scanner.Text()))
+		}
+	}()
+
+	_, err = p.Run()
+	return err
+}